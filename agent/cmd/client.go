@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/duration"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/yaml"
+
+	"k3f.io/kubeforce/agent/pkg/apiserver"
+	"k3f.io/kubeforce/agent/pkg/config"
+	clientset "k3f.io/kubeforce/agent/pkg/generated/clientset/versioned"
+	"k3f.io/kubeforce/agent/pkg/install"
+)
+
+// clientOptions describes how the CLI connects to the local agent.
+type clientOptions struct {
+	kubeconfig string
+	socket     string
+}
+
+func newClientOptions() *clientOptions {
+	return &clientOptions{
+		socket: config.DefaultLocalSocketPath,
+	}
+}
+
+func (o *clientOptions) addFlags(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&o.kubeconfig, "kubeconfig", o.kubeconfig,
+		"Path to the kubeconfig with the admin credential of the agent. "+
+			"If it is not specified, the local socket is used and "+install.AdminKubeconfigPath+" if the socket does not exist.")
+	cmd.PersistentFlags().StringVar(&o.socket, "socket", o.socket, "Path to the local socket of the agent.")
+}
+
+// clientset returns the clientset for the local agent.
+func (o *clientOptions) clientset() (*clientset.Clientset, error) {
+	restConfig, err := o.restConfig()
+	if err != nil {
+		return nil, err
+	}
+	restConfig.Timeout = 30 * time.Second
+	return clientset.NewForConfig(restConfig)
+}
+
+func (o *clientOptions) restConfig() (*restclient.Config, error) {
+	kubeconfig := o.kubeconfig
+	if kubeconfig == "" {
+		if info, err := os.Stat(o.socket); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return apiserver.NewLocalClientConfig(o.socket), nil
+		}
+		kubeconfig = install.AdminKubeconfigPath
+	}
+	restConfig, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to load kubeconfig %q", kubeconfig)
+	}
+	return restConfig, nil
+}
+
+// printObject prints the object in the output format.
+func printObject(w io.Writer, obj runtime.Object, output string) error {
+	var marshalled []byte
+	var err error
+	switch output {
+	case "yaml":
+		marshalled, err = yaml.Marshal(obj)
+	case "json":
+		marshalled, err = json.MarshalIndent(obj, "", "  ")
+	default:
+		return errors.Errorf("unsupported output format %q", output)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w, string(marshalled))
+	return err
+}
+
+// printTable prints rows with the header as a table aligned by columns.
+func printTable(header []string, rows [][]string) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 3, ' ', 0)
+	for _, row := range append([][]string{header}, rows...) {
+		for i, col := range row {
+			if i > 0 {
+				fmt.Fprint(w, "\t")
+			}
+			fmt.Fprint(w, col)
+		}
+		fmt.Fprintln(w)
+	}
+	return w.Flush()
+}
+
+func age(t metav1.Time) string {
+	if t.IsZero() {
+		return "<unknown>"
+	}
+	return duration.HumanDuration(time.Since(t.Time))
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+)
+
+var (
+	deploymentExample = `
+# List playbook deployments of the local agent
+agent deployment list
+
+# Stop creating new playbooks for the deployment
+agent deployment pause init-node`
+)
+
+// NewDeploymentCommand returns a cobra command for managing playbook deployments of the local agent.
+func NewDeploymentCommand() *cobra.Command {
+	clientOpts := newClientOptions()
+	cmd := &cobra.Command{
+		Use:     "deployment",
+		Short:   "Manage playbook deployments of the local agent",
+		Example: deploymentExample,
+	}
+	clientOpts.addFlags(cmd)
+	cmd.AddCommand(
+		newDeploymentListCommand(clientOpts),
+		newDeploymentPauseCommand(clientOpts, "pause", "Pause the playbook deployment", true),
+		newDeploymentPauseCommand(clientOpts, "resume", "Resume the paused playbook deployment", false),
+	)
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(NewDeploymentCommand())
+}
+
+func newDeploymentListCommand(clientOpts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List playbook deployments",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runDeploymentListCmd(clientOpts); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func newDeploymentPauseCommand(clientOpts *clientOptions, use, short string, paused bool) *cobra.Command {
+	return &cobra.Command{
+		Use:   use + " <name>",
+		Short: short,
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runDeploymentPauseCmd(clientOpts, args[0], paused); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func runDeploymentListCmd(clientOpts *clientOptions) error {
+	cs, err := clientOpts.clientset()
+	if err != nil {
+		return err
+	}
+	list, err := cs.AgentV1alpha1().PlaybookDeployments().List(ctrl.SetupSignalHandler(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(list.Items))
+	for _, pd := range list.Items {
+		rows = append(rows, []string{
+			pd.Name,
+			string(pd.Status.Phase),
+			strconv.FormatBool(pd.Spec.Paused),
+			age(pd.CreationTimestamp),
+		})
+	}
+	return printTable([]string{"NAME", "PHASE", "PAUSED", "AGE"}, rows)
+}
+
+func runDeploymentPauseCmd(clientOpts *clientOptions, name string, paused bool) error {
+	cs, err := clientOpts.clientset()
+	if err != nil {
+		return err
+	}
+	patch := fmt.Sprintf(`{"spec":{"paused":%t}}`, paused)
+	_, err = cs.AgentV1alpha1().PlaybookDeployments().Patch(ctrl.SetupSignalHandler(), name,
+		types.MergePatchType, []byte(patch), metav1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	if paused {
+		fmt.Printf("playbook deployment %s has been paused\n", name)
+	} else {
+		fmt.Printf("playbook deployment %s has been resumed\n", name)
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/yaml"
+
+	"k3f.io/kubeforce/agent/pkg/apiserver"
+	"k3f.io/kubeforce/agent/pkg/config"
+	configutils "k3f.io/kubeforce/agent/pkg/config/utils"
+	"k3f.io/kubeforce/agent/pkg/install"
+)
+
+var (
+	etcdExample = `
+# Save a snapshot of the agent database
+agent etcd snapshot save ./snapshot.db -c /var/lib/kubeforce/config.yaml
+
+# Restore the agent database from the latest periodic snapshot
+agent etcd snapshot restore -c /var/lib/kubeforce/config.yaml
+
+# Print the status of the agent database
+agent etcd status -c /var/lib/kubeforce/config.yaml`
+)
+
+type etcdRestoreOptions struct {
+	skipService bool
+}
+
+type etcdStatusOptions struct {
+	output string
+}
+
+// NewEtcdCommand returns a cobra command for the maintenance of the embedded etcd.
+func NewEtcdCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:     "etcd",
+		Short:   "Maintain the embedded etcd of the agent",
+		Long:    `Save and restore snapshots, defragment and print the status of the embedded etcd of the agent.`,
+		Example: etcdExample,
+	}
+	snapshotCmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Save or restore snapshots of the embedded etcd",
+	}
+	snapshotCmd.AddCommand(newEtcdSnapshotSaveCommand(), newEtcdSnapshotRestoreCommand())
+	cmd.AddCommand(snapshotCmd, newEtcdDefragCommand(), newEtcdStatusCommand())
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(NewEtcdCommand())
+}
+
+func newEtcdSnapshotSaveCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "save <file>",
+		Short: "Save a snapshot of the running etcd to the file",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runEtcdSnapshotSaveCmd(args[0]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func newEtcdSnapshotRestoreCommand() *cobra.Command {
+	o := &etcdRestoreOptions{}
+	cmd := &cobra.Command{
+		Use:   "restore [file]",
+		Short: "Restore the etcd data from the snapshot",
+		Long: `Restore the etcd data from the snapshot.
+The latest periodic snapshot is used if the file is not specified.
+The agent service is stopped during the restore and the previous data directory is kept as a backup.`,
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			file := ""
+			if len(args) > 0 {
+				file = args[0]
+			}
+			if err := runEtcdSnapshotRestoreCmd(o, file); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().BoolVar(&o.skipService, "skip-service", o.skipService, "Do not stop and start the agent service.")
+	return cmd
+}
+
+func newEtcdDefragCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "defrag",
+		Short: "Defragment the database of the running etcd",
+		Long: `Defragment the database of the running etcd to return the free space to the file system.
+The NOSPACE alarm is disarmed after the defragmentation.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runEtcdDefragCmd(); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func newEtcdStatusCommand() *cobra.Command {
+	o := &etcdStatusOptions{
+		output: "yaml",
+	}
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Print the status of the running etcd",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runEtcdStatusCmd(o); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.output, "output", "o", o.output, "One of 'yaml' or 'json'.")
+	return cmd
+}
+
+func loadEtcdConfig() (config.EtcdConfig, error) {
+	cfg, err := configutils.LoadFromFile(cfgFile)
+	if err != nil {
+		return config.EtcdConfig{}, errors.Wrapf(err, "unable to read config file: %q", cfgFile)
+	}
+	return cfg.Spec.Etcd, nil
+}
+
+func runEtcdSnapshotSaveCmd(file string) error {
+	cfg, err := loadEtcdConfig()
+	if err != nil {
+		return err
+	}
+	if err := apiserver.SaveEtcdSnapshot(ctrl.SetupSignalHandler(), cfg, file); err != nil {
+		return err
+	}
+	fmt.Printf("snapshot has been saved to %s\n", file)
+	return nil
+}
+
+func runEtcdSnapshotRestoreCmd(o *etcdRestoreOptions, file string) error {
+	cfg, err := loadEtcdConfig()
+	if err != nil {
+		return err
+	}
+	if file == "" {
+		file, err = apiserver.LatestEtcdSnapshot(cfg)
+		if err != nil {
+			return err
+		}
+	}
+	ctx := ctrl.SetupSignalHandler()
+	if !o.skipService {
+		if err := install.StopService(ctx); err != nil {
+			return err
+		}
+	}
+	backupDir, err := apiserver.RestoreEtcdSnapshot(cfg, file)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("etcd data has been restored from %s\n", file)
+	if backupDir != "" {
+		fmt.Printf("previous etcd data has been moved to %s\n", backupDir)
+	}
+	if o.skipService {
+		return nil
+	}
+	return install.StartService(ctx)
+}
+
+func runEtcdDefragCmd() error {
+	cfg, err := loadEtcdConfig()
+	if err != nil {
+		return err
+	}
+	if err := apiserver.DefragmentEtcd(ctrl.SetupSignalHandler(), cfg); err != nil {
+		return err
+	}
+	fmt.Println("etcd database has been defragmented")
+	return nil
+}
+
+func runEtcdStatusCmd(o *etcdStatusOptions) error {
+	cfg, err := loadEtcdConfig()
+	if err != nil {
+		return err
+	}
+	status, err := apiserver.GetEtcdStatus(ctrl.SetupSignalHandler(), cfg)
+	if err != nil {
+		return err
+	}
+	var marshalled []byte
+	switch o.output {
+	case "yaml":
+		marshalled, err = yaml.Marshal(status)
+	case "json":
+		marshalled, err = json.MarshalIndent(status, "", "  ")
+	default:
+		return errors.Errorf("unsupported output format %q", o.output)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(marshalled))
+	return nil
+}
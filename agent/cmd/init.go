@@ -33,8 +33,13 @@ import (
 	"k3f.io/kubeforce/agent/pkg/install"
 )
 
+type initOptions struct {
+	adminKubeconfig string
+}
+
 // NewInitCommand returns a cobra command for install agent to the host..
 func NewInitCommand() *cobra.Command {
+	o := &initOptions{}
 	c := logsv1.NewLoggingConfiguration()
 	klog.EnableContextualLogging(true)
 	cmd := &cobra.Command{
@@ -50,7 +55,7 @@ func NewInitCommand() *cobra.Command {
 			}
 
 			ctx := klog.NewContext(ctrl.SetupSignalHandler(), klog.Background())
-			err := runInitCmd(ctx)
+			err := runInitCmd(ctx, o)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "%v\n", err)
 				os.Exit(1)
@@ -58,6 +63,8 @@ func NewInitCommand() *cobra.Command {
 		},
 	}
 	logsv1.AddFlags(c, cmd.Flags())
+	cmd.Flags().StringVar(&o.adminKubeconfig, "admin-kubeconfig", o.adminKubeconfig,
+		"Path to the kubeconfig with the admin credential that is installed to "+install.AdminKubeconfigPath+" for the agent CLI.")
 	return cmd
 }
 
@@ -80,7 +87,7 @@ func printConfig(cfg *config.Config) error {
 	return nil
 }
 
-func runInitCmd(ctx context.Context) error {
+func runInitCmd(ctx context.Context, o *initOptions) error {
 	cfg, err := configutils.LoadFromFile(cfgFile)
 	if err != nil {
 		return errors.Wrapf(err, "unable to read config file: %q", cfgFile)
@@ -94,6 +101,11 @@ func runInitCmd(ctx context.Context) error {
 	if err := install.Install(ctx, *cfg); err != nil {
 		return err
 	}
+	if o.adminKubeconfig != "" {
+		if err := install.SaveAdminKubeconfig(o.adminKubeconfig); err != nil {
+			return errors.Wrap(err, "unable to install the admin kubeconfig")
+		}
+	}
 
 	return nil
 }
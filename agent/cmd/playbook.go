@@ -0,0 +1,305 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+)
+
+var (
+	playbookExample = `
+# List playbooks of the local agent
+agent playbook list
+
+# Print the logs of the playbook and wait for new lines
+agent playbook logs init-node -f
+
+# Run the playbook from the directory
+agent playbook run -f ./debug --entrypoint site.yml`
+)
+
+type playbookGetOptions struct {
+	output string
+}
+
+type playbookLogsOptions struct {
+	follow   bool
+	previous bool
+}
+
+type playbookRunOptions struct {
+	dir        string
+	name       string
+	entrypoint string
+}
+
+// NewPlaybookCommand returns a cobra command for managing playbooks of the local agent.
+func NewPlaybookCommand() *cobra.Command {
+	clientOpts := newClientOptions()
+	cmd := &cobra.Command{
+		Use:     "playbook",
+		Short:   "Manage playbooks of the local agent",
+		Example: playbookExample,
+	}
+	clientOpts.addFlags(cmd)
+	cmd.AddCommand(
+		newPlaybookListCommand(clientOpts),
+		newPlaybookGetCommand(clientOpts),
+		newPlaybookLogsCommand(clientOpts),
+		newPlaybookRunCommand(clientOpts),
+		newPlaybookDeleteCommand(clientOpts),
+	)
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(NewPlaybookCommand())
+}
+
+func newPlaybookListCommand(clientOpts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List playbooks",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runPlaybookListCmd(clientOpts); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func newPlaybookGetCommand(clientOpts *clientOptions) *cobra.Command {
+	o := &playbookGetOptions{
+		output: "yaml",
+	}
+	cmd := &cobra.Command{
+		Use:   "get <name>",
+		Short: "Print the playbook",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runPlaybookGetCmd(clientOpts, o, args[0]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.output, "output", "o", o.output, "One of 'yaml' or 'json'.")
+	return cmd
+}
+
+func newPlaybookLogsCommand(clientOpts *clientOptions) *cobra.Command {
+	o := &playbookLogsOptions{}
+	cmd := &cobra.Command{
+		Use:   "logs <name>",
+		Short: "Print the logs of the playbook",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runPlaybookLogsCmd(clientOpts, o, args[0]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().BoolVarP(&o.follow, "follow", "f", o.follow, "Specify if the logs should be streamed.")
+	cmd.Flags().BoolVarP(&o.previous, "previous", "p", o.previous, "Print the logs of the previous execution of the playbook.")
+	return cmd
+}
+
+func newPlaybookRunCommand(clientOpts *clientOptions) *cobra.Command {
+	o := &playbookRunOptions{
+		entrypoint: "site.yml",
+	}
+	cmd := &cobra.Command{
+		Use:   "run",
+		Short: "Create the playbook from files of the directory",
+		Long: `Create the playbook from files of the directory.
+The agent starts the playbook as soon as it is created.`,
+		Args: cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runPlaybookRunCmd(clientOpts, o); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.dir, "file", "f", o.dir, "Path to the directory with the playbook files.")
+	cmd.Flags().StringVar(&o.name, "name", o.name, "Name of the playbook. It is generated from the directory name if it is not specified.")
+	cmd.Flags().StringVar(&o.entrypoint, "entrypoint", o.entrypoint, "Path to the playbook file relative to the directory.")
+	_ = cmd.MarkFlagRequired("file")
+	return cmd
+}
+
+func newPlaybookDeleteCommand(clientOpts *clientOptions) *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete <name>",
+		Short: "Delete the playbook",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runPlaybookDeleteCmd(clientOpts, args[0]); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+}
+
+func runPlaybookListCmd(clientOpts *clientOptions) error {
+	cs, err := clientOpts.clientset()
+	if err != nil {
+		return err
+	}
+	list, err := cs.AgentV1alpha1().Playbooks().List(ctrl.SetupSignalHandler(), metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, 0, len(list.Items))
+	for _, pb := range list.Items {
+		rows = append(rows, []string{
+			pb.Name,
+			string(pb.Status.Phase),
+			strconv.Itoa(int(pb.Status.Failed)),
+			age(pb.CreationTimestamp),
+		})
+	}
+	return printTable([]string{"NAME", "PHASE", "FAILED", "AGE"}, rows)
+}
+
+func runPlaybookGetCmd(clientOpts *clientOptions, o *playbookGetOptions, name string) error {
+	cs, err := clientOpts.clientset()
+	if err != nil {
+		return err
+	}
+	pb, err := cs.AgentV1alpha1().Playbooks().Get(ctrl.SetupSignalHandler(), name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	pb.SetGroupVersionKind(v1alpha1.SchemeGroupVersion.WithKind("Playbook"))
+	return printObject(os.Stdout, pb, o.output)
+}
+
+func runPlaybookLogsCmd(clientOpts *clientOptions, o *playbookLogsOptions, name string) error {
+	cs, err := clientOpts.clientset()
+	if err != nil {
+		return err
+	}
+	logOpts := &v1alpha1.PlaybookLogOptions{
+		Follow:   o.follow,
+		Previous: o.previous,
+	}
+	req := cs.AgentV1alpha1().Playbooks().GetLogs(name, logOpts)
+	if o.follow {
+		// the stream is not limited by the client timeout
+		req = req.Timeout(0)
+	}
+	stream, err := req.Stream(ctrl.SetupSignalHandler())
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	_, err = io.Copy(os.Stdout, stream)
+	return err
+}
+
+func runPlaybookRunCmd(clientOpts *clientOptions, o *playbookRunOptions) error {
+	files, err := readPlaybookFiles(o.dir)
+	if err != nil {
+		return err
+	}
+	if _, ok := files[o.entrypoint]; !ok {
+		return errors.Errorf("entrypoint %q is not found in the directory %s", o.entrypoint, o.dir)
+	}
+	pb := &v1alpha1.Playbook{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: o.name,
+		},
+		Spec: v1alpha1.PlaybookSpec{
+			Files:      files,
+			Entrypoint: o.entrypoint,
+		},
+	}
+	if pb.Name == "" {
+		absDir, err := filepath.Abs(o.dir)
+		if err != nil {
+			return err
+		}
+		pb.GenerateName = filepath.Base(absDir) + "-"
+	}
+	cs, err := clientOpts.clientset()
+	if err != nil {
+		return err
+	}
+	pb, err = cs.AgentV1alpha1().Playbooks().Create(ctrl.SetupSignalHandler(), pb, metav1.CreateOptions{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("playbook %s has been created\n", pb.Name)
+	return nil
+}
+
+// readPlaybookFiles returns the regular files of the directory.
+// The keys are paths of the files relative to the directory.
+func readPlaybookFiles(dir string) (map[string]string, error) {
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to read the playbook directory %s", dir)
+	}
+	return files, nil
+}
+
+func runPlaybookDeleteCmd(clientOpts *clientOptions, name string) error {
+	cs, err := clientOpts.clientset()
+	if err != nil {
+		return err
+	}
+	if err := cs.AgentV1alpha1().Playbooks().Delete(ctrl.SetupSignalHandler(), name, metav1.DeleteOptions{}); err != nil {
+		return err
+	}
+	fmt.Printf("playbook %s has been deleted\n", name)
+	return nil
+}
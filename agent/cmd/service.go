@@ -20,22 +20,27 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"time"
 
+	"github.com/go-logr/logr"
 	"github.com/go-logr/zapr"
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	"k8s.io/client-go/rest"
 	ctrl "sigs.k8s.io/controller-runtime"
 	ctrlzap "sigs.k8s.io/controller-runtime/pkg/log/zap"
 
+	"k3f.io/kubeforce/agent/pkg/ansible"
 	"k3f.io/kubeforce/agent/pkg/apiserver"
 	"k3f.io/kubeforce/agent/pkg/config"
 	configutils "k3f.io/kubeforce/agent/pkg/config/utils"
 	"k3f.io/kubeforce/agent/pkg/controllers"
+	"k3f.io/kubeforce/agent/pkg/install"
 	"k3f.io/kubeforce/agent/pkg/manager"
 )
 
@@ -77,17 +82,20 @@ func runServiceCmd() error {
 	if err != nil {
 		return err
 	}
-	etcdSrv, err := apiserver.NewEtcdServer(cfg.Spec.Etcd)
-	if err != nil {
-		return err
+	if cfg.Spec.GetStorageBackend() == config.StorageBackendEtcd {
+		etcdSrv, err := apiserver.NewEtcdServer(cfg.Spec.Etcd)
+		if err != nil {
+			return err
+		}
+		mgr.Add(etcdSrv)
 	}
-	mgr.Add(etcdSrv)
 	srv, err := apiserver.NewServer(cfg.Spec)
 	if err != nil {
 		return err
 	}
 	mgr.Add(srv)
 	mgr.Add(createInternalCtrlManager(cfg, srv.LoopbackClientConfig))
+	mgr.Add(readinessMarker(logger))
 	if err := mgr.Start(ctrl.SetupSignalHandler()); err != nil {
 		logger.Error(err, "problem running manager")
 		return err
@@ -104,14 +112,61 @@ func createInternalCtrlManager(agentConfig *config.Config, config *rest.Config)
 		if err != nil {
 			return err
 		}
+		// playbooks of the previous process have to be recovered before the reconciler is started
+		log := ctrl.Log.WithName("playbook-recovery")
+		err = wait.PollImmediateUntilWithContext(ctx, time.Second, func(ctx context.Context) (bool, error) {
+			if err := controllers.RecoverInterruptedPlaybooks(ctx, mgr.GetAPIReader(), mgr.GetClient(), log); err != nil {
+				log.Error(err, "unable to recover interrupted playbooks")
+				return false, nil
+			}
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		if ansibleCfg := agentConfig.Spec.Ansible; ansibleCfg != nil {
+			// the offline bundles are uploaded to the directory through the agent API
+			if err := os.MkdirAll(ansibleCfg.GetBundlesDir(), 0o700); err != nil {
+				return errors.Wrap(err, "unable to create the directory of the ansible bundles")
+			}
+		}
+		// the artifacts of the playbook files are uploaded to the directory through the agent API
+		if err := os.MkdirAll(agentConfig.Spec.GetArtifactsPath(), 0o700); err != nil {
+			return errors.Wrap(err, "unable to create the directory of the playbook artifacts")
+		}
 		if err := (&controllers.PlaybookReconciler{
-			PlaybookPath: agentConfig.Spec.PlaybookPath,
+			PlaybookPath:  agentConfig.Spec.PlaybookPath,
+			ArtifactsPath: agentConfig.Spec.GetArtifactsPath(),
+			Runtimes:      ansible.NewRuntimeManager(agentConfig.Spec.Ansible),
 		}).SetupWithManager(mgr); err != nil {
 			return err
 		}
 		if err := (&controllers.PlaybookDeploymentReconciler{}).SetupWithManager(mgr); err != nil {
 			return err
 		}
+		err = mgr.Add(&controllers.ArtifactsCollector{
+			ArtifactsPath: agentConfig.Spec.GetArtifactsPath(),
+			Client:        mgr.GetAPIReader(),
+			Log:           ctrl.Log.WithName("artifacts"),
+		})
+		if err != nil {
+			return err
+		}
 		return mgr.Start(ctx)
 	}
 }
+
+// readinessMarker records that the agent is ready after the main components have been started.
+// It allows the upgrade process to check that the new binary works.
+func readinessMarker(logger logr.Logger) manager.RunnableFunc {
+	return func(ctx context.Context) error {
+		if err := install.MarkReady(); err != nil {
+			logger.Error(err, "unable to mark the agent as ready")
+		}
+		<-ctx.Done()
+		if err := install.UnmarkReady(); err != nil {
+			logger.Error(err, "unable to unmark the agent as ready")
+		}
+		return nil
+	}
+}
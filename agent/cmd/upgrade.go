@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"k8s.io/apimachinery/pkg/version"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"k3f.io/kubeforce/agent/pkg/install"
+)
+
+var (
+	upgradeExample = `
+# Upgrade the agent to the binary from the file
+agent upgrade --file ./agent --checksum sha256:<hex>`
+)
+
+type upgradeOptions struct {
+	file     string
+	checksum string
+	timeout  time.Duration
+}
+
+// NewUpgradeCommand returns a cobra command for upgrading the agent.
+func NewUpgradeCommand() *cobra.Command {
+	o := &upgradeOptions{
+		timeout: install.DefaultUpgradeTimeout,
+	}
+	cmd := &cobra.Command{
+		Use:   "upgrade",
+		Short: "Upgrade the installed agent",
+		Long: `Replace the installed agent binary and restart the agent service.
+The previous binary is restored if the new agent is not ready within the timeout.
+If the file is not specified, the binary staged by the agent API is used.`,
+		Example: upgradeExample,
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := runUpgradeCmd(o); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		},
+	}
+	cmd.Flags().StringVarP(&o.file, "file", "f", o.file, "Path to the new agent binary.")
+	cmd.Flags().StringVar(&o.checksum, "checksum", o.checksum, "Checksum of the new agent binary in the format sha256:<hex>. It is required with --file.")
+	cmd.Flags().DurationVar(&o.timeout, "timeout", o.timeout, "Time to wait for the new agent to become ready.")
+	return cmd
+}
+
+func init() {
+	rootCmd.AddCommand(NewUpgradeCommand())
+}
+
+func runUpgradeCmd(o *upgradeOptions) error {
+	ctx := ctrl.SetupSignalHandler()
+	if o.file != "" {
+		if err := install.LockUpgrade(o.timeout); err != nil {
+			return err
+		}
+		info, err := stageBinaryFile(ctx, o.file, o.checksum)
+		if err != nil {
+			if unlockErr := install.UnlockUpgrade(); unlockErr != nil {
+				fmt.Printf("unable to release the upgrade lock: %v\n", unlockErr)
+			}
+			return err
+		}
+		fmt.Printf("new agent binary has been verified, version: %s\n", info.GitVersion)
+	}
+	return install.Upgrade(ctx, o.timeout)
+}
+
+func stageBinaryFile(ctx context.Context, file, checksum string) (*version.Info, error) {
+	f, err := os.Open(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return install.StageBinary(ctx, f, checksum)
+}
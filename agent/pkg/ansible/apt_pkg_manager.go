@@ -20,14 +20,16 @@ import "context"
 
 var _ PackageManager = &aptPkgManager{}
 
+// aptPkgManager is the package manager of Debian based distributions.
 type aptPkgManager struct {
+	run CommandRunner
 }
 
 func (a aptPkgManager) Update(ctx context.Context) error {
-	return runCmd(ctx, "sudo", "apt-get", "update")
+	return a.run(ctx, "apt-get", "update")
 }
 
 func (a aptPkgManager) Install(ctx context.Context, packages ...string) error {
-	args := append([]string{"sudo", "apt-get", "install", "-y"}, packages...)
-	return runCmd(ctx, args...)
+	args := append([]string{"apt-get", "install", "-y"}, packages...)
+	return a.run(ctx, args...)
 }
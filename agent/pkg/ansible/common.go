@@ -19,6 +19,7 @@ package ansible
 import (
 	"context"
 	"os/exec"
+	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -32,6 +33,29 @@ func runCmd(ctx context.Context, args ...string) error {
 	return nil
 }
 
+// CommandInDir returns the CommandRunner that executes the commands in the directory.
+// The output of the failed command is added to the error.
+func CommandInDir(dir string) CommandRunner {
+	return func(ctx context.Context, args ...string) error {
+		//nolint:gosec
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Dir = dir
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return errors.Wrapf(err, "unable to execute cmd: %q, output: %s", cmd, lastLines(string(out), 10))
+		}
+		return nil
+	}
+}
+
+// lastLines returns the last n lines of the text.
+func lastLines(text string, n int) string {
+	lines := strings.Split(strings.TrimRight(text, "\n"), "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
+
 func isCommandAvailable(ctx context.Context, name string) bool {
 	innerCommand := "command -v " + name
 	//nolint:gosec
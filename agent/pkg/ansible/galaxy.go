@@ -0,0 +1,162 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	galaxyBinary       = "ansible-galaxy"
+	collectionsSubdir  = "collections"
+	rolesSubdir        = "roles"
+	defaultCollections = "~/.ansible/collections:/usr/share/ansible/collections"
+	defaultRoles       = "~/.ansible/roles:/usr/share/ansible/roles:/etc/ansible/roles"
+)
+
+// RequirementsFiles are the names of the requirements file of ansible-galaxy in the playbook files.
+var RequirementsFiles = []string{"requirements.yml", "requirements.yaml"}
+
+// InstallRequirements installs the collections and roles listed in the requirements file into the directory.
+// The directory is created only if the installation is successful, so its existence means
+// that the requirements have been installed.
+func InstallRequirements(ctx context.Context, run CommandRunner, galaxyBinary, requirementsFile, dir string) error {
+	data, err := os.ReadFile(filepath.Clean(requirementsFile))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	hasCollections, hasRoles, err := parseRequirements(data)
+	if err != nil {
+		return errors.Wrapf(err, "unable to parse the requirements file %s", filepath.Base(requirementsFile))
+	}
+	tmpDir := dir + ".tmp"
+	if err := os.RemoveAll(tmpDir); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(tmpDir, 0o700); err != nil {
+		return errors.WithStack(err)
+	}
+	if hasCollections {
+		err := run(ctx, galaxyBinary, "collection", "install", "-r", requirementsFile, "-p", filepath.Join(tmpDir, collectionsSubdir))
+		if err != nil {
+			return errors.Wrap(err, "unable to install the collections")
+		}
+	}
+	if hasRoles {
+		err := run(ctx, galaxyBinary, "role", "install", "-r", requirementsFile, "-p", filepath.Join(tmpDir, rolesSubdir))
+		if err != nil {
+			return errors.Wrap(err, "unable to install the roles")
+		}
+	}
+	return errors.WithStack(os.Rename(tmpDir, dir))
+}
+
+// GalaxyBinary returns the path of the ansible-galaxy binary next to the ansible-playbook binary.
+func GalaxyBinary(playbookBinary string) string {
+	if !strings.ContainsRune(playbookBinary, filepath.Separator) {
+		return galaxyBinary
+	}
+	return filepath.Join(filepath.Dir(playbookBinary), galaxyBinary)
+}
+
+// RequirementsEnv returns the environment variables for ansible to find the requirements installed into the directory.
+func RequirementsEnv(dir string) []string {
+	return []string{
+		"ANSIBLE_COLLECTIONS_PATH=" + filepath.Join(dir, collectionsSubdir) + ":" + defaultCollections,
+		"ANSIBLE_ROLES_PATH=" + filepath.Join(dir, rolesSubdir) + ":" + defaultRoles,
+	}
+}
+
+// HasLocalRequirements returns true if the requirements file installs collections or roles from local files,
+// such as tarballs or directories shipped with the playbook.
+func HasLocalRequirements(data []byte) (bool, error) {
+	var content interface{}
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return false, err
+	}
+	var entries []interface{}
+	switch c := content.(type) {
+	case []interface{}:
+		entries = c
+	case map[string]interface{}:
+		collections, _ := c["collections"].([]interface{})
+		roles, _ := c["roles"].([]interface{})
+		entries = append(append(entries, collections...), roles...)
+	}
+	for _, entry := range entries {
+		if isLocalRequirement(entry) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// isLocalRequirement returns true if the entry of the requirements file refers to a local file or directory.
+func isLocalRequirement(entry interface{}) bool {
+	switch e := entry.(type) {
+	case string:
+		return isLocalSource(e)
+	case map[string]interface{}:
+		if t, _ := e["type"].(string); t == "file" || t == "dir" || t == "subdirs" {
+			return true
+		}
+		for _, key := range []string{"name", "src", "source"} {
+			if v, _ := e[key].(string); isLocalSource(v) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isLocalSource returns true if the source of a collection or role is a path on the host.
+func isLocalSource(source string) bool {
+	if strings.HasPrefix(source, "file://") {
+		return true
+	}
+	if strings.Contains(source, "://") || strings.Contains(source, "@") {
+		return false
+	}
+	return strings.HasPrefix(source, "/") || strings.HasPrefix(source, "./") || strings.HasPrefix(source, "../") ||
+		strings.HasSuffix(source, ".tar.gz") || strings.HasSuffix(source, ".tgz")
+}
+
+// parseRequirements returns which sections the requirements file contains.
+// The file is either a list of roles or an object with the "collections" and "roles" lists.
+func parseRequirements(data []byte) (hasCollections, hasRoles bool, err error) {
+	var content interface{}
+	if err := yaml.Unmarshal(data, &content); err != nil {
+		return false, false, err
+	}
+	switch c := content.(type) {
+	case nil:
+		return false, false, nil
+	case []interface{}:
+		return false, len(c) > 0, nil
+	case map[string]interface{}:
+		collections, _ := c["collections"].([]interface{})
+		roles, _ := c["roles"].([]interface{})
+		return len(collections) > 0, len(roles) > 0, nil
+	}
+	return false, false, errors.New("the requirements must be a list of roles or an object with collections and roles")
+}
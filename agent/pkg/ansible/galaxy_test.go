@@ -0,0 +1,157 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+func TestInstallRequirements(t *testing.T) {
+	tests := []struct {
+		name         string
+		requirements string
+		failRoles    bool
+		wantCommands []string
+		wantErr      bool
+	}{
+		{
+			name:         "list of roles",
+			requirements: "- src: geerlingguy.docker\n  version: 6.1.0\n",
+			wantCommands: []string{"role"},
+		},
+		{
+			name: "collections and roles",
+			requirements: `collections:
+- name: community.general
+  version: 6.6.0
+- name: ./ansible-posix-1.5.4.tar.gz
+  type: file
+roles:
+- name: geerlingguy.docker
+`,
+			wantCommands: []string{"collection", "role"},
+		},
+		{
+			name:         "only collections",
+			requirements: "collections:\n- ansible.posix\n",
+			wantCommands: []string{"collection"},
+		},
+		{
+			name:         "failed installation",
+			requirements: "collections:\n- ansible.posix\nroles:\n- geerlingguy.docker\n",
+			failRoles:    true,
+			wantCommands: []string{"collection", "role"},
+			wantErr:      true,
+		},
+		{
+			name:         "invalid requirements",
+			requirements: "collections: community.general\nroles: [\n",
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			tmpDir := t.TempDir()
+			requirementsFile := filepath.Join(tmpDir, "requirements.yml")
+			g.Expect(os.WriteFile(requirementsFile, []byte(tt.requirements), 0o600)).To(Succeed())
+			dir := filepath.Join(tmpDir, "cache", "0")
+			var commands []string
+			run := func(_ context.Context, args ...string) error {
+				g.Expect(args[0]).To(Equal("/opt/ansible/bin/ansible-galaxy"))
+				g.Expect(args).To(ContainElement(requirementsFile))
+				commands = append(commands, args[1])
+				if tt.failRoles && args[1] == "role" {
+					return errors.New("role is not found")
+				}
+				return nil
+			}
+			err := InstallRequirements(context.Background(), run, "/opt/ansible/bin/ansible-galaxy", requirementsFile, dir)
+			g.Expect(commands).To(Equal(tt.wantCommands))
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(dir).NotTo(BeADirectory())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(dir).To(BeADirectory())
+		})
+	}
+}
+
+func TestGalaxyBinary(t *testing.T) {
+	g := NewWithT(t)
+	g.Expect(GalaxyBinary("ansible-playbook")).To(Equal("ansible-galaxy"))
+	g.Expect(GalaxyBinary("/var/lib/kubeforce/ansible/2.13.13/bin/ansible-playbook")).
+		To(Equal("/var/lib/kubeforce/ansible/2.13.13/bin/ansible-galaxy"))
+}
+
+func TestHasLocalRequirements(t *testing.T) {
+	tests := []struct {
+		name         string
+		requirements string
+		want         bool
+		wantErr      bool
+	}{
+		{
+			name:         "galaxy collections and roles",
+			requirements: "collections:\n- name: community.general\n  version: 6.6.0\nroles:\n- src: geerlingguy.docker\n",
+		},
+		{
+			name:         "collection tarball",
+			requirements: "collections:\n- ansible-posix-1.5.4.tar.gz\n",
+			want:         true,
+		},
+		{
+			name:         "collection directory",
+			requirements: "collections:\n- name: my.collection\n  source: ./collections/my\n  type: dir\n",
+			want:         true,
+		},
+		{
+			name:         "list of roles with a local tarball",
+			requirements: "- src: file:///tmp/role.tar.gz\n  name: local_role\n",
+			want:         true,
+		},
+		{
+			name:         "role from the git repository",
+			requirements: "- src: https://github.com/geerlingguy/ansible-role-docker/archive/6.1.0.tar.gz\n  name: docker\n",
+		},
+		{
+			name:         "invalid requirements",
+			requirements: "roles: [\n",
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			got, err := HasLocalRequirements([]byte(tt.requirements))
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
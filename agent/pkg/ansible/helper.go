@@ -73,7 +73,7 @@ func (h *helper) EnsureAnsible(ctx context.Context) error {
 }
 
 func (h *helper) installAnsible(ctx context.Context) error {
-	pkgManager, err := GetPackageManager(ctx)
+	pkgManager, err := GetPackageManager()
 	if err != nil {
 		return err
 	}
@@ -17,23 +17,145 @@ limitations under the License.
 package ansible
 
 import (
+	"bufio"
 	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
+// osReleasePaths are the paths of the os-release file in the order of precedence.
+var osReleasePaths = []string{"/etc/os-release", "/usr/lib/os-release"}
+
+var (
+	// rpmPackages are the names of the packages in the RPM based distributions.
+	rpmPackages = map[string]string{
+		"python3-venv": "python3",
+	}
+	// apkPackages are the names of the packages in Alpine Linux.
+	apkPackages = map[string]string{
+		"python3-pip":  "py3-pip",
+		"python3-venv": "python3",
+	}
+	// pacmanPackages are the names of the packages in Arch Linux.
+	pacmanPackages = map[string]string{
+		"python3-pip":  "python-pip",
+		"python3-venv": "python",
+	}
+)
+
 // PackageManager describes the behavior of a package manager for a Linux host.
 type PackageManager interface {
+	// Update refreshes the package indexes.
 	Update(ctx context.Context) error
+	// Install installs the packages.
+	// The packages are named as in Debian, they are renamed for other distributions if it is necessary.
 	Install(ctx context.Context, packages ...string) error
 }
 
-// GetPackageManager returns the installed package manager on the current host.
-func GetPackageManager(ctx context.Context) (PackageManager, error) {
-	if isCommandAvailable(ctx, "apt-get") {
-		return &aptPkgManager{}, nil
-	} else if isCommandAvailable(ctx, "yum") {
-		return &yumPkgManager{}, nil
+// CommandRunner runs the command with the arguments on the host.
+type CommandRunner func(ctx context.Context, args ...string) error
+
+// GetPackageManager returns the package manager of the current host.
+// The distribution of the host is detected from the os-release file.
+func GetPackageManager() (PackageManager, error) {
+	osRelease, err := readOSRelease()
+	if err != nil {
+		return nil, err
+	}
+	return NewPackageManager(osRelease, asRoot(runCmd, os.Geteuid()))
+}
+
+// NewPackageManager returns the package manager of the distribution described by the os-release fields.
+// The commands of the package manager are executed by the runner.
+func NewPackageManager(osRelease map[string]string, run CommandRunner) (PackageManager, error) {
+	ids := append([]string{osRelease["ID"]}, strings.Fields(osRelease["ID_LIKE"])...)
+	for i, id := range ids {
+		switch id {
+		case "debian", "ubuntu":
+			return &aptPkgManager{run: run}, nil
+		case "fedora":
+			return &dnfPkgManager{run: run}, nil
+		case "rhel", "centos", "rocky", "almalinux", "ol", "amzn":
+			// dnf replaced yum in RHEL 8 and Amazon Linux 2023,
+			// the version of the derivative distribution is not comparable with the RHEL version
+			major, err := strconv.Atoi(strings.Split(osRelease["VERSION_ID"], ".")[0])
+			if i == 0 && err == nil && major < 8 {
+				return &yumPkgManager{run: run}, nil
+			}
+			return &dnfPkgManager{run: run}, nil
+		case "suse", "sles", "opensuse", "opensuse-leap", "opensuse-tumbleweed":
+			return &zypperPkgManager{run: run}, nil
+		case "alpine":
+			return &apkPkgManager{run: run}, nil
+		case "arch", "archlinux", "manjaro":
+			return &pacmanPkgManager{run: run}, nil
+		}
+	}
+	return nil, errors.Errorf("this system uses an unknown package manager, ID: %q, ID_LIKE: %q", osRelease["ID"], osRelease["ID_LIKE"])
+}
+
+// asRoot returns the CommandRunner that executes the commands through sudo if the effective user is not root.
+func asRoot(run CommandRunner, euid int) CommandRunner {
+	if euid == 0 {
+		return run
+	}
+	return func(ctx context.Context, args ...string) error {
+		return run(ctx, append([]string{"sudo"}, args...)...)
+	}
+}
+
+// renamePackages returns the packages with the names replaced according to the map.
+func renamePackages(packages []string, names map[string]string) []string {
+	result := make([]string, 0, len(packages))
+	for _, p := range packages {
+		if name, ok := names[p]; ok {
+			p = name
+		}
+		result = append(result, p)
+	}
+	return result
+}
+
+func readOSRelease() (map[string]string, error) {
+	for _, path := range osReleasePaths {
+		f, err := os.Open(filepath.Clean(path))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		defer f.Close()
+		return parseOSRelease(bufio.NewScanner(f))
+	}
+	return nil, errors.New("unable to detect the distribution, os-release file is not found")
+}
+
+// parseOSRelease parses the environment-like lines of the os-release file.
+func parseOSRelease(scanner *bufio.Scanner) (map[string]string, error) {
+	result := make(map[string]string)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		} else {
+			value = strings.Trim(value, `'"`)
+		}
+		result[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "unable to read os-release file")
 	}
-	return nil, errors.New("this system uses an unknown package manager")
+	return result, nil
 }
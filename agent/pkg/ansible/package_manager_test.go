@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestNewPackageManager(t *testing.T) {
+	tests := []struct {
+		name        string
+		osRelease   string
+		wantUpdate  []string
+		wantInstall []string
+		wantErr     bool
+	}{
+		{
+			name:        "ubuntu",
+			osRelease:   "NAME=\"Ubuntu\"\nID=ubuntu\nID_LIKE=debian\nVERSION_ID=\"22.04\"\n",
+			wantUpdate:  []string{"apt-get", "update"},
+			wantInstall: []string{"apt-get", "install", "-y", "python3-pip", "python3-venv"},
+		},
+		{
+			name:        "centos 7",
+			osRelease:   "ID=\"centos\"\nID_LIKE=\"rhel fedora\"\nVERSION_ID=\"7\"\n",
+			wantUpdate:  []string{"yum", "-y", "update"},
+			wantInstall: []string{"yum", "-y", "install", "python3-pip", "python3"},
+		},
+		{
+			name:        "rocky 9",
+			osRelease:   "ID=\"rocky\"\nID_LIKE=\"rhel centos fedora\"\nVERSION_ID=\"9.2\"\n",
+			wantUpdate:  []string{"dnf", "-y", "makecache"},
+			wantInstall: []string{"dnf", "-y", "install", "python3-pip", "python3"},
+		},
+		{
+			name:        "derivative of rhel",
+			osRelease:   "ID=\"custom\"\nID_LIKE=\"rhel fedora\"\nVERSION_ID=\"1.0\"\n",
+			wantUpdate:  []string{"dnf", "-y", "makecache"},
+			wantInstall: []string{"dnf", "-y", "install", "python3-pip", "python3"},
+		},
+		{
+			name:        "sles",
+			osRelease:   "# SUSE Linux Enterprise Server\nID=\"sles\"\nID_LIKE=\"suse\"\nVERSION_ID=\"15.4\"\n",
+			wantUpdate:  []string{"zypper", "--non-interactive", "refresh"},
+			wantInstall: []string{"zypper", "--non-interactive", "install", "python3-pip", "python3"},
+		},
+		{
+			name:        "alpine",
+			osRelease:   "ID=alpine\nVERSION_ID=3.18.0\n",
+			wantUpdate:  []string{"apk", "update"},
+			wantInstall: []string{"apk", "add", "py3-pip", "python3"},
+		},
+		{
+			name:        "arch",
+			osRelease:   "ID=arch\nBUILD_ID=rolling\n",
+			wantUpdate:  []string{"pacman", "-Sy", "--noconfirm"},
+			wantInstall: []string{"pacman", "-S", "--noconfirm", "--needed", "python-pip", "python"},
+		},
+		{
+			name:      "unknown",
+			osRelease: "ID=unknown\n",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			osRelease, err := parseOSRelease(bufio.NewScanner(strings.NewReader(tt.osRelease)))
+			g.Expect(err).NotTo(HaveOccurred())
+			var calls [][]string
+			run := func(_ context.Context, args ...string) error {
+				calls = append(calls, args)
+				return nil
+			}
+			pm, err := NewPackageManager(osRelease, run)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(pm.Update(context.Background())).To(Succeed())
+			g.Expect(pm.Install(context.Background(), "python3-pip", "python3-venv")).To(Succeed())
+			g.Expect(calls).To(Equal([][]string{tt.wantUpdate, tt.wantInstall}))
+		})
+	}
+}
+
+func TestAsRoot(t *testing.T) {
+	tests := []struct {
+		name string
+		euid int
+		want []string
+	}{
+		{
+			name: "root",
+			euid: 0,
+			want: []string{"apt-get", "update"},
+		},
+		{
+			name: "regular user",
+			euid: 1000,
+			want: []string{"sudo", "apt-get", "update"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			var got []string
+			run := asRoot(func(_ context.Context, args ...string) error {
+				got = args
+				return nil
+			}, tt.euid)
+			g.Expect(run(context.Background(), "apt-get", "update")).To(Succeed())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,239 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+const (
+	pythonCmd         = "python3"
+	venvPackage       = "python3-venv"
+	ansibleCorePkg    = "ansible-core"
+	playbookBinary    = "ansible-playbook"
+	installedMarker   = ".installed"
+	maxBundleFileSize = 256 << 20
+)
+
+var versionRegexp = regexp.MustCompile(`^[0-9]+\.[0-9]+(\.[0-9]+)?([a-z0-9.]*)$`)
+
+// IsValidVersion returns true if the version is a valid version of ansible-core, e.g. "2.13.13".
+func IsValidVersion(version string) bool {
+	return versionRegexp.MatchString(version)
+}
+
+// RuntimeManager manages the ansible runtimes of the playbooks.
+type RuntimeManager interface {
+	// EnsureRuntime installs the runtime of the ansible-core version if it is not installed.
+	// The default version is used if the version is empty.
+	EnsureRuntime(ctx context.Context, version string) error
+	// PlaybookBinary returns the path of the ansible-playbook binary of the ansible-core version.
+	PlaybookBinary(version string) string
+	// Version returns the ansible-core version that is used for the version.
+	// The default version is returned if the version is empty.
+	Version(version string) string
+}
+
+// NewRuntimeManager returns the RuntimeManager for the ansible configuration of the agent.
+// The system-wide ansible is used if the configuration is nil.
+func NewRuntimeManager(cfg *config.AnsibleConfig) RuntimeManager {
+	if cfg == nil {
+		return &systemRuntimeManager{}
+	}
+	return &venvRuntimeManager{
+		cfg: *cfg,
+		run: runCmd,
+	}
+}
+
+// systemRuntimeManager uses the ansible installed system-wide.
+type systemRuntimeManager struct{}
+
+func (m *systemRuntimeManager) EnsureRuntime(ctx context.Context, version string) error {
+	if version != "" {
+		return errors.Errorf("ansible version %s cannot be used without the managed ansible runtime in the agent configuration", version)
+	}
+	return GetHelper().EnsureAnsible(ctx)
+}
+
+func (m *systemRuntimeManager) PlaybookBinary(string) string {
+	return playbookBinary
+}
+
+// Version returns the version as is, because the version of the system-wide ansible is not managed.
+func (m *systemRuntimeManager) Version(version string) string {
+	return version
+}
+
+// venvRuntimeManager installs every version of ansible-core into a separate virtualenv.
+type venvRuntimeManager struct {
+	cfg config.AnsibleConfig
+	mu  sync.Mutex
+	run CommandRunner
+}
+
+func (m *venvRuntimeManager) runtimeDir(version string) string {
+	return filepath.Join(m.cfg.GetDir(), m.Version(version))
+}
+
+func (m *venvRuntimeManager) Version(version string) string {
+	if version == "" {
+		return m.cfg.GetVersion()
+	}
+	return version
+}
+
+func (m *venvRuntimeManager) PlaybookBinary(version string) string {
+	return filepath.Join(m.runtimeDir(version), "bin", playbookBinary)
+}
+
+func (m *venvRuntimeManager) EnsureRuntime(ctx context.Context, version string) error {
+	version = m.Version(version)
+	if !IsValidVersion(version) {
+		return errors.Errorf("invalid ansible version %q", version)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir := m.runtimeDir(version)
+	if _, err := os.Stat(filepath.Join(dir, installedMarker)); err == nil {
+		return nil
+	}
+	if err := m.install(ctx, version, dir); err != nil {
+		return errors.Wrapf(err, "unable to install ansible-core %s", version)
+	}
+	return nil
+}
+
+func (m *venvRuntimeManager) install(ctx context.Context, version, dir string) error {
+	// the runtime could be installed partially by the previous attempt
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(m.cfg.GetDir(), 0o755); err != nil {
+		return err
+	}
+	if err := m.createVenv(ctx, dir); err != nil {
+		return err
+	}
+	args := []string{filepath.Join(dir, "bin", "pip"), "install", "--disable-pip-version-check"}
+	if m.cfg.Offline {
+		wheelsDir, err := os.MkdirTemp(m.cfg.GetDir(), "wheels-")
+		if err != nil {
+			return err
+		}
+		defer os.RemoveAll(wheelsDir)
+		if err := extractBundle(m.cfg.GetBundlePath(version), wheelsDir); err != nil {
+			return err
+		}
+		args = append(args, "--no-index", "--find-links", wheelsDir)
+	}
+	args = append(args, ansibleCorePkg+"=="+version)
+	if err := m.run(ctx, args...); err != nil {
+		return err
+	}
+	if err := m.run(ctx, m.PlaybookBinary(version), "--version"); err != nil {
+		return errors.Wrap(err, "ansible was installed incorrectly")
+	}
+	return os.WriteFile(filepath.Join(dir, installedMarker), []byte(version), 0o600)
+}
+
+func (m *venvRuntimeManager) createVenv(ctx context.Context, dir string) error {
+	err := m.run(ctx, pythonCmd, "-m", "venv", dir)
+	if err == nil || m.cfg.Offline {
+		return err
+	}
+	// the venv module is packaged separately on Debian based systems
+	pkgManager, pkgErr := GetPackageManager()
+	if pkgErr != nil {
+		return err
+	}
+	if err := pkgManager.Update(ctx); err != nil {
+		return err
+	}
+	if err := pkgManager.Install(ctx, venvPackage); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return err
+	}
+	return m.run(ctx, pythonCmd, "-m", "venv", dir)
+}
+
+// extractBundle extracts the regular files of the tar.gz bundle to the directory.
+func extractBundle(bundlePath, dir string) error {
+	f, err := os.Open(filepath.Clean(bundlePath))
+	if err != nil {
+		return errors.Wrap(err, "unable to open the ansible bundle")
+	}
+	defer f.Close()
+	gzr, err := gzip.NewReader(f)
+	if err != nil {
+		return errors.Wrapf(err, "unable to read the ansible bundle %s", bundlePath)
+	}
+	defer gzr.Close()
+	tr := tar.NewReader(gzr)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrapf(err, "unable to read the ansible bundle %s", bundlePath)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Clean(header.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return errors.Errorf("the ansible bundle %s contains the invalid path %q", bundlePath, header.Name)
+		}
+		if err := extractFile(tr, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := io.CopyN(f, r, maxBundleFileSize+1)
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if n > maxBundleFileSize {
+		return errors.Errorf("the file %s of the ansible bundle is too large", path)
+	}
+	return nil
+}
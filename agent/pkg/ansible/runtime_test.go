@@ -0,0 +1,180 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+func writeBundle(t *testing.T, path string, files map[string]string) {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gzw)
+	for name, content := range files {
+		header := &tar.Header{
+			Name:     name,
+			Mode:     0o644,
+			Size:     int64(len(content)),
+			Typeflag: tar.TypeReg,
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExtractBundle(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr bool
+	}{
+		{
+			name: "wheels",
+			files: map[string]string{
+				"ansible_core-2.13.13-py3-none-any.whl": "ansible",
+				"wheels/PyYAML-6.0-cp38-linux.whl":      "yaml",
+			},
+		},
+		{
+			name:    "parent directory",
+			files:   map[string]string{"../evil.whl": "evil"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			tmpDir := t.TempDir()
+			bundlePath := filepath.Join(tmpDir, "bundle.tar.gz")
+			writeBundle(t, bundlePath, tt.files)
+			dir := filepath.Join(tmpDir, "wheels")
+			err := extractBundle(bundlePath, dir)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(filepath.Join(tmpDir, "evil.whl")).NotTo(BeAnExistingFile())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			for name, content := range tt.files {
+				data, err := os.ReadFile(filepath.Join(dir, name))
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(string(data)).To(Equal(content))
+			}
+		})
+	}
+}
+
+func TestEnsureRuntime(t *testing.T) {
+	tests := []struct {
+		name        string
+		offline     bool
+		version     string
+		wantVersion string
+		wantArgs    []string
+	}{
+		{
+			name:        "default version",
+			wantVersion: config.DefaultAnsibleVersion,
+			wantArgs:    []string{"install", "--disable-pip-version-check", "ansible-core==" + config.DefaultAnsibleVersion},
+		},
+		{
+			name:        "offline",
+			offline:     true,
+			version:     "2.14.1",
+			wantVersion: "2.14.1",
+			wantArgs:    []string{"install", "--disable-pip-version-check", "--no-index", "--find-links", "ansible-core==2.14.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			cfg := config.AnsibleConfig{
+				Dir:     t.TempDir(),
+				Offline: tt.offline,
+			}
+			writeBundle(t, cfg.GetBundlePath("2.14.1"), map[string]string{"ansible_core-2.14.1-py3-none-any.whl": "ansible"})
+			var calls [][]string
+			m := &venvRuntimeManager{
+				cfg: cfg,
+				run: func(_ context.Context, args ...string) error {
+					calls = append(calls, args)
+					if len(calls) == 1 {
+						return os.MkdirAll(args[len(args)-1], 0o755)
+					}
+					return nil
+				},
+			}
+			g.Expect(m.EnsureRuntime(context.Background(), tt.version)).To(Succeed())
+			dir := filepath.Join(cfg.Dir, tt.wantVersion)
+			g.Expect(calls).To(HaveLen(3))
+			g.Expect(calls[0]).To(Equal([]string{"python3", "-m", "venv", dir}))
+			g.Expect(calls[1][0]).To(Equal(filepath.Join(dir, "bin", "pip")))
+			for _, arg := range tt.wantArgs {
+				g.Expect(calls[1]).To(ContainElement(arg))
+			}
+			g.Expect(calls[2]).To(Equal([]string{filepath.Join(dir, "bin", "ansible-playbook"), "--version"}))
+			g.Expect(m.PlaybookBinary(tt.version)).To(Equal(filepath.Join(dir, "bin", "ansible-playbook")))
+			g.Expect(m.Version(tt.version)).To(Equal(tt.wantVersion))
+
+			// the installed runtime is reused
+			calls = nil
+			g.Expect(m.EnsureRuntime(context.Background(), tt.version)).To(Succeed())
+			g.Expect(calls).To(BeEmpty())
+
+			// the temporary directory of the wheels is removed
+			entries, err := os.ReadDir(cfg.Dir)
+			g.Expect(err).NotTo(HaveOccurred())
+			for _, e := range entries {
+				g.Expect(strings.HasPrefix(e.Name(), "wheels-")).To(BeFalse())
+			}
+		})
+	}
+}
+
+func TestEnsureRuntimeInvalidVersion(t *testing.T) {
+	g := NewWithT(t)
+	m := NewRuntimeManager(&config.AnsibleConfig{Dir: t.TempDir()})
+	g.Expect(m.EnsureRuntime(context.Background(), "../2.13")).NotTo(Succeed())
+}
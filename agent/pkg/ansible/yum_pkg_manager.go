@@ -20,14 +20,16 @@ import "context"
 
 var _ PackageManager = &yumPkgManager{}
 
+// yumPkgManager is the package manager of RHEL 7 based distributions.
 type yumPkgManager struct {
+	run CommandRunner
 }
 
 func (a yumPkgManager) Update(ctx context.Context) error {
-	return runCmd(ctx, "sudo", "yum", "-y", "update")
+	return a.run(ctx, "yum", "-y", "update")
 }
 
 func (a yumPkgManager) Install(ctx context.Context, packages ...string) error {
-	args := append([]string{"sudo", "yum", "-y", "install"}, packages...)
-	return runCmd(ctx, args...)
+	args := append([]string{"yum", "-y", "install"}, renamePackages(packages, rpmPackages)...)
+	return a.run(ctx, args...)
 }
@@ -0,0 +1,35 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package ansible
+
+import "context"
+
+var _ PackageManager = &zypperPkgManager{}
+
+// zypperPkgManager is the package manager of SUSE based distributions.
+type zypperPkgManager struct {
+	run CommandRunner
+}
+
+func (a zypperPkgManager) Update(ctx context.Context) error {
+	return a.run(ctx, "zypper", "--non-interactive", "refresh")
+}
+
+func (a zypperPkgManager) Install(ctx context.Context, packages ...string) error {
+	args := append([]string{"zypper", "--non-interactive", "install"}, renamePackages(packages, rpmPackages)...)
+	return a.run(ctx, args...)
+}
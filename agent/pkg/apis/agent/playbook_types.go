@@ -18,6 +18,7 @@ package agent
 
 import (
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -51,6 +52,35 @@ type PlaybookSpec struct {
 	// Entrypoint is file path to execute this playbook.
 	// Entrypoint must be one of file specified in the Files field of this playbook
 	Entrypoint string
+	// AnsibleVersion is the version of ansible-core that executes the playbook.
+	// It requires the managed ansible runtime in the agent configuration,
+	// the default version of the runtime is used if it is not specified.
+	// +optional
+	AnsibleVersion string
+	// BinaryFiles are the playbook files with binary content or the content uploaded to the agent separately.
+	// +optional
+	BinaryFiles []PlaybookFile
+}
+
+// PlaybookFile is a playbook file that is not stored as text in the Files of the playbook.
+// Exactly one of Content and Artifact must be specified.
+type PlaybookFile struct {
+	// Path is the path of the file relative to the playbook directory.
+	Path string
+	// Content is the content of the file, it is base64 encoded in JSON.
+	// +optional
+	Content []byte
+	// Artifact is the name of the file in the artifacts directory of the agent.
+	// The artifacts are uploaded to the agent through the upload API.
+	// +optional
+	Artifact string
+	// SHA256 is the hex encoded SHA-256 checksum of the content.
+	// It is required for the artifact.
+	// +optional
+	SHA256 string
+	// Mode is the permission bits of the file. Defaults to 0600.
+	// +optional
+	Mode *int32
 }
 
 // PlaybookStatus defines the observed state of Playbook.
@@ -64,6 +94,13 @@ type PlaybookStatus struct {
 	// The number of times the playbook has reached the Failed phase.
 	// +optional
 	Failed int32
+	// The number of playbook attempts interrupted by the agent restart.
+	// +optional
+	Interrupted int32
+	// Unit is the name of the systemd unit of the current attempt.
+	// It is set only in the SystemdUnit execution mode.
+	// +optional
+	Unit string
 }
 
 // Policy defines the playbook execution policy.
@@ -77,6 +114,51 @@ type Policy struct {
 	// Defaults to 3
 	// +optional
 	BackoffLimit *int32
+
+	// CountAgentRestarts specifies whether the attempts interrupted by the agent restart
+	// are counted against the backoff limit.
+	// Defaults to true
+	// +optional
+	CountAgentRestarts *bool
+
+	// ExecutionMode defines how the playbook is executed.
+	// Defaults to Process
+	// +optional
+	ExecutionMode ExecutionMode
+
+	// Resources are the resource limits of the playbook.
+	// They are applied only in the SystemdUnit execution mode.
+	// +optional
+	Resources *PlaybookResources
+
+	// PurgeFilesAfterSuccess specifies that the playbook files are deleted from the disk
+	// once the playbook succeeds. The logs of the playbook are kept.
+	// +optional
+	PurgeFilesAfterSuccess bool
+}
+
+// ExecutionMode defines how the playbook is executed.
+type ExecutionMode string
+
+const (
+	// ExecutionModeProcess runs ansible as a child process of the agent.
+	ExecutionModeProcess ExecutionMode = "Process"
+	// ExecutionModeSystemdUnit runs ansible in a transient systemd unit.
+	// The playbook is not stopped when the agent is restarted.
+	ExecutionModeSystemdUnit ExecutionMode = "SystemdUnit"
+)
+
+// PlaybookResources defines the resource limits of the playbook.
+type PlaybookResources struct {
+	// CPU is the maximum CPU time of the playbook, e.g. "500m" is a half of one CPU.
+	// +optional
+	CPU *resource.Quantity
+	// Memory is the maximum memory of the playbook.
+	// +optional
+	Memory *resource.Quantity
+	// IOWeight is the relative IO weight of the playbook in the range from 1 to 10000.
+	// +optional
+	IOWeight *int32
 }
 
 // PlaybookPhase defines the phase of playbook at the current time.
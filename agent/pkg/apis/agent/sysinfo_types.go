@@ -44,6 +44,10 @@ type Network struct {
 	Hostname string
 	// DefaultIPAddress is an ip address from default route
 	DefaultIPAddress string
+	// DefaultIPv4Address is an ip address from the IPv4 default route
+	DefaultIPv4Address string
+	// DefaultIPv6Address is an ip address from the IPv6 default route
+	DefaultIPv6Address string
 	// DefaultInterfaceName is a network interface from default route
 	DefaultInterfaceName string
 	// Interfaces is the slice of network interfaces for this host
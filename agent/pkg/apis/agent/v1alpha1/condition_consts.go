@@ -36,4 +36,11 @@ const (
 
 	// PlaybookPreparationFailedReason documents a Playbook when an error occurs during prepare phase.
 	PlaybookPreparationFailedReason = "PreparationFailed"
+
+	// RequirementsInstallationFailedReason documents a Playbook when an error occurs during the installation
+	// of the collections and roles from the requirements file.
+	RequirementsInstallationFailedReason = "RequirementsInstallationFailed"
+
+	// AgentRestartedReason documents a Playbook which execution has been interrupted by the agent restart.
+	AgentRestartedReason = "AgentRestarted"
 )
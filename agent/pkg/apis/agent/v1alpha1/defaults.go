@@ -33,6 +33,13 @@ func SetDefaults_Policy(obj *Policy) {
 		limit := int32(3)
 		obj.BackoffLimit = &limit
 	}
+	if obj.CountAgentRestarts == nil {
+		count := true
+		obj.CountAgentRestarts = &count
+	}
+	if obj.ExecutionMode == "" {
+		obj.ExecutionMode = ExecutionModeProcess
+	}
 }
 
 // SetDefaults_PlaybookDeploymentSpec assigns default values for the PlaybookDeploymentSpec
@@ -48,6 +48,10 @@ type Network struct {
 	Hostname string `json:"hostname"`
 	// DefaultIPAddress is an ip address from default route
 	DefaultIPAddress string `json:"defaultIPAddress,omitempty"`
+	// DefaultIPv4Address is an ip address from the IPv4 default route
+	DefaultIPv4Address string `json:"defaultIPv4Address,omitempty"`
+	// DefaultIPv6Address is an ip address from the IPv6 default route
+	DefaultIPv6Address string `json:"defaultIPv6Address,omitempty"`
 	// DefaultInterfaceName is a network interface from default route
 	DefaultInterfaceName string `json:"defaultInterfaceName,omitempty"`
 	// Interfaces is the slice of network interfaces for this host
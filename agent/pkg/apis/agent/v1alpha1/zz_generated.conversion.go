@@ -27,6 +27,7 @@ import (
 
 	agent "k3f.io/kubeforce/agent/pkg/apis/agent"
 	v1 "k8s.io/api/core/v1"
+	resource "k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	conversion "k8s.io/apimachinery/pkg/conversion"
 	runtime "k8s.io/apimachinery/pkg/runtime"
@@ -119,6 +120,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*PlaybookFile)(nil), (*agent.PlaybookFile)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_PlaybookFile_To_agent_PlaybookFile(a.(*PlaybookFile), b.(*agent.PlaybookFile), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*agent.PlaybookFile)(nil), (*PlaybookFile)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_agent_PlaybookFile_To_v1alpha1_PlaybookFile(a.(*agent.PlaybookFile), b.(*PlaybookFile), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*PlaybookList)(nil), (*agent.PlaybookList)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_PlaybookList_To_agent_PlaybookList(a.(*PlaybookList), b.(*agent.PlaybookList), scope)
 	}); err != nil {
@@ -139,6 +150,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*PlaybookResources)(nil), (*agent.PlaybookResources)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_PlaybookResources_To_agent_PlaybookResources(a.(*PlaybookResources), b.(*agent.PlaybookResources), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*agent.PlaybookResources)(nil), (*PlaybookResources)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_agent_PlaybookResources_To_v1alpha1_PlaybookResources(a.(*agent.PlaybookResources), b.(*PlaybookResources), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*PlaybookSpec)(nil), (*agent.PlaybookSpec)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_PlaybookSpec_To_agent_PlaybookSpec(a.(*PlaybookSpec), b.(*agent.PlaybookSpec), scope)
 	}); err != nil {
@@ -264,6 +285,8 @@ func Convert_agent_Interface_To_v1alpha1_Interface(in *agent.Interface, out *Int
 func autoConvert_v1alpha1_Network_To_agent_Network(in *Network, out *agent.Network, s conversion.Scope) error {
 	out.Hostname = in.Hostname
 	out.DefaultIPAddress = in.DefaultIPAddress
+	out.DefaultIPv4Address = in.DefaultIPv4Address
+	out.DefaultIPv6Address = in.DefaultIPv6Address
 	out.DefaultInterfaceName = in.DefaultInterfaceName
 	out.Interfaces = *(*[]agent.Interface)(unsafe.Pointer(&in.Interfaces))
 	return nil
@@ -277,6 +300,8 @@ func Convert_v1alpha1_Network_To_agent_Network(in *Network, out *agent.Network,
 func autoConvert_agent_Network_To_v1alpha1_Network(in *agent.Network, out *Network, s conversion.Scope) error {
 	out.Hostname = in.Hostname
 	out.DefaultIPAddress = in.DefaultIPAddress
+	out.DefaultIPv4Address = in.DefaultIPv4Address
+	out.DefaultIPv6Address = in.DefaultIPv6Address
 	out.DefaultInterfaceName = in.DefaultInterfaceName
 	out.Interfaces = *(*[]Interface)(unsafe.Pointer(&in.Interfaces))
 	return nil
@@ -423,6 +448,34 @@ func Convert_agent_PlaybookDeploymentStatus_To_v1alpha1_PlaybookDeploymentStatus
 	return autoConvert_agent_PlaybookDeploymentStatus_To_v1alpha1_PlaybookDeploymentStatus(in, out, s)
 }
 
+func autoConvert_v1alpha1_PlaybookFile_To_agent_PlaybookFile(in *PlaybookFile, out *agent.PlaybookFile, s conversion.Scope) error {
+	out.Path = in.Path
+	out.Content = *(*[]byte)(unsafe.Pointer(&in.Content))
+	out.Artifact = in.Artifact
+	out.SHA256 = in.SHA256
+	out.Mode = (*int32)(unsafe.Pointer(in.Mode))
+	return nil
+}
+
+// Convert_v1alpha1_PlaybookFile_To_agent_PlaybookFile is an autogenerated conversion function.
+func Convert_v1alpha1_PlaybookFile_To_agent_PlaybookFile(in *PlaybookFile, out *agent.PlaybookFile, s conversion.Scope) error {
+	return autoConvert_v1alpha1_PlaybookFile_To_agent_PlaybookFile(in, out, s)
+}
+
+func autoConvert_agent_PlaybookFile_To_v1alpha1_PlaybookFile(in *agent.PlaybookFile, out *PlaybookFile, s conversion.Scope) error {
+	out.Path = in.Path
+	out.Content = *(*[]byte)(unsafe.Pointer(&in.Content))
+	out.Artifact = in.Artifact
+	out.SHA256 = in.SHA256
+	out.Mode = (*int32)(unsafe.Pointer(in.Mode))
+	return nil
+}
+
+// Convert_agent_PlaybookFile_To_v1alpha1_PlaybookFile is an autogenerated conversion function.
+func Convert_agent_PlaybookFile_To_v1alpha1_PlaybookFile(in *agent.PlaybookFile, out *PlaybookFile, s conversion.Scope) error {
+	return autoConvert_agent_PlaybookFile_To_v1alpha1_PlaybookFile(in, out, s)
+}
+
 func autoConvert_v1alpha1_PlaybookList_To_agent_PlaybookList(in *PlaybookList, out *agent.PlaybookList, s conversion.Scope) error {
 	out.ListMeta = in.ListMeta
 	out.Items = *(*[]agent.Playbook)(unsafe.Pointer(&in.Items))
@@ -528,10 +581,36 @@ func Convert_url_Values_To_v1alpha1_PlaybookLogOptions(in *url.Values, out *Play
 	return autoConvert_url_Values_To_v1alpha1_PlaybookLogOptions(in, out, s)
 }
 
+func autoConvert_v1alpha1_PlaybookResources_To_agent_PlaybookResources(in *PlaybookResources, out *agent.PlaybookResources, s conversion.Scope) error {
+	out.CPU = (*resource.Quantity)(unsafe.Pointer(in.CPU))
+	out.Memory = (*resource.Quantity)(unsafe.Pointer(in.Memory))
+	out.IOWeight = (*int32)(unsafe.Pointer(in.IOWeight))
+	return nil
+}
+
+// Convert_v1alpha1_PlaybookResources_To_agent_PlaybookResources is an autogenerated conversion function.
+func Convert_v1alpha1_PlaybookResources_To_agent_PlaybookResources(in *PlaybookResources, out *agent.PlaybookResources, s conversion.Scope) error {
+	return autoConvert_v1alpha1_PlaybookResources_To_agent_PlaybookResources(in, out, s)
+}
+
+func autoConvert_agent_PlaybookResources_To_v1alpha1_PlaybookResources(in *agent.PlaybookResources, out *PlaybookResources, s conversion.Scope) error {
+	out.CPU = (*resource.Quantity)(unsafe.Pointer(in.CPU))
+	out.Memory = (*resource.Quantity)(unsafe.Pointer(in.Memory))
+	out.IOWeight = (*int32)(unsafe.Pointer(in.IOWeight))
+	return nil
+}
+
+// Convert_agent_PlaybookResources_To_v1alpha1_PlaybookResources is an autogenerated conversion function.
+func Convert_agent_PlaybookResources_To_v1alpha1_PlaybookResources(in *agent.PlaybookResources, out *PlaybookResources, s conversion.Scope) error {
+	return autoConvert_agent_PlaybookResources_To_v1alpha1_PlaybookResources(in, out, s)
+}
+
 func autoConvert_v1alpha1_PlaybookSpec_To_agent_PlaybookSpec(in *PlaybookSpec, out *agent.PlaybookSpec, s conversion.Scope) error {
 	out.Policy = (*agent.Policy)(unsafe.Pointer(in.Policy))
 	out.Files = *(*map[string]string)(unsafe.Pointer(&in.Files))
 	out.Entrypoint = in.Entrypoint
+	out.AnsibleVersion = in.AnsibleVersion
+	out.BinaryFiles = *(*[]agent.PlaybookFile)(unsafe.Pointer(&in.BinaryFiles))
 	return nil
 }
 
@@ -544,6 +623,8 @@ func autoConvert_agent_PlaybookSpec_To_v1alpha1_PlaybookSpec(in *agent.PlaybookS
 	out.Policy = (*Policy)(unsafe.Pointer(in.Policy))
 	out.Files = *(*map[string]string)(unsafe.Pointer(&in.Files))
 	out.Entrypoint = in.Entrypoint
+	out.AnsibleVersion = in.AnsibleVersion
+	out.BinaryFiles = *(*[]PlaybookFile)(unsafe.Pointer(&in.BinaryFiles))
 	return nil
 }
 
@@ -556,6 +637,8 @@ func autoConvert_v1alpha1_PlaybookStatus_To_agent_PlaybookStatus(in *PlaybookSta
 	out.Phase = agent.PlaybookPhase(in.Phase)
 	out.Conditions = *(*agent.Conditions)(unsafe.Pointer(&in.Conditions))
 	out.Failed = in.Failed
+	out.Interrupted = in.Interrupted
+	out.Unit = in.Unit
 	return nil
 }
 
@@ -568,6 +651,8 @@ func autoConvert_agent_PlaybookStatus_To_v1alpha1_PlaybookStatus(in *agent.Playb
 	out.Phase = PlaybookPhase(in.Phase)
 	out.Conditions = *(*Conditions)(unsafe.Pointer(&in.Conditions))
 	out.Failed = in.Failed
+	out.Interrupted = in.Interrupted
+	out.Unit = in.Unit
 	return nil
 }
 
@@ -605,6 +690,10 @@ func Convert_agent_PlaybookTemplateSpec_To_v1alpha1_PlaybookTemplateSpec(in *age
 func autoConvert_v1alpha1_Policy_To_agent_Policy(in *Policy, out *agent.Policy, s conversion.Scope) error {
 	out.Timeout = (*metav1.Duration)(unsafe.Pointer(in.Timeout))
 	out.BackoffLimit = (*int32)(unsafe.Pointer(in.BackoffLimit))
+	out.CountAgentRestarts = (*bool)(unsafe.Pointer(in.CountAgentRestarts))
+	out.ExecutionMode = agent.ExecutionMode(in.ExecutionMode)
+	out.Resources = (*agent.PlaybookResources)(unsafe.Pointer(in.Resources))
+	out.PurgeFilesAfterSuccess = in.PurgeFilesAfterSuccess
 	return nil
 }
 
@@ -616,6 +705,10 @@ func Convert_v1alpha1_Policy_To_agent_Policy(in *Policy, out *agent.Policy, s co
 func autoConvert_agent_Policy_To_v1alpha1_Policy(in *agent.Policy, out *Policy, s conversion.Scope) error {
 	out.Timeout = (*metav1.Duration)(unsafe.Pointer(in.Timeout))
 	out.BackoffLimit = (*int32)(unsafe.Pointer(in.BackoffLimit))
+	out.CountAgentRestarts = (*bool)(unsafe.Pointer(in.CountAgentRestarts))
+	out.ExecutionMode = ExecutionMode(in.ExecutionMode)
+	out.Resources = (*PlaybookResources)(unsafe.Pointer(in.Resources))
+	out.PurgeFilesAfterSuccess = in.PurgeFilesAfterSuccess
 	return nil
 }
 
@@ -18,11 +18,15 @@ package validation
 
 import (
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/google/go-cmp/cmp"
 	apimachineryvalidation "k8s.io/apimachinery/pkg/api/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
 
+	"k3f.io/kubeforce/agent/pkg/ansible"
 	"k3f.io/kubeforce/agent/pkg/apis/agent"
 )
 
@@ -44,6 +48,47 @@ func validatePlaybookSpec(p *agent.PlaybookSpec, fieldPath *field.Path) field.Er
 	if p.Entrypoint == "" {
 		allErrs = append(allErrs, field.Invalid(fieldPath.Child("entrypoint"), p.Entrypoint, "cannot be empty"))
 	}
+	if p.AnsibleVersion != "" && !ansible.IsValidVersion(p.AnsibleVersion) {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("ansibleVersion"), p.AnsibleVersion, "must be a valid version of ansible-core"))
+	}
+	for i := range p.BinaryFiles {
+		allErrs = append(allErrs, validatePlaybookFile(&p.BinaryFiles[i], p.Files, fieldPath.Child("binaryFiles").Index(i))...)
+	}
+	return allErrs
+}
+
+var sha256Regexp = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+func validatePlaybookFile(f *agent.PlaybookFile, files map[string]string, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	cleanPath := filepath.Clean(f.Path)
+	switch {
+	case f.Path == "":
+		allErrs = append(allErrs, field.Required(fieldPath.Child("path"), "cannot be empty"))
+	case filepath.IsAbs(f.Path) || cleanPath == ".." || strings.HasPrefix(cleanPath, "../"):
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("path"), f.Path, "must be a relative path inside the playbook directory"))
+	default:
+		if _, ok := files[f.Path]; ok {
+			allErrs = append(allErrs, field.Duplicate(fieldPath.Child("path"), f.Path))
+		}
+	}
+	switch {
+	case f.Content != nil && f.Artifact != "":
+		allErrs = append(allErrs, field.Invalid(fieldPath, f.Path, "only one of content and artifact can be specified"))
+	case f.Content == nil && f.Artifact == "":
+		allErrs = append(allErrs, field.Required(fieldPath, "either content or artifact must be specified"))
+	case f.Artifact != "" && f.SHA256 == "":
+		allErrs = append(allErrs, field.Required(fieldPath.Child("sha256"), "is required for the artifact"))
+	}
+	if f.Artifact != "" && (strings.ContainsRune(f.Artifact, '/') || f.Artifact == "." || f.Artifact == "..") {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("artifact"), f.Artifact, "must be a file name"))
+	}
+	if f.SHA256 != "" && !sha256Regexp.MatchString(f.SHA256) {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("sha256"), f.SHA256, "must be a hex encoded SHA-256 checksum in lower case"))
+	}
+	if f.Mode != nil && (*f.Mode < 0 || *f.Mode > 0o777) {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("mode"), *f.Mode, "must be a number between 0 and 0777 (octal)"))
+	}
 	return allErrs
 }
 
@@ -55,6 +100,29 @@ func validatePolicy(p *agent.Policy, fieldPath *field.Path) field.ErrorList {
 	if p.Timeout != nil {
 		allErrs = append(allErrs, apimachineryvalidation.ValidateNonnegativeField(int64(*p.BackoffLimit), fieldPath.Child("timeout"))...)
 	}
+	switch p.ExecutionMode {
+	case "", agent.ExecutionModeProcess, agent.ExecutionModeSystemdUnit:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fieldPath.Child("executionMode"), p.ExecutionMode,
+			[]string{string(agent.ExecutionModeProcess), string(agent.ExecutionModeSystemdUnit)}))
+	}
+	if p.Resources != nil {
+		allErrs = append(allErrs, validateResources(p.Resources, fieldPath.Child("resources"))...)
+	}
+	return allErrs
+}
+
+func validateResources(r *agent.PlaybookResources, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if r.CPU != nil && r.CPU.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("cpu"), r.CPU.String(), "must be greater than 0"))
+	}
+	if r.Memory != nil && r.Memory.Sign() <= 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("memory"), r.Memory.String(), "must be greater than 0"))
+	}
+	if r.IOWeight != nil && (*r.IOWeight < 1 || *r.IOWeight > 10000) {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("ioWeight"), *r.IOWeight, "must be in the range from 1 to 10000"))
+	}
 	return allErrs
 }
 
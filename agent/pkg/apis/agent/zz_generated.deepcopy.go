@@ -241,6 +241,32 @@ func (in *PlaybookDeploymentStatus) DeepCopy() *PlaybookDeploymentStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookFile) DeepCopyInto(out *PlaybookFile) {
+	*out = *in
+	if in.Content != nil {
+		in, out := &in.Content, &out.Content
+		*out = make([]byte, len(*in))
+		copy(*out, *in)
+	}
+	if in.Mode != nil {
+		in, out := &in.Mode, &out.Mode
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookFile.
+func (in *PlaybookFile) DeepCopy() *PlaybookFile {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookFile)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlaybookList) DeepCopyInto(out *PlaybookList) {
 	*out = *in
@@ -313,6 +339,37 @@ func (in *PlaybookLogOptions) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookResources) DeepCopyInto(out *PlaybookResources) {
+	*out = *in
+	if in.CPU != nil {
+		in, out := &in.CPU, &out.CPU
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Memory != nil {
+		in, out := &in.Memory, &out.Memory
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.IOWeight != nil {
+		in, out := &in.IOWeight, &out.IOWeight
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookResources.
+func (in *PlaybookResources) DeepCopy() *PlaybookResources {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookResources)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlaybookSpec) DeepCopyInto(out *PlaybookSpec) {
 	*out = *in
@@ -328,6 +385,13 @@ func (in *PlaybookSpec) DeepCopyInto(out *PlaybookSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.BinaryFiles != nil {
+		in, out := &in.BinaryFiles, &out.BinaryFiles
+		*out = make([]PlaybookFile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	return
 }
 
@@ -395,6 +459,16 @@ func (in *Policy) DeepCopyInto(out *Policy) {
 		*out = new(int32)
 		**out = **in
 	}
+	if in.CountAgentRestarts != nil {
+		in, out := &in.CountAgentRestarts, &out.CountAgentRestarts
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Resources != nil {
+		in, out := &in.Resources, &out.Resources
+		*out = new(PlaybookResources)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+)
+
+// NewArtifactsHandler creates a new handler that lists the artifacts in the directory.
+func NewArtifactsHandler(dir string) *ArtifactsHandler {
+	return &ArtifactsHandler{
+		dir: dir,
+	}
+}
+
+// ArtifactsHandler is a handler that lists the names of the artifacts uploaded to the agent.
+// The clients use it to upload only the missing artifacts.
+type ArtifactsHandler struct {
+	dir string
+}
+
+func (h *ArtifactsHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		responsewriters.ErrorNegotiated(
+			apierrors.NewInternalError(fmt.Errorf("method not allowed %q", req.Method)),
+			Codecs, schema.GroupVersion{}, w, req,
+		)
+		return
+	}
+	names, err := listArtifacts(h.dir)
+	if err != nil {
+		responsewriters.ErrorNegotiated(
+			apierrors.NewInternalError(err),
+			Codecs, schema.GroupVersion{}, w, req,
+		)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(names)
+}
+
+// listArtifacts returns the names of the regular files in the artifacts directory.
+func listArtifacts(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "unable to read the artifacts directory")
+	}
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e.Type().IsRegular() {
+			names = append(names, e.Name())
+		}
+	}
+	return names, nil
+}
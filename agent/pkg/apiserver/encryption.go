@@ -0,0 +1,118 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	apiserverconfigv1 "k8s.io/apiserver/pkg/apis/config/v1"
+	"k8s.io/apiserver/pkg/server/options/encryptionconfig"
+	"k8s.io/apiserver/pkg/storage/value"
+	"k8s.io/klog/v2"
+	"sigs.k8s.io/yaml"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent"
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+// encryptedResources are the resources that contain the playbook files.
+var encryptedResources = []schema.GroupResource{
+	{Group: agent.GroupName, Resource: "playbooks"},
+	{Group: agent.GroupName, Resource: "playbookdeployments"},
+}
+
+// ensureEncryptionConfig generates the encryption configuration with a random key if it does not exist.
+func ensureEncryptionConfig(c config.EncryptionConfig) error {
+	path := c.GetConfigFile()
+	if _, err := os.Stat(path); err == nil || !os.IsNotExist(err) {
+		return err
+	}
+	data, err := newEncryptionConfig(c.GetProvider())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return errors.Wrap(err, "unable to create the directory of the encryption configuration")
+	}
+	tmpFile := path + ".tmp"
+	if err := os.WriteFile(tmpFile, data, 0o600); err != nil {
+		return errors.Wrap(err, "unable to write the encryption configuration")
+	}
+	if err := os.Rename(tmpFile, path); err != nil {
+		return errors.Wrap(err, "unable to write the encryption configuration")
+	}
+	klog.InfoS("encryption configuration has been generated", "path", path, "provider", c.GetProvider())
+	return nil
+}
+
+// newEncryptionConfig returns the EncryptionConfiguration with a new random key of the provider.
+// The identity provider is the last one to read the objects stored before the encryption has been enabled.
+func newEncryptionConfig(provider config.EncryptionProvider) ([]byte, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	keys := []apiserverconfigv1.Key{
+		{
+			Name:   "key1",
+			Secret: base64.StdEncoding.EncodeToString(secret),
+		},
+	}
+	var providerConfig apiserverconfigv1.ProviderConfiguration
+	switch provider {
+	case config.EncryptionProviderAESCBC:
+		providerConfig.AESCBC = &apiserverconfigv1.AESConfiguration{Keys: keys}
+	case config.EncryptionProviderSecretbox:
+		providerConfig.Secretbox = &apiserverconfigv1.SecretboxConfiguration{Keys: keys}
+	default:
+		return nil, errors.Errorf("unsupported encryption provider %q", provider)
+	}
+	resources := make([]string, 0, len(encryptedResources))
+	for _, r := range encryptedResources {
+		resources = append(resources, r.String())
+	}
+	cfg := &apiserverconfigv1.EncryptionConfiguration{
+		Resources: []apiserverconfigv1.ResourceConfiguration{
+			{
+				Resources: resources,
+				Providers: []apiserverconfigv1.ProviderConfiguration{
+					providerConfig,
+					{Identity: &apiserverconfigv1.IdentityConfiguration{}},
+				},
+			},
+		},
+	}
+	cfg.APIVersion = apiserverconfigv1.SchemeGroupVersion.String()
+	cfg.Kind = "EncryptionConfiguration"
+	return yaml.Marshal(cfg)
+}
+
+// loadTransformers returns the transformers of the resources from the encryption configuration.
+func loadTransformers(path string) (map[schema.GroupResource]value.Transformer, error) {
+	// the channel stops only the KMS plugins that are not used by the agent
+	encryptionConfig, err := encryptionconfig.LoadEncryptionConfig(path, false, wait.NeverStop)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to load the encryption configuration")
+	}
+	return encryptionConfig.Transformers, nil
+}
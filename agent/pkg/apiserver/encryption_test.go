@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/storage/value"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent"
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+func TestEnsureEncryptionConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		provider   config.EncryptionProvider
+		wantPrefix string
+	}{
+		{
+			name:       "default provider",
+			wantPrefix: "k8s:enc:aescbc:v1:key1:",
+		},
+		{
+			name:       "secretbox",
+			provider:   config.EncryptionProviderSecretbox,
+			wantPrefix: "k8s:enc:secretbox:v1:key1:",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			cfg := config.EncryptionConfig{
+				Provider:   tt.provider,
+				ConfigFile: filepath.Join(t.TempDir(), "encryption", "config.yaml"),
+			}
+			g.Expect(ensureEncryptionConfig(cfg)).To(Succeed())
+			info, err := os.Stat(cfg.ConfigFile)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+			data, err := os.ReadFile(cfg.ConfigFile)
+			g.Expect(err).NotTo(HaveOccurred())
+
+			// the existing configuration is not changed
+			g.Expect(ensureEncryptionConfig(cfg)).To(Succeed())
+			g.Expect(os.ReadFile(cfg.ConfigFile)).To(Equal(data))
+
+			transformers, err := loadTransformers(cfg.ConfigFile)
+			g.Expect(err).NotTo(HaveOccurred())
+			transformer := transformers[schema.GroupResource{Group: agent.GroupName, Resource: "playbooks"}]
+			g.Expect(transformer).NotTo(BeNil())
+			ctx := context.Background()
+			dataCtx := value.DefaultContext("/playbooks/boot")
+			encrypted, err := transformer.TransformToStorage(ctx, []byte("join token"), dataCtx)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(encrypted)).To(HavePrefix(tt.wantPrefix))
+			decrypted, _, err := transformer.TransformFromStorage(ctx, encrypted, dataCtx)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(decrypted)).To(Equal("join token"))
+
+			// the objects stored before the encryption has been enabled are readable
+			plain, _, err := transformer.TransformFromStorage(ctx, []byte("plain"), dataCtx)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(plain)).To(Equal("plain"))
+		})
+	}
+}
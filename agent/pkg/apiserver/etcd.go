@@ -54,6 +54,20 @@ func NewEtcdServer(cfg config.EtcdConfig) (*EtcdServer, error) {
 	if err != nil {
 		return nil, err
 	}
+	etcdCfg, err := newEmbedConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &EtcdServer{
+		cfg:         etcdCfg,
+		maintenance: etcdMaintenance(cfg),
+		dataDir:     cfg.DataDir,
+		started:     make(chan struct{}),
+	}
+	return s, nil
+}
+
+func newEmbedConfig(cfg config.EtcdConfig) (*embed.Config, error) {
 	etcdCfg := embed.NewConfig()
 	etcdCfg.Dir = cfg.DataDir
 	if cfg.ListenPeerURLs != "" {
@@ -82,11 +96,17 @@ func NewEtcdServer(cfg config.EtcdConfig) (*EtcdServer, error) {
 	}
 	etcdCfg.ClientTLSInfo = tslInfo
 	etcdCfg.PeerTLSInfo = tslInfo
-	s := &EtcdServer{
-		cfg:     etcdCfg,
-		started: make(chan struct{}),
+	etcdCfg.QuotaBackendBytes = cfg.QuotaBackendBytes
+	maintenance := etcdMaintenance(cfg)
+	etcdCfg.AutoCompactionMode = embed.CompactorModePeriodic
+	if maintenance.AutoCompactionMode != "" {
+		etcdCfg.AutoCompactionMode = maintenance.AutoCompactionMode
 	}
-	return s, nil
+	etcdCfg.AutoCompactionRetention = defaultAutoCompactionRetention
+	if maintenance.AutoCompactionRetention != "" {
+		etcdCfg.AutoCompactionRetention = maintenance.AutoCompactionRetention
+	}
+	return etcdCfg, nil
 }
 
 func certFilePath(dir, baseName string) string {
@@ -128,9 +148,11 @@ func generateCerts(certsDir string) error {
 
 // EtcdServer is the component responsible for starting and stopping the etcd server.
 type EtcdServer struct {
-	cfg     *embed.Config
-	started chan struct{}
-	Etcd    *embed.Etcd
+	cfg         *embed.Config
+	maintenance config.EtcdMaintenance
+	dataDir     string
+	started     chan struct{}
+	Etcd        *embed.Etcd
 }
 
 // Start starts running the etcd server.
@@ -143,12 +165,13 @@ func (s *EtcdServer) Start(ctx context.Context) error {
 	case <-e.Server.ReadyNotify():
 		s.Etcd = e
 		close(s.started)
+		go s.runMaintenance(ctx)
 	case <-ctx.Done():
-		e.Server.Stop()
+		e.Close()
 		return nil
 	}
 	<-ctx.Done()
-	e.Server.Stop()
+	e.Close()
 	return nil
 }
 
@@ -0,0 +1,348 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/client/pkg/v3/transport"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/snapshot"
+	"go.etcd.io/etcd/server/v3/etcdserver"
+	"go.etcd.io/etcd/server/v3/mvcc/backend"
+	"go.uber.org/zap"
+	"k8s.io/klog/v2"
+
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+const (
+	defaultAutoCompactionRetention = "1h"
+	defaultDefragInterval          = 24 * time.Hour
+	defaultSnapshotRetention       = 3
+	etcdDialTimeout                = 10 * time.Second
+
+	snapshotFilePrefix = "etcd-snapshot-"
+	snapshotFileSuffix = ".db"
+	snapshotTimeFormat = "20060102T150405Z"
+)
+
+// EtcdStatus describes the state of the etcd server.
+type EtcdStatus struct {
+	Version           string   `json:"version"`
+	DBSize            int64    `json:"dbSize"`
+	DBSizeInUse       int64    `json:"dbSizeInUse"`
+	QuotaBackendBytes int64    `json:"quotaBackendBytes"`
+	Revision          int64    `json:"revision"`
+	RaftIndex         uint64   `json:"raftIndex"`
+	Alarms            []string `json:"alarms,omitempty"`
+	Errors            []string `json:"errors,omitempty"`
+	Snapshots         []string `json:"snapshots,omitempty"`
+}
+
+// runMaintenance defragments the database and saves snapshots periodically until the context is done.
+func (s *EtcdServer) runMaintenance(ctx context.Context) {
+	log := klog.FromContext(ctx).WithName("etcd-maintenance")
+	defragInterval := defaultDefragInterval
+	if s.maintenance.DefragInterval != nil {
+		defragInterval = s.maintenance.DefragInterval.Duration
+	}
+	var snapshotInterval time.Duration
+	if s.maintenance.SnapshotInterval != nil {
+		snapshotInterval = s.maintenance.SnapshotInterval.Duration
+	}
+
+	var defragC, snapshotC <-chan time.Time
+	if defragInterval > 0 {
+		ticker := time.NewTicker(defragInterval)
+		defer ticker.Stop()
+		defragC = ticker.C
+	}
+	if snapshotInterval > 0 {
+		ticker := time.NewTicker(snapshotInterval)
+		defer ticker.Stop()
+		snapshotC = ticker.C
+	}
+	if defragC == nil && snapshotC == nil {
+		return
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-defragC:
+			if err := s.defragment(ctx); err != nil {
+				log.Error(err, "unable to defragment the etcd database")
+				continue
+			}
+			log.Info("etcd database has been defragmented")
+		case <-snapshotC:
+			path, err := s.saveSnapshot()
+			if err != nil {
+				log.Error(err, "unable to save the etcd snapshot")
+				continue
+			}
+			log.Info("etcd snapshot has been saved", "path", path)
+		}
+	}
+}
+
+func (s *EtcdServer) defragment(ctx context.Context) error {
+	if err := s.Etcd.Server.Backend().Defrag(); err != nil {
+		return err
+	}
+	return disarmNoSpaceAlarms(ctx, s.Etcd.Server)
+}
+
+// disarmNoSpaceAlarms deactivates the alarms raised when the database exceeded the quota.
+// The alarm is raised again if the database still exceeds the quota.
+func disarmNoSpaceAlarms(ctx context.Context, srv *etcdserver.EtcdServer) error {
+	for _, alarm := range srv.Alarms() {
+		if alarm.Alarm != pb.AlarmType_NOSPACE {
+			continue
+		}
+		_, err := srv.Alarm(ctx, &pb.AlarmRequest{
+			Action:   pb.AlarmRequest_DEACTIVATE,
+			MemberID: alarm.MemberID,
+			Alarm:    alarm.Alarm,
+		})
+		if err != nil {
+			return errors.Wrap(err, "unable to disarm the NOSPACE alarm")
+		}
+	}
+	return nil
+}
+
+func (s *EtcdServer) saveSnapshot() (string, error) {
+	dir := snapshotDir(s.dataDir, s.maintenance)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	name := snapshotFilePrefix + time.Now().UTC().Format(snapshotTimeFormat) + snapshotFileSuffix
+	path := filepath.Join(dir, name)
+	if err := writeBackendSnapshot(s.Etcd.Server.Backend(), path); err != nil {
+		return "", err
+	}
+	retention := s.maintenance.SnapshotRetention
+	if retention == 0 {
+		retention = defaultSnapshotRetention
+	}
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < len(snapshots)-retention; i++ {
+		if err := os.Remove(snapshots[i]); err != nil {
+			return "", err
+		}
+	}
+	return path, nil
+}
+
+// writeBackendSnapshot writes the snapshot of the backend with the sha256 checksum at the end of the file
+// in the same format as the etcd snapshot API.
+func writeBackendSnapshot(be backend.Backend, path string) error {
+	tmpPath := path + ".part"
+	f, err := os.OpenFile(filepath.Clean(tmpPath), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+	defer f.Close()
+
+	snap := be.Snapshot()
+	defer snap.Close()
+	h := sha256.New()
+	if _, err := snap.WriteTo(io.MultiWriter(f, h)); err != nil {
+		return errors.Wrap(err, "unable to write the etcd snapshot")
+	}
+	if _, err := f.Write(h.Sum(nil)); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// etcdMaintenance returns the maintenance settings, the defaults are used if they are not specified.
+func etcdMaintenance(cfg config.EtcdConfig) config.EtcdMaintenance {
+	if cfg.Maintenance == nil {
+		return config.EtcdMaintenance{}
+	}
+	return *cfg.Maintenance
+}
+
+// snapshotDir returns the directory for periodic snapshots.
+func snapshotDir(dataDir string, maintenance config.EtcdMaintenance) string {
+	if maintenance.SnapshotDir != "" {
+		return maintenance.SnapshotDir
+	}
+	return filepath.Join(filepath.Dir(filepath.Clean(dataDir)), "snapshots")
+}
+
+// listSnapshots returns the periodic snapshots from the directory from the oldest to the newest.
+func listSnapshots(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	snapshots := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, snapshotFilePrefix) && strings.HasSuffix(name, snapshotFileSuffix) {
+			snapshots = append(snapshots, filepath.Join(dir, name))
+		}
+	}
+	sort.Strings(snapshots)
+	return snapshots, nil
+}
+
+// LatestEtcdSnapshot returns the path to the latest periodic snapshot.
+func LatestEtcdSnapshot(cfg config.EtcdConfig) (string, error) {
+	dir := snapshotDir(cfg.DataDir, etcdMaintenance(cfg))
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(snapshots) == 0 {
+		return "", errors.Errorf("no snapshots found in %s", dir)
+	}
+	return snapshots[len(snapshots)-1], nil
+}
+
+// NewEtcdClient creates a client for the etcd server of the agent.
+func NewEtcdClient(cfg config.EtcdConfig) (*clientv3.Client, error) {
+	clientCfg, err := newEtcdClientConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return clientv3.New(clientCfg)
+}
+
+func newEtcdClientConfig(cfg config.EtcdConfig) (clientv3.Config, error) {
+	tlsInfo := transport.TLSInfo{
+		CertFile:      certFilePath(cfg.CertsDir, etcdClientBaseName),
+		KeyFile:       keyFilePath(cfg.CertsDir, etcdClientBaseName),
+		TrustedCAFile: certFilePath(cfg.CertsDir, etcdCaBaseName),
+	}
+	tlsConfig, err := tlsInfo.ClientConfig()
+	if err != nil {
+		return clientv3.Config{}, errors.Wrap(err, "unable to load etcd client certificates")
+	}
+	endpoints := strings.Split(cfg.ListenClientURLs, ",")
+	if len(endpoints) == 0 || endpoints[0] == "" {
+		return clientv3.Config{}, errors.New("etcd client url is not defined")
+	}
+	return clientv3.Config{
+		Endpoints:   endpoints,
+		TLS:         tlsConfig,
+		DialTimeout: etcdDialTimeout,
+	}, nil
+}
+
+// SaveEtcdSnapshot saves the snapshot of the running etcd server to the file.
+func SaveEtcdSnapshot(ctx context.Context, cfg config.EtcdConfig, path string) error {
+	clientCfg, err := newEtcdClientConfig(cfg)
+	if err != nil {
+		return err
+	}
+	// snapshot must be requested from one endpoint only
+	clientCfg.Endpoints = clientCfg.Endpoints[:1]
+	return snapshot.Save(ctx, zap.NewNop(), clientCfg, path)
+}
+
+// DefragmentEtcd defragments the database of the running etcd server and disarms the NOSPACE alarms.
+func DefragmentEtcd(ctx context.Context, cfg config.EtcdConfig) error {
+	cli, err := NewEtcdClient(cfg)
+	if err != nil {
+		return err
+	}
+	defer cli.Close()
+	for _, endpoint := range cli.Endpoints() {
+		if _, err := cli.Defragment(ctx, endpoint); err != nil {
+			return errors.Wrapf(err, "unable to defragment %s", endpoint)
+		}
+	}
+	alarms, err := cli.AlarmList(ctx)
+	if err != nil {
+		return err
+	}
+	for _, alarm := range alarms.Alarms {
+		if alarm.Alarm != pb.AlarmType_NOSPACE {
+			continue
+		}
+		if _, err := cli.AlarmDisarm(ctx, (*clientv3.AlarmMember)(alarm)); err != nil {
+			return errors.Wrap(err, "unable to disarm the NOSPACE alarm")
+		}
+	}
+	return nil
+}
+
+// GetEtcdStatus returns the status of the running etcd server.
+func GetEtcdStatus(ctx context.Context, cfg config.EtcdConfig) (*EtcdStatus, error) {
+	cli, err := NewEtcdClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer cli.Close()
+	endpoint := cli.Endpoints()[0]
+	resp, err := cli.Status(ctx, endpoint)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get status of %s", endpoint)
+	}
+	status := &EtcdStatus{
+		Version:           resp.Version,
+		DBSize:            resp.DbSize,
+		DBSizeInUse:       resp.DbSizeInUse,
+		QuotaBackendBytes: cfg.QuotaBackendBytes,
+		Revision:          resp.Header.Revision,
+		RaftIndex:         resp.RaftIndex,
+		Errors:            resp.Errors,
+	}
+	if status.QuotaBackendBytes == 0 {
+		status.QuotaBackendBytes = etcdserver.DefaultQuotaBytes
+	}
+	alarms, err := cli.AlarmList(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, alarm := range alarms.Alarms {
+		status.Alarms = append(status.Alarms, fmt.Sprintf("%x: %s", alarm.MemberID, alarm.Alarm))
+	}
+	status.Snapshots, err = listSnapshots(snapshotDir(cfg.DataDir, etcdMaintenance(cfg)))
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
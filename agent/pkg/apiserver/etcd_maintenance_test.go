@@ -0,0 +1,96 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	pb "go.etcd.io/etcd/api/v3/etcdserverpb"
+
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+func TestSaveSnapshotRetention(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "etcd")
+	snapshotsDir := filepath.Join(dir, "snapshots")
+	e, _ := startTestEtcd(t, dataDir)
+
+	g.Expect(os.MkdirAll(snapshotsDir, 0o700)).To(Succeed())
+	old := []string{
+		filepath.Join(snapshotsDir, snapshotFilePrefix+"20200101T000000Z"+snapshotFileSuffix),
+		filepath.Join(snapshotsDir, snapshotFilePrefix+"20200102T000000Z"+snapshotFileSuffix),
+	}
+	for _, path := range old {
+		g.Expect(os.WriteFile(path, []byte("old"), 0o600)).To(Succeed())
+	}
+	// unrelated files are not removed
+	other := filepath.Join(snapshotsDir, "manual.db")
+	g.Expect(os.WriteFile(other, []byte("manual"), 0o600)).To(Succeed())
+
+	s := &EtcdServer{
+		Etcd:        e,
+		dataDir:     dataDir,
+		maintenance: config.EtcdMaintenance{SnapshotRetention: 2},
+	}
+	path, err := s.saveSnapshot()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(filepath.Dir(path)).To(Equal(snapshotsDir))
+
+	snapshots, err := listSnapshots(snapshotsDir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(snapshots).To(Equal([]string{old[1], path}))
+	g.Expect(other).To(BeAnExistingFile())
+
+	latest, err := LatestEtcdSnapshot(config.EtcdConfig{DataDir: dataDir})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(latest).To(Equal(path))
+
+	// the saved snapshot is a valid database with the checksum
+	g.Expect(copySnapshotDB(filepath.Join(dir, "db"), path)).To(Succeed())
+}
+
+func TestLatestEtcdSnapshotWithoutSnapshots(t *testing.T) {
+	g := NewWithT(t)
+	_, err := LatestEtcdSnapshot(config.EtcdConfig{
+		DataDir:     filepath.Join(t.TempDir(), "etcd"),
+		Maintenance: &config.EtcdMaintenance{SnapshotDir: t.TempDir()},
+	})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestDefragmentDisarmsNoSpaceAlarm(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	e, _ := startTestEtcd(t, filepath.Join(t.TempDir(), "etcd"))
+	_, err := e.Server.Alarm(ctx, &pb.AlarmRequest{
+		Action:   pb.AlarmRequest_ACTIVATE,
+		MemberID: uint64(e.Server.ID()),
+		Alarm:    pb.AlarmType_NOSPACE,
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(e.Server.Alarms()).To(HaveLen(1))
+
+	s := &EtcdServer{Etcd: e}
+	g.Expect(s.defragment(ctx)).To(Succeed())
+	g.Expect(e.Server.Alarms()).To(BeEmpty())
+}
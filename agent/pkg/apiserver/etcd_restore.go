@@ -0,0 +1,210 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/api/v3/etcdserverpb"
+	"go.etcd.io/etcd/client/pkg/v3/types"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"go.etcd.io/etcd/server/v3/etcdserver"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/membership"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/v2store"
+	"go.etcd.io/etcd/server/v3/etcdserver/cindex"
+	"go.etcd.io/etcd/server/v3/mvcc/backend"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+	"go.uber.org/zap"
+
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+// RestoreEtcdSnapshot replaces the etcd data directory with the data from the snapshot.
+// The etcd server must be stopped. The previous data directory is kept next to the new one
+// with the timestamp suffix, its path is returned.
+// It repeats the logic of "etcdutl snapshot restore" for the single member cluster of the agent.
+func RestoreEtcdSnapshot(cfg config.EtcdConfig, snapshotPath string) (string, error) {
+	embedCfg, err := newEmbedConfig(cfg)
+	if err != nil {
+		return "", err
+	}
+	urlsMap, token, err := embedCfg.PeerURLsMapAndToken("etcd")
+	if err != nil {
+		return "", err
+	}
+	dataDir := filepath.Clean(cfg.DataDir)
+	restoreDir := dataDir + ".restore"
+	if err := os.RemoveAll(restoreDir); err != nil {
+		return "", err
+	}
+	if err := restoreToDir(zap.NewNop(), embedCfg.Name, urlsMap, token, snapshotPath, restoreDir); err != nil {
+		_ = os.RemoveAll(restoreDir)
+		return "", errors.Wrapf(err, "unable to restore the snapshot %s", snapshotPath)
+	}
+
+	backupDir := ""
+	if _, err := os.Stat(dataDir); err == nil {
+		backupDir = dataDir + "." + time.Now().UTC().Format(snapshotTimeFormat)
+		if err := os.Rename(dataDir, backupDir); err != nil {
+			return "", errors.Wrap(err, "unable to back up the etcd data directory")
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	if err := os.Rename(restoreDir, dataDir); err != nil {
+		return "", errors.Wrap(err, "unable to replace the etcd data directory")
+	}
+	return backupDir, nil
+}
+
+func restoreToDir(lg *zap.Logger, name string, urlsMap types.URLsMap, token, snapshotPath, dir string) error {
+	snapDir := filepath.Join(dir, "member", "snap")
+	walDir := filepath.Join(dir, "member", "wal")
+	if err := os.MkdirAll(snapDir, 0o700); err != nil {
+		return err
+	}
+	dbPath := filepath.Join(snapDir, "db")
+	if err := copySnapshotDB(dbPath, snapshotPath); err != nil {
+		return err
+	}
+
+	cl, err := membership.NewClusterFromURLsMap(lg, token, urlsMap)
+	if err != nil {
+		return err
+	}
+	m := cl.MemberByName(name)
+	if m == nil {
+		return errors.Errorf("member %q is not found in the initial cluster", name)
+	}
+
+	be := backend.NewDefaultBackend(dbPath)
+	defer be.Close()
+	if err := membership.TrimMembershipFromBackend(lg, be); err != nil {
+		return err
+	}
+	st := v2store.New(etcdserver.StoreClusterPrefix, etcdserver.StoreKeysPrefix)
+	cl.SetStore(st)
+	cl.SetBackend(be)
+	for _, member := range cl.Members() {
+		cl.AddMember(member, membership.ApplyBoth)
+	}
+
+	metadata, err := (&etcdserverpb.Metadata{NodeID: uint64(m.ID), ClusterID: uint64(cl.ID())}).Marshal()
+	if err != nil {
+		return err
+	}
+	w, err := wal.Create(lg, walDir, metadata)
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	const term = 1
+	ids := cl.MemberIDs()
+	ents := make([]raftpb.Entry, 0, len(ids))
+	voters := make([]uint64, 0, len(ids))
+	for i, id := range ids {
+		ctx, err := json.Marshal(cl.Member(id))
+		if err != nil {
+			return err
+		}
+		cc := raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: uint64(id), Context: ctx}
+		data, err := cc.Marshal()
+		if err != nil {
+			return err
+		}
+		ents = append(ents, raftpb.Entry{Type: raftpb.EntryConfChange, Term: term, Index: uint64(i + 1), Data: data})
+		voters = append(voters, uint64(id))
+	}
+	commit := uint64(len(ents))
+	hardState := raftpb.HardState{Term: term, Vote: voters[0], Commit: commit}
+	if err := w.Save(hardState, ents); err != nil {
+		return err
+	}
+
+	data, err := st.Save()
+	if err != nil {
+		return err
+	}
+	confState := raftpb.ConfState{Voters: voters}
+	raftSnap := raftpb.Snapshot{
+		Data: data,
+		Metadata: raftpb.SnapshotMetadata{
+			Index:     commit,
+			Term:      term,
+			ConfState: confState,
+		},
+	}
+	if err := snap.New(lg, snapDir).SaveSnap(raftSnap); err != nil {
+		return err
+	}
+	if err := w.SaveSnapshot(walpb.Snapshot{Index: commit, Term: term, ConfState: &confState}); err != nil {
+		return err
+	}
+	cindex.UpdateConsistentIndex(be.BatchTx(), commit, term)
+	be.ForceCommit()
+	return nil
+}
+
+// copySnapshotDB copies the bolt database from the snapshot file.
+// The snapshot taken by the etcd snapshot API has the sha256 checksum at the end,
+// it is verified and removed. The database files copied from the data directory have no checksum.
+func copySnapshotDB(dst, src string) error {
+	in, err := os.Open(filepath.Clean(src))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(filepath.Clean(dst), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	// the bolt database size is a multiple of the page size
+	if info.Size()%512 != sha256.Size {
+		if _, err := io.Copy(out, in); err != nil {
+			return err
+		}
+		return out.Sync()
+	}
+	h := sha256.New()
+	if _, err := io.CopyN(io.MultiWriter(out, h), in, info.Size()-sha256.Size); err != nil {
+		return err
+	}
+	expected := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(in, expected); err != nil {
+		return err
+	}
+	if actual := h.Sum(nil); !bytes.Equal(actual, expected) {
+		return errors.Errorf("snapshot checksum mismatch: expected %x, actual %x", expected, actual)
+	}
+	return out.Sync()
+}
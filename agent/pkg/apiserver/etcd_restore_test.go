@@ -0,0 +1,181 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/v3client"
+
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+func TestCopySnapshotDB(t *testing.T) {
+	db := bytes.Repeat([]byte{1}, 1024)
+	sum := sha256.Sum256(db)
+	tests := []struct {
+		name     string
+		snapshot []byte
+		wantErr  bool
+	}{
+		{
+			name:     "snapshot with checksum",
+			snapshot: append(append([]byte{}, db...), sum[:]...),
+		},
+		{
+			name:     "database file without checksum",
+			snapshot: db,
+		},
+		{
+			name:     "corrupted snapshot",
+			snapshot: append(append([]byte{2}, db[1:]...), sum[:]...),
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			dir := t.TempDir()
+			src := filepath.Join(dir, "snapshot.db")
+			dst := filepath.Join(dir, "db")
+			g.Expect(os.WriteFile(src, tt.snapshot, 0o600)).To(Succeed())
+			err := copySnapshotDB(dst, src)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			data, err := os.ReadFile(dst)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(data).To(Equal(db))
+		})
+	}
+}
+
+// startTestEtcd starts the etcd server without TLS on free local ports.
+// The returned function stops the server, the server is also stopped at the end of the test.
+func startTestEtcd(t *testing.T, dataDir string) (*embed.Etcd, func()) {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Dir = dataDir
+	cfg.Logger = "zap"
+	cfg.LogLevel = "error"
+	cfg.LPUrls = []url.URL{freeLocalURL(t)}
+	cfg.LCUrls = []url.URL{freeLocalURL(t)}
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var once sync.Once
+	stop := func() {
+		once.Do(e.Close)
+	}
+	t.Cleanup(stop)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		t.Fatal("etcd server is not ready")
+	}
+	return e, stop
+}
+
+func freeLocalURL(t *testing.T) url.URL {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+func getTestEtcdValue(t *testing.T, e *embed.Etcd, key string) string {
+	t.Helper()
+	resp, err := v3client.New(e.Server).Get(context.Background(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Kvs) == 0 {
+		return ""
+	}
+	return string(resp.Kvs[0].Value)
+}
+
+func TestRestoreEtcdSnapshot(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "etcd")
+	snapshotPath := filepath.Join(dir, "snapshot.db")
+
+	e, stop := startTestEtcd(t, dataDir)
+	cli := v3client.New(e.Server)
+	_, err := cli.Put(context.Background(), "key", "snapshot")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(writeBackendSnapshot(e.Server.Backend(), snapshotPath)).To(Succeed())
+	_, err = cli.Put(context.Background(), "key", "after snapshot")
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = cli.Put(context.Background(), "new-key", "after snapshot")
+	g.Expect(err).NotTo(HaveOccurred())
+	stop()
+
+	backupDir, err := RestoreEtcdSnapshot(config.EtcdConfig{DataDir: dataDir}, snapshotPath)
+	g.Expect(err).NotTo(HaveOccurred())
+	// the previous data directory is kept
+	g.Expect(backupDir).To(HavePrefix(dataDir + "."))
+	g.Expect(filepath.Join(backupDir, "member", "snap", "db")).To(BeAnExistingFile())
+	g.Expect(dataDir + ".restore").NotTo(BeAnExistingFile())
+
+	restored, _ := startTestEtcd(t, dataDir)
+	g.Expect(getTestEtcdValue(t, restored, "key")).To(Equal("snapshot"))
+	g.Expect(getTestEtcdValue(t, restored, "new-key")).To(BeEmpty())
+	// the restored member accepts writes
+	_, err = v3client.New(restored.Server).Put(context.Background(), "key", "restored")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(getTestEtcdValue(t, restored, "key")).To(Equal("restored"))
+}
+
+func TestRestoreEtcdSnapshotKeepsDataOnFailure(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	dataDir := filepath.Join(dir, "etcd")
+	dbPath := filepath.Join(dataDir, "member", "snap", "db")
+	g.Expect(os.MkdirAll(filepath.Dir(dbPath), 0o700)).To(Succeed())
+	g.Expect(os.WriteFile(dbPath, []byte("data"), 0o600)).To(Succeed())
+
+	db := bytes.Repeat([]byte{1}, 1024)
+	corrupted := append(append([]byte{}, db...), make([]byte, sha256.Size)...)
+	snapshotPath := filepath.Join(dir, "snapshot.db")
+	g.Expect(os.WriteFile(snapshotPath, corrupted, 0o600)).To(Succeed())
+
+	_, err := RestoreEtcdSnapshot(config.EtcdConfig{DataDir: dataDir}, snapshotPath)
+	g.Expect(err).To(HaveOccurred())
+	data, err := os.ReadFile(dbPath)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal("data"))
+	g.Expect(dataDir + ".restore").NotTo(BeAnExistingFile())
+}
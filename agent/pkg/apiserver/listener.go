@@ -0,0 +1,136 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	genericoptions "k8s.io/apiserver/pkg/server/options"
+	netutils "k8s.io/utils/net"
+)
+
+// createListener creates the listener that accepts connections on all bind addresses.
+func createListener(bindAddresses []string, port int) (net.Listener, error) {
+	hasIPv4, hasIPv6 := false, false
+	for _, addr := range bindAddresses {
+		hasIPv4 = hasIPv4 || netutils.IsIPv4String(addr)
+		hasIPv6 = hasIPv6 || netutils.IsIPv6String(addr)
+	}
+	listeners := make([]net.Listener, 0, len(bindAddresses))
+	for _, addr := range bindAddresses {
+		network := "tcp"
+		// wildcard addresses accept connections of both IP families by default,
+		// so they conflict with each other on the same port.
+		if hasIPv4 && hasIPv6 {
+			network = "tcp4"
+			if netutils.IsIPv6String(addr) {
+				network = "tcp6"
+			}
+		}
+		listener, _, err := genericoptions.CreateListener(network, net.JoinHostPort(addr, strconv.Itoa(port)), net.ListenConfig{})
+		if err != nil {
+			for _, l := range listeners {
+				_ = l.Close()
+			}
+			return nil, errors.Wrapf(err, "failed to create listener for %s", addr)
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 1 {
+		return listeners[0], nil
+	}
+	return newMultiListener(listeners), nil
+}
+
+type acceptResult struct {
+	conn net.Conn
+	err  error
+}
+
+// multiListener is a net.Listener that accepts connections from several listeners.
+type multiListener struct {
+	listeners []net.Listener
+	conns     chan acceptResult
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+var _ net.Listener = &multiListener{}
+
+func newMultiListener(listeners []net.Listener) *multiListener {
+	ml := &multiListener{
+		listeners: listeners,
+		conns:     make(chan acceptResult),
+		closed:    make(chan struct{}),
+	}
+	for _, l := range listeners {
+		go ml.acceptLoop(l)
+	}
+	return ml
+}
+
+func (ml *multiListener) acceptLoop(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		select {
+		case ml.conns <- acceptResult{conn: conn, err: err}:
+		case <-ml.closed:
+			if conn != nil {
+				_ = conn.Close()
+			}
+			return
+		}
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+	}
+}
+
+// Accept waits for and returns the next connection from any of the listeners.
+func (ml *multiListener) Accept() (net.Conn, error) {
+	select {
+	case r := <-ml.conns:
+		return r.conn, r.err
+	case <-ml.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close closes all listeners.
+func (ml *multiListener) Close() error {
+	var errs []error
+	ml.closeOnce.Do(func() {
+		close(ml.closed)
+		for _, l := range ml.listeners {
+			if err := l.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	})
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// Addr returns the address of the first listener.
+func (ml *multiListener) Addr() net.Addr {
+	return ml.listeners[0].Addr()
+}
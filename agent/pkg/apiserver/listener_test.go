@@ -0,0 +1,78 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"net"
+	"strconv"
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestMultiListener(t *testing.T) {
+	g := NewWithT(t)
+	l1, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).NotTo(HaveOccurred())
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).NotTo(HaveOccurred())
+	ml := newMultiListener([]net.Listener{l1, l2})
+	g.Expect(ml.Addr()).To(Equal(l1.Addr()))
+
+	for _, l := range []net.Listener{l1, l2} {
+		client, err := net.Dial("tcp", l.Addr().String())
+		g.Expect(err).NotTo(HaveOccurred())
+		conn, err := ml.Accept()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(conn.LocalAddr()).To(Equal(l.Addr()))
+		g.Expect(conn.Close()).To(Succeed())
+		g.Expect(client.Close()).To(Succeed())
+	}
+
+	g.Expect(ml.Close()).To(Succeed())
+	_, err = ml.Accept()
+	g.Expect(err).To(MatchError(net.ErrClosed))
+	_, err = net.Dial("tcp", l2.Addr().String())
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestCreateListener(t *testing.T) {
+	g := NewWithT(t)
+	probe, err := net.Listen("tcp", "127.0.0.1:0")
+	g.Expect(err).NotTo(HaveOccurred())
+	port := probe.Addr().(*net.TCPAddr).Port
+	g.Expect(probe.Close()).To(Succeed())
+
+	addresses := []string{"127.0.0.1"}
+	if l, err := net.Listen("tcp", "[::1]:0"); err == nil {
+		g.Expect(l.Close()).To(Succeed())
+		addresses = append(addresses, "::1")
+	}
+	listener, err := createListener(addresses, port)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer listener.Close()
+
+	for _, addr := range addresses {
+		client, err := net.Dial("tcp", net.JoinHostPort(addr, strconv.Itoa(port)))
+		g.Expect(err).NotTo(HaveOccurred())
+		conn, err := listener.Accept()
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(conn.LocalAddr().(*net.TCPAddr).IP.Equal(net.ParseIP(addr))).To(BeTrue())
+		g.Expect(conn.Close()).To(Succeed())
+		g.Expect(client.Close()).To(Succeed())
+	}
+}
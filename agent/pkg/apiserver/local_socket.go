@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apiserver/pkg/authentication/authenticator"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+	"k8s.io/apiserver/pkg/authorization/authorizerfactory"
+	authorizerunion "k8s.io/apiserver/pkg/authorization/union"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/klog/v2"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent"
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+const (
+	// LocalUserName is the name of the user connected to the local socket.
+	LocalUserName = "kubeforce:local"
+	// LocalGroup is the group of the user connected to the local socket.
+	LocalGroup = "kubeforce:local"
+	// CertificateGroup is the group of clients authenticated by the client certificate.
+	CertificateGroup = "kubeforce:certificate"
+)
+
+// localWritableResources are the resources of the agent API group that can be changed by the local user.
+var localWritableResources = sets.NewString("playbooks", "playbookdeployments")
+
+// localConnKey is the context key that marks requests received from the local socket.
+type localConnKey struct{}
+
+// createLocalSocketListener creates the unix domain socket for the local access to the agent.
+func createLocalSocketListener(c config.LocalSocketConfig) (net.Listener, error) {
+	path := c.GetPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return nil, err
+	}
+	// the socket file is left if the previous agent process has not been stopped gracefully
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrapf(err, "unable to remove the socket file %s", path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to create the local socket listener")
+	}
+	if err := os.Chmod(path, c.GetMode()); err != nil {
+		_ = listener.Close()
+		return nil, errors.Wrapf(err, "unable to change permissions of the socket file %s", path)
+	}
+	return listener, nil
+}
+
+// newLocalAuthenticator returns the authenticator that authenticates all requests
+// received from the local socket as the local user.
+func newLocalAuthenticator() authenticator.Request {
+	return authenticator.RequestFunc(func(req *http.Request) (*authenticator.Response, bool, error) {
+		if local, _ := req.Context().Value(localConnKey{}).(bool); !local {
+			return nil, false, nil
+		}
+		return &authenticator.Response{
+			User: &user.DefaultInfo{
+				Name:   LocalUserName,
+				Groups: []string{LocalGroup, user.AllAuthenticated},
+			},
+		}, true, nil
+	})
+}
+
+// newAuthorizer returns the authorizer of the agent API.
+// The loopback client and clients authenticated by the client certificate have full access,
+// the access of the local user is limited by the local policy.
+func newAuthorizer() authorizer.Authorizer {
+	return authorizerunion.New(
+		authorizerfactory.NewPrivilegedGroups(user.SystemPrivilegedGroup, CertificateGroup),
+		authorizer.AuthorizerFunc(authorizeLocalUser),
+	)
+}
+
+// authorizeLocalUser implements the policy of the local user.
+// The local user can read the agent API, run and delete playbooks and manage playbook deployments.
+// Other requests like the upgrade, the upload of files and the uninstallation of the agent are denied.
+func authorizeLocalUser(_ context.Context, a authorizer.Attributes) (authorizer.Decision, string, error) {
+	if a.GetUser() == nil || !sets.NewString(a.GetUser().GetGroups()...).Has(LocalGroup) {
+		return authorizer.DecisionNoOpinion, "", nil
+	}
+	if !a.IsResourceRequest() {
+		if a.GetVerb() == "get" {
+			return authorizer.DecisionAllow, "", nil
+		}
+		return authorizer.DecisionDeny, "the local user can not change the agent", nil
+	}
+	if a.GetAPIGroup() != agent.GroupName {
+		return authorizer.DecisionDeny, "the local user has access only to the agent API group", nil
+	}
+	switch a.GetVerb() {
+	case "get", "list", "watch":
+		return authorizer.DecisionAllow, "", nil
+	case "create", "update", "patch", "delete":
+		if localWritableResources.Has(a.GetResource()) {
+			return authorizer.DecisionAllow, "", nil
+		}
+	}
+	return authorizer.DecisionDeny, fmt.Sprintf("the local user can not %s %s", a.GetVerb(), a.GetResource()), nil
+}
+
+// NewLocalClientConfig returns the rest.Config to connect to the agent through the local socket.
+func NewLocalClientConfig(path string) *restclient.Config {
+	return &restclient.Config{
+		Host: "http://localhost",
+		Dial: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", path)
+		},
+		QPS:   restclient.DefaultQPS,
+		Burst: restclient.DefaultBurst,
+	}
+}
+
+// newLocalLoopbackConfig returns the loopback client config that connects through the local socket without TLS.
+func newLocalLoopbackConfig(path string, loopback *restclient.Config) *restclient.Config {
+	cfg := NewLocalClientConfig(path)
+	cfg.BearerToken = loopback.BearerToken
+	cfg.ContentConfig = loopback.ContentConfig
+	cfg.QPS = loopback.QPS
+	cfg.Burst = loopback.Burst
+	return cfg
+}
+
+// serveLocalSocket serves the agent API on the local socket until the context is done.
+func (s *Server) serveLocalSocket(ctx context.Context, handler http.Handler) {
+	srv := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 32 * time.Second,
+		ConnContext: func(ctx context.Context, _ net.Conn) context.Context {
+			return context.WithValue(ctx, localConnKey{}, true)
+		},
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownGracePeriod.Duration)
+		defer cancel()
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			klog.ErrorS(err, "unable to shut down the local socket server")
+		}
+	}()
+	klog.InfoS("serving the agent API on the local socket", "address", s.localListener.Addr().String())
+	if err := srv.Serve(s.localListener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		klog.ErrorS(err, "local socket server has been stopped")
+	}
+}
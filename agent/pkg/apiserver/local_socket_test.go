@@ -0,0 +1,178 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apiserver/pkg/authentication/user"
+	"k8s.io/apiserver/pkg/authorization/authorizer"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent"
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+func TestLocalAuthenticator(t *testing.T) {
+	tests := []struct {
+		name     string
+		local    bool
+		wantUser string
+	}{
+		{
+			name:     "request from the local socket",
+			local:    true,
+			wantUser: LocalUserName,
+		},
+		{
+			name:  "request from the network",
+			local: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			req := httptest.NewRequest(http.MethodGet, "/apis", nil)
+			if tt.local {
+				req = req.WithContext(context.WithValue(req.Context(), localConnKey{}, true))
+			}
+			resp, ok, err := newLocalAuthenticator().AuthenticateRequest(req)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ok).To(Equal(tt.local))
+			if tt.local {
+				g.Expect(resp.User.GetName()).To(Equal(tt.wantUser))
+				g.Expect(resp.User.GetGroups()).To(ContainElement(LocalGroup))
+			}
+		})
+	}
+}
+
+func TestAuthorizer(t *testing.T) {
+	localUser := &user.DefaultInfo{Name: LocalUserName, Groups: []string{LocalGroup, user.AllAuthenticated}}
+	certUser := &user.DefaultInfo{Name: "kubeforce", Groups: []string{CertificateGroup, user.AllAuthenticated}}
+	authenticatedUser := &user.DefaultInfo{Name: "kubeforce", Groups: []string{user.AllAuthenticated}}
+	tests := []struct {
+		name  string
+		attrs authorizer.AttributesRecord
+		want  authorizer.Decision
+	}{
+		{
+			name: "local user lists playbooks",
+			attrs: authorizer.AttributesRecord{
+				User: localUser, Verb: "list", APIGroup: agent.GroupName, Resource: "playbooks", ResourceRequest: true,
+			},
+			want: authorizer.DecisionAllow,
+		},
+		{
+			name: "local user reads the playbook log",
+			attrs: authorizer.AttributesRecord{
+				User: localUser, Verb: "get", APIGroup: agent.GroupName, Resource: "playbooks", Subresource: "log",
+				ResourceRequest: true,
+			},
+			want: authorizer.DecisionAllow,
+		},
+		{
+			name: "local user patches a playbook deployment",
+			attrs: authorizer.AttributesRecord{
+				User: localUser, Verb: "patch", APIGroup: agent.GroupName, Resource: "playbookdeployments",
+				ResourceRequest: true,
+			},
+			want: authorizer.DecisionAllow,
+		},
+		{
+			name: "local user deletes all playbooks",
+			attrs: authorizer.AttributesRecord{
+				User: localUser, Verb: "deletecollection", APIGroup: agent.GroupName, Resource: "playbooks",
+				ResourceRequest: true,
+			},
+			want: authorizer.DecisionDeny,
+		},
+		{
+			name: "local user reads secrets of another group",
+			attrs: authorizer.AttributesRecord{
+				User: localUser, Verb: "get", Resource: "secrets", ResourceRequest: true,
+			},
+			want: authorizer.DecisionDeny,
+		},
+		{
+			name:  "local user reads the health endpoint",
+			attrs: authorizer.AttributesRecord{User: localUser, Verb: "get", Path: "/healthz"},
+			want:  authorizer.DecisionAllow,
+		},
+		{
+			name:  "local user upgrades the agent",
+			attrs: authorizer.AttributesRecord{User: localUser, Verb: "post", Path: "/upgrade"},
+			want:  authorizer.DecisionDeny,
+		},
+		{
+			name:  "local user uninstalls the agent",
+			attrs: authorizer.AttributesRecord{User: localUser, Verb: "delete", Path: "/uninstall"},
+			want:  authorizer.DecisionDeny,
+		},
+		{
+			name:  "client certificate user upgrades the agent",
+			attrs: authorizer.AttributesRecord{User: certUser, Verb: "post", Path: "/upgrade"},
+			want:  authorizer.DecisionAllow,
+		},
+		{
+			name: "client certificate user deletes all playbooks",
+			attrs: authorizer.AttributesRecord{
+				User: certUser, Verb: "deletecollection", APIGroup: agent.GroupName, Resource: "playbooks",
+				ResourceRequest: true,
+			},
+			want: authorizer.DecisionAllow,
+		},
+		{
+			name:  "authenticated user without a known group",
+			attrs: authorizer.AttributesRecord{User: authenticatedUser, Verb: "get", Path: "/healthz"},
+			want:  authorizer.DecisionNoOpinion,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			decision, _, err := newAuthorizer().Authorize(context.Background(), tt.attrs)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(decision).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestCreateLocalSocketListener(t *testing.T) {
+	g := NewWithT(t)
+	mode := int32(0o660)
+	path := filepath.Join(t.TempDir(), "run", "agent.sock")
+	// the socket file of the previous process is replaced
+	g.Expect(os.MkdirAll(filepath.Dir(path), 0o750)).To(Succeed())
+	g.Expect(os.WriteFile(path, nil, 0o600)).To(Succeed())
+
+	listener, err := createLocalSocketListener(config.LocalSocketConfig{Path: path, Mode: &mode})
+	g.Expect(err).NotTo(HaveOccurred())
+	info, err := os.Stat(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Mode() & os.ModeSocket).NotTo(BeZero())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o660)))
+
+	g.Expect(listener.Close()).To(Succeed())
+	_, err = os.Stat(path)
+	g.Expect(os.IsNotExist(err)).To(BeTrue())
+}
@@ -21,7 +21,6 @@ import (
 	"fmt"
 	"net"
 	"net/http"
-	"strconv"
 	"strings"
 	"time"
 
@@ -36,6 +35,8 @@ import (
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/apimachinery/pkg/util/sets"
 	"k8s.io/apiserver/pkg/authentication/authenticatorfactory"
+	"k8s.io/apiserver/pkg/authentication/group"
+	authenticatorunion "k8s.io/apiserver/pkg/authentication/request/union"
 	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
 	"k8s.io/apiserver/pkg/endpoints/openapi"
 	"k8s.io/apiserver/pkg/features"
@@ -44,6 +45,7 @@ import (
 	"k8s.io/apiserver/pkg/server/dynamiccertificates"
 	"k8s.io/apiserver/pkg/server/filters"
 	genericoptions "k8s.io/apiserver/pkg/server/options"
+	"k8s.io/apiserver/pkg/storage/value"
 	utilfeature "k8s.io/apiserver/pkg/util/feature"
 	clientgoinformers "k8s.io/client-go/informers"
 	clientgoclientset "k8s.io/client-go/kubernetes"
@@ -61,6 +63,7 @@ import (
 	"k3f.io/kubeforce/agent/pkg/install"
 	agentrest "k3f.io/kubeforce/agent/pkg/registry/agent/rest"
 	"k3f.io/kubeforce/agent/pkg/registry/storage"
+	"k3f.io/kubeforce/agent/pkg/registry/storage/filestore"
 )
 
 var (
@@ -93,7 +96,11 @@ type Server struct {
 	// LoopbackClientConfig is a config for a privileged loopback connection to the API server
 	LoopbackClientConfig *restclient.Config
 	completedConfig      *genericapiserver.CompletedConfig
-	started              chan struct{}
+	// db is the database of the "file" storage backend.
+	db *filestore.DB
+	// localListener is the listener of the local socket.
+	localListener net.Listener
+	started       chan struct{}
 }
 
 // InstallAPIs will install the APIs for the restStorageProviders if they are enabled.
@@ -139,9 +146,10 @@ func (s *Server) init() error {
 	utilruntime.Must(metav1.AddMetaToScheme(Scheme))
 
 	gvs := []schema.GroupVersion{v1alpha1.SchemeGroupVersion}
+	storageCodec := Codecs.LegacyCodec(gvs...)
 	recommendedOptions := genericoptions.NewRecommendedOptions(
-		"/registry/kubeforce-apiserver",
-		Codecs.LegacyCodec(gvs...),
+		etcdPathPrefix,
+		storageCodec,
 	)
 	etcdServers := s.config.Etcd.ListenClientURLs
 	recommendedOptions.Etcd.StorageConfig.Transport.ServerList = strings.Split(etcdServers, ",")
@@ -154,6 +162,18 @@ func (s *Server) init() error {
 	recommendedOptions.Admission = nil
 	recommendedOptions.SecureServing = &genericoptions.SecureServingOptionsWithLoopback{}
 	recommendedOptions.Etcd.StorageConfig.Paging = utilfeature.DefaultFeatureGate.Enabled(features.APIListChunking)
+	if s.config.GetStorageBackend() == config.StorageBackendFile {
+		// the objects are stored in the database file instead of etcd
+		recommendedOptions.Etcd = nil
+	}
+	if s.config.Encryption != nil {
+		if err := ensureEncryptionConfig(*s.config.Encryption); err != nil {
+			return err
+		}
+		if recommendedOptions.Etcd != nil {
+			recommendedOptions.Etcd.EncryptionProviderConfigFilepath = s.config.Encryption.GetConfigFile()
+		}
+	}
 
 	if err := kerrors.NewAggregate(recommendedOptions.Validate()); err != nil {
 		return err
@@ -164,6 +184,22 @@ func (s *Server) init() error {
 	if err := recommendedOptions.ApplyTo(serverConfig); err != nil {
 		return err
 	}
+	serverConfig.Authorization.Authorizer = newAuthorizer()
+	if recommendedOptions.Etcd == nil {
+		var transformers map[schema.GroupResource]value.Transformer
+		if s.config.Encryption != nil {
+			var err error
+			if transformers, err = loadTransformers(s.config.Encryption.GetConfigFile()); err != nil {
+				return err
+			}
+		}
+		db, err := openFileStorage(s.config)
+		if err != nil {
+			return err
+		}
+		s.db = db
+		serverConfig.RESTOptionsGetter = filestore.NewRESTOptionsGetter(db, storageCodec, transformers)
+	}
 	var err error
 	if serverConfig.SecureServing, err = createSecureServing(s.config); err != nil {
 		return err
@@ -171,6 +207,13 @@ func (s *Server) init() error {
 	if serverConfig.LoopbackClientConfig, err = createLoopBackConfig(serverConfig.SecureServing); err != nil {
 		return err
 	}
+	if s.config.LocalSocket != nil {
+		if s.localListener, err = createLocalSocketListener(*s.config.LocalSocket); err != nil {
+			return err
+		}
+		// the loopback client connects to the local socket without TLS
+		serverConfig.LoopbackClientConfig = newLocalLoopbackConfig(s.config.LocalSocket.GetPath(), serverConfig.LoopbackClientConfig)
+	}
 
 	if err := applyToAuthentication(&serverConfig.Authentication, serverConfig.SecureServing, serverConfig.OpenAPIConfig, s.config); err != nil {
 		return err
@@ -221,6 +264,8 @@ func (s *Server) InstallDefaultHandlers() {
 	klog.InfoS("Adding default handlers to agent server")
 	s.genericAPIServer.Handler.NonGoRestfulMux.HandleFunc("/uninstall", s.uninstall)
 	s.genericAPIServer.Handler.NonGoRestfulMux.Handle("/upload", NewUploadHandler())
+	s.genericAPIServer.Handler.NonGoRestfulMux.Handle("/upgrade", NewUpgradeHandler())
+	s.genericAPIServer.Handler.NonGoRestfulMux.Handle("/artifacts", NewArtifactsHandler(s.config.GetArtifactsPath()))
 }
 
 // createSecureServing fills up serving information in the server configuration.
@@ -229,11 +274,9 @@ func createSecureServing(cfg config.ConfigSpec) (*genericapiserver.SecureServing
 		return nil, fmt.Errorf("unable to use port: %d", cfg.Port)
 	}
 
-	addr := net.JoinHostPort("0.0.0.0", strconv.Itoa(cfg.Port))
-	lc := net.ListenConfig{}
-	listener, _, err := genericoptions.CreateListener("tcp", addr, lc)
+	listener, err := createListener(cfg.GetBindAddresses(), cfg.Port)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create listener: %v", err)
+		return nil, err
 	}
 
 	c := &genericapiserver.SecureServingInfo{
@@ -320,7 +363,12 @@ func applyToAuthentication(authenticationInfo *genericapiserver.AuthenticationIn
 	if err != nil {
 		return err
 	}
+	// clients authenticated by the client certificate are distinguished from the local user by the group
+	authenticator = group.NewGroupAdder(authenticator, []string{CertificateGroup})
 	authenticationInfo.Authenticator = authenticator
+	if cfg.LocalSocket != nil {
+		authenticationInfo.Authenticator = authenticatorunion.New(authenticator, newLocalAuthenticator())
+	}
 	if openAPIConfig != nil {
 		openAPIConfig.SecurityDefinitions = securityDefinitions
 	}
@@ -351,7 +399,16 @@ func (s *Server) Start(ctx context.Context) error {
 	}
 
 	apiServer := s.genericAPIServer.PrepareRun()
-	return apiServer.Run(ctx.Done())
+	if s.localListener != nil {
+		go s.serveLocalSocket(ctx, s.genericAPIServer.Handler)
+	}
+	err := apiServer.Run(ctx.Done())
+	if s.db != nil {
+		if closeErr := s.db.Close(); closeErr != nil {
+			klog.ErrorS(closeErr, "unable to close the database")
+		}
+	}
+	return err
 }
 
 func (s *Server) uninstall(resp http.ResponseWriter, req *http.Request) {
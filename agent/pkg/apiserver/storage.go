@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"k8s.io/klog/v2"
+
+	"k3f.io/kubeforce/agent/pkg/config"
+	"k3f.io/kubeforce/agent/pkg/registry/storage/filestore"
+)
+
+// etcdPathPrefix is the prefix of keys of the agent objects in etcd.
+const etcdPathPrefix = "/registry/kubeforce-apiserver"
+
+// openFileStorage opens the database of the "file" storage backend.
+// The objects are migrated from the etcd data directory when the database file is created.
+func openFileStorage(cfg config.ConfigSpec) (*filestore.DB, error) {
+	path := cfg.Storage.Path
+	_, err := os.Stat(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	created := os.IsNotExist(err)
+	db, err := filestore.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !created || cfg.Etcd.DataDir == "" {
+		return db, nil
+	}
+	etcdDBPath := filepath.Join(cfg.Etcd.DataDir, "member", "snap", "db")
+	if _, err := os.Stat(etcdDBPath); err != nil {
+		if os.IsNotExist(err) {
+			return db, nil
+		}
+		return nil, err
+	}
+	count, err := db.ImportEtcd(etcdDBPath, etcdPathPrefix+"/")
+	if err != nil {
+		_ = db.Close()
+		// the migration is repeated on the next start
+		_ = os.Remove(path)
+		return nil, errors.Wrap(err, "unable to migrate objects from etcd")
+	}
+	klog.InfoS("objects have been migrated from etcd", "count", count, "etcdDataDir", cfg.Etcd.DataDir, "path", path)
+	return db, nil
+}
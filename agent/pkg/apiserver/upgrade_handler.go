@@ -0,0 +1,154 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package apiserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/endpoints/handlers/responsewriters"
+	"k8s.io/klog/v2"
+
+	"k3f.io/kubeforce/agent/pkg/install"
+)
+
+const (
+	paramURL      = "url"
+	paramChecksum = "checksum"
+	paramTimeout  = "timeout"
+)
+
+// NewUpgradeHandler creates a new handler for upgrading the agent binary.
+func NewUpgradeHandler() *UpgradeHandler {
+	return &UpgradeHandler{
+		// Maximum upload of 512 MB files
+		maxMemory:  512 << 20,
+		httpClient: http.DefaultClient,
+	}
+}
+
+// UpgradeHandler is a handler for upgrading the agent binary.
+// The new binary is uploaded as the "data" form field or downloaded from the url parameter.
+// The agent replies as soon as the binary is verified, the service is restarted asynchronously.
+type UpgradeHandler struct {
+	maxMemory  int64
+	httpClient *http.Client
+}
+
+func (h *UpgradeHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		responsewriters.ErrorNegotiated(
+			apierrors.NewInternalError(fmt.Errorf("method not allowed %q", req.Method)),
+			Codecs, schema.GroupVersion{}, w, req,
+		)
+		return
+	}
+	if err := h.upgrade(req); err != nil {
+		if errors.Is(err, install.ErrUpgradeInProgress) {
+			w.WriteHeader(http.StatusConflict)
+			responsewriters.ErrorNegotiated(
+				apierrors.NewConflict(schema.GroupResource{Resource: "upgrade"}, "agent", err),
+				Codecs, schema.GroupVersion{}, w, req,
+			)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+		responsewriters.ErrorNegotiated(
+			apierrors.NewInternalError(err),
+			Codecs, schema.GroupVersion{}, w, req,
+		)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (h *UpgradeHandler) upgrade(r *http.Request) error {
+	values := r.URL.Query()
+	timeout := install.DefaultUpgradeTimeout
+	if values.Has(paramTimeout) {
+		var err error
+		timeout, err = time.ParseDuration(values.Get(paramTimeout))
+		if err != nil {
+			return errors.Wrapf(err, "unable to parse timeout %q", values.Get(paramTimeout))
+		}
+	}
+	checksum := values.Get(paramChecksum)
+	if checksum == "" {
+		return errors.Errorf("checksum of the agent binary is required")
+	}
+	if err := install.LockUpgrade(timeout); err != nil {
+		return err
+	}
+	if err := h.stageAndSchedule(r, checksum, timeout); err != nil {
+		if unlockErr := install.UnlockUpgrade(); unlockErr != nil {
+			klog.ErrorS(unlockErr, "unable to release the upgrade lock")
+		}
+		return err
+	}
+	return nil
+}
+
+func (h *UpgradeHandler) stageAndSchedule(r *http.Request, checksum string, timeout time.Duration) error {
+	values := r.URL.Query()
+	var body io.ReadCloser
+	if values.Has(paramURL) {
+		resp, err := h.download(r, values.Get(paramURL))
+		if err != nil {
+			return err
+		}
+		body = resp
+	} else {
+		if err := r.ParseMultipartForm(h.maxMemory); err != nil {
+			return errors.Errorf("unable to parse a request body as multipart/form-data")
+		}
+		file, _, err := r.FormFile("data")
+		if err != nil {
+			return errors.Wrap(err, "unable to parse form")
+		}
+		body = file
+	}
+	defer body.Close()
+
+	info, err := install.StageBinary(r.Context(), body, checksum)
+	if err != nil {
+		return err
+	}
+	klog.Infof("new agent binary has been verified, version: %s", info.GitVersion)
+	return install.ScheduleUpgrade(r.Context(), timeout)
+}
+
+func (h *UpgradeHandler) download(r *http.Request, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resp, err := h.httpClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to download the agent binary from %s", url)
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("unable to download the agent binary from %s, status: %s", url, resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -18,6 +18,8 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -36,6 +38,9 @@ type Config struct {
 type ConfigSpec struct {
 	// Port is the port for the Agent to serve on.
 	Port int
+	// BindAddresses are the IP addresses on which the Agent serves.
+	// The default is DefaultBindAddresses.
+	BindAddresses []string
 	// TLS specifies tls configuration for the server.
 	TLS TLS
 	// authentication specifies how requests to the Agent's server are authenticated
@@ -44,8 +49,21 @@ type ConfigSpec struct {
 	ShutdownGracePeriod metav1.Duration
 	// Etcd contains the etcd configuration.
 	Etcd EtcdConfig
+	// Storage defines where the agent objects are stored.
+	// The embedded etcd is used if it is not specified.
+	Storage *StorageConfig
+	// LocalSocket is the unix domain socket for the local access to the agent API.
+	// The socket is not created if it is not specified.
+	LocalSocket *LocalSocketConfig
 	// PlaybookPath is the path for storing temporary playbook files.
+	// The artifacts of the playbook files are stored in the ".artifacts" subdirectory.
 	PlaybookPath string
+	// Ansible defines the managed ansible runtime of the playbooks.
+	// Ansible is installed system-wide by pip if it is not specified.
+	Ansible *AnsibleConfig
+	// Encryption defines the encryption at rest of the agent objects.
+	// The objects are stored in plaintext if it is not specified.
+	Encryption *EncryptionConfig
 }
 
 // TLS describes the tls certificate.
@@ -103,6 +121,195 @@ type EtcdConfig struct {
 	ListenPeerURLs string
 	// ListenClientURLs is the list of URLs to listen on for client traffic
 	ListenClientURLs string
+	// QuotaBackendBytes is the maximum size of the etcd database in bytes.
+	// The etcd default is used if it is zero.
+	QuotaBackendBytes int64
+	// Maintenance contains the settings of the periodic maintenance of the etcd database.
+	Maintenance *EtcdMaintenance
+}
+
+// EtcdMaintenance defines the periodic maintenance of the etcd database.
+type EtcdMaintenance struct {
+	// AutoCompactionMode is either "periodic" or "revision". The default is "periodic".
+	AutoCompactionMode string
+	// AutoCompactionRetention is a duration for the "periodic" mode or a number of revisions for the "revision" mode.
+	// The default is "1h".
+	AutoCompactionRetention string
+	// DefragInterval is the interval between defragmentations of the database.
+	// The default is 24h, the zero value disables the defragmentation.
+	DefragInterval *metav1.Duration
+	// SnapshotInterval is the interval between snapshots of the database.
+	// Snapshots are disabled if the interval is not specified or zero.
+	SnapshotInterval *metav1.Duration
+	// SnapshotDir is the directory for snapshots of the database.
+	// The default is the "snapshots" directory next to the DataDir.
+	SnapshotDir string
+	// SnapshotRetention is the number of snapshots to keep. The default is 3.
+	SnapshotRetention int
+}
+
+// StorageBackend is the type of the storage for the agent objects.
+type StorageBackend string
+
+const (
+	// StorageBackendEtcd stores the objects in the embedded etcd server.
+	StorageBackendEtcd StorageBackend = "etcd"
+	// StorageBackendFile stores the objects in a single database file without listening ports.
+	StorageBackendFile StorageBackend = "file"
+)
+
+// StorageConfig defines the storage for the agent objects.
+type StorageConfig struct {
+	// Backend is the type of the storage. The default is "etcd".
+	Backend StorageBackend
+	// Path is the path to the database file of the "file" backend.
+	// The objects are migrated from the etcd DataDir when the file is created.
+	Path string
+}
+
+// DefaultLocalSocketPath is the default path of the unix domain socket of the agent.
+const DefaultLocalSocketPath = "/run/kubeforce/agent.sock"
+
+// LocalSocketConfig defines the unix domain socket for the local access to the agent API.
+// Clients connected to the socket are authenticated as the local user without TLS.
+type LocalSocketConfig struct {
+	// Path is the path of the socket file. The default is DefaultLocalSocketPath.
+	Path string
+	// Mode is the permission bits of the socket file. The default is 0600.
+	Mode *int32
+}
+
+// GetPath returns the path of the socket file with the default value.
+func (c LocalSocketConfig) GetPath() string {
+	if c.Path == "" {
+		return DefaultLocalSocketPath
+	}
+	return c.Path
+}
+
+// GetMode returns the permission bits of the socket file with the default value.
+func (c LocalSocketConfig) GetMode() os.FileMode {
+	if c.Mode == nil {
+		return 0o600
+	}
+	return os.FileMode(*c.Mode)
+}
+
+const (
+	// DefaultAnsibleVersion is the default version of ansible-core in the managed ansible runtime.
+	DefaultAnsibleVersion = "2.13.13"
+	// DefaultAnsibleDir is the default directory of the managed ansible runtimes.
+	DefaultAnsibleDir = "/var/lib/kubeforce/ansible"
+)
+
+// AnsibleConfig defines the managed ansible runtime.
+// Every version of ansible-core is installed into a separate virtualenv in the Dir.
+type AnsibleConfig struct {
+	// Version is the version of ansible-core for the playbooks that do not specify it.
+	// The default is DefaultAnsibleVersion.
+	Version string
+	// Dir is the directory of the virtualenvs and the offline bundles. The default is DefaultAnsibleDir.
+	Dir string
+	// Offline specifies that ansible-core is installed from the wheel bundle without access to the package index.
+	// The bundle of the version is expected at the path returned by GetBundlePath.
+	Offline bool
+}
+
+// GetVersion returns the version of ansible-core with the default value.
+func (c AnsibleConfig) GetVersion() string {
+	if c.Version == "" {
+		return DefaultAnsibleVersion
+	}
+	return c.Version
+}
+
+// GetDir returns the directory of the runtimes with the default value.
+func (c AnsibleConfig) GetDir() string {
+	if c.Dir == "" {
+		return DefaultAnsibleDir
+	}
+	return c.Dir
+}
+
+// GetBundlesDir returns the directory of the offline bundles.
+func (c AnsibleConfig) GetBundlesDir() string {
+	return filepath.Join(c.GetDir(), "bundles")
+}
+
+// GetBundlePath returns the path of the wheel bundle of the ansible-core version.
+// The bundle is a tar.gz archive of the wheels of ansible-core and all its dependencies.
+func (c AnsibleConfig) GetBundlePath(version string) string {
+	return filepath.Join(c.GetBundlesDir(), AnsibleBundleFileName(version))
+}
+
+// EncryptionProvider is the provider that encrypts the agent objects at rest.
+type EncryptionProvider string
+
+const (
+	// EncryptionProviderAESCBC encrypts the objects with AES-CBC and PKCS#7 padding.
+	EncryptionProviderAESCBC EncryptionProvider = "aescbc"
+	// EncryptionProviderSecretbox encrypts the objects with XSalsa20 and Poly1305.
+	EncryptionProviderSecretbox EncryptionProvider = "secretbox"
+)
+
+// DefaultEncryptionConfigFile is the default path of the encryption configuration of the agent apiserver.
+const DefaultEncryptionConfigFile = "/etc/kubeforce/encryption/config.yaml"
+
+// EncryptionConfig defines the encryption at rest of the agent objects.
+type EncryptionConfig struct {
+	// Provider is the provider that encrypts the objects when the ConfigFile is generated.
+	// The default is EncryptionProviderAESCBC.
+	Provider EncryptionProvider
+	// ConfigFile is the path to the EncryptionConfiguration (apiserver.config.k8s.io/v1) of the agent apiserver.
+	// The file is generated with a random key of the Provider if it does not exist.
+	// It must be outside the etcd data directory and the directory of the "file" storage database.
+	// The default is DefaultEncryptionConfigFile.
+	ConfigFile string
+}
+
+// GetProvider returns the encryption provider with the default value.
+func (c EncryptionConfig) GetProvider() EncryptionProvider {
+	if c.Provider == "" {
+		return EncryptionProviderAESCBC
+	}
+	return c.Provider
+}
+
+// GetConfigFile returns the path of the encryption configuration with the default value.
+func (c EncryptionConfig) GetConfigFile() string {
+	if c.ConfigFile == "" {
+		return DefaultEncryptionConfigFile
+	}
+	return c.ConfigFile
+}
+
+// AnsibleBundleFileName returns the file name of the wheel bundle of the ansible-core version.
+func AnsibleBundleFileName(version string) string {
+	return "ansible-core-" + version + ".tar.gz"
+}
+
+// DefaultBindAddresses are the default IP addresses on which the Agent serves.
+var DefaultBindAddresses = []string{"0.0.0.0"}
+
+// GetBindAddresses returns the bind addresses with the default value.
+func (c ConfigSpec) GetBindAddresses() []string {
+	if len(c.BindAddresses) == 0 {
+		return DefaultBindAddresses
+	}
+	return c.BindAddresses
+}
+
+// GetArtifactsPath returns the directory of the artifacts referenced by the playbook files.
+func (c ConfigSpec) GetArtifactsPath() string {
+	return filepath.Join(c.PlaybookPath, ".artifacts")
+}
+
+// GetStorageBackend returns the storage backend with the default value.
+func (c ConfigSpec) GetStorageBackend() StorageBackend {
+	if c.Storage == nil || c.Storage.Backend == "" {
+		return StorageBackendEtcd
+	}
+	return c.Storage.Backend
 }
 
 var _ fmt.Stringer = new(TLS)
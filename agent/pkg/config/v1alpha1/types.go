@@ -32,6 +32,10 @@ type Config struct {
 type ConfigSpec struct {
 	// Port is the port for the Agent to serve on.
 	Port int `json:"port"`
+	// BindAddresses are the IP addresses on which the Agent serves.
+	// The default is ["0.0.0.0"]. Use "::" to serve on all IPv4 and IPv6 addresses.
+	// +optional
+	BindAddresses []string `json:"bindAddresses,omitempty"`
 	// TLS specifies tls configuration for the server.
 	TLS TLS `json:"tls"`
 	// authentication specifies how requests to the Agent's server are authenticated
@@ -41,8 +45,25 @@ type ConfigSpec struct {
 	ShutdownGracePeriod metav1.Duration `json:"shutdownGracePeriod,omitempty"`
 	// Etcd contains the etcd configuration.
 	Etcd EtcdConfig `json:"etcd"`
+	// Storage defines where the agent objects are stored.
+	// The embedded etcd is used if it is not specified.
+	// +optional
+	Storage *StorageConfig `json:"storage,omitempty"`
+	// LocalSocket is the unix domain socket for the local access to the agent API.
+	// The socket is not created if it is not specified.
+	// +optional
+	LocalSocket *LocalSocketConfig `json:"localSocket,omitempty"`
 	// PlaybookPath is the path for storing temporary playbook files.
+	// The artifacts of the playbook files are stored in the ".artifacts" subdirectory.
 	PlaybookPath string `json:"playbookPath"`
+	// Ansible defines the managed ansible runtime of the playbooks.
+	// Ansible is installed system-wide by pip if it is not specified.
+	// +optional
+	Ansible *AnsibleConfig `json:"ansible,omitempty"`
+	// Encryption defines the encryption at rest of the agent objects.
+	// The objects are stored in plaintext if it is not specified.
+	// +optional
+	Encryption *EncryptionConfig `json:"encryption,omitempty"`
 }
 
 // TLS describes tls certificate.
@@ -98,4 +119,109 @@ type EtcdConfig struct {
 	ListenPeerURLs string `json:"listenPeerURLs"`
 	// ListenClientURLs is the list of URLs to listen on for client traffic
 	ListenClientURLs string `json:"listenClientURLs"`
+	// QuotaBackendBytes is the maximum size of the etcd database in bytes.
+	// The etcd default is used if it is zero.
+	// +optional
+	QuotaBackendBytes int64 `json:"quotaBackendBytes,omitempty"`
+	// Maintenance contains the settings of the periodic maintenance of the etcd database.
+	// +optional
+	Maintenance *EtcdMaintenance `json:"maintenance,omitempty"`
+}
+
+// StorageBackend is the type of the storage for the agent objects.
+type StorageBackend string
+
+const (
+	// StorageBackendEtcd stores the objects in the embedded etcd server.
+	StorageBackendEtcd StorageBackend = "etcd"
+	// StorageBackendFile stores the objects in a single database file without listening ports.
+	StorageBackendFile StorageBackend = "file"
+)
+
+// StorageConfig defines the storage for the agent objects.
+type StorageConfig struct {
+	// Backend is the type of the storage. The default is "etcd".
+	// +optional
+	Backend StorageBackend `json:"backend,omitempty"`
+	// Path is the path to the database file of the "file" backend.
+	// The objects are migrated from the etcd dataDir when the file is created.
+	// +optional
+	Path string `json:"path,omitempty"`
+}
+
+// LocalSocketConfig defines the unix domain socket for the local access to the agent API.
+// Clients connected to the socket are authenticated as the local user without TLS.
+type LocalSocketConfig struct {
+	// Path is the path of the socket file. The default is "/run/kubeforce/agent.sock".
+	// +optional
+	Path string `json:"path,omitempty"`
+	// Mode is the permission bits of the socket file. The default is 0600.
+	// +optional
+	Mode *int32 `json:"mode,omitempty"`
+}
+
+// AnsibleConfig defines the managed ansible runtime.
+// Every version of ansible-core is installed into a separate virtualenv in the Dir.
+type AnsibleConfig struct {
+	// Version is the version of ansible-core for the playbooks that do not specify it.
+	// The default is "2.13.13".
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Dir is the directory of the virtualenvs and the offline bundles. The default is "/var/lib/kubeforce/ansible".
+	// +optional
+	Dir string `json:"dir,omitempty"`
+	// Offline specifies that ansible-core is installed from the wheel bundle without access to the package index.
+	// The bundle of the version is expected at "<dir>/bundles/ansible-core-<version>.tar.gz".
+	// +optional
+	Offline bool `json:"offline,omitempty"`
+}
+
+// EncryptionProvider is the provider that encrypts the agent objects at rest.
+type EncryptionProvider string
+
+const (
+	// EncryptionProviderAESCBC encrypts the objects with AES-CBC and PKCS#7 padding.
+	EncryptionProviderAESCBC EncryptionProvider = "aescbc"
+	// EncryptionProviderSecretbox encrypts the objects with XSalsa20 and Poly1305.
+	EncryptionProviderSecretbox EncryptionProvider = "secretbox"
+)
+
+// EncryptionConfig defines the encryption at rest of the agent objects.
+type EncryptionConfig struct {
+	// Provider is the provider that encrypts the objects when the configFile is generated.
+	// The default is "aescbc".
+	// +optional
+	Provider EncryptionProvider `json:"provider,omitempty"`
+	// ConfigFile is the path to the EncryptionConfiguration (apiserver.config.k8s.io/v1) of the agent apiserver.
+	// The file is generated with a random key of the provider if it does not exist.
+	// It must be outside the etcd data directory and the directory of the "file" storage database.
+	// The default is "/etc/kubeforce/encryption/config.yaml".
+	// +optional
+	ConfigFile string `json:"configFile,omitempty"`
+}
+
+// EtcdMaintenance defines the periodic maintenance of the etcd database.
+type EtcdMaintenance struct {
+	// AutoCompactionMode is either "periodic" or "revision". The default is "periodic".
+	// +optional
+	AutoCompactionMode string `json:"autoCompactionMode,omitempty"`
+	// AutoCompactionRetention is a duration for the "periodic" mode or a number of revisions for the "revision" mode.
+	// The default is "1h".
+	// +optional
+	AutoCompactionRetention string `json:"autoCompactionRetention,omitempty"`
+	// DefragInterval is the interval between defragmentations of the database.
+	// The default is 24h, the zero value disables the defragmentation.
+	// +optional
+	DefragInterval *metav1.Duration `json:"defragInterval,omitempty"`
+	// SnapshotInterval is the interval between snapshots of the database.
+	// Snapshots are disabled if the interval is not specified or zero.
+	// +optional
+	SnapshotInterval *metav1.Duration `json:"snapshotInterval,omitempty"`
+	// SnapshotDir is the directory for snapshots of the database.
+	// The default is the "snapshots" directory next to the dataDir.
+	// +optional
+	SnapshotDir string `json:"snapshotDir,omitempty"`
+	// SnapshotRetention is the number of snapshots to keep. The default is 3.
+	// +optional
+	SnapshotRetention int `json:"snapshotRetention,omitempty"`
 }
@@ -25,6 +25,7 @@ import (
 	unsafe "unsafe"
 
 	config "k3f.io/kubeforce/agent/pkg/config"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	conversion "k8s.io/apimachinery/pkg/conversion"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
@@ -56,6 +57,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*AnsibleConfig)(nil), (*config.AnsibleConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_AnsibleConfig_To_config_AnsibleConfig(a.(*AnsibleConfig), b.(*config.AnsibleConfig), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.AnsibleConfig)(nil), (*AnsibleConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_AnsibleConfig_To_v1alpha1_AnsibleConfig(a.(*config.AnsibleConfig), b.(*AnsibleConfig), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*Config)(nil), (*config.Config)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_Config_To_config_Config(a.(*Config), b.(*config.Config), scope)
 	}); err != nil {
@@ -76,6 +87,16 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*EncryptionConfig)(nil), (*config.EncryptionConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_EncryptionConfig_To_config_EncryptionConfig(a.(*EncryptionConfig), b.(*config.EncryptionConfig), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.EncryptionConfig)(nil), (*EncryptionConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_EncryptionConfig_To_v1alpha1_EncryptionConfig(a.(*config.EncryptionConfig), b.(*EncryptionConfig), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*EtcdConfig)(nil), (*config.EtcdConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_EtcdConfig_To_config_EtcdConfig(a.(*EtcdConfig), b.(*config.EtcdConfig), scope)
 	}); err != nil {
@@ -86,6 +107,36 @@ func RegisterConversions(s *runtime.Scheme) error {
 	}); err != nil {
 		return err
 	}
+	if err := s.AddGeneratedConversionFunc((*EtcdMaintenance)(nil), (*config.EtcdMaintenance)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_EtcdMaintenance_To_config_EtcdMaintenance(a.(*EtcdMaintenance), b.(*config.EtcdMaintenance), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.EtcdMaintenance)(nil), (*EtcdMaintenance)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_EtcdMaintenance_To_v1alpha1_EtcdMaintenance(a.(*config.EtcdMaintenance), b.(*EtcdMaintenance), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*LocalSocketConfig)(nil), (*config.LocalSocketConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_LocalSocketConfig_To_config_LocalSocketConfig(a.(*LocalSocketConfig), b.(*config.LocalSocketConfig), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.LocalSocketConfig)(nil), (*LocalSocketConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_LocalSocketConfig_To_v1alpha1_LocalSocketConfig(a.(*config.LocalSocketConfig), b.(*LocalSocketConfig), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*StorageConfig)(nil), (*config.StorageConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_v1alpha1_StorageConfig_To_config_StorageConfig(a.(*StorageConfig), b.(*config.StorageConfig), scope)
+	}); err != nil {
+		return err
+	}
+	if err := s.AddGeneratedConversionFunc((*config.StorageConfig)(nil), (*StorageConfig)(nil), func(a, b interface{}, scope conversion.Scope) error {
+		return Convert_config_StorageConfig_To_v1alpha1_StorageConfig(a.(*config.StorageConfig), b.(*StorageConfig), scope)
+	}); err != nil {
+		return err
+	}
 	if err := s.AddGeneratedConversionFunc((*TLS)(nil), (*config.TLS)(nil), func(a, b interface{}, scope conversion.Scope) error {
 		return Convert_v1alpha1_TLS_To_config_TLS(a.(*TLS), b.(*config.TLS), scope)
 	}); err != nil {
@@ -145,6 +196,30 @@ func Convert_config_AgentX509Authentication_To_v1alpha1_AgentX509Authentication(
 	return autoConvert_config_AgentX509Authentication_To_v1alpha1_AgentX509Authentication(in, out, s)
 }
 
+func autoConvert_v1alpha1_AnsibleConfig_To_config_AnsibleConfig(in *AnsibleConfig, out *config.AnsibleConfig, s conversion.Scope) error {
+	out.Version = in.Version
+	out.Dir = in.Dir
+	out.Offline = in.Offline
+	return nil
+}
+
+// Convert_v1alpha1_AnsibleConfig_To_config_AnsibleConfig is an autogenerated conversion function.
+func Convert_v1alpha1_AnsibleConfig_To_config_AnsibleConfig(in *AnsibleConfig, out *config.AnsibleConfig, s conversion.Scope) error {
+	return autoConvert_v1alpha1_AnsibleConfig_To_config_AnsibleConfig(in, out, s)
+}
+
+func autoConvert_config_AnsibleConfig_To_v1alpha1_AnsibleConfig(in *config.AnsibleConfig, out *AnsibleConfig, s conversion.Scope) error {
+	out.Version = in.Version
+	out.Dir = in.Dir
+	out.Offline = in.Offline
+	return nil
+}
+
+// Convert_config_AnsibleConfig_To_v1alpha1_AnsibleConfig is an autogenerated conversion function.
+func Convert_config_AnsibleConfig_To_v1alpha1_AnsibleConfig(in *config.AnsibleConfig, out *AnsibleConfig, s conversion.Scope) error {
+	return autoConvert_config_AnsibleConfig_To_v1alpha1_AnsibleConfig(in, out, s)
+}
+
 func autoConvert_v1alpha1_Config_To_config_Config(in *Config, out *config.Config, s conversion.Scope) error {
 	if err := Convert_v1alpha1_ConfigSpec_To_config_ConfigSpec(&in.Spec, &out.Spec, s); err != nil {
 		return err
@@ -171,6 +246,7 @@ func Convert_config_Config_To_v1alpha1_Config(in *config.Config, out *Config, s
 
 func autoConvert_v1alpha1_ConfigSpec_To_config_ConfigSpec(in *ConfigSpec, out *config.ConfigSpec, s conversion.Scope) error {
 	out.Port = in.Port
+	out.BindAddresses = *(*[]string)(unsafe.Pointer(&in.BindAddresses))
 	if err := Convert_v1alpha1_TLS_To_config_TLS(&in.TLS, &out.TLS, s); err != nil {
 		return err
 	}
@@ -181,7 +257,11 @@ func autoConvert_v1alpha1_ConfigSpec_To_config_ConfigSpec(in *ConfigSpec, out *c
 	if err := Convert_v1alpha1_EtcdConfig_To_config_EtcdConfig(&in.Etcd, &out.Etcd, s); err != nil {
 		return err
 	}
+	out.Storage = (*config.StorageConfig)(unsafe.Pointer(in.Storage))
+	out.LocalSocket = (*config.LocalSocketConfig)(unsafe.Pointer(in.LocalSocket))
 	out.PlaybookPath = in.PlaybookPath
+	out.Ansible = (*config.AnsibleConfig)(unsafe.Pointer(in.Ansible))
+	out.Encryption = (*config.EncryptionConfig)(unsafe.Pointer(in.Encryption))
 	return nil
 }
 
@@ -192,6 +272,7 @@ func Convert_v1alpha1_ConfigSpec_To_config_ConfigSpec(in *ConfigSpec, out *confi
 
 func autoConvert_config_ConfigSpec_To_v1alpha1_ConfigSpec(in *config.ConfigSpec, out *ConfigSpec, s conversion.Scope) error {
 	out.Port = in.Port
+	out.BindAddresses = *(*[]string)(unsafe.Pointer(&in.BindAddresses))
 	if err := Convert_config_TLS_To_v1alpha1_TLS(&in.TLS, &out.TLS, s); err != nil {
 		return err
 	}
@@ -202,7 +283,11 @@ func autoConvert_config_ConfigSpec_To_v1alpha1_ConfigSpec(in *config.ConfigSpec,
 	if err := Convert_config_EtcdConfig_To_v1alpha1_EtcdConfig(&in.Etcd, &out.Etcd, s); err != nil {
 		return err
 	}
+	out.Storage = (*StorageConfig)(unsafe.Pointer(in.Storage))
+	out.LocalSocket = (*LocalSocketConfig)(unsafe.Pointer(in.LocalSocket))
 	out.PlaybookPath = in.PlaybookPath
+	out.Ansible = (*AnsibleConfig)(unsafe.Pointer(in.Ansible))
+	out.Encryption = (*EncryptionConfig)(unsafe.Pointer(in.Encryption))
 	return nil
 }
 
@@ -211,11 +296,35 @@ func Convert_config_ConfigSpec_To_v1alpha1_ConfigSpec(in *config.ConfigSpec, out
 	return autoConvert_config_ConfigSpec_To_v1alpha1_ConfigSpec(in, out, s)
 }
 
+func autoConvert_v1alpha1_EncryptionConfig_To_config_EncryptionConfig(in *EncryptionConfig, out *config.EncryptionConfig, s conversion.Scope) error {
+	out.Provider = config.EncryptionProvider(in.Provider)
+	out.ConfigFile = in.ConfigFile
+	return nil
+}
+
+// Convert_v1alpha1_EncryptionConfig_To_config_EncryptionConfig is an autogenerated conversion function.
+func Convert_v1alpha1_EncryptionConfig_To_config_EncryptionConfig(in *EncryptionConfig, out *config.EncryptionConfig, s conversion.Scope) error {
+	return autoConvert_v1alpha1_EncryptionConfig_To_config_EncryptionConfig(in, out, s)
+}
+
+func autoConvert_config_EncryptionConfig_To_v1alpha1_EncryptionConfig(in *config.EncryptionConfig, out *EncryptionConfig, s conversion.Scope) error {
+	out.Provider = EncryptionProvider(in.Provider)
+	out.ConfigFile = in.ConfigFile
+	return nil
+}
+
+// Convert_config_EncryptionConfig_To_v1alpha1_EncryptionConfig is an autogenerated conversion function.
+func Convert_config_EncryptionConfig_To_v1alpha1_EncryptionConfig(in *config.EncryptionConfig, out *EncryptionConfig, s conversion.Scope) error {
+	return autoConvert_config_EncryptionConfig_To_v1alpha1_EncryptionConfig(in, out, s)
+}
+
 func autoConvert_v1alpha1_EtcdConfig_To_config_EtcdConfig(in *EtcdConfig, out *config.EtcdConfig, s conversion.Scope) error {
 	out.DataDir = in.DataDir
 	out.CertsDir = in.CertsDir
 	out.ListenPeerURLs = in.ListenPeerURLs
 	out.ListenClientURLs = in.ListenClientURLs
+	out.QuotaBackendBytes = in.QuotaBackendBytes
+	out.Maintenance = (*config.EtcdMaintenance)(unsafe.Pointer(in.Maintenance))
 	return nil
 }
 
@@ -229,6 +338,8 @@ func autoConvert_config_EtcdConfig_To_v1alpha1_EtcdConfig(in *config.EtcdConfig,
 	out.CertsDir = in.CertsDir
 	out.ListenPeerURLs = in.ListenPeerURLs
 	out.ListenClientURLs = in.ListenClientURLs
+	out.QuotaBackendBytes = in.QuotaBackendBytes
+	out.Maintenance = (*EtcdMaintenance)(unsafe.Pointer(in.Maintenance))
 	return nil
 }
 
@@ -237,6 +348,80 @@ func Convert_config_EtcdConfig_To_v1alpha1_EtcdConfig(in *config.EtcdConfig, out
 	return autoConvert_config_EtcdConfig_To_v1alpha1_EtcdConfig(in, out, s)
 }
 
+func autoConvert_v1alpha1_EtcdMaintenance_To_config_EtcdMaintenance(in *EtcdMaintenance, out *config.EtcdMaintenance, s conversion.Scope) error {
+	out.AutoCompactionMode = in.AutoCompactionMode
+	out.AutoCompactionRetention = in.AutoCompactionRetention
+	out.DefragInterval = (*v1.Duration)(unsafe.Pointer(in.DefragInterval))
+	out.SnapshotInterval = (*v1.Duration)(unsafe.Pointer(in.SnapshotInterval))
+	out.SnapshotDir = in.SnapshotDir
+	out.SnapshotRetention = in.SnapshotRetention
+	return nil
+}
+
+// Convert_v1alpha1_EtcdMaintenance_To_config_EtcdMaintenance is an autogenerated conversion function.
+func Convert_v1alpha1_EtcdMaintenance_To_config_EtcdMaintenance(in *EtcdMaintenance, out *config.EtcdMaintenance, s conversion.Scope) error {
+	return autoConvert_v1alpha1_EtcdMaintenance_To_config_EtcdMaintenance(in, out, s)
+}
+
+func autoConvert_config_EtcdMaintenance_To_v1alpha1_EtcdMaintenance(in *config.EtcdMaintenance, out *EtcdMaintenance, s conversion.Scope) error {
+	out.AutoCompactionMode = in.AutoCompactionMode
+	out.AutoCompactionRetention = in.AutoCompactionRetention
+	out.DefragInterval = (*v1.Duration)(unsafe.Pointer(in.DefragInterval))
+	out.SnapshotInterval = (*v1.Duration)(unsafe.Pointer(in.SnapshotInterval))
+	out.SnapshotDir = in.SnapshotDir
+	out.SnapshotRetention = in.SnapshotRetention
+	return nil
+}
+
+// Convert_config_EtcdMaintenance_To_v1alpha1_EtcdMaintenance is an autogenerated conversion function.
+func Convert_config_EtcdMaintenance_To_v1alpha1_EtcdMaintenance(in *config.EtcdMaintenance, out *EtcdMaintenance, s conversion.Scope) error {
+	return autoConvert_config_EtcdMaintenance_To_v1alpha1_EtcdMaintenance(in, out, s)
+}
+
+func autoConvert_v1alpha1_LocalSocketConfig_To_config_LocalSocketConfig(in *LocalSocketConfig, out *config.LocalSocketConfig, s conversion.Scope) error {
+	out.Path = in.Path
+	out.Mode = (*int32)(unsafe.Pointer(in.Mode))
+	return nil
+}
+
+// Convert_v1alpha1_LocalSocketConfig_To_config_LocalSocketConfig is an autogenerated conversion function.
+func Convert_v1alpha1_LocalSocketConfig_To_config_LocalSocketConfig(in *LocalSocketConfig, out *config.LocalSocketConfig, s conversion.Scope) error {
+	return autoConvert_v1alpha1_LocalSocketConfig_To_config_LocalSocketConfig(in, out, s)
+}
+
+func autoConvert_config_LocalSocketConfig_To_v1alpha1_LocalSocketConfig(in *config.LocalSocketConfig, out *LocalSocketConfig, s conversion.Scope) error {
+	out.Path = in.Path
+	out.Mode = (*int32)(unsafe.Pointer(in.Mode))
+	return nil
+}
+
+// Convert_config_LocalSocketConfig_To_v1alpha1_LocalSocketConfig is an autogenerated conversion function.
+func Convert_config_LocalSocketConfig_To_v1alpha1_LocalSocketConfig(in *config.LocalSocketConfig, out *LocalSocketConfig, s conversion.Scope) error {
+	return autoConvert_config_LocalSocketConfig_To_v1alpha1_LocalSocketConfig(in, out, s)
+}
+
+func autoConvert_v1alpha1_StorageConfig_To_config_StorageConfig(in *StorageConfig, out *config.StorageConfig, s conversion.Scope) error {
+	out.Backend = config.StorageBackend(in.Backend)
+	out.Path = in.Path
+	return nil
+}
+
+// Convert_v1alpha1_StorageConfig_To_config_StorageConfig is an autogenerated conversion function.
+func Convert_v1alpha1_StorageConfig_To_config_StorageConfig(in *StorageConfig, out *config.StorageConfig, s conversion.Scope) error {
+	return autoConvert_v1alpha1_StorageConfig_To_config_StorageConfig(in, out, s)
+}
+
+func autoConvert_config_StorageConfig_To_v1alpha1_StorageConfig(in *config.StorageConfig, out *StorageConfig, s conversion.Scope) error {
+	out.Backend = StorageBackend(in.Backend)
+	out.Path = in.Path
+	return nil
+}
+
+// Convert_config_StorageConfig_To_v1alpha1_StorageConfig is an autogenerated conversion function.
+func Convert_config_StorageConfig_To_v1alpha1_StorageConfig(in *config.StorageConfig, out *StorageConfig, s conversion.Scope) error {
+	return autoConvert_config_StorageConfig_To_v1alpha1_StorageConfig(in, out, s)
+}
+
 func autoConvert_v1alpha1_TLS_To_config_TLS(in *TLS, out *config.TLS, s conversion.Scope) error {
 	out.CertFile = in.CertFile
 	out.PrivateKeyFile = in.PrivateKeyFile
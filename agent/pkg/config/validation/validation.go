@@ -17,8 +17,13 @@ limitations under the License.
 package validation
 
 import (
+	"net"
+	"path/filepath"
+	"strings"
+
 	"k8s.io/apimachinery/pkg/util/validation/field"
 
+	"k3f.io/kubeforce/agent/pkg/ansible"
 	"k3f.io/kubeforce/agent/pkg/config"
 )
 
@@ -32,10 +37,34 @@ func validateConfigSpec(s *config.ConfigSpec, fieldPath *field.Path) field.Error
 	if s.Port == 0 {
 		allErrs = append(allErrs, field.Required(fieldPath.Child("port"), "cannot be zero"))
 	}
+	for i, addr := range s.BindAddresses {
+		if net.ParseIP(addr) == nil {
+			allErrs = append(allErrs, field.Invalid(fieldPath.Child("bindAddresses").Index(i), addr, "must be a valid IP address"))
+		}
+	}
 	if s.PlaybookPath == "" {
 		allErrs = append(allErrs, field.Required(fieldPath.Child("playbookPath"), "cannot be empty"))
 	}
-	allErrs = append(allErrs, validateEtcdConfig(&s.Etcd, fieldPath.Child("etcd"))...)
+	switch s.GetStorageBackend() {
+	case config.StorageBackendEtcd:
+		allErrs = append(allErrs, validateEtcdConfig(&s.Etcd, fieldPath.Child("etcd"))...)
+	case config.StorageBackendFile:
+		if s.Storage.Path == "" {
+			allErrs = append(allErrs, field.Required(fieldPath.Child("storage", "path"), "must not be empty"))
+		}
+	default:
+		allErrs = append(allErrs, field.NotSupported(fieldPath.Child("storage", "backend"), s.Storage.Backend,
+			[]string{string(config.StorageBackendEtcd), string(config.StorageBackendFile)}))
+	}
+	if s.Ansible != nil {
+		allErrs = append(allErrs, validateAnsible(s.Ansible, fieldPath.Child("ansible"))...)
+	}
+	if s.Encryption != nil {
+		allErrs = append(allErrs, validateEncryption(s, fieldPath.Child("encryption"))...)
+	}
+	if s.LocalSocket != nil {
+		allErrs = append(allErrs, validateLocalSocket(s.LocalSocket, fieldPath.Child("localSocket"))...)
+	}
 	allErrs = append(allErrs, validateTLS(&s.TLS, fieldPath.Child("tls"))...)
 	allErrs = append(allErrs, validateAuthentication(&s.Authentication, fieldPath.Child("authentication"))...)
 	return allErrs
@@ -52,6 +81,66 @@ func validateTLS(c *config.TLS, fieldPath *field.Path) field.ErrorList {
 	return allErrs
 }
 
+func validateLocalSocket(c *config.LocalSocketConfig, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if c.Path != "" && !filepath.IsAbs(c.Path) {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("path"), c.Path, "must be an absolute path"))
+	}
+	if c.Mode != nil && (*c.Mode < 0 || *c.Mode > 0o777) {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("mode"), *c.Mode, "must be a number between 0 and 0777 (octal)"))
+	}
+	return allErrs
+}
+
+func validateAnsible(c *config.AnsibleConfig, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if c.Version != "" && !ansible.IsValidVersion(c.Version) {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("version"), c.Version, "must be a valid version of ansible-core"))
+	}
+	if c.Dir != "" && !filepath.IsAbs(c.Dir) {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("dir"), c.Dir, "must be an absolute path"))
+	}
+	return allErrs
+}
+
+func validateEncryption(s *config.ConfigSpec, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	c := s.Encryption
+	switch c.GetProvider() {
+	case config.EncryptionProviderAESCBC, config.EncryptionProviderSecretbox:
+	default:
+		allErrs = append(allErrs, field.NotSupported(fieldPath.Child("provider"), c.Provider,
+			[]string{string(config.EncryptionProviderAESCBC), string(config.EncryptionProviderSecretbox)}))
+	}
+	configFile := c.GetConfigFile()
+	if !filepath.IsAbs(configFile) {
+		return append(allErrs, field.Invalid(fieldPath.Child("configFile"), configFile, "must be an absolute path"))
+	}
+	// the keys must not be stored together with the encrypted data
+	dataDirs := []string{s.Etcd.DataDir, s.PlaybookPath}
+	if s.Etcd.Maintenance != nil {
+		dataDirs = append(dataDirs, s.Etcd.Maintenance.SnapshotDir)
+	}
+	if s.GetStorageBackend() == config.StorageBackendFile && s.Storage.Path != "" {
+		dataDirs = append(dataDirs, filepath.Dir(s.Storage.Path))
+	}
+	for _, dir := range dataDirs {
+		if dir != "" && isInsideDir(configFile, dir) {
+			allErrs = append(allErrs, field.Invalid(fieldPath.Child("configFile"), configFile, "must be outside the directory "+dir))
+		}
+	}
+	return allErrs
+}
+
+// isInsideDir returns true if the path is the directory or is inside it.
+func isInsideDir(path, dir string) bool {
+	rel, err := filepath.Rel(filepath.Clean(dir), filepath.Clean(path))
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
 func validateEtcdConfig(c *config.EtcdConfig, fieldPath *field.Path) field.ErrorList {
 	allErrs := field.ErrorList{}
 	if c.DataDir == "" {
@@ -60,6 +149,31 @@ func validateEtcdConfig(c *config.EtcdConfig, fieldPath *field.Path) field.Error
 	if c.CertsDir == "" {
 		allErrs = append(allErrs, field.Required(fieldPath.Child("certsDir"), "must not be empty"))
 	}
+	if c.QuotaBackendBytes < 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("quotaBackendBytes"), c.QuotaBackendBytes, "must not be negative"))
+	}
+	if c.Maintenance != nil {
+		allErrs = append(allErrs, validateEtcdMaintenance(c.Maintenance, fieldPath.Child("maintenance"))...)
+	}
+	return allErrs
+}
+
+func validateEtcdMaintenance(m *config.EtcdMaintenance, fieldPath *field.Path) field.ErrorList {
+	allErrs := field.ErrorList{}
+	switch m.AutoCompactionMode {
+	case "", "periodic", "revision":
+	default:
+		allErrs = append(allErrs, field.NotSupported(fieldPath.Child("autoCompactionMode"), m.AutoCompactionMode, []string{"periodic", "revision"}))
+	}
+	if m.DefragInterval != nil && m.DefragInterval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("defragInterval"), m.DefragInterval.Duration.String(), "must not be negative"))
+	}
+	if m.SnapshotInterval != nil && m.SnapshotInterval.Duration < 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("snapshotInterval"), m.SnapshotInterval.Duration.String(), "must not be negative"))
+	}
+	if m.SnapshotRetention < 0 {
+		allErrs = append(allErrs, field.Invalid(fieldPath.Child("snapshotRetention"), m.SnapshotRetention, "must not be negative"))
+	}
 	return allErrs
 }
 
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package validation
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	"k3f.io/kubeforce/agent/pkg/config"
+)
+
+func TestValidateEncryption(t *testing.T) {
+	tests := []struct {
+		name       string
+		configFile string
+		storage    *config.StorageConfig
+		wantErr    bool
+	}{
+		{
+			name:       "default config file",
+			configFile: config.DefaultEncryptionConfigFile,
+		},
+		{
+			name:       "relative config file",
+			configFile: "encryption/config.yaml",
+			wantErr:    true,
+		},
+		{
+			name:       "config file in the etcd data directory",
+			configFile: "/var/lib/kubeforce/etcd/encryption.yaml",
+			wantErr:    true,
+		},
+		{
+			name:       "config file in the playbook directory",
+			configFile: "/var/lib/kubeforce/playbooks/encryption.yaml",
+			wantErr:    true,
+		},
+		{
+			name:       "config file next to the database file",
+			configFile: "/var/lib/kubeforce/db/encryption.yaml",
+			storage:    &config.StorageConfig{Backend: config.StorageBackendFile, Path: "/var/lib/kubeforce/db/agent.db"},
+			wantErr:    true,
+		},
+		{
+			name:       "config file outside the directory of the database file",
+			configFile: config.DefaultEncryptionConfigFile,
+			storage:    &config.StorageConfig{Backend: config.StorageBackendFile, Path: "/var/lib/kubeforce/db/agent.db"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			s := &config.ConfigSpec{
+				PlaybookPath: "/var/lib/kubeforce/playbooks",
+				Etcd:         config.EtcdConfig{DataDir: "/var/lib/kubeforce/etcd"},
+				Storage:      tt.storage,
+				Encryption:   &config.EncryptionConfig{ConfigFile: tt.configFile},
+			}
+			errs := validateEncryption(s, field.NewPath("spec", "encryption"))
+			if tt.wantErr {
+				g.Expect(errs).NotTo(BeEmpty())
+			} else {
+				g.Expect(errs).To(BeEmpty())
+			}
+		})
+	}
+}
@@ -22,6 +22,7 @@ limitations under the License.
 package config
 
 import (
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
@@ -63,6 +64,22 @@ func (in *AgentX509Authentication) DeepCopy() *AgentX509Authentication {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnsibleConfig) DeepCopyInto(out *AnsibleConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnsibleConfig.
+func (in *AnsibleConfig) DeepCopy() *AnsibleConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(AnsibleConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Config) DeepCopyInto(out *Config) {
 	*out = *in
@@ -92,10 +109,35 @@ func (in *Config) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ConfigSpec) DeepCopyInto(out *ConfigSpec) {
 	*out = *in
+	if in.BindAddresses != nil {
+		in, out := &in.BindAddresses, &out.BindAddresses
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	in.TLS.DeepCopyInto(&out.TLS)
 	in.Authentication.DeepCopyInto(&out.Authentication)
 	out.ShutdownGracePeriod = in.ShutdownGracePeriod
-	out.Etcd = in.Etcd
+	in.Etcd.DeepCopyInto(&out.Etcd)
+	if in.Storage != nil {
+		in, out := &in.Storage, &out.Storage
+		*out = new(StorageConfig)
+		**out = **in
+	}
+	if in.LocalSocket != nil {
+		in, out := &in.LocalSocket, &out.LocalSocket
+		*out = new(LocalSocketConfig)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Ansible != nil {
+		in, out := &in.Ansible, &out.Ansible
+		*out = new(AnsibleConfig)
+		**out = **in
+	}
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(EncryptionConfig)
+		**out = **in
+	}
 	return
 }
 
@@ -109,9 +151,30 @@ func (in *ConfigSpec) DeepCopy() *ConfigSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EncryptionConfig) DeepCopyInto(out *EncryptionConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EncryptionConfig.
+func (in *EncryptionConfig) DeepCopy() *EncryptionConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(EncryptionConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *EtcdConfig) DeepCopyInto(out *EtcdConfig) {
 	*out = *in
+	if in.Maintenance != nil {
+		in, out := &in.Maintenance, &out.Maintenance
+		*out = new(EtcdMaintenance)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -125,6 +188,69 @@ func (in *EtcdConfig) DeepCopy() *EtcdConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EtcdMaintenance) DeepCopyInto(out *EtcdMaintenance) {
+	*out = *in
+	if in.DefragInterval != nil {
+		in, out := &in.DefragInterval, &out.DefragInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.SnapshotInterval != nil {
+		in, out := &in.SnapshotInterval, &out.SnapshotInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EtcdMaintenance.
+func (in *EtcdMaintenance) DeepCopy() *EtcdMaintenance {
+	if in == nil {
+		return nil
+	}
+	out := new(EtcdMaintenance)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LocalSocketConfig) DeepCopyInto(out *LocalSocketConfig) {
+	*out = *in
+	if in.Mode != nil {
+		in, out := &in.Mode, &out.Mode
+		*out = new(int32)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LocalSocketConfig.
+func (in *LocalSocketConfig) DeepCopy() *LocalSocketConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(LocalSocketConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *StorageConfig) DeepCopyInto(out *StorageConfig) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new StorageConfig.
+func (in *StorageConfig) DeepCopy() *StorageConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(StorageConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TLS) DeepCopyInto(out *TLS) {
 	*out = *in
@@ -0,0 +1,132 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+)
+
+const (
+	defaultArtifactsCollectionInterval = 10 * time.Minute
+	// defaultArtifactsGracePeriod protects the artifacts that are uploaded before the playbook is created.
+	defaultArtifactsGracePeriod = time.Hour
+)
+
+// ArtifactsCollector removes the artifacts that are not referenced by the playbooks and the playbook deployments.
+type ArtifactsCollector struct {
+	ArtifactsPath string
+	Client        client.Reader
+	Log           logr.Logger
+	// Interval is the period of the collection. Defaults to 10 minutes.
+	Interval time.Duration
+	// GracePeriod is the minimal age of the unreferenced artifact to be removed. Defaults to 1 hour.
+	GracePeriod time.Duration
+}
+
+// Start runs the collection periodically until the context is done.
+func (c *ArtifactsCollector) Start(ctx context.Context) error {
+	interval := c.Interval
+	if interval == 0 {
+		interval = defaultArtifactsCollectionInterval
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.Collect(ctx, time.Now()); err != nil {
+			c.Log.Error(err, "unable to remove the unused artifacts")
+		}
+	}, interval)
+	return nil
+}
+
+// Collect removes the unreferenced artifacts that are older than the grace period.
+func (c *ArtifactsCollector) Collect(ctx context.Context, now time.Time) error {
+	gracePeriod := c.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = defaultArtifactsGracePeriod
+	}
+	entries, err := os.ReadDir(c.ArtifactsPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.WithStack(err)
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+	used, err := c.referencedArtifacts(ctx)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() || used.Has(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return errors.WithStack(err)
+		}
+		if now.Sub(info.ModTime()) < gracePeriod {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.ArtifactsPath, e.Name())); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+		c.Log.Info("the unused artifact has been removed", "artifact", e.Name())
+	}
+	return nil
+}
+
+// referencedArtifacts returns the artifacts of the binary files of all playbooks and playbook deployments.
+func (c *ArtifactsCollector) referencedArtifacts(ctx context.Context) (sets.String, error) {
+	result := sets.NewString()
+	addFiles := func(files []v1alpha1.PlaybookFile) {
+		for _, f := range files {
+			if f.Artifact != "" {
+				result.Insert(f.Artifact)
+			}
+		}
+	}
+	playbooks := &v1alpha1.PlaybookList{}
+	if err := c.Client.List(ctx, playbooks); err != nil {
+		return nil, errors.Wrap(err, "unable to list playbooks")
+	}
+	for _, pb := range playbooks.Items {
+		addFiles(pb.Spec.BinaryFiles)
+	}
+	deployments := &v1alpha1.PlaybookDeploymentList{}
+	if err := c.Client.List(ctx, deployments); err != nil {
+		return nil, errors.Wrap(err, "unable to list playbook deployments")
+	}
+	for _, pd := range deployments.Items {
+		addFiles(pd.Spec.Template.Spec.BinaryFiles)
+	}
+	return result, nil
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+	"k3f.io/kubeforce/agent/pkg/apiserver"
+)
+
+func TestArtifactsCollector(t *testing.T) {
+	g := NewWithT(t)
+	now := time.Now()
+	dir := t.TempDir()
+	writeArtifact := func(name string, age time.Duration) {
+		path := filepath.Join(dir, name)
+		g.Expect(os.WriteFile(path, []byte(name), 0o600)).To(Succeed())
+		g.Expect(os.Chtimes(path, now.Add(-age), now.Add(-age))).To(Succeed())
+	}
+	writeArtifact("playbook", 2*time.Hour)
+	writeArtifact("deployment", 2*time.Hour)
+	writeArtifact("unused", 2*time.Hour)
+	writeArtifact("uploaded", time.Minute)
+
+	pb := &v1alpha1.Playbook{
+		ObjectMeta: metav1.ObjectMeta{Name: "pb", Namespace: "default"},
+		Spec: v1alpha1.PlaybookSpec{
+			BinaryFiles: []v1alpha1.PlaybookFile{{Path: "files/a.tar.gz", Artifact: "playbook", SHA256: "playbook"}},
+		},
+	}
+	pd := &v1alpha1.PlaybookDeployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "pd", Namespace: "default"},
+		Spec: v1alpha1.PlaybookDeploymentSpec{
+			Template: v1alpha1.PlaybookTemplateSpec{
+				Spec: v1alpha1.PlaybookSpec{
+					BinaryFiles: []v1alpha1.PlaybookFile{{Path: "files/b.tar.gz", Artifact: "deployment", SHA256: "deployment"}},
+				},
+			},
+		},
+	}
+	c := &ArtifactsCollector{
+		ArtifactsPath: dir,
+		Client:        fake.NewClientBuilder().WithScheme(apiserver.Scheme).WithObjects(pb, pd).Build(),
+		Log:           ctrl.Log,
+	}
+	g.Expect(c.Collect(context.Background(), now)).To(Succeed())
+
+	entries, err := os.ReadDir(dir)
+	g.Expect(err).NotTo(HaveOccurred())
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	g.Expect(names).To(ConsistOf("playbook", "deployment", "uploaded"))
+}
@@ -22,6 +22,7 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/apenella/go-ansible/pkg/execute"
@@ -39,6 +40,7 @@ import (
 
 	"k3f.io/kubeforce/agent/pkg/ansible"
 	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+	"k3f.io/kubeforce/agent/pkg/systemd"
 	"k3f.io/kubeforce/agent/pkg/util/conditions"
 )
 
@@ -61,8 +63,14 @@ var _ inject.Client = &PlaybookReconciler{}
 // PlaybookReconciler reconciles a Playbook objects.
 type PlaybookReconciler struct {
 	PlaybookPath string
-	Client       client.Client
-	Log          logr.Logger
+	// ArtifactsPath is the directory of the artifacts referenced by the binary files of the playbooks.
+	ArtifactsPath string
+	Client        client.Client
+	Log           logr.Logger
+	// Units manages the systemd units of the playbooks in the SystemdUnit execution mode.
+	Units systemd.UnitManager
+	// Runtimes manages the ansible runtimes of the playbooks.
+	Runtimes ansible.RuntimeManager
 }
 
 // InjectClient set client to the PlaybookReconciler.
@@ -113,6 +121,13 @@ func (r *PlaybookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (r
 	}()
 
 	if conditions.IsTrue(pb, v1alpha1.PlaybookExecutionCondition) || conditions.IsTrue(pb, v1alpha1.PlaybookFailedCondition) {
+		if pb.Status.Phase == v1alpha1.PlaybookSucceeded && pb.Spec.Policy.PurgeFilesAfterSuccess {
+			// the files are purged after the status of the succeeded playbook has been updated
+			if err := r.purgePlaybookFiles(pb); err != nil {
+				return ctrl.Result{}, err
+			}
+			return ctrl.Result{}, r.purgeArtifacts(ctx, pb)
+		}
 		return ctrl.Result{}, nil
 	}
 	if pb.Status.Failed >= *pb.Spec.Policy.BackoffLimit {
@@ -141,8 +156,7 @@ func (r *PlaybookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (r
 	}
 
 	if pb.Status.Phase == v1alpha1.PlaybookPending {
-		helper := ansible.GetHelper()
-		if err := helper.EnsureAnsible(ctx); err != nil {
+		if err := r.Runtimes.EnsureRuntime(ctx, pb.Spec.AnsibleVersion); err != nil {
 			pb.Status.Phase = v1alpha1.PlaybookFailed
 			pb.Status.Failed++
 			conditions.MarkFalse(
@@ -150,12 +164,28 @@ func (r *PlaybookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (r
 				v1alpha1.PlaybookExecutionCondition,
 				v1alpha1.PlaybookPreparationFailedReason,
 				err.Error())
+			r.Log.Error(err, "failed to prepare the ansible runtime", "req", req)
+			return ctrl.Result{}, nil
+		}
+		if err := r.installRequirements(ctx, pb); err != nil {
+			pb.Status.Phase = v1alpha1.PlaybookFailed
+			pb.Status.Failed++
+			conditions.MarkFalse(
+				pb,
+				v1alpha1.PlaybookExecutionCondition,
+				v1alpha1.RequirementsInstallationFailedReason,
+				err.Error())
+			r.Log.Error(err, "failed to install the playbook requirements", "req", req)
+			return ctrl.Result{}, nil
 		}
 		pb.Status.Phase = v1alpha1.PlaybookRunning
 		return ctrl.Result{}, nil
 	}
 
 	if pb.Status.Phase == v1alpha1.PlaybookRunning {
+		if pb.Spec.Policy.ExecutionMode == v1alpha1.ExecutionModeSystemdUnit {
+			return r.reconcileUnit(ctx, pb)
+		}
 		err := r.runPlaybook(ctx, pb)
 		if err != nil {
 			pb.Status.Phase = v1alpha1.PlaybookFailed
@@ -177,6 +207,12 @@ func (r *PlaybookReconciler) Reconcile(ctx context.Context, req ctrl.Request) (r
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *PlaybookReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	if r.Units == nil {
+		r.Units = systemd.NewUnitManager()
+	}
+	if r.Runtimes == nil {
+		r.Runtimes = ansible.NewRuntimeManager(nil)
+	}
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&v1alpha1.Playbook{}).
 		Complete(r)
@@ -186,11 +222,20 @@ func (r *PlaybookReconciler) reconcileDelete(ctx context.Context, pb *v1alpha1.P
 	if !controllerutil.ContainsFinalizer(pb, PlaybookFinalizer) {
 		return ctrl.Result{}, nil
 	}
+	// the running playbook must not outlive its directory
+	if pb.Status.Unit != "" {
+		if err := r.removeUnit(ctx, pb.Status.Unit); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 	dir := filepath.Join(r.PlaybookPath, pb.Name)
 	err := os.RemoveAll(dir)
 	if err != nil {
 		r.Log.Error(err, "unable to remove root directory", "playbook", pb.Name, "dir", dir)
 	}
+	if err := r.purgeArtifacts(ctx, pb); err != nil {
+		r.Log.Error(err, "unable to remove the artifacts", "playbook", pb.Name)
+	}
 	oldPb := pb.DeepCopy()
 	controllerutil.RemoveFinalizer(pb, PlaybookFinalizer)
 	if err := r.Client.Patch(ctx, pb, client.MergeFrom(oldPb)); err != nil {
@@ -200,31 +245,12 @@ func (r *PlaybookReconciler) reconcileDelete(ctx context.Context, pb *v1alpha1.P
 }
 
 func (r *PlaybookReconciler) runPlaybook(ctx context.Context, pb *v1alpha1.Playbook) error {
-	err := os.MkdirAll(filepath.Join(r.PlaybookPath, pb.Name, "logs"), 0700)
-	if err != nil {
+	if err := r.writePlaybookFiles(pb); err != nil {
 		return err
 	}
-	for key, data := range pb.Spec.Files {
-		filename := filepath.Join(r.PlaybookPath, pb.Name, key)
-		err := os.MkdirAll(filepath.Dir(filename), 0700)
-		if err != nil {
-			return err
-		}
-		err = os.WriteFile(filename, []byte(data), 0600)
-		if err != nil {
-			return err
-		}
-	}
-	ansiblePlaybookConnectionOptions := &options.AnsibleConnectionOptions{
-		Connection: "local",
-	}
-	ansiblePlaybookOptions := &playbook.AnsiblePlaybookOptions{
-		Inventory: "127.0.0.1,",
-	}
-	now := time.Now()
-	logFilename := now.Format("2006_01_02T15_04_05") + ".log"
-	logFilePath := filepath.Join(r.PlaybookPath, pb.Name, "logs", logFilename)
-	f, err := os.Create(filepath.Clean(logFilePath))
+	logFilePath := r.newLogFilePath(pb)
+	// the output of the playbook may contain secrets
+	f, err := os.OpenFile(filepath.Clean(logFilePath), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
 	if err != nil {
 		return errors.Wrapf(err, "unable to create file %s", logFilePath)
 	}
@@ -235,11 +261,10 @@ func (r *PlaybookReconciler) runPlaybook(ctx context.Context, pb *v1alpha1.Playb
 		execute.WithCmdRunDir(filepath.Join(r.PlaybookPath, pb.Name)),
 	)
 
-	cmd := &playbook.AnsiblePlaybookCmd{
-		Playbooks:         []string{filepath.Join(r.PlaybookPath, pb.Name, pb.Spec.Entrypoint)},
-		ConnectionOptions: ansiblePlaybookConnectionOptions,
-		Options:           ansiblePlaybookOptions,
-		Exec:              exec,
+	cmd := r.playbookCmd(pb)
+	cmd.Exec = &envExecutor{
+		Executor: exec,
+		env:      r.playbookEnv(pb),
 	}
 	ctx, cancelFunc := context.WithTimeout(ctx, pb.Spec.Policy.Timeout.Duration)
 	defer cancelFunc()
@@ -254,6 +279,100 @@ func (r *PlaybookReconciler) runPlaybook(ctx context.Context, pb *v1alpha1.Playb
 	return nil
 }
 
+// writePlaybookFiles writes the files of the playbook to the playbook directory.
+// The files may contain secrets, so they are accessible only by the owner.
+func (r *PlaybookReconciler) writePlaybookFiles(pb *v1alpha1.Playbook) error {
+	dir := filepath.Join(r.PlaybookPath, pb.Name)
+	err := os.MkdirAll(filepath.Join(dir, playbookLogsDir), 0700)
+	if err != nil {
+		return err
+	}
+	// the directory could be created with other permissions by the previous versions of the agent
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+	for key, data := range pb.Spec.Files {
+		filename := filepath.Join(dir, key)
+		if err := writeFileChecked(filename, strings.NewReader(data), "", 0600); err != nil {
+			return err
+		}
+	}
+	for i := range pb.Spec.BinaryFiles {
+		if err := r.writeBinaryFile(&pb.Spec.BinaryFiles[i], filepath.Join(r.PlaybookPath, pb.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newLogFilePath returns the path of the log file for the new attempt of the playbook.
+func (r *PlaybookReconciler) newLogFilePath(pb *v1alpha1.Playbook) string {
+	logFilename := time.Now().Format("2006_01_02T15_04_05") + ".log"
+	return filepath.Join(r.PlaybookPath, pb.Name, playbookLogsDir, logFilename)
+}
+
+func (r *PlaybookReconciler) playbookCmd(pb *v1alpha1.Playbook) *playbook.AnsiblePlaybookCmd {
+	ansiblePlaybookConnectionOptions := &options.AnsibleConnectionOptions{
+		Connection: "local",
+	}
+	ansiblePlaybookOptions := &playbook.AnsiblePlaybookOptions{
+		Inventory: "127.0.0.1,",
+	}
+	cmd := &playbook.AnsiblePlaybookCmd{
+		Playbooks:         []string{filepath.Join(r.PlaybookPath, pb.Name, pb.Spec.Entrypoint)},
+		ConnectionOptions: ansiblePlaybookConnectionOptions,
+		Options:           ansiblePlaybookOptions,
+	}
+	if r.Runtimes != nil {
+		cmd.Binary = r.Runtimes.PlaybookBinary(pb.Spec.AnsibleVersion)
+	}
+	return cmd
+}
+
+// RecoverInterruptedPlaybooks marks the playbooks that were running when the previous agent process died.
+// The interrupted attempt moves the playbook to the Unknown phase and the playbook is started again
+// according to the backoff policy. It must be called before the PlaybookReconciler is started.
+func RecoverInterruptedPlaybooks(ctx context.Context, reader client.Reader, writer client.StatusClient, log logr.Logger) error {
+	list := &v1alpha1.PlaybookList{}
+	if err := reader.List(ctx, list); err != nil {
+		return errors.Wrap(err, "unable to list playbooks")
+	}
+	var errs []error
+	for i := range list.Items {
+		pb := &list.Items[i]
+		if pb.Status.Phase != v1alpha1.PlaybookRunning || !pb.DeletionTimestamp.IsZero() {
+			continue
+		}
+		// the systemd unit survives the agent restart, the reconciler checks its state
+		if pb.Spec.Policy != nil && pb.Spec.Policy.ExecutionMode == v1alpha1.ExecutionModeSystemdUnit {
+			continue
+		}
+		oldPb := pb.DeepCopy()
+		markInterrupted(pb)
+		if err := writer.Status().Patch(ctx, pb, client.MergeFrom(oldPb)); err != nil {
+			errs = append(errs, errors.Wrapf(err, "unable to patch playbook %s", pb.Name))
+			continue
+		}
+		log.Info("playbook has been interrupted by the agent restart", "playbook", pb.Name,
+			"interrupted", pb.Status.Interrupted, "failed", pb.Status.Failed)
+	}
+	return kerrors.NewAggregate(errs)
+}
+
+// markInterrupted records the attempt interrupted by the agent restart.
+func markInterrupted(pb *v1alpha1.Playbook) {
+	pb.Status.Phase = v1alpha1.PlaybookUnknown
+	pb.Status.Interrupted++
+	if pb.Spec.Policy == nil || pb.Spec.Policy.CountAgentRestarts == nil || *pb.Spec.Policy.CountAgentRestarts {
+		pb.Status.Failed++
+	}
+	conditions.MarkFalse(
+		pb,
+		v1alpha1.PlaybookExecutionCondition,
+		v1alpha1.AgentRestartedReason,
+		"the playbook execution has been interrupted by the agent restart")
+}
+
 func getBackoff(exp int32) time.Duration {
 	if exp <= 0 {
 		return time.Duration(0)
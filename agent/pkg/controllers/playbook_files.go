@@ -0,0 +1,143 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+)
+
+// playbookLogsDir is the directory of the log files in the playbook directory.
+const playbookLogsDir = "logs"
+
+// purgePlaybookFiles deletes the files of the playbook from the disk, the logs are kept.
+func (r *PlaybookReconciler) purgePlaybookFiles(pb *v1alpha1.Playbook) error {
+	dir := filepath.Join(r.PlaybookPath, pb.Name)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if e.Name() == playbookLogsDir {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dir, e.Name())); err != nil {
+			return errors.Wrapf(err, "unable to purge the files of the playbook %s", pb.Name)
+		}
+	}
+	return nil
+}
+
+// purgeArtifacts deletes the artifacts of the playbook that are not required by the other playbooks
+// that have not succeeded yet. The artifacts may contain secrets, e.g. the variables of the playbook.
+// The clients upload the artifacts again before they create a playbook that refers to them.
+func (r *PlaybookReconciler) purgeArtifacts(ctx context.Context, pb *v1alpha1.Playbook) error {
+	if r.ArtifactsPath == "" {
+		return nil
+	}
+	artifacts := sets.NewString()
+	for _, f := range pb.Spec.BinaryFiles {
+		if f.Artifact != "" {
+			artifacts.Insert(f.Artifact)
+		}
+	}
+	if artifacts.Len() == 0 {
+		return nil
+	}
+	playbooks := &v1alpha1.PlaybookList{}
+	if err := r.Client.List(ctx, playbooks); err != nil {
+		return errors.Wrap(err, "unable to list playbooks")
+	}
+	for _, other := range playbooks.Items {
+		if other.UID == pb.UID || other.Status.Phase == v1alpha1.PlaybookSucceeded {
+			continue
+		}
+		for _, f := range other.Spec.BinaryFiles {
+			artifacts.Delete(f.Artifact)
+		}
+	}
+	for _, name := range artifacts.List() {
+		err := os.Remove(filepath.Join(r.ArtifactsPath, filepath.Base(name)))
+		if err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "unable to purge the artifact %s of the playbook %s", name, pb.Name)
+		}
+	}
+	return nil
+}
+
+// writeBinaryFile writes the content or the artifact of the binary file to the playbook directory.
+// The checksum of the content is verified if it is specified.
+func (r *PlaybookReconciler) writeBinaryFile(f *v1alpha1.PlaybookFile, dir string) error {
+	filename := filepath.Join(dir, filepath.Clean(f.Path))
+	mode := os.FileMode(0o600)
+	if f.Mode != nil {
+		mode = os.FileMode(*f.Mode)
+	}
+	if f.Artifact == "" {
+		return writeFileChecked(filename, bytes.NewReader(f.Content), f.SHA256, mode)
+	}
+	if r.ArtifactsPath == "" {
+		return errors.Errorf("unable to write file %s, the artifacts directory is not configured", f.Path)
+	}
+	src, err := os.Open(filepath.Join(r.ArtifactsPath, filepath.Base(f.Artifact)))
+	if err != nil {
+		return errors.Wrapf(err, "unable to open artifact %s of file %s", f.Artifact, f.Path)
+	}
+	defer src.Close()
+	return writeFileChecked(filename, src, f.SHA256, mode)
+}
+
+// writeFileChecked writes the content to the file if its SHA-256 checksum matches the expected checksum.
+// The file is not changed if the checksum does not match.
+func writeFileChecked(filename string, content io.Reader, checksum string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0o700); err != nil {
+		return err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	defer tmpFile.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tmpFile, hash), content); err != nil {
+		return errors.Wrapf(err, "unable to write file %s", filename)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); checksum != "" && actual != checksum {
+		return errors.Errorf("checksum of file %s does not match, expected: %s, actual: %s", filename, checksum, actual)
+	}
+	if err := tmpFile.Chmod(mode); err != nil {
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
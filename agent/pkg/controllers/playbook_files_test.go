@@ -0,0 +1,185 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+	"k3f.io/kubeforce/agent/pkg/apiserver"
+)
+
+func TestWriteBinaryFile(t *testing.T) {
+	content := []byte{0x1f, 0x8b, 0x08, 0x00, 0xff}
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	executable := int32(0o755)
+	tests := []struct {
+		name     string
+		file     v1alpha1.PlaybookFile
+		wantMode os.FileMode
+		wantErr  bool
+	}{
+		{
+			name:     "inline content",
+			file:     v1alpha1.PlaybookFile{Path: "files/archive.tar.gz", Content: content},
+			wantMode: 0o600,
+		},
+		{
+			name:     "inline content with checksum and mode",
+			file:     v1alpha1.PlaybookFile{Path: "bin/tool", Content: content, SHA256: checksum, Mode: &executable},
+			wantMode: 0o755,
+		},
+		{
+			name:    "inline content with wrong checksum",
+			file:    v1alpha1.PlaybookFile{Path: "files/archive.tar.gz", Content: []byte("other"), SHA256: checksum},
+			wantErr: true,
+		},
+		{
+			name:     "artifact",
+			file:     v1alpha1.PlaybookFile{Path: "files/archive.tar.gz", Artifact: checksum, SHA256: checksum},
+			wantMode: 0o600,
+		},
+		{
+			name:    "artifact is not uploaded",
+			file:    v1alpha1.PlaybookFile{Path: "files/archive.tar.gz", Artifact: "missing", SHA256: checksum},
+			wantErr: true,
+		},
+		{
+			name:    "artifact with wrong checksum",
+			file:    v1alpha1.PlaybookFile{Path: "files/archive.tar.gz", Artifact: checksum, SHA256: hex.EncodeToString(make([]byte, 32))},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			r := &PlaybookReconciler{
+				PlaybookPath:  t.TempDir(),
+				ArtifactsPath: t.TempDir(),
+			}
+			g.Expect(os.WriteFile(filepath.Join(r.ArtifactsPath, checksum), content, 0o600)).To(Succeed())
+			dir := filepath.Join(r.PlaybookPath, "test")
+			err := r.writeBinaryFile(&tt.file, dir)
+			filename := filepath.Join(dir, tt.file.Path)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(filename).NotTo(BeAnExistingFile())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			data, err := os.ReadFile(filename)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(data).To(Equal(content))
+			info, err := os.Stat(filename)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(info.Mode().Perm()).To(Equal(tt.wantMode))
+			entries, err := os.ReadDir(filepath.Dir(filename))
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(entries).To(HaveLen(1))
+		})
+	}
+}
+
+func TestWritePlaybookFiles(t *testing.T) {
+	g := NewWithT(t)
+	r := &PlaybookReconciler{
+		PlaybookPath: t.TempDir(),
+	}
+	pb := &v1alpha1.Playbook{
+		ObjectMeta: metav1.ObjectMeta{Name: "boot"},
+		Spec: v1alpha1.PlaybookSpec{
+			Files: map[string]string{
+				"site.yml":           simpePlaybook,
+				"vars/bootstrap.yml": "token: secret",
+			},
+			Entrypoint: "site.yml",
+			Policy: &v1alpha1.Policy{
+				PurgeFilesAfterSuccess: true,
+			},
+		},
+	}
+	dir := filepath.Join(r.PlaybookPath, pb.Name)
+	// the files written with loose permissions are fixed
+	g.Expect(os.MkdirAll(filepath.Join(dir, "vars"), 0o755)).To(Succeed())
+	g.Expect(os.Chmod(dir, 0o755)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "vars", "bootstrap.yml"), []byte("old"), 0o644)).To(Succeed())
+
+	g.Expect(r.writePlaybookFiles(pb)).To(Succeed())
+	info, err := os.Stat(dir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o700)))
+	for name, content := range pb.Spec.Files {
+		filename := filepath.Join(dir, name)
+		data, err := os.ReadFile(filename)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(string(data)).To(Equal(content))
+		info, err := os.Stat(filename)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(info.Mode().Perm()).To(Equal(os.FileMode(0o600)))
+	}
+	logFile := r.newLogFilePath(pb)
+	g.Expect(os.WriteFile(logFile, []byte("ok"), 0o600)).To(Succeed())
+
+	g.Expect(r.purgePlaybookFiles(pb)).To(Succeed())
+	entries, err := os.ReadDir(dir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(entries).To(HaveLen(1))
+	g.Expect(entries[0].Name()).To(Equal(playbookLogsDir))
+	g.Expect(logFile).To(BeAnExistingFile())
+}
+
+func TestPurgeArtifacts(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	for _, name := range []string{"variables", "shared", "succeeded"} {
+		g.Expect(os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600)).To(Succeed())
+	}
+	newPlaybook := func(name string, phase v1alpha1.PlaybookPhase, artifacts ...string) *v1alpha1.Playbook {
+		pb := &v1alpha1.Playbook{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", UID: types.UID(name)},
+			Status:     v1alpha1.PlaybookStatus{Phase: phase},
+		}
+		for _, a := range artifacts {
+			pb.Spec.BinaryFiles = append(pb.Spec.BinaryFiles, v1alpha1.PlaybookFile{Path: a, Artifact: a, SHA256: a})
+		}
+		return pb
+	}
+	pb := newPlaybook("purged", v1alpha1.PlaybookSucceeded, "variables", "shared", "succeeded")
+	pending := newPlaybook("pending", v1alpha1.PlaybookPending, "shared")
+	succeeded := newPlaybook("succeeded", v1alpha1.PlaybookSucceeded, "succeeded")
+	r := &PlaybookReconciler{
+		ArtifactsPath: dir,
+		Client:        fake.NewClientBuilder().WithScheme(apiserver.Scheme).WithObjects(pb, pending, succeeded).Build(),
+	}
+	g.Expect(r.purgeArtifacts(context.Background(), pb)).To(Succeed())
+
+	entries, err := os.ReadDir(dir)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(entries).To(HaveLen(1))
+	g.Expect(entries[0].Name()).To(Equal("shared"))
+}
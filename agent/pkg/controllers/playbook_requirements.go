@@ -0,0 +1,147 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/apenella/go-ansible/pkg/execute"
+	"github.com/apenella/go-ansible/pkg/stdoutcallback"
+
+	"k3f.io/kubeforce/agent/pkg/ansible"
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+)
+
+// requirementsCacheDir is the directory in the PlaybookPath for the installed requirements of the playbooks.
+// It cannot conflict with the directories of the playbooks because their names cannot start with a dot.
+const requirementsCacheDir = ".galaxy"
+
+// requirementsFile returns the name of the requirements file of ansible-galaxy in the playbook files.
+func requirementsFile(pb *v1alpha1.Playbook) string {
+	for _, name := range ansible.RequirementsFiles {
+		if _, ok := pb.Spec.Files[name]; ok {
+			return name
+		}
+	}
+	return ""
+}
+
+// requirementsDir returns the directory of the collections and roles of the playbook.
+// The playbooks with the same requirements and ansible version share the directory,
+// so the requirements are installed only once.
+// If the requirements refer to local files, the checksums of the playbook files are the part of the key,
+// so the requirements are installed again when the local tarballs or directories are changed.
+func (r *PlaybookReconciler) requirementsDir(pb *v1alpha1.Playbook) string {
+	name := requirementsFile(pb)
+	if name == "" {
+		return ""
+	}
+	// the requirements are installed by ansible-galaxy of the resolved version,
+	// so the directory is changed when the default version of the agent is changed
+	version := pb.Spec.AnsibleVersion
+	if r.Runtimes != nil {
+		version = r.Runtimes.Version(version)
+	}
+	h := sha256.New()
+	h.Write([]byte(version + "\n" + pb.Spec.Files[name]))
+	if local, err := ansible.HasLocalRequirements([]byte(pb.Spec.Files[name])); err == nil && local {
+		writePlaybookFilesDigest(h, pb)
+	}
+	return filepath.Join(r.PlaybookPath, requirementsCacheDir, hex.EncodeToString(h.Sum(nil)[:16]))
+}
+
+// writePlaybookFilesDigest writes the paths and the checksums of all playbook files in a stable order.
+func writePlaybookFilesDigest(w io.Writer, pb *v1alpha1.Playbook) {
+	checksums := make(map[string]string, len(pb.Spec.Files)+len(pb.Spec.BinaryFiles))
+	for name, content := range pb.Spec.Files {
+		sum := sha256.Sum256([]byte(content))
+		checksums[name] = hex.EncodeToString(sum[:])
+	}
+	for _, f := range pb.Spec.BinaryFiles {
+		checksum := f.SHA256
+		if checksum == "" {
+			sum := sha256.Sum256(f.Content)
+			checksum = hex.EncodeToString(sum[:])
+		}
+		checksums[f.Path] = checksum
+	}
+	paths := make([]string, 0, len(checksums))
+	for p := range checksums {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	for _, p := range paths {
+		fmt.Fprintf(w, "\n%s %s", p, checksums[p])
+	}
+}
+
+// installRequirements installs the collections and roles from the requirements file of the playbook.
+// The local sources in the requirements file are resolved relative to the playbook directory.
+func (r *PlaybookReconciler) installRequirements(ctx context.Context, pb *v1alpha1.Playbook) error {
+	dir := r.requirementsDir(pb)
+	if dir == "" {
+		return nil
+	}
+	if _, err := os.Stat(dir); err == nil {
+		return nil
+	}
+	if err := r.writePlaybookFiles(pb); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dir), 0o700); err != nil {
+		return err
+	}
+	playbookDir := filepath.Join(r.PlaybookPath, pb.Name)
+	galaxy := ansible.GalaxyBinary(r.Runtimes.PlaybookBinary(pb.Spec.AnsibleVersion))
+	err := ansible.InstallRequirements(ctx, ansible.CommandInDir(playbookDir), galaxy,
+		filepath.Join(playbookDir, requirementsFile(pb)), dir)
+	if err != nil {
+		return err
+	}
+	r.Log.Info("playbook requirements have been installed", "playbook", pb.Name, "dir", dir)
+	return nil
+}
+
+// playbookEnv returns the additional environment variables of the playbook process.
+func (r *PlaybookReconciler) playbookEnv(pb *v1alpha1.Playbook) []string {
+	dir := r.requirementsDir(pb)
+	if dir == "" {
+		return nil
+	}
+	return ansible.RequirementsEnv(dir)
+}
+
+// envExecutor executes the commands with the additional environment variables.
+type envExecutor struct {
+	execute.Executor
+	env []string
+}
+
+func (e *envExecutor) Execute(ctx context.Context, command []string, resultsFunc stdoutcallback.StdoutCallbackResultsFunc,
+	options ...execute.ExecuteOptions) error {
+	if len(e.env) > 0 {
+		command = append(append([]string{"env"}, e.env...), command...)
+	}
+	return e.Executor.Execute(ctx, command, resultsFunc, options...)
+}
@@ -22,11 +22,17 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-logr/logr"
 	. "github.com/onsi/gomega"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
 
+	"k3f.io/kubeforce/agent/pkg/ansible"
 	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+	"k3f.io/kubeforce/agent/pkg/apiserver"
+	"k3f.io/kubeforce/agent/pkg/config"
 	clientset "k3f.io/kubeforce/agent/pkg/generated/clientset/versioned"
 	"k3f.io/kubeforce/agent/pkg/util/conditions"
 )
@@ -138,3 +144,118 @@ func TestFailedPlaybook(t *testing.T) {
 		g.Expect(string(raw)).Should(ContainSubstring("custom error message"))
 	})
 }
+
+func TestRecoverInterruptedPlaybooks(t *testing.T) {
+	countRestarts := false
+	tests := []struct {
+		name            string
+		phase           v1alpha1.PlaybookPhase
+		policy          *v1alpha1.Policy
+		wantPhase       v1alpha1.PlaybookPhase
+		wantFailed      int32
+		wantInterrupted int32
+	}{
+		{
+			name:            "running playbook is counted as failed",
+			phase:           v1alpha1.PlaybookRunning,
+			wantPhase:       v1alpha1.PlaybookUnknown,
+			wantFailed:      1,
+			wantInterrupted: 1,
+		},
+		{
+			name:            "running playbook is not counted as failed",
+			phase:           v1alpha1.PlaybookRunning,
+			policy:          &v1alpha1.Policy{CountAgentRestarts: &countRestarts},
+			wantPhase:       v1alpha1.PlaybookUnknown,
+			wantFailed:      0,
+			wantInterrupted: 1,
+		},
+		{
+			name:      "succeeded playbook is not changed",
+			phase:     v1alpha1.PlaybookSucceeded,
+			wantPhase: v1alpha1.PlaybookSucceeded,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			pb := &v1alpha1.Playbook{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "interrupted",
+				},
+				Spec: v1alpha1.PlaybookSpec{
+					Policy: tt.policy,
+				},
+				Status: v1alpha1.PlaybookStatus{
+					Phase: tt.phase,
+				},
+			}
+			c := fake.NewClientBuilder().WithScheme(apiserver.Scheme).WithObjects(pb).Build()
+			g.Expect(RecoverInterruptedPlaybooks(context.Background(), c, c, logr.Discard())).To(Succeed())
+
+			got := &v1alpha1.Playbook{}
+			g.Expect(c.Get(context.Background(), client.ObjectKeyFromObject(pb), got)).To(Succeed())
+			g.Expect(got.Status.Phase).To(Equal(tt.wantPhase))
+			g.Expect(got.Status.Failed).To(Equal(tt.wantFailed))
+			g.Expect(got.Status.Interrupted).To(Equal(tt.wantInterrupted))
+			if tt.wantInterrupted > 0 {
+				cond := conditions.Get(got, v1alpha1.PlaybookExecutionCondition)
+				g.Expect(cond).NotTo(BeNil())
+				g.Expect(cond.Reason).To(Equal(v1alpha1.AgentRestartedReason))
+			}
+		})
+	}
+}
+
+func TestRequirementsDir(t *testing.T) {
+	g := NewWithT(t)
+	r := &PlaybookReconciler{
+		PlaybookPath: "/var/lib/kubeforce/playbooks",
+	}
+	newPlaybook := func(name string, files map[string]string) *v1alpha1.Playbook {
+		return &v1alpha1.Playbook{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Spec: v1alpha1.PlaybookSpec{
+				Files:      files,
+				Entrypoint: "site.yml",
+			},
+		}
+	}
+	requirements := "collections:\n- community.general\n"
+	pb1 := newPlaybook("first", map[string]string{"site.yml": simpePlaybook, "requirements.yml": requirements})
+	pb2 := newPlaybook("second", map[string]string{"site.yaml": simpePlaybook, "requirements.yml": requirements})
+	pb3 := newPlaybook("third", map[string]string{"site.yml": simpePlaybook, "requirements.yaml": "collections:\n- ansible.posix\n"})
+	noRequirements := newPlaybook("fourth", map[string]string{"site.yml": simpePlaybook})
+
+	dir := r.requirementsDir(pb1)
+	g.Expect(dir).To(HavePrefix("/var/lib/kubeforce/playbooks/.galaxy/"))
+	g.Expect(r.requirementsDir(pb2)).To(Equal(dir))
+	g.Expect(r.requirementsDir(pb3)).NotTo(Equal(dir))
+	g.Expect(r.requirementsDir(noRequirements)).To(BeEmpty())
+
+	// the requirements with local sources are installed again when the local files are changed
+	localRequirements := "collections:\n- name: ./ansible-posix-1.5.4.tar.gz\n  type: file\n"
+	local1 := newPlaybook("local1", map[string]string{"site.yml": simpePlaybook, "requirements.yml": localRequirements})
+	local1.Spec.BinaryFiles = []v1alpha1.PlaybookFile{{Path: "ansible-posix-1.5.4.tar.gz", Artifact: "posix", SHA256: "aaaa"}}
+	local2 := local1.DeepCopy()
+	local2.Name = "local2"
+	local3 := local1.DeepCopy()
+	local3.Name = "local3"
+	local3.Spec.BinaryFiles[0].SHA256 = "bbbb"
+	localDir := r.requirementsDir(local1)
+	g.Expect(r.requirementsDir(local2)).To(Equal(localDir))
+	g.Expect(r.requirementsDir(local3)).NotTo(Equal(localDir))
+
+	g.Expect(r.playbookEnv(pb1)).To(ContainElement(HavePrefix("ANSIBLE_COLLECTIONS_PATH=" + dir + "/collections:")))
+	g.Expect(r.playbookEnv(noRequirements)).To(BeEmpty())
+
+	// the playbook without the ansible version uses the default version of the runtime
+	r.Runtimes = ansible.NewRuntimeManager(&config.AnsibleConfig{Version: "2.14.1"})
+	defaultDir := r.requirementsDir(pb1)
+	pinned := pb1.DeepCopy()
+	pinned.Spec.AnsibleVersion = "2.14.1"
+	g.Expect(r.requirementsDir(pinned)).To(Equal(defaultDir))
+	r.Runtimes = ansible.NewRuntimeManager(&config.AnsibleConfig{Version: "2.15.0"})
+	g.Expect(r.requirementsDir(pb1)).NotTo(Equal(defaultDir))
+	g.Expect(r.requirementsDir(pinned)).To(Equal(defaultDir))
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	godbus "github.com/godbus/dbus/v5"
+	ctrl "sigs.k8s.io/controller-runtime"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+	"k3f.io/kubeforce/agent/pkg/util/conditions"
+)
+
+const (
+	// playbookUnitPrefix is the name prefix of the systemd units of the playbooks.
+	playbookUnitPrefix = "kubeforce-playbook-"
+	// unitPollInterval is the interval of checking the state of the running playbook unit.
+	unitPollInterval = 5 * time.Second
+	// unitResultTimeout is the result of the unit that has been active longer than RuntimeMaxSec.
+	unitResultTimeout = "timeout"
+)
+
+// unitName returns the name of the systemd unit for the current attempt of the playbook.
+// The name is the same for the attempt after the agent restart, so the running unit is found again.
+func unitName(pb *v1alpha1.Playbook) string {
+	return fmt.Sprintf("%s%s-%d.service", playbookUnitPrefix, pb.Name, pb.Status.Failed+pb.Status.Interrupted)
+}
+
+// reconcileUnit runs the playbook in the transient systemd unit and tracks its completion.
+func (r *PlaybookReconciler) reconcileUnit(ctx context.Context, pb *v1alpha1.Playbook) (ctrl.Result, error) {
+	unit := unitName(pb)
+	state, err := r.Units.GetServiceState(ctx, unit)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	switch {
+	case !state.IsLoaded() && pb.Status.Unit == unit:
+		// the unit has been lost, e.g. the host has been rebooted
+		markInterrupted(pb)
+		return ctrl.Result{}, nil
+	case !state.IsLoaded():
+		if err := r.startUnit(ctx, pb, unit); err != nil {
+			pb.Status.Phase = v1alpha1.PlaybookFailed
+			pb.Status.Failed++
+			conditions.MarkFalse(
+				pb,
+				v1alpha1.PlaybookExecutionCondition,
+				v1alpha1.PlaybookExecutionFailedReason,
+				err.Error())
+			r.Log.Error(err, "failed to start the playbook unit", "playbook", pb.Name, "unit", unit)
+			return ctrl.Result{}, nil
+		}
+		pb.Status.Unit = unit
+		return ctrl.Result{RequeueAfter: unitPollInterval}, nil
+	case state.IsRunning():
+		pb.Status.Unit = unit
+		return ctrl.Result{RequeueAfter: unitPollInterval}, nil
+	}
+
+	if err := r.Units.RemoveService(ctx, unit); err != nil {
+		return ctrl.Result{}, err
+	}
+	if state.IsSucceeded() {
+		pb.Status.Phase = v1alpha1.PlaybookSucceeded
+		conditions.MarkTrue(pb, v1alpha1.PlaybookExecutionCondition)
+		return ctrl.Result{}, nil
+	}
+	reason := v1alpha1.PlaybookExecutionFailedReason
+	if state.Result == unitResultTimeout {
+		reason = v1alpha1.DeadlineExceededReason
+	}
+	pb.Status.Phase = v1alpha1.PlaybookFailed
+	pb.Status.Failed++
+	conditions.MarkFalse(
+		pb,
+		v1alpha1.PlaybookExecutionCondition,
+		reason,
+		"unit %s has failed with the result %q", unit, state.Result)
+	return ctrl.Result{}, nil
+}
+
+// removeUnit stops the playbook unit and unloads it, the unit that is not loaded is skipped.
+func (r *PlaybookReconciler) removeUnit(ctx context.Context, unit string) error {
+	state, err := r.Units.GetServiceState(ctx, unit)
+	if err != nil {
+		return err
+	}
+	if !state.IsLoaded() {
+		return nil
+	}
+	if err := r.Units.RemoveService(ctx, unit); err != nil {
+		return err
+	}
+	r.Log.Info("playbook unit has been removed", "unit", unit)
+	return nil
+}
+
+func (r *PlaybookReconciler) startUnit(ctx context.Context, pb *v1alpha1.Playbook, unit string) error {
+	if err := r.writePlaybookFiles(pb); err != nil {
+		return err
+	}
+	command, err := r.playbookCmd(pb).Command()
+	if err != nil {
+		return err
+	}
+	props := unitProperties(pb, filepath.Join(r.PlaybookPath, pb.Name), r.newLogFilePath(pb), command, r.playbookEnv(pb))
+	if err := r.Units.StartTransientService(ctx, unit, props); err != nil {
+		return err
+	}
+	r.Log.Info("playbook unit has been started", "playbook", pb.Name, "unit", unit)
+	return nil
+}
+
+// unitProperties returns the properties of the transient systemd unit for the playbook.
+func unitProperties(pb *v1alpha1.Playbook, dir, logFile string, command, env []string) []dbus.Property {
+	// the output is redirected by the shell because the unit properties for log files
+	// are not supported by old systemd versions
+	execStart := append([]string{"/bin/sh", "-c", `exec "$@" >>"$PLAYBOOK_LOG" 2>&1`, "sh"}, command...)
+	props := []dbus.Property{
+		dbus.PropDescription(fmt.Sprintf("Kubeforce playbook %s", pb.Name)),
+		dbus.PropExecStart(execStart, true),
+		// the unit stays loaded after the successful completion to keep its result
+		dbus.PropRemainAfterExit(true),
+		{Name: "WorkingDirectory", Value: godbus.MakeVariant(dir)},
+		{Name: "Environment", Value: godbus.MakeVariant(append([]string{"PLAYBOOK_LOG=" + logFile}, env...))},
+		// the log file and the files created by the playbook may contain secrets
+		{Name: "UMask", Value: godbus.MakeVariant(uint32(0o077))},
+	}
+	policy := pb.Spec.Policy
+	if policy == nil {
+		return props
+	}
+	if policy.Timeout != nil && policy.Timeout.Duration > 0 {
+		props = append(props, dbus.Property{Name: "RuntimeMaxUSec", Value: godbus.MakeVariant(uint64(policy.Timeout.Microseconds()))})
+	}
+	if res := policy.Resources; res != nil {
+		if res.CPU != nil {
+			props = append(props,
+				dbus.Property{Name: "CPUAccounting", Value: godbus.MakeVariant(true)},
+				dbus.Property{Name: "CPUQuotaPerSecUSec", Value: godbus.MakeVariant(uint64(res.CPU.MilliValue()) * 1000)},
+			)
+		}
+		if res.Memory != nil {
+			props = append(props,
+				dbus.Property{Name: "MemoryAccounting", Value: godbus.MakeVariant(true)},
+				dbus.Property{Name: "MemoryMax", Value: godbus.MakeVariant(uint64(res.Memory.Value()))},
+			)
+		}
+		if res.IOWeight != nil {
+			props = append(props,
+				dbus.Property{Name: "IOAccounting", Value: godbus.MakeVariant(true)},
+				dbus.Property{Name: "IOWeight", Value: godbus.MakeVariant(uint64(*res.IOWeight))},
+			)
+		}
+	}
+	return props
+}
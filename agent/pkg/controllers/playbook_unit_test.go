@@ -0,0 +1,290 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+	"k3f.io/kubeforce/agent/pkg/apiserver"
+	"k3f.io/kubeforce/agent/pkg/systemd"
+	"k3f.io/kubeforce/agent/pkg/util/conditions"
+)
+
+type fakeUnitManager struct {
+	states    map[string]systemd.ServiceState
+	started   map[string][]dbus.Property
+	removed   []string
+	removeErr error
+}
+
+func (m *fakeUnitManager) StartTransientService(_ context.Context, name string, properties []dbus.Property) error {
+	m.started[name] = properties
+	return nil
+}
+
+func (m *fakeUnitManager) GetServiceState(_ context.Context, name string) (*systemd.ServiceState, error) {
+	state, ok := m.states[name]
+	if !ok {
+		return &systemd.ServiceState{LoadState: "not-found", ActiveState: "inactive", SubState: "dead"}, nil
+	}
+	return &state, nil
+}
+
+func (m *fakeUnitManager) RemoveService(_ context.Context, name string) error {
+	if m.removeErr != nil {
+		return m.removeErr
+	}
+	m.removed = append(m.removed, name)
+	delete(m.states, name)
+	return nil
+}
+
+func TestReconcileUnit(t *testing.T) {
+	const unit = "kubeforce-playbook-test-1.service"
+	tests := []struct {
+		name        string
+		state       *systemd.ServiceState
+		statusUnit  string
+		wantPhase   v1alpha1.PlaybookPhase
+		wantReason  string
+		wantStarted bool
+		wantRemoved bool
+		wantRequeue bool
+	}{
+		{
+			name:        "start the unit",
+			wantPhase:   v1alpha1.PlaybookRunning,
+			wantStarted: true,
+			wantRequeue: true,
+		},
+		{
+			name:        "unit is running after the agent restart",
+			state:       &systemd.ServiceState{LoadState: "loaded", ActiveState: "active", SubState: "running"},
+			wantPhase:   v1alpha1.PlaybookRunning,
+			wantRequeue: true,
+		},
+		{
+			name:        "unit has succeeded",
+			state:       &systemd.ServiceState{LoadState: "loaded", ActiveState: "active", SubState: "exited", Result: "success"},
+			statusUnit:  unit,
+			wantPhase:   v1alpha1.PlaybookSucceeded,
+			wantRemoved: true,
+		},
+		{
+			name:        "unit has failed",
+			state:       &systemd.ServiceState{LoadState: "loaded", ActiveState: "failed", SubState: "failed", Result: "exit-code"},
+			statusUnit:  unit,
+			wantPhase:   v1alpha1.PlaybookFailed,
+			wantReason:  v1alpha1.PlaybookExecutionFailedReason,
+			wantRemoved: true,
+		},
+		{
+			name:        "unit has exceeded the timeout",
+			state:       &systemd.ServiceState{LoadState: "loaded", ActiveState: "failed", SubState: "failed", Result: "timeout"},
+			statusUnit:  unit,
+			wantPhase:   v1alpha1.PlaybookFailed,
+			wantReason:  v1alpha1.DeadlineExceededReason,
+			wantRemoved: true,
+		},
+		{
+			name:       "unit has been lost",
+			statusUnit: unit,
+			wantPhase:  v1alpha1.PlaybookUnknown,
+			wantReason: v1alpha1.AgentRestartedReason,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			units := &fakeUnitManager{
+				states:  map[string]systemd.ServiceState{},
+				started: map[string][]dbus.Property{},
+			}
+			if tt.state != nil {
+				units.states[unit] = *tt.state
+			}
+			r := &PlaybookReconciler{
+				PlaybookPath: t.TempDir(),
+				Log:          logr.Discard(),
+				Units:        units,
+			}
+			pb := &v1alpha1.Playbook{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "test",
+				},
+				Spec: v1alpha1.PlaybookSpec{
+					Policy: &v1alpha1.Policy{
+						ExecutionMode: v1alpha1.ExecutionModeSystemdUnit,
+					},
+					Files:      map[string]string{"site.yml": simpePlaybook},
+					Entrypoint: "site.yml",
+				},
+				Status: v1alpha1.PlaybookStatus{
+					Phase:  v1alpha1.PlaybookRunning,
+					Failed: 1,
+					Unit:   tt.statusUnit,
+				},
+			}
+			res, err := r.reconcileUnit(context.Background(), pb)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(pb.Status.Phase).To(Equal(tt.wantPhase))
+			g.Expect(res.RequeueAfter > 0).To(Equal(tt.wantRequeue))
+			g.Expect(units.started).To(HaveLen(map[bool]int{true: 1}[tt.wantStarted]))
+			g.Expect(units.removed).To(HaveLen(map[bool]int{true: 1}[tt.wantRemoved]))
+			if tt.wantReason != "" {
+				g.Expect(conditions.GetReason(pb, v1alpha1.PlaybookExecutionCondition)).To(Equal(tt.wantReason))
+			}
+			if tt.wantPhase == v1alpha1.PlaybookRunning {
+				g.Expect(pb.Status.Unit).To(Equal(unit))
+			}
+		})
+	}
+}
+
+func TestDeleteRunningUnitPlaybook(t *testing.T) {
+	const unit = "kubeforce-playbook-test-0.service"
+	running := systemd.ServiceState{LoadState: "loaded", ActiveState: "active", SubState: "running"}
+	tests := []struct {
+		name          string
+		states        map[string]systemd.ServiceState
+		removeErr     error
+		wantErr       bool
+		wantRemoved   []string
+		wantFinalizer bool
+	}{
+		{
+			name:        "the running unit is stopped",
+			states:      map[string]systemd.ServiceState{unit: running},
+			wantRemoved: []string{unit},
+		},
+		{
+			name:   "the unit that is not loaded is skipped",
+			states: map[string]systemd.ServiceState{},
+		},
+		{
+			name:          "the finalizer is kept if the unit is not stopped",
+			states:        map[string]systemd.ServiceState{unit: running},
+			removeErr:     errors.New("unable to stop unit"),
+			wantErr:       true,
+			wantFinalizer: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			ctx := context.Background()
+			units := &fakeUnitManager{
+				states:    tt.states,
+				started:   map[string][]dbus.Property{},
+				removeErr: tt.removeErr,
+			}
+			now := metav1.Now()
+			pb := &v1alpha1.Playbook{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:              "test",
+					Namespace:         "default",
+					Finalizers:        []string{PlaybookFinalizer},
+					DeletionTimestamp: &now,
+				},
+				Spec: v1alpha1.PlaybookSpec{
+					Policy: &v1alpha1.Policy{
+						ExecutionMode: v1alpha1.ExecutionModeSystemdUnit,
+					},
+					Files:      map[string]string{"site.yml": simpePlaybook},
+					Entrypoint: "site.yml",
+				},
+				Status: v1alpha1.PlaybookStatus{
+					Phase: v1alpha1.PlaybookRunning,
+					Unit:  unit,
+				},
+			}
+			c := fake.NewClientBuilder().WithScheme(apiserver.Scheme).WithObjects(pb).Build()
+			r := &PlaybookReconciler{
+				Client:        c,
+				PlaybookPath:  t.TempDir(),
+				ArtifactsPath: t.TempDir(),
+				Log:           logr.Discard(),
+				Units:         units,
+			}
+			g.Expect(r.writePlaybookFiles(pb)).To(Succeed())
+			dir := filepath.Join(r.PlaybookPath, pb.Name)
+
+			_, err := r.reconcileDelete(ctx, pb)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(dir).To(BeADirectory())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(dir).NotTo(BeADirectory())
+			}
+			g.Expect(units.removed).To(Equal(tt.wantRemoved))
+			g.Expect(controllerutil.ContainsFinalizer(pb, PlaybookFinalizer)).To(Equal(tt.wantFinalizer))
+		})
+	}
+}
+
+func TestUnitProperties(t *testing.T) {
+	g := NewWithT(t)
+	cpu := resource.MustParse("500m")
+	memory := resource.MustParse("256Mi")
+	ioWeight := int32(50)
+	pb := &v1alpha1.Playbook{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "test",
+		},
+		Spec: v1alpha1.PlaybookSpec{
+			Policy: &v1alpha1.Policy{
+				Timeout: &metav1.Duration{Duration: time.Minute},
+				Resources: &v1alpha1.PlaybookResources{
+					CPU:      &cpu,
+					Memory:   &memory,
+					IOWeight: &ioWeight,
+				},
+			},
+		},
+	}
+	props := unitProperties(pb, "/var/lib/kubeforce/playbooks/test", "/var/lib/kubeforce/playbooks/test/logs/1.log",
+		[]string{"/usr/bin/ansible-playbook", "site.yml"}, []string{"ANSIBLE_ROLES_PATH=/var/lib/kubeforce/playbooks/.galaxy/0/roles"})
+	values := make(map[string]interface{}, len(props))
+	for _, p := range props {
+		values[p.Name] = p.Value.Value()
+	}
+	g.Expect(values).To(HaveKeyWithValue("RemainAfterExit", true))
+	g.Expect(values).To(HaveKeyWithValue("WorkingDirectory", "/var/lib/kubeforce/playbooks/test"))
+	g.Expect(values).To(HaveKeyWithValue("Environment", []string{
+		"PLAYBOOK_LOG=/var/lib/kubeforce/playbooks/test/logs/1.log",
+		"ANSIBLE_ROLES_PATH=/var/lib/kubeforce/playbooks/.galaxy/0/roles",
+	}))
+	g.Expect(values).To(HaveKeyWithValue("UMask", uint32(0o077)))
+	g.Expect(values).To(HaveKeyWithValue("RuntimeMaxUSec", uint64(60_000_000)))
+	g.Expect(values).To(HaveKeyWithValue("CPUQuotaPerSecUSec", uint64(500_000)))
+	g.Expect(values).To(HaveKeyWithValue("MemoryMax", uint64(256*1024*1024)))
+	g.Expect(values).To(HaveKeyWithValue("IOWeight", uint64(50)))
+}
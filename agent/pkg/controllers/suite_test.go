@@ -40,6 +40,8 @@ var (
 	restcfg      *rest.Config
 	k8sClient    client.Client
 	k8sClientset *clientset.Clientset
+	// testAgentConfig is the configuration of the agent in the test environment.
+	testAgentConfig *config.Config
 )
 
 func TestMain(m *testing.M) {
@@ -74,6 +76,7 @@ func setup(ctx context.Context) error {
 }
 
 func createCtrlManager(agentConfig *config.Config, config *rest.Config) manager.RunnableFunc {
+	testAgentConfig = agentConfig
 	return func(ctx context.Context) error {
 		mgr, err := ctrl.NewManager(config, ctrl.Options{
 			Scheme: apiserver.Scheme,
@@ -20,6 +20,7 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -42,3 +43,37 @@ func TestSuccessfulUpload(t *testing.T) {
 		g.Expect(string(data)).Should(Equal(fileContent))
 	})
 }
+
+func TestSuccessfulStreamUpload(t *testing.T) {
+	ctx := context.Background()
+	g := NewGomegaWithT(t)
+	t.Run("stream the large file", func(t *testing.T) {
+		tempDir := t.TempDir()
+		targetPath := filepath.Join(tempDir, "bundle.tar.gz")
+		content := strings.Repeat(fileContent, 1<<16)
+		mode := os.FileMode(0o640)
+		err := k8sClientset.Upload(ctx, targetPath, strings.NewReader(content), &mode)
+		g.Expect(err).Should(Succeed())
+		data, err := os.ReadFile(filepath.Clean(targetPath))
+		g.Expect(err).Should(Succeed())
+		g.Expect(string(data)).Should(Equal(content))
+		info, err := os.Stat(targetPath)
+		g.Expect(err).Should(Succeed())
+		g.Expect(info.Mode().Perm()).Should(Equal(mode))
+	})
+}
+
+func TestListArtifacts(t *testing.T) {
+	ctx := context.Background()
+	g := NewGomegaWithT(t)
+	t.Run("list the uploaded artifact", func(t *testing.T) {
+		name := "0123456789abcdef"
+		artifactsPath := testAgentConfig.Spec.GetArtifactsPath()
+		g.Expect(os.MkdirAll(artifactsPath, 0o700)).Should(Succeed())
+		err := k8sClientset.UploadData(ctx, filepath.Join(artifactsPath, name), []byte(fileContent), nil)
+		g.Expect(err).Should(Succeed())
+		names, err := k8sClientset.ListArtifacts(ctx)
+		g.Expect(err).Should(Succeed())
+		g.Expect(names).Should(ContainElement(name))
+	})
+}
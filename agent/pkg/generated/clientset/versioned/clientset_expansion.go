@@ -19,12 +19,16 @@ package versioned
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"io"
 	"mime/multipart"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/pkg/errors"
+	"k8s.io/client-go/rest"
 )
 
 // Uninstall uninstalls the agent from the host.
@@ -37,6 +41,12 @@ func (c *Clientset) Uninstall(ctx context.Context) error {
 
 // UploadData uploads content to the host and saves it as a file.
 func (c *Clientset) UploadData(ctx context.Context, targetPath string, data []byte, mode *os.FileMode) error {
+	return c.Upload(ctx, targetPath, bytes.NewReader(data), mode)
+}
+
+// Upload streams the content of the reader to the host and saves it as a file.
+// The content is not buffered in memory, so it is suitable for large files.
+func (c *Clientset) Upload(ctx context.Context, targetPath string, r io.Reader, mode *os.FileMode) error {
 	request := c.RESTClient().
 		Post().
 		AbsPath("upload").
@@ -45,9 +55,48 @@ func (c *Clientset) UploadData(ctx context.Context, targetPath string, data []by
 		request.Param("mode", strconv.FormatInt(int64(*mode), 8))
 	}
 
+	pr, pw := io.Pipe()
+	w := multipart.NewWriter(pw)
+	go func() {
+		part, err := w.CreateFormFile("data", filepath.Base(targetPath))
+		if err == nil {
+			_, err = io.Copy(part, r)
+		}
+		if err == nil {
+			err = errors.Wrap(w.Close(), "unable to close multipart writer")
+		}
+		_ = pw.CloseWithError(err)
+	}()
+	// unblocks the writer if the request is finished before the whole content is sent
+	defer pr.Close()
+	request.SetHeader("Content-Type", w.FormDataContentType())
+	request.Body(pr)
+	return request.Do(ctx).Error()
+}
+
+// ListArtifacts returns the names of the artifacts uploaded to the agent.
+func (c *Clientset) ListArtifacts(ctx context.Context) ([]string, error) {
+	data, err := c.RESTClient().
+		Get().
+		AbsPath("artifacts").
+		DoRaw(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return nil, errors.Wrap(err, "unable to decode the list of artifacts")
+	}
+	return names, nil
+}
+
+// Upgrade uploads a new agent binary and upgrades the agent.
+// The agent is restarted asynchronously after the binary is verified.
+func (c *Clientset) Upgrade(ctx context.Context, data []byte, checksum string, timeout time.Duration) error {
+	request := c.upgradeRequest(checksum, timeout)
 	buf := new(bytes.Buffer)
 	w := multipart.NewWriter(buf)
-	part, err := w.CreateFormFile("data", filepath.Base(targetPath))
+	part, err := w.CreateFormFile("data", "kubeforce-agent")
 	if err != nil {
 		return err
 	}
@@ -62,3 +111,25 @@ func (c *Clientset) UploadData(ctx context.Context, targetPath string, data []by
 	request.Body(buf)
 	return request.Do(ctx).Error()
 }
+
+// UpgradeFromURL upgrades the agent to the binary downloaded by the agent from the url.
+// The agent is restarted asynchronously after the binary is verified.
+func (c *Clientset) UpgradeFromURL(ctx context.Context, url string, checksum string, timeout time.Duration) error {
+	return c.upgradeRequest(checksum, timeout).
+		Param("url", url).
+		Do(ctx).
+		Error()
+}
+
+func (c *Clientset) upgradeRequest(checksum string, timeout time.Duration) *rest.Request {
+	request := c.RESTClient().
+		Post().
+		AbsPath("upgrade")
+	if checksum != "" {
+		request.Param("checksum", checksum)
+	}
+	if timeout > 0 {
+		request.Param("timeout", timeout.String())
+	}
+	return request
+}
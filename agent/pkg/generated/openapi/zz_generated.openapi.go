@@ -24,6 +24,7 @@ limitations under the License.
 package openapi
 
 import (
+	resource "k8s.io/apimachinery/pkg/api/resource"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	common "k8s.io/kube-openapi/pkg/common"
 	spec "k8s.io/kube-openapi/pkg/validation/spec"
@@ -39,14 +40,18 @@ func GetOpenAPIDefinitions(ref common.ReferenceCallback) map[string]common.OpenA
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookDeploymentList":   schema_pkg_apis_agent_v1alpha1_PlaybookDeploymentList(ref),
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookDeploymentSpec":   schema_pkg_apis_agent_v1alpha1_PlaybookDeploymentSpec(ref),
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookDeploymentStatus": schema_pkg_apis_agent_v1alpha1_PlaybookDeploymentStatus(ref),
+		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookFile":             schema_pkg_apis_agent_v1alpha1_PlaybookFile(ref),
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookList":             schema_pkg_apis_agent_v1alpha1_PlaybookList(ref),
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookLogOptions":       schema_pkg_apis_agent_v1alpha1_PlaybookLogOptions(ref),
+		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookResources":        schema_pkg_apis_agent_v1alpha1_PlaybookResources(ref),
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookSpec":             schema_pkg_apis_agent_v1alpha1_PlaybookSpec(ref),
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookStatus":           schema_pkg_apis_agent_v1alpha1_PlaybookStatus(ref),
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookTemplateSpec":     schema_pkg_apis_agent_v1alpha1_PlaybookTemplateSpec(ref),
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.Policy":                   schema_pkg_apis_agent_v1alpha1_Policy(ref),
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.SysInfo":                  schema_pkg_apis_agent_v1alpha1_SysInfo(ref),
 		"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.SysInfoSpec":              schema_pkg_apis_agent_v1alpha1_SysInfoSpec(ref),
+		"k8s.io/apimachinery/pkg/api/resource.Quantity":                           schema_apimachinery_pkg_api_resource_Quantity(ref),
+		"k8s.io/apimachinery/pkg/api/resource.int64Amount":                        schema_apimachinery_pkg_api_resource_int64Amount(ref),
 		"k8s.io/apimachinery/pkg/apis/meta/v1.APIGroup":                           schema_pkg_apis_meta_v1_APIGroup(ref),
 		"k8s.io/apimachinery/pkg/apis/meta/v1.APIGroupList":                       schema_pkg_apis_meta_v1_APIGroupList(ref),
 		"k8s.io/apimachinery/pkg/apis/meta/v1.APIResource":                        schema_pkg_apis_meta_v1_APIResource(ref),
@@ -233,6 +238,20 @@ func schema_pkg_apis_agent_v1alpha1_Network(ref common.ReferenceCallback) common
 							Format:      "",
 						},
 					},
+					"defaultIPv4Address": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DefaultIPv4Address is an ip address from the IPv4 default route",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"defaultIPv6Address": {
+						SchemaProps: spec.SchemaProps{
+							Description: "DefaultIPv6Address is an ip address from the IPv6 default route",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 					"defaultInterfaceName": {
 						SchemaProps: spec.SchemaProps{
 							Description: "DefaultInterfaceName is a network interface from default route",
@@ -470,6 +489,56 @@ func schema_pkg_apis_agent_v1alpha1_PlaybookDeploymentStatus(ref common.Referenc
 	}
 }
 
+func schema_pkg_apis_agent_v1alpha1_PlaybookFile(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "PlaybookFile is a playbook file that is not stored as text in the Files of the playbook. Exactly one of Content and Artifact must be specified.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"path": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Path is the path of the file relative to the playbook directory.",
+							Default:     "",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"content": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Content is the content of the file, it is base64 encoded in JSON.",
+							Type:        []string{"string"},
+							Format:      "byte",
+						},
+					},
+					"artifact": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Artifact is the name of the file in the artifacts directory of the agent. The artifacts are uploaded to the agent through the upload API.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"sha256": {
+						SchemaProps: spec.SchemaProps{
+							Description: "SHA256 is the hex encoded SHA-256 checksum of the content. It is required for the artifact.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"mode": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Mode is the permission bits of the file. Defaults to 0600.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+				Required: []string{"path"},
+			},
+		},
+	}
+}
+
 func schema_pkg_apis_agent_v1alpha1_PlaybookList(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -589,6 +658,40 @@ func schema_pkg_apis_agent_v1alpha1_PlaybookLogOptions(ref common.ReferenceCallb
 	}
 }
 
+func schema_pkg_apis_agent_v1alpha1_PlaybookResources(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "PlaybookResources defines the resource limits of the playbook.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"cpu": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CPU is the maximum CPU time of the playbook, e.g. \"500m\" is a half of one CPU.",
+							Ref:         ref("k8s.io/apimachinery/pkg/api/resource.Quantity"),
+						},
+					},
+					"memory": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Memory is the maximum memory of the playbook.",
+							Ref:         ref("k8s.io/apimachinery/pkg/api/resource.Quantity"),
+						},
+					},
+					"ioWeight": {
+						SchemaProps: spec.SchemaProps{
+							Description: "IOWeight is the relative IO weight of the playbook in the range from 1 to 10000.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+				},
+			},
+		},
+		Dependencies: []string{
+			"k8s.io/apimachinery/pkg/api/resource.Quantity"},
+	}
+}
+
 func schema_pkg_apis_agent_v1alpha1_PlaybookSpec(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
@@ -626,12 +729,33 @@ func schema_pkg_apis_agent_v1alpha1_PlaybookSpec(ref common.ReferenceCallback) c
 							Format:      "",
 						},
 					},
+					"ansibleVersion": {
+						SchemaProps: spec.SchemaProps{
+							Description: "AnsibleVersion is the version of ansible-core that executes the playbook. It requires the managed ansible runtime in the agent configuration, the default version of the runtime is used if it is not specified.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"binaryFiles": {
+						SchemaProps: spec.SchemaProps{
+							Description: "BinaryFiles are the playbook files with binary content or the content uploaded to the agent separately.",
+							Type:        []string{"array"},
+							Items: &spec.SchemaOrArray{
+								Schema: &spec.Schema{
+									SchemaProps: spec.SchemaProps{
+										Default: map[string]interface{}{},
+										Ref:     ref("k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookFile"),
+									},
+								},
+							},
+						},
+					},
 				},
 				Required: []string{"files", "entrypoint"},
 			},
 		},
 		Dependencies: []string{
-			"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.Policy"},
+			"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookFile", "k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.Policy"},
 	}
 }
 
@@ -670,6 +794,20 @@ func schema_pkg_apis_agent_v1alpha1_PlaybookStatus(ref common.ReferenceCallback)
 							Format:      "int32",
 						},
 					},
+					"interrupted": {
+						SchemaProps: spec.SchemaProps{
+							Description: "The number of playbook attempts interrupted by the agent restart.",
+							Type:        []string{"integer"},
+							Format:      "int32",
+						},
+					},
+					"unit": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Unit is the name of the systemd unit of the current attempt. It is set only in the SystemdUnit execution mode.",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
 				},
 			},
 		},
@@ -727,11 +865,38 @@ func schema_pkg_apis_agent_v1alpha1_Policy(ref common.ReferenceCallback) common.
 							Format:      "int32",
 						},
 					},
+					"countAgentRestarts": {
+						SchemaProps: spec.SchemaProps{
+							Description: "CountAgentRestarts specifies whether the attempts interrupted by the agent restart are counted against the backoff limit. Defaults to true",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
+					"executionMode": {
+						SchemaProps: spec.SchemaProps{
+							Description: "ExecutionMode defines how the playbook is executed. Defaults to Process",
+							Type:        []string{"string"},
+							Format:      "",
+						},
+					},
+					"resources": {
+						SchemaProps: spec.SchemaProps{
+							Description: "Resources are the resource limits of the playbook. They are applied only in the SystemdUnit execution mode.",
+							Ref:         ref("k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookResources"),
+						},
+					},
+					"purgeFilesAfterSuccess": {
+						SchemaProps: spec.SchemaProps{
+							Description: "PurgeFilesAfterSuccess specifies that the playbook files are deleted from the disk once the playbook succeeds. The logs of the playbook are kept.",
+							Type:        []string{"boolean"},
+							Format:      "",
+						},
+					},
 				},
 			},
 		},
 		Dependencies: []string{
-			"k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
+			"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1.PlaybookResources", "k8s.io/apimachinery/pkg/apis/meta/v1.Duration"},
 	}
 }
 
@@ -798,6 +963,54 @@ func schema_pkg_apis_agent_v1alpha1_SysInfoSpec(ref common.ReferenceCallback) co
 	}
 }
 
+func schema_apimachinery_pkg_api_resource_Quantity(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.EmbedOpenAPIDefinitionIntoV2Extension(common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "Quantity is a fixed-point representation of a number. It provides convenient marshaling/unmarshaling in JSON and YAML, in addition to String() and AsInt64() accessors.\n\nThe serialization format is:\n\n``` <quantity>        ::= <signedNumber><suffix>\n\n\t(Note that <suffix> may be empty, from the \"\" case in <decimalSI>.)\n\n<digit>           ::= 0 | 1 | ... | 9 <digits>          ::= <digit> | <digit><digits> <number>          ::= <digits> | <digits>.<digits> | <digits>. | .<digits> <sign>            ::= \"+\" | \"-\" <signedNumber>    ::= <number> | <sign><number> <suffix>          ::= <binarySI> | <decimalExponent> | <decimalSI> <binarySI>        ::= Ki | Mi | Gi | Ti | Pi | Ei\n\n\t(International System of units; See: http://physics.nist.gov/cuu/Units/binary.html)\n\n<decimalSI>       ::= m | \"\" | k | M | G | T | P | E\n\n\t(Note that 1024 = 1Ki but 1000 = 1k; I didn't choose the capitalization.)\n\n<decimalExponent> ::= \"e\" <signedNumber> | \"E\" <signedNumber> ```\n\nNo matter which of the three exponent forms is used, no quantity may represent a number greater than 2^63-1 in magnitude, nor may it have more than 3 decimal places. Numbers larger or more precise will be capped or rounded up. (E.g.: 0.1m will rounded up to 1m.) This may be extended in the future if we require larger or smaller quantities.\n\nWhen a Quantity is parsed from a string, it will remember the type of suffix it had, and will use the same type again when it is serialized.\n\nBefore serializing, Quantity will be put in \"canonical form\". This means that Exponent/suffix will be adjusted up or down (with a corresponding increase or decrease in Mantissa) such that:\n\n- No precision is lost - No fractional digits will be emitted - The exponent (or suffix) is as large as possible.\n\nThe sign will be omitted unless the number is negative.\n\nExamples:\n\n- 1.5 will be serialized as \"1500m\" - 1.5Gi will be serialized as \"1536Mi\"\n\nNote that the quantity will NEVER be internally represented by a floating point number. That is the whole point of this exercise.\n\nNon-canonical values will still parse as long as they are well formed, but will be re-emitted in their canonical form. (So always use canonical form, or don't diff.)\n\nThis format is intended to make it difficult to use these numbers without writing some sort of special handling code in the hopes that that will cause implementors to also use a fixed point implementation.",
+				OneOf:       common.GenerateOpenAPIV3OneOfSchema(resource.Quantity{}.OpenAPIV3OneOfTypes()),
+				Format:      resource.Quantity{}.OpenAPISchemaFormat(),
+			},
+		},
+	}, common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "Quantity is a fixed-point representation of a number. It provides convenient marshaling/unmarshaling in JSON and YAML, in addition to String() and AsInt64() accessors.\n\nThe serialization format is:\n\n``` <quantity>        ::= <signedNumber><suffix>\n\n\t(Note that <suffix> may be empty, from the \"\" case in <decimalSI>.)\n\n<digit>           ::= 0 | 1 | ... | 9 <digits>          ::= <digit> | <digit><digits> <number>          ::= <digits> | <digits>.<digits> | <digits>. | .<digits> <sign>            ::= \"+\" | \"-\" <signedNumber>    ::= <number> | <sign><number> <suffix>          ::= <binarySI> | <decimalExponent> | <decimalSI> <binarySI>        ::= Ki | Mi | Gi | Ti | Pi | Ei\n\n\t(International System of units; See: http://physics.nist.gov/cuu/Units/binary.html)\n\n<decimalSI>       ::= m | \"\" | k | M | G | T | P | E\n\n\t(Note that 1024 = 1Ki but 1000 = 1k; I didn't choose the capitalization.)\n\n<decimalExponent> ::= \"e\" <signedNumber> | \"E\" <signedNumber> ```\n\nNo matter which of the three exponent forms is used, no quantity may represent a number greater than 2^63-1 in magnitude, nor may it have more than 3 decimal places. Numbers larger or more precise will be capped or rounded up. (E.g.: 0.1m will rounded up to 1m.) This may be extended in the future if we require larger or smaller quantities.\n\nWhen a Quantity is parsed from a string, it will remember the type of suffix it had, and will use the same type again when it is serialized.\n\nBefore serializing, Quantity will be put in \"canonical form\". This means that Exponent/suffix will be adjusted up or down (with a corresponding increase or decrease in Mantissa) such that:\n\n- No precision is lost - No fractional digits will be emitted - The exponent (or suffix) is as large as possible.\n\nThe sign will be omitted unless the number is negative.\n\nExamples:\n\n- 1.5 will be serialized as \"1500m\" - 1.5Gi will be serialized as \"1536Mi\"\n\nNote that the quantity will NEVER be internally represented by a floating point number. That is the whole point of this exercise.\n\nNon-canonical values will still parse as long as they are well formed, but will be re-emitted in their canonical form. (So always use canonical form, or don't diff.)\n\nThis format is intended to make it difficult to use these numbers without writing some sort of special handling code in the hopes that that will cause implementors to also use a fixed point implementation.",
+				Type:        resource.Quantity{}.OpenAPISchemaType(),
+				Format:      resource.Quantity{}.OpenAPISchemaFormat(),
+			},
+		},
+	})
+}
+
+func schema_apimachinery_pkg_api_resource_int64Amount(ref common.ReferenceCallback) common.OpenAPIDefinition {
+	return common.OpenAPIDefinition{
+		Schema: spec.Schema{
+			SchemaProps: spec.SchemaProps{
+				Description: "int64Amount represents a fixed precision numerator and arbitrary scale exponent. It is faster than operations on inf.Dec for values that can be represented as int64.",
+				Type:        []string{"object"},
+				Properties: map[string]spec.Schema{
+					"value": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int64",
+						},
+					},
+					"scale": {
+						SchemaProps: spec.SchemaProps{
+							Default: 0,
+							Type:    []string{"integer"},
+							Format:  "int32",
+						},
+					},
+				},
+				Required: []string{"value", "scale"},
+			},
+		},
+	}
+}
+
 func schema_pkg_apis_meta_v1_APIGroup(ref common.ReferenceCallback) common.OpenAPIDefinition {
 	return common.OpenAPIDefinition{
 		Schema: spec.Schema{
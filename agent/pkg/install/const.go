@@ -26,4 +26,21 @@ const (
 	certFile       = certsDir + "tls.crt"
 	privateKeyFile = certsDir + "tls.key"
 	clientCAFile   = certsDir + "client-ca.crt"
+
+	// AdminKubeconfigPath is the kubeconfig with the admin credential that is used by the agent CLI.
+	AdminKubeconfigPath = "/etc/kubeforce/admin.kubeconfig"
+
+	// readyFile contains the PID of the agent process that is ready to serve requests.
+	readyFile = "/var/lib/kubeforce/agent.ready"
+
+	upgradeUnitPrefix = "kubeforce-agent-upgrade-"
+	upgradeDir        = "/var/lib/kubeforce/upgrade/"
+	// upgraderPath is a copy of the current binary that drives the upgrade.
+	upgraderPath = upgradeDir + "kubeforce-agent"
+	// upgradeLockFile contains the deadline of the upgrade in progress.
+	upgradeLockFile = upgradeDir + "upgrade.lock"
+	// stagedAgentPath and backupAgentPath must be on the same filesystem as agentPath
+	// to be able to replace the binary atomically.
+	stagedAgentPath = agentPath + ".new"
+	backupAgentPath = agentPath + ".bak"
 )
@@ -39,7 +39,7 @@ var (
 
 // Install installs a agent as the systemd service and runs it.
 func Install(ctx context.Context, cfg config.Config) error {
-	if err := stopService(ctx); err != nil {
+	if err := StopService(ctx); err != nil {
 		return err
 	}
 	if err := copyBinary(); err != nil {
@@ -60,6 +60,15 @@ func Install(ctx context.Context, cfg config.Config) error {
 	return nil
 }
 
+// SaveAdminKubeconfig copies the kubeconfig with the admin credential of the agent
+// to the well-known path to be used by the agent CLI on the host.
+func SaveAdminKubeconfig(src string) error {
+	if err := os.MkdirAll(filepath.Dir(AdminKubeconfigPath), 0o750); err != nil {
+		return err
+	}
+	return copyFile(AdminKubeconfigPath, src, 0o600)
+}
+
 func copyBinary() error {
 	exPath, err := os.Executable()
 	if err != nil {
@@ -143,7 +152,8 @@ func saveConfig(cfg config.Config) error {
 	return nil
 }
 
-func stopService(ctx context.Context) error {
+// StopService stops the agent service if it is active.
+func StopService(ctx context.Context) error {
 	conn, err := dbus.NewWithContext(ctx)
 	if err != nil {
 		return errors.Wrap(err, "failed to connect to dbus")
@@ -176,6 +186,25 @@ func stopService(ctx context.Context) error {
 	return nil
 }
 
+// StartService starts the agent service.
+func StartService(ctx context.Context) error {
+	conn, err := dbus.NewWithContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to dbus")
+	}
+	defer conn.Close()
+
+	responseCh := make(chan string, 1)
+	if _, err := conn.StartUnitContext(ctx, serviceName, "replace", responseCh); err != nil {
+		return errors.Wrapf(err, "unable to start unit %s", serviceName)
+	}
+	if response := <-responseCh; response != "done" {
+		return errors.Errorf("unable to start unit %s, response: %s", serviceName, response)
+	}
+	klog.FromContext(ctx).Info("service has been started", "unit", serviceName)
+	return nil
+}
+
 func createService(ctx context.Context) error {
 	//nolint:gosec
 	if err := os.WriteFile(servicePath, []byte(agentServiceContent), 0644); err != nil {
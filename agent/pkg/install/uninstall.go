@@ -56,6 +56,14 @@ func Uninstall(ctx context.Context, cfgSpec *config.ConfigSpec, wait bool) error
 		if err := os.RemoveAll(cfgSpec.Authentication.X509.ClientCAFile); err != nil {
 			return err
 		}
+		if cfgSpec.Encryption != nil {
+			if err := os.RemoveAll(cfgSpec.Encryption.GetConfigFile()); err != nil {
+				return err
+			}
+		}
+	}
+	if err := os.RemoveAll(AdminKubeconfigPath); err != nil {
+		return err
 	}
 	// remove all internal data
 	if err := os.RemoveAll("/var/lib/kubeforce/"); err != nil {
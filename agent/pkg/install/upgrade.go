@@ -0,0 +1,326 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/version"
+	"k8s.io/klog/v2"
+)
+
+const (
+	// DefaultUpgradeTimeout is the default time to wait for the upgraded agent to become ready.
+	DefaultUpgradeTimeout = 2 * time.Minute
+
+	checksumAlgorithmSHA256 = "sha256"
+	verifyBinaryTimeout     = 30 * time.Second
+	readyPollInterval       = 2 * time.Second
+	// upgradeLockMargin is added to the time of the upgrade and the rollback
+	// to release the lock of the upgrade that has been interrupted.
+	upgradeLockMargin = 5 * time.Minute
+)
+
+// ErrUpgradeInProgress is returned when another upgrade is staged or is pending the rollback.
+var ErrUpgradeInProgress = errors.New("another upgrade of the agent is in progress")
+
+// MarkReady records that the current agent process is ready to serve requests.
+// It is used by the upgrade process to check the health of the new binary.
+func MarkReady() error {
+	return saveFile(readyFile, []byte(strconv.Itoa(os.Getpid())), 0o600, 0o750)
+}
+
+// UnmarkReady removes the readiness record of the current agent process.
+func UnmarkReady() error {
+	pid, err := readyPID()
+	if err != nil || pid != os.Getpid() {
+		return err
+	}
+	return os.RemoveAll(readyFile)
+}
+
+// LockUpgrade marks the upgrade in progress until it is finished by Upgrade or UnlockUpgrade.
+// The lock expires after the time of the upgrade and the rollback if the upgrade has been interrupted.
+// It returns ErrUpgradeInProgress if another upgrade is staged or is pending the rollback.
+func LockUpgrade(timeout time.Duration) error {
+	if err := os.MkdirAll(upgradeDir, 0o750); err != nil {
+		return err
+	}
+	return lockUpgrade(upgradeLockFile, time.Now(), 2*timeout+upgradeLockMargin)
+}
+
+// UnlockUpgrade releases the lock of the upgrade.
+func UnlockUpgrade() error {
+	return os.RemoveAll(upgradeLockFile)
+}
+
+func lockUpgrade(path string, now time.Time, duration time.Duration) error {
+	deadline := now.Add(duration).UTC().Format(time.RFC3339)
+	for i := 0; i < 2; i++ {
+		f, err := os.OpenFile(filepath.Clean(path), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+		if err == nil {
+			_, err = f.WriteString(deadline)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			return err
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+		stat, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Clean(path))
+		if err != nil {
+			return err
+		}
+		lockDeadline, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+		if err != nil {
+			// the deadline may not be written yet by the other process
+			lockDeadline = stat.ModTime().Add(upgradeLockMargin)
+		}
+		if now.Before(lockDeadline) {
+			return errors.Wrapf(ErrUpgradeInProgress, "the lock expires at %s", lockDeadline)
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+	}
+	return ErrUpgradeInProgress
+}
+
+// StageBinary saves a new agent binary next to the current one and verifies it.
+// The checksum is required and has the format "sha256:<hex>", the algorithm prefix is optional.
+func StageBinary(ctx context.Context, r io.Reader, checksum string) (*version.Info, error) {
+	if checksum == "" {
+		return nil, errors.New("checksum of the agent binary is required")
+	}
+	expected, err := parseChecksum(checksum)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(stagedAgentPath), 0o750); err != nil {
+		return nil, err
+	}
+	if err := writeBinary(stagedAgentPath, r, expected); err != nil {
+		_ = os.RemoveAll(stagedAgentPath)
+		return nil, err
+	}
+	info, err := verifyBinary(ctx, stagedAgentPath)
+	if err != nil {
+		_ = os.RemoveAll(stagedAgentPath)
+		return nil, err
+	}
+	return info, nil
+}
+
+// ScheduleUpgrade starts a transient systemd unit that replaces the agent binary
+// with the staged one and restarts the agent service.
+// The unit runs a copy of the current binary, so it survives the restart of the agent.
+func ScheduleUpgrade(ctx context.Context, timeout time.Duration) error {
+	if _, err := os.Stat(stagedAgentPath); err != nil {
+		return errors.Wrap(err, "the new agent binary is not staged")
+	}
+	exPath, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(upgradeDir, 0o750); err != nil {
+		return err
+	}
+	if err := copyFile(upgraderPath, exPath, 0o750); err != nil {
+		return errors.Wrap(err, "unable to copy the upgrader binary")
+	}
+	conn, err := dbus.NewWithContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to dbus")
+	}
+	defer conn.Close()
+
+	unitName := fmt.Sprintf("%s%d.service", upgradeUnitPrefix, time.Now().Unix())
+	properties := []dbus.Property{
+		dbus.PropDescription("Upgrade of the kubeforce agent"),
+		dbus.PropExecStart([]string{upgraderPath, "upgrade", "--timeout", timeout.String()}, true),
+	}
+	if _, err := conn.StartTransientUnitContext(ctx, unitName, "fail", properties, nil); err != nil {
+		_ = os.RemoveAll(stagedAgentPath)
+		return errors.Wrapf(err, "unable to start unit %s", unitName)
+	}
+	klog.FromContext(ctx).Info("agent upgrade has been scheduled", "unit", unitName)
+	return nil
+}
+
+// Upgrade replaces the agent binary with the staged one and restarts the agent service.
+// If the new agent does not become ready within the timeout, the previous binary is restored.
+// The lock of the upgrade is released when the upgrade or the rollback is finished.
+func Upgrade(ctx context.Context, timeout time.Duration) error {
+	log := klog.FromContext(ctx)
+	defer func() {
+		if err := UnlockUpgrade(); err != nil {
+			log.Error(err, "unable to release the upgrade lock")
+		}
+	}()
+	if _, err := os.Stat(stagedAgentPath); err != nil {
+		return errors.Wrap(err, "the new agent binary is not staged")
+	}
+	if err := os.RemoveAll(backupAgentPath); err != nil {
+		return err
+	}
+	if err := os.Link(agentPath, backupAgentPath); err != nil {
+		return errors.Wrap(err, "unable to back up the agent binary")
+	}
+	if err := os.Rename(stagedAgentPath, agentPath); err != nil {
+		return errors.Wrap(err, "unable to replace the agent binary")
+	}
+	log.Info("agent binary has been replaced", "path", agentPath)
+
+	upgradeErr := restartAndWait(ctx, timeout)
+	if upgradeErr == nil {
+		log.Info("agent has been upgraded")
+		return os.RemoveAll(backupAgentPath)
+	}
+
+	log.Error(upgradeErr, "the new agent is not ready, rolling back")
+	if err := os.Rename(backupAgentPath, agentPath); err != nil {
+		return errors.Wrapf(err, "unable to restore the agent binary after the failed upgrade: %v", upgradeErr)
+	}
+	if err := restartAndWait(ctx, timeout); err != nil {
+		return errors.Wrapf(err, "unable to start the previous agent after the failed upgrade: %v", upgradeErr)
+	}
+	return errors.Wrap(upgradeErr, "upgrade has been rolled back")
+}
+
+func restartAndWait(ctx context.Context, timeout time.Duration) error {
+	conn, err := dbus.NewWithContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to dbus")
+	}
+	defer conn.Close()
+
+	responseCh := make(chan string, 1)
+	if _, err := conn.RestartUnitContext(ctx, serviceName, "replace", responseCh); err != nil {
+		return errors.Wrapf(err, "unable to restart unit %s", serviceName)
+	}
+	if response := <-responseCh; response != "done" {
+		return errors.Errorf("unable to restart unit %s, response: %s", serviceName, response)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	err = wait.PollImmediateUntilWithContext(waitCtx, readyPollInterval, func(ctx context.Context) (bool, error) {
+		mainPID, err := servicePID(ctx, conn)
+		if err != nil || mainPID == 0 {
+			return false, nil
+		}
+		pid, err := readyPID()
+		if err != nil {
+			return false, nil
+		}
+		return pid == mainPID, nil
+	})
+	if err != nil {
+		return errors.Wrapf(err, "agent is not ready after %s", timeout)
+	}
+	return nil
+}
+
+func servicePID(ctx context.Context, conn *dbus.Conn) (int, error) {
+	prop, err := conn.GetServicePropertyContext(ctx, serviceName, "MainPID")
+	if err != nil {
+		return 0, err
+	}
+	pid, ok := prop.Value.Value().(uint32)
+	if !ok {
+		return 0, errors.Errorf("unexpected type of MainPID property %T", prop.Value.Value())
+	}
+	return int(pid), nil
+}
+
+func readyPID() (int, error) {
+	data, err := os.ReadFile(readyFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+func parseChecksum(checksum string) ([]byte, error) {
+	algorithm, value := checksumAlgorithmSHA256, checksum
+	if i := strings.Index(checksum, ":"); i >= 0 {
+		algorithm, value = checksum[:i], checksum[i+1:]
+	}
+	if algorithm != checksumAlgorithmSHA256 {
+		return nil, errors.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	sum, err := hex.DecodeString(value)
+	if err != nil || len(sum) != sha256.Size {
+		return nil, errors.Errorf("invalid sha256 checksum %q", value)
+	}
+	return sum, nil
+}
+
+func writeBinary(dst string, r io.Reader, expected []byte) error {
+	f, err := os.OpenFile(filepath.Clean(dst), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o750)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), r); err != nil {
+		return errors.Wrap(err, "unable to save the agent binary")
+	}
+	if actual := h.Sum(nil); !bytes.Equal(actual, expected) {
+		return errors.Errorf("checksum mismatch: expected sha256:%x, actual sha256:%x", expected, actual)
+	}
+	return f.Sync()
+}
+
+// verifyBinary checks that the binary can be executed on this host.
+func verifyBinary(ctx context.Context, path string) (*version.Info, error) {
+	ctx, cancel := context.WithTimeout(ctx, verifyBinaryTimeout)
+	defer cancel()
+	//nolint:gosec
+	out, err := exec.CommandContext(ctx, path, "version", "-o", "json").Output()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to execute the new agent binary")
+	}
+	info := &version.Info{}
+	if err := json.Unmarshal(out, info); err != nil {
+		return nil, errors.Wrap(err, "unable to get the version of the new agent binary")
+	}
+	return info, nil
+}
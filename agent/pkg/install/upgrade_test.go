@@ -0,0 +1,144 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package install
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+func TestWriteBinary(t *testing.T) {
+	content := "agent binary"
+	sum := sha256.Sum256([]byte(content))
+	tests := []struct {
+		name     string
+		checksum string
+		wantErr  bool
+	}{
+		{
+			name:     "checksum with algorithm",
+			checksum: "sha256:" + hex.EncodeToString(sum[:]),
+		},
+		{
+			name:     "checksum without algorithm",
+			checksum: hex.EncodeToString(sum[:]),
+		},
+		{
+			name:     "checksum mismatch",
+			checksum: "sha256:" + strings.Repeat("0", sha256.Size*2),
+			wantErr:  true,
+		},
+		{
+			name:     "unsupported algorithm",
+			checksum: "md5:" + hex.EncodeToString(sum[:]),
+			wantErr:  true,
+		},
+		{
+			name:     "invalid checksum",
+			checksum: "sha256:abc",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			dst := filepath.Join(t.TempDir(), "agent")
+			expected, err := parseChecksum(tt.checksum)
+			if err == nil {
+				err = writeBinary(dst, strings.NewReader(content), expected)
+			}
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			data, err := os.ReadFile(dst)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(data)).To(Equal(content))
+		})
+	}
+}
+
+func TestStageBinaryRequiresChecksum(t *testing.T) {
+	g := NewWithT(t)
+	_, err := StageBinary(context.Background(), strings.NewReader("agent binary"), "")
+	g.Expect(err).To(MatchError(ContainSubstring("checksum of the agent binary is required")))
+}
+
+func TestLockUpgrade(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		lock    string
+		modTime time.Time
+		wantErr bool
+	}{
+		{
+			name: "no upgrade in progress",
+		},
+		{
+			name:    "upgrade in progress",
+			lock:    now.Add(time.Minute).Format(time.RFC3339),
+			modTime: now,
+			wantErr: true,
+		},
+		{
+			name:    "expired lock of the interrupted upgrade",
+			lock:    now.Add(-time.Minute).Format(time.RFC3339),
+			modTime: now.Add(-time.Hour),
+		},
+		{
+			name:    "deadline is not written yet",
+			modTime: now,
+			wantErr: true,
+		},
+		{
+			name:    "expired lock without the deadline",
+			modTime: now.Add(-time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			path := filepath.Join(t.TempDir(), "upgrade.lock")
+			if !tt.modTime.IsZero() {
+				g.Expect(os.WriteFile(path, []byte(tt.lock), 0o600)).To(Succeed())
+				g.Expect(os.Chtimes(path, tt.modTime, tt.modTime)).To(Succeed())
+			}
+			err := lockUpgrade(path, now, 5*time.Minute)
+			if tt.wantErr {
+				g.Expect(errors.Is(err, ErrUpgradeInProgress)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			data, err := os.ReadFile(path)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(data)).To(Equal(now.Add(5 * time.Minute).Format(time.RFC3339)))
+			// the second upgrade is rejected until the lock is released
+			g.Expect(errors.Is(lockUpgrade(path, now, 5*time.Minute), ErrUpgradeInProgress)).To(BeTrue())
+		})
+	}
+}
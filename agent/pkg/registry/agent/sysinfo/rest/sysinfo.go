@@ -27,6 +27,7 @@ import (
 	"k8s.io/apimachinery/pkg/runtime"
 	apiutilnet "k8s.io/apimachinery/pkg/util/net"
 	"k8s.io/apiserver/pkg/registry/rest"
+	netutils "k8s.io/utils/net"
 
 	"k3f.io/kubeforce/agent/pkg/apis/agent"
 	utilnet "k3f.io/kubeforce/agent/pkg/util/net"
@@ -82,6 +83,8 @@ func (r *SysInfoREST) Get(ctx context.Context, name string, options *metav1.GetO
 			Network: agent.Network{
 				Hostname:             hostname,
 				DefaultIPAddress:     ip.String(),
+				DefaultIPv4Address:   defaultAddress(net.IPv4zero, netutils.IsIPv4),
+				DefaultIPv6Address:   defaultAddress(net.IPv6unspecified, netutils.IsIPv6),
 				DefaultInterfaceName: interfaceByIP.Name,
 				Interfaces:           interfaces,
 			},
@@ -89,6 +92,16 @@ func (r *SysInfoREST) Get(ctx context.Context, name string, options *metav1.GetO
 	}, nil
 }
 
+// defaultAddress returns the ip address of the family from the default route.
+// It returns an empty string if the host has no default route of the family.
+func defaultAddress(bindAddress net.IP, isFamily func(net.IP) bool) string {
+	ip, err := apiutilnet.ResolveBindAddress(bindAddress)
+	if err != nil || !isFamily(ip) {
+		return ""
+	}
+	return ip.String()
+}
+
 func (r *SysInfoREST) getInterfaces() ([]agent.Interface, error) {
 	interfaces, err := net.Interfaces()
 	if err != nil {
@@ -0,0 +1,308 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// historySize is the number of the latest events kept in memory to resume watches.
+	historySize = 512
+	// watcherBufferSize is the number of events that can be queued for a watcher.
+	// The watcher is closed if it is not able to keep up.
+	watcherBufferSize = 1024
+	openTimeout       = 10 * time.Second
+)
+
+var (
+	objectsBucket = []byte("objects")
+	metaBucket    = []byte("meta")
+	revisionKey   = []byte("revision")
+
+	errConflict = errors.New("the object has been modified")
+)
+
+// DB is a single file database for the objects of the agent API.
+// Every change increments the revision of the database that is used as the resourceVersion of objects.
+type DB struct {
+	bolt *bolt.DB
+
+	// mu serializes changes and registration of watchers to keep the history consistent.
+	mu sync.Mutex
+	// history contains the latest events ordered by revision.
+	history []event
+	// historyRev is the revision from which the history is complete.
+	historyRev int64
+	watchers   map[*watcher]struct{}
+}
+
+// event is a change of the key in the database.
+type event struct {
+	key       string
+	rev       int64
+	value     []byte
+	prevValue []byte
+	prevRev   int64
+	deleted   bool
+}
+
+// Open opens the database file, the file is created if it does not exist.
+func Open(path string) (*DB, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to open the database %s", path)
+	}
+	d := &DB{
+		bolt:     db,
+		watchers: make(map[*watcher]struct{}),
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists(objectsBucket); err != nil {
+			return err
+		}
+		meta, err := tx.CreateBucketIfNotExists(metaBucket)
+		if err != nil {
+			return err
+		}
+		if meta.Get(revisionKey) == nil {
+			// the revision starts from 1 as in etcd, the zero resourceVersion has a special meaning for clients
+			if err := meta.Put(revisionKey, encodeRevision(1)); err != nil {
+				return err
+			}
+		}
+		d.historyRev = decodeRevision(meta.Get(revisionKey))
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// Close closes the database file and all watchers.
+func (d *DB) Close() error {
+	d.mu.Lock()
+	for w := range d.watchers {
+		delete(d.watchers, w)
+		close(w.incoming)
+	}
+	d.mu.Unlock()
+	return d.bolt.Close()
+}
+
+// Revision returns the current revision of the database.
+func (d *DB) Revision() (int64, error) {
+	var rev int64
+	err := d.bolt.View(func(tx *bolt.Tx) error {
+		rev = currentRevision(tx)
+		return nil
+	})
+	return rev, err
+}
+
+// get returns the value and the modification revision of the key with the current revision of the database.
+// The value is nil if the key does not exist.
+func (d *DB) get(key string) (value []byte, modRev, rev int64, err error) {
+	err = d.bolt.View(func(tx *bolt.Tx) error {
+		rev = currentRevision(tx)
+		value, modRev = getValue(tx, key)
+		return nil
+	})
+	return value, modRev, rev, err
+}
+
+// list calls fn for the keys with the prefix starting from the key "from" in the lexicographical order
+// until fn returns false.
+func (d *DB) list(prefix, from string, fn func(key string, value []byte, modRev int64) bool) (rev int64, err error) {
+	err = d.bolt.View(func(tx *bolt.Tx) error {
+		rev = currentRevision(tx)
+		forEach(tx, prefix, from, fn)
+		return nil
+	})
+	return rev, err
+}
+
+// put stores the value of the key if the modification revision of the key is expectedRev.
+// The zero expectedRev means that the key must not exist.
+// It returns errConflict if the key has been modified.
+func (d *DB) put(key string, value []byte, expectedRev int64) (int64, error) {
+	return d.update(key, value, expectedRev, false)
+}
+
+// delete removes the key if the modification revision of the key is expectedRev.
+// It returns errConflict if the key has been modified.
+func (d *DB) delete(key string, expectedRev int64) (int64, error) {
+	return d.update(key, nil, expectedRev, true)
+}
+
+func (d *DB) update(key string, value []byte, expectedRev int64, deleted bool) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	e := event{
+		key:     key,
+		value:   value,
+		deleted: deleted,
+	}
+	err := d.bolt.Update(func(tx *bolt.Tx) error {
+		prevValue, prevRev := getValue(tx, key)
+		if prevRev != expectedRev || (deleted && prevValue == nil) {
+			return errConflict
+		}
+		e.rev = currentRevision(tx) + 1
+		e.prevValue = prevValue
+		e.prevRev = prevRev
+		if err := tx.Bucket(metaBucket).Put(revisionKey, encodeRevision(e.rev)); err != nil {
+			return err
+		}
+		if deleted {
+			return tx.Bucket(objectsBucket).Delete([]byte(key))
+		}
+		return tx.Bucket(objectsBucket).Put([]byte(key), encodeValue(value, e.rev))
+	})
+	if err != nil {
+		return 0, err
+	}
+	d.appendEvent(e)
+	return e.rev, nil
+}
+
+// appendEvent adds the event to the history and sends it to watchers. It must be called under the lock.
+func (d *DB) appendEvent(e event) {
+	d.history = append(d.history, e)
+	if len(d.history) > historySize {
+		d.historyRev = d.history[0].rev
+		d.history = append(d.history[:0:0], d.history[1:]...)
+	}
+	for w := range d.watchers {
+		select {
+		case w.incoming <- e:
+		default:
+			// the watcher is too slow, it has to be restarted by the client
+			delete(d.watchers, w)
+			close(w.incoming)
+		}
+	}
+}
+
+// addWatcher registers the watcher and returns the events since the revision.
+// All existing objects are returned as created if the revision is zero.
+func (d *DB) addWatcher(w *watcher, rev int64) ([]event, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var events []event
+	if rev == 0 {
+		err := d.bolt.View(func(tx *bolt.Tx) error {
+			forEach(tx, w.key, w.key, func(key string, value []byte, modRev int64) bool {
+				if w.matchKey(key) {
+					events = append(events, event{key: key, rev: modRev, value: value})
+				}
+				return w.recursive
+			})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		if rev < d.historyRev {
+			return nil, errTooOldResourceVersion(rev, d.historyRev)
+		}
+		for _, e := range d.history {
+			if e.rev > rev && w.matchKey(e.key) {
+				events = append(events, e)
+			}
+		}
+	}
+	d.watchers[w] = struct{}{}
+	return events, nil
+}
+
+// removeWatcher unregisters the watcher.
+func (d *DB) removeWatcher(w *watcher) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, ok := d.watchers[w]; ok {
+		delete(d.watchers, w)
+		close(w.incoming)
+	}
+}
+
+func currentRevision(tx *bolt.Tx) int64 {
+	return decodeRevision(tx.Bucket(metaBucket).Get(revisionKey))
+}
+
+func getValue(tx *bolt.Tx, key string) ([]byte, int64) {
+	data := tx.Bucket(objectsBucket).Get([]byte(key))
+	if data == nil {
+		return nil, 0
+	}
+	return decodeValue(data)
+}
+
+func forEach(tx *bolt.Tx, prefix, from string, fn func(key string, value []byte, modRev int64) bool) {
+	c := tx.Bucket(objectsBucket).Cursor()
+	p := []byte(prefix)
+	for k, v := c.Seek([]byte(from)); k != nil && bytes.HasPrefix(k, p); k, v = c.Next() {
+		value, modRev := decodeValue(v)
+		if !fn(string(k), value, modRev) {
+			return
+		}
+	}
+}
+
+// encodeValue stores the modification revision before the data.
+// The result is a new slice, because bolt values are valid only during the transaction.
+func encodeValue(data []byte, modRev int64) []byte {
+	value := make([]byte, 8+len(data))
+	binary.BigEndian.PutUint64(value, uint64(modRev))
+	copy(value[8:], data)
+	return value
+}
+
+func decodeValue(value []byte) ([]byte, int64) {
+	data := make([]byte, len(value)-8)
+	copy(data, value[8:])
+	return data, int64(binary.BigEndian.Uint64(value))
+}
+
+func encodeRevision(rev int64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(rev))
+	return b
+}
+
+func decodeRevision(b []byte) int64 {
+	if len(b) != 8 {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(b))
+}
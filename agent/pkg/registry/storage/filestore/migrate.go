@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"encoding/binary"
+	"strings"
+
+	"github.com/pkg/errors"
+	bolt "go.etcd.io/bbolt"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+)
+
+const (
+	// etcdRevBytesLen is the length of the etcd revision key: the main revision, '_' and the sub revision.
+	etcdRevBytesLen = 8 + 1 + 8
+	// etcdTombstone marks the revision key of the deleted key.
+	etcdTombstone = 't'
+)
+
+var etcdKeyBucket = []byte("key")
+
+// ImportEtcd copies the latest values of keys with the prefix from the etcd database file.
+// The prefix is removed from the keys and the resourceVersions of objects are kept.
+// The database must be empty and etcd must not be running.
+// It returns the number of imported objects.
+func (d *DB) ImportEtcd(etcdDBPath, prefix string) (int, error) {
+	kvs, etcdRev, err := readEtcd(etcdDBPath, prefix)
+	if err != nil {
+		return 0, errors.Wrapf(err, "unable to read the etcd database %s", etcdDBPath)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err = d.bolt.Update(func(tx *bolt.Tx) error {
+		objects := tx.Bucket(objectsBucket)
+		if k, _ := objects.Cursor().First(); k != nil {
+			return errors.Errorf("the database is not empty, revision: %d", currentRevision(tx))
+		}
+		for key, kv := range kvs {
+			if err := objects.Put([]byte(key), encodeValue(kv.Value, kv.ModRevision)); err != nil {
+				return err
+			}
+		}
+		return tx.Bucket(metaBucket).Put(revisionKey, encodeRevision(etcdRev))
+	})
+	if err != nil {
+		return 0, err
+	}
+	d.historyRev = etcdRev
+	return len(kvs), nil
+}
+
+// readEtcd returns the latest values of keys with the prefix and the revision of the etcd database.
+func readEtcd(path, prefix string) (map[string]*mvccpb.KeyValue, int64, error) {
+	db, err := bolt.Open(path, 0o400, &bolt.Options{ReadOnly: true, Timeout: openTimeout})
+	if err != nil {
+		return nil, 0, err
+	}
+	defer db.Close()
+
+	kvs := make(map[string]*mvccpb.KeyValue)
+	var rev int64
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(etcdKeyBucket)
+		if b == nil {
+			return errors.New("the key bucket is not found")
+		}
+		// keys of the bucket are revisions, so the last value of the key is the latest one
+		return b.ForEach(func(k, v []byte) error {
+			if len(k) < etcdRevBytesLen {
+				return errors.Errorf("unexpected revision key %x", k)
+			}
+			if mainRev := int64(binary.BigEndian.Uint64(k)); mainRev > rev {
+				rev = mainRev
+			}
+			kv := &mvccpb.KeyValue{}
+			if err := kv.Unmarshal(v); err != nil {
+				return err
+			}
+			if !strings.HasPrefix(string(kv.Key), prefix) {
+				return nil
+			}
+			key := "/" + strings.TrimPrefix(strings.TrimPrefix(string(kv.Key), prefix), "/")
+			if len(k) > etcdRevBytesLen && k[etcdRevBytesLen] == etcdTombstone {
+				delete(kvs, key)
+				return nil
+			}
+			kvs[key] = kv
+			return nil
+		})
+	})
+	return kvs, rev, err
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/server/v3/embed"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/v3client"
+)
+
+func TestImportEtcd(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	etcdDir := filepath.Join(t.TempDir(), "etcd")
+
+	cfg := embed.NewConfig()
+	cfg.Dir = etcdDir
+	cfg.Logger = "zap"
+	cfg.LogLevel = "error"
+	cfg.LPUrls = []url.URL{freeLocalURL(t)}
+	cfg.LCUrls = []url.URL{freeLocalURL(t)}
+	e, err := embed.StartEtcd(cfg)
+	g.Expect(err).NotTo(HaveOccurred())
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(30 * time.Second):
+		e.Close()
+		t.Fatal("etcd server is not ready")
+	}
+	cli := v3client.New(e.Server)
+	_, err = cli.Put(ctx, "/registry/pods/default/updated", "v1")
+	g.Expect(err).NotTo(HaveOccurred())
+	created, err := cli.Put(ctx, "/registry/pods/default/created", "v1")
+	g.Expect(err).NotTo(HaveOccurred())
+	updated, err := cli.Put(ctx, "/registry/pods/default/updated", "v2")
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = cli.Put(ctx, "/registry/pods/default/deleted", "v1")
+	g.Expect(err).NotTo(HaveOccurred())
+	_, err = cli.Delete(ctx, "/registry/pods/default/deleted")
+	g.Expect(err).NotTo(HaveOccurred())
+	last, err := cli.Put(ctx, "/other/key", "v1")
+	g.Expect(err).NotTo(HaveOccurred())
+	e.Close()
+
+	db, err := Open(filepath.Join(t.TempDir(), "agent.db"))
+	g.Expect(err).NotTo(HaveOccurred())
+	defer db.Close()
+	count, err := db.ImportEtcd(filepath.Join(etcdDir, "member", "snap", "db"), "/registry/")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(count).To(Equal(2))
+
+	rev, err := db.Revision()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(rev).To(Equal(last.Header.Revision))
+
+	// the values keep the resourceVersions of objects
+	value, modRev, _, err := db.get("/pods/default/created")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(value)).To(Equal("v1"))
+	g.Expect(modRev).To(Equal(created.Header.Revision))
+	value, modRev, _, err = db.get("/pods/default/updated")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(value)).To(Equal("v2"))
+	g.Expect(modRev).To(Equal(updated.Header.Revision))
+	value, _, _, err = db.get("/pods/default/deleted")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(value).To(BeNil())
+
+	// new revisions continue after the imported revision
+	newRev, err := db.put("/pods/default/new", []byte("v1"), 0)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(newRev).To(Equal(last.Header.Revision + 1))
+
+	// the data is not imported to the database that is in use
+	_, err = db.ImportEtcd(filepath.Join(etcdDir, "member", "snap", "db"), "/registry/")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func freeLocalURL(t *testing.T) url.URL {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apiserver/pkg/registry/generic"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/storagebackend"
+	"k8s.io/apiserver/pkg/storage/storagebackend/factory"
+	"k8s.io/apiserver/pkg/storage/value"
+	"k8s.io/client-go/tools/cache"
+)
+
+// NewRESTOptionsGetter returns the generic.RESTOptionsGetter that stores all resources in the database.
+// The values of the resources are encrypted by the transformers, other resources are stored as is.
+func NewRESTOptionsGetter(db *DB, codec runtime.Codec, transformers map[schema.GroupResource]value.Transformer) generic.RESTOptionsGetter {
+	return &restOptionsGetter{
+		db:           db,
+		codec:        codec,
+		transformers: transformers,
+	}
+}
+
+type restOptionsGetter struct {
+	db           *DB
+	codec        runtime.Codec
+	transformers map[schema.GroupResource]value.Transformer
+}
+
+// GetRESTOptions implements generic.RESTOptionsGetter.
+func (g *restOptionsGetter) GetRESTOptions(resource schema.GroupResource) (generic.RESTOptions, error) {
+	return generic.RESTOptions{
+		StorageConfig: &storagebackend.ConfigForResource{
+			Config: storagebackend.Config{
+				Codec:       g.codec,
+				Transformer: g.transformers[resource],
+			},
+			GroupResource: resource,
+		},
+		Decorator:               g.decorate,
+		DeleteCollectionWorkers: 1,
+		ResourcePrefix:          resource.Group + "/" + resource.Resource,
+	}, nil
+}
+
+func (g *restOptionsGetter) decorate(config *storagebackend.ConfigForResource, _ string, _ func(obj runtime.Object) (string, error),
+	newFunc func() runtime.Object, _ func() runtime.Object, _ storage.AttrFunc, _ storage.IndexerFuncs, _ *cache.Indexers,
+) (storage.Interface, factory.DestroyFunc, error) {
+	// the database is closed by the owner
+	return NewStore(g.db, config.Codec, config.Transformer, newFunc), func() {}, nil
+}
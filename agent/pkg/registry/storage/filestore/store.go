@@ -0,0 +1,601 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/conversion"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/apiserver/pkg/storage/value"
+	"k8s.io/klog/v2"
+)
+
+// NewStore returns the storage.Interface for the objects of one resource in the database.
+// The values are stored as is if the transformer is nil.
+func NewStore(db *DB, codec runtime.Codec, transformer value.Transformer, newFunc func() runtime.Object) storage.Interface {
+	return &store{
+		db:          db,
+		codec:       codec,
+		transformer: transformer,
+		versioner:   storage.APIObjectVersioner{},
+		newFunc:     newFunc,
+	}
+}
+
+type store struct {
+	db          *DB
+	codec       runtime.Codec
+	transformer value.Transformer
+	versioner   storage.Versioner
+	newFunc     func() runtime.Object
+}
+
+var _ storage.Interface = &store{}
+
+// objState is the state of the object in the database.
+type objState struct {
+	obj  runtime.Object
+	data []byte
+	rev  int64
+}
+
+// Versioner implements storage.Interface.
+func (s *store) Versioner() storage.Versioner {
+	return s.versioner
+}
+
+// Get implements storage.Interface.
+func (s *store) Get(ctx context.Context, key string, opts storage.GetOptions, out runtime.Object) error {
+	key, err := prepareKey(key)
+	if err != nil {
+		return err
+	}
+	data, modRev, rev, err := s.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if err := s.validateMinimumResourceVersion(opts.ResourceVersion, rev); err != nil {
+		return err
+	}
+	if data == nil {
+		if opts.IgnoreNotFound {
+			return runtime.SetZeroValue(out)
+		}
+		return storage.NewKeyNotFoundError(key, 0)
+	}
+	return s.decode(data, out, modRev)
+}
+
+// Create implements storage.Interface.
+func (s *store) Create(ctx context.Context, key string, obj, out runtime.Object, ttl uint64) error {
+	key, err := prepareKey(key)
+	if err != nil {
+		return err
+	}
+	if version, err := s.versioner.ObjectResourceVersion(obj); err == nil && version != 0 {
+		return errors.New("resourceVersion should not be set on objects to be created")
+	}
+	if err := s.versioner.PrepareObjectForStorage(obj); err != nil {
+		return fmt.Errorf("PrepareObjectForStorage failed: %v", err)
+	}
+	data, err := runtime.Encode(s.codec, obj)
+	if err != nil {
+		return err
+	}
+	rev, err := s.put(ctx, key, data, 0)
+	if err != nil {
+		if errors.Is(err, errConflict) {
+			return storage.NewKeyExistsError(key, 0)
+		}
+		return err
+	}
+	if out != nil {
+		return s.decode(data, out, rev)
+	}
+	return nil
+}
+
+// Delete implements storage.Interface.
+func (s *store) Delete(ctx context.Context, key string, out runtime.Object, preconditions *storage.Preconditions,
+	validateDeletion storage.ValidateObjectFunc, cachedExistingObject runtime.Object) error {
+	key, err := prepareKey(key)
+	if err != nil {
+		return err
+	}
+	v, err := conversion.EnforcePtr(out)
+	if err != nil {
+		return fmt.Errorf("unable to convert output object to pointer: %v", err)
+	}
+	getCurrentState := func() (*objState, error) {
+		return s.getState(ctx, key, v, false)
+	}
+
+	var origState *objState
+	var origStateIsCurrent bool
+	if cachedExistingObject != nil {
+		origState, err = s.getStateFromObject(cachedExistingObject)
+	} else {
+		origState, err = getCurrentState()
+		origStateIsCurrent = true
+	}
+	if err != nil {
+		return err
+	}
+	for {
+		if err := s.checkDeletion(ctx, key, origState, preconditions, validateDeletion); err != nil {
+			if origStateIsCurrent {
+				return err
+			}
+			// the cached object may be outdated, try again with the current one
+			cachedRev := origState.rev
+			cachedDeletionErr := err
+			origState, err = getCurrentState()
+			if err != nil {
+				return err
+			}
+			origStateIsCurrent = true
+			if cachedRev == origState.rev {
+				return cachedDeletionErr
+			}
+			continue
+		}
+		rev, err := s.db.delete(key, origState.rev)
+		if errors.Is(err, errConflict) {
+			klog.V(4).Infof("deletion of %s failed because of a conflict, going to retry", key)
+			origState, err = getCurrentState()
+			if err != nil {
+				return err
+			}
+			origStateIsCurrent = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return s.decode(origState.data, out, rev)
+	}
+}
+
+func (s *store) checkDeletion(ctx context.Context, key string, state *objState,
+	preconditions *storage.Preconditions, validateDeletion storage.ValidateObjectFunc) error {
+	if preconditions != nil {
+		if err := preconditions.Check(key, state.obj); err != nil {
+			return err
+		}
+	}
+	return validateDeletion(ctx, state.obj)
+}
+
+// GuaranteedUpdate implements storage.Interface.
+func (s *store) GuaranteedUpdate(ctx context.Context, key string, destination runtime.Object, ignoreNotFound bool,
+	preconditions *storage.Preconditions, tryUpdate storage.UpdateFunc, cachedExistingObject runtime.Object) error {
+	key, err := prepareKey(key)
+	if err != nil {
+		return err
+	}
+	v, err := conversion.EnforcePtr(destination)
+	if err != nil {
+		return fmt.Errorf("unable to convert output object to pointer: %v", err)
+	}
+	getCurrentState := func() (*objState, error) {
+		return s.getState(ctx, key, v, ignoreNotFound)
+	}
+
+	var origState *objState
+	var origStateIsCurrent bool
+	if cachedExistingObject != nil {
+		origState, err = s.getStateFromObject(cachedExistingObject)
+	} else {
+		origState, err = getCurrentState()
+		origStateIsCurrent = true
+	}
+	if err != nil {
+		return err
+	}
+
+	for {
+		if err := preconditions.Check(key, origState.obj); err != nil {
+			if origStateIsCurrent {
+				return err
+			}
+			origState, err = getCurrentState()
+			if err != nil {
+				return err
+			}
+			origStateIsCurrent = true
+			continue
+		}
+
+		ret, err := s.updateState(origState, tryUpdate)
+		if err != nil {
+			if origStateIsCurrent {
+				return err
+			}
+			// the cached object may be outdated, try again with the current one
+			cachedRev := origState.rev
+			cachedUpdateErr := err
+			origState, err = getCurrentState()
+			if err != nil {
+				return err
+			}
+			origStateIsCurrent = true
+			if cachedRev == origState.rev {
+				return cachedUpdateErr
+			}
+			continue
+		}
+
+		data, err := runtime.Encode(s.codec, ret)
+		if err != nil {
+			return err
+		}
+		if origState.rev != 0 && bytes.Equal(data, origState.data) {
+			// the object has not been changed, it is not stored to keep the resourceVersion
+			if !origStateIsCurrent {
+				origState, err = getCurrentState()
+				if err != nil {
+					return err
+				}
+				origStateIsCurrent = true
+				if !bytes.Equal(data, origState.data) {
+					continue
+				}
+			}
+			return s.decode(origState.data, destination, origState.rev)
+		}
+
+		rev, err := s.put(ctx, key, data, origState.rev)
+		if errors.Is(err, errConflict) {
+			klog.V(4).Infof("GuaranteedUpdate of %s failed because of a conflict, going to retry", key)
+			origState, err = getCurrentState()
+			if err != nil {
+				return err
+			}
+			origStateIsCurrent = true
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return s.decode(data, destination, rev)
+	}
+}
+
+// GetList implements storage.Interface.
+func (s *store) GetList(ctx context.Context, key string, opts storage.ListOptions, listObj runtime.Object) error {
+	key, err := prepareKey(key)
+	if err != nil {
+		return err
+	}
+	listPtr, err := meta.GetItemsPtr(listObj)
+	if err != nil {
+		return err
+	}
+	v, err := conversion.EnforcePtr(listPtr)
+	if err != nil || v.Kind() != reflect.Slice {
+		return fmt.Errorf("need ptr to slice: %v", err)
+	}
+	// For recursive lists, the key must end with "/" to get only children of the key.
+	if opts.Recursive && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	keyPrefix := key
+	pred := opts.Predicate
+	paging := opts.Recursive && pred.Limit > 0
+
+	var fromRV *int64
+	if len(opts.ResourceVersion) > 0 {
+		parsedRV, err := s.versioner.ParseResourceVersion(opts.ResourceVersion)
+		if err != nil {
+			return apierrors.NewBadRequest(fmt.Sprintf("invalid resource version: %v", err))
+		}
+		rv := int64(parsedRV)
+		fromRV = &rv
+	}
+
+	// The database keeps only the current state of objects,
+	// so the list can be served only at the current revision.
+	var exactRV int64
+	from := key
+	switch {
+	case opts.Recursive && len(pred.Continue) > 0:
+		if len(opts.ResourceVersion) > 0 && opts.ResourceVersion != "0" {
+			return apierrors.NewBadRequest("specifying resource version is not allowed when using continue")
+		}
+		continueKey, continueRV, err := storage.DecodeContinue(pred.Continue, keyPrefix)
+		if err != nil {
+			return apierrors.NewBadRequest(fmt.Sprintf("invalid continue token: %v", err))
+		}
+		from = continueKey
+		if continueRV > 0 {
+			exactRV = continueRV
+		}
+	case fromRV != nil:
+		switch opts.ResourceVersionMatch {
+		case metav1.ResourceVersionMatchNotOlderThan:
+		case metav1.ResourceVersionMatchExact:
+			exactRV = *fromRV
+		case "": // legacy case
+			if paging && *fromRV > 0 {
+				exactRV = *fromRV
+			}
+		default:
+			return fmt.Errorf("unknown ResourceVersionMatch value: %v", opts.ResourceVersionMatch)
+		}
+	}
+
+	newItemFunc := newItemFunc(v)
+	var lastKey string
+	var hasMore bool
+	var decodeErr error
+	rev, err := s.db.list(key, from, func(itemKey string, data []byte, modRev int64) bool {
+		if !opts.Recursive && itemKey != key {
+			return false
+		}
+		if paging && int64(v.Len()) >= pred.Limit {
+			hasMore = true
+			return false
+		}
+		lastKey = itemKey
+		if data, decodeErr = s.fromStorage(ctx, itemKey, data); decodeErr != nil {
+			return false
+		}
+		if decodeErr = s.appendListItem(v, data, modRev, pred, newItemFunc); decodeErr != nil {
+			return false
+		}
+		return opts.Recursive
+	})
+	if err != nil {
+		return err
+	}
+	if decodeErr != nil {
+		return decodeErr
+	}
+	if exactRV > 0 && exactRV != rev {
+		if len(pred.Continue) > 0 {
+			return apierrors.NewResourceExpired("the provided continue parameter is too old to display a consistent list result. " +
+				"You can start a new list without the continue parameter.")
+		}
+		if exactRV > rev {
+			return storage.NewTooLargeResourceVersionError(uint64(exactRV), uint64(rev), 0)
+		}
+		return errTooOldResourceVersion(exactRV, rev)
+	}
+	if err := s.validateMinimumResourceVersion(opts.ResourceVersion, rev); err != nil {
+		return err
+	}
+	if hasMore {
+		next, err := storage.EncodeContinue(lastKey+"\x00", keyPrefix, rev)
+		if err != nil {
+			return err
+		}
+		return s.versioner.UpdateList(listObj, uint64(rev), next, nil)
+	}
+	return s.versioner.UpdateList(listObj, uint64(rev), "", nil)
+}
+
+// Watch implements storage.Interface.
+func (s *store) Watch(ctx context.Context, key string, opts storage.ListOptions) (watch.Interface, error) {
+	key, err := prepareKey(key)
+	if err != nil {
+		return nil, err
+	}
+	rev, err := s.versioner.ParseResourceVersion(opts.ResourceVersion)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Recursive && !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	return newWatcher(ctx, s, key, int64(rev), opts.Recursive, opts.Predicate), nil
+}
+
+// Count implements storage.Interface.
+func (s *store) Count(key string) (int64, error) {
+	key, err := prepareKey(key)
+	if err != nil {
+		return 0, err
+	}
+	if !strings.HasSuffix(key, "/") {
+		key += "/"
+	}
+	var count int64
+	_, err = s.db.list(key, key, func(string, []byte, int64) bool {
+		count++
+		return true
+	})
+	return count, err
+}
+
+func (s *store) getState(ctx context.Context, key string, v reflect.Value, ignoreNotFound bool) (*objState, error) {
+	state := &objState{}
+	if u, ok := v.Addr().Interface().(runtime.Unstructured); ok {
+		state.obj = u.NewEmptyInstance()
+	} else {
+		state.obj = reflect.New(v.Type()).Interface().(runtime.Object)
+	}
+	data, modRev, _, err := s.get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		if !ignoreNotFound {
+			return nil, storage.NewKeyNotFoundError(key, 0)
+		}
+		if err := runtime.SetZeroValue(state.obj); err != nil {
+			return nil, err
+		}
+		return state, nil
+	}
+	state.rev = modRev
+	state.data = data
+	if err := s.decode(data, state.obj, modRev); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+func (s *store) getStateFromObject(obj runtime.Object) (*objState, error) {
+	state := &objState{obj: obj}
+	rv, err := s.versioner.ObjectResourceVersion(obj)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't get resource version: %v", err)
+	}
+	state.rev = int64(rv)
+	// the resourceVersion is not stored, it has to be cleaned to compute the stored data
+	if err := s.versioner.PrepareObjectForStorage(obj); err != nil {
+		return nil, fmt.Errorf("PrepareObjectForStorage failed: %v", err)
+	}
+	state.data, err = runtime.Encode(s.codec, obj)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.versioner.UpdateObject(state.obj, rv); err != nil {
+		klog.Errorf("failed to update object version: %v", err)
+	}
+	return state, nil
+}
+
+func (s *store) updateState(st *objState, userUpdate storage.UpdateFunc) (runtime.Object, error) {
+	ret, _, err := userUpdate(st.obj, storage.ResponseMeta{ResourceVersion: uint64(st.rev)})
+	if err != nil {
+		return nil, err
+	}
+	if err := s.versioner.PrepareObjectForStorage(ret); err != nil {
+		return nil, fmt.Errorf("PrepareObjectForStorage failed: %v", err)
+	}
+	return ret, nil
+}
+
+// get returns the decrypted value of the key.
+func (s *store) get(ctx context.Context, key string) (data []byte, modRev, rev int64, err error) {
+	data, modRev, rev, err = s.db.get(key)
+	if err != nil || data == nil {
+		return data, modRev, rev, err
+	}
+	data, err = s.fromStorage(ctx, key, data)
+	return data, modRev, rev, err
+}
+
+// put encrypts the value and stores it in the database.
+func (s *store) put(ctx context.Context, key string, data []byte, expectedRev int64) (int64, error) {
+	if s.transformer != nil {
+		var err error
+		data, err = s.transformer.TransformToStorage(ctx, data, value.DefaultContext(key))
+		if err != nil {
+			return 0, storage.NewInternalError(err.Error())
+		}
+	}
+	return s.db.put(key, data, expectedRev)
+}
+
+// fromStorage decrypts the value of the key stored in the database.
+func (s *store) fromStorage(ctx context.Context, key string, data []byte) ([]byte, error) {
+	if s.transformer == nil {
+		return data, nil
+	}
+	data, _, err := s.transformer.TransformFromStorage(ctx, data, value.DefaultContext(key))
+	if err != nil {
+		return nil, storage.NewInternalError(err.Error())
+	}
+	return data, nil
+}
+
+// decode decodes the data into the object and sets the resourceVersion of the object.
+func (s *store) decode(data []byte, objPtr runtime.Object, rev int64) error {
+	if _, err := conversion.EnforcePtr(objPtr); err != nil {
+		return fmt.Errorf("unable to convert output object to pointer: %v", err)
+	}
+	if _, _, err := s.codec.Decode(data, nil, objPtr); err != nil {
+		return err
+	}
+	if err := s.versioner.UpdateObject(objPtr, uint64(rev)); err != nil {
+		klog.Errorf("failed to update object version: %v", err)
+	}
+	return nil
+}
+
+func (s *store) appendListItem(v reflect.Value, data []byte, rev int64, pred storage.SelectionPredicate, newItemFunc func() runtime.Object) error {
+	obj := newItemFunc()
+	if err := s.decode(data, obj, rev); err != nil {
+		return err
+	}
+	if matched, err := pred.Matches(obj); err == nil && matched {
+		v.Set(reflect.Append(v, reflect.ValueOf(obj).Elem()))
+	}
+	return nil
+}
+
+func newItemFunc(v reflect.Value) func() runtime.Object {
+	elem := v.Type().Elem()
+	return func() runtime.Object {
+		return reflect.New(elem).Interface().(runtime.Object)
+	}
+}
+
+// validateMinimumResourceVersion returns a 'too large resource' version error when the provided minimumResourceVersion is
+// greater than the current revision of the database.
+func (s *store) validateMinimumResourceVersion(minimumResourceVersion string, rev int64) error {
+	if minimumResourceVersion == "" {
+		return nil
+	}
+	minimumRV, err := s.versioner.ParseResourceVersion(minimumResourceVersion)
+	if err != nil {
+		return apierrors.NewBadRequest(fmt.Sprintf("invalid resource version: %v", err))
+	}
+	if minimumRV > uint64(rev) {
+		return storage.NewTooLargeResourceVersionError(minimumRV, uint64(rev), 0)
+	}
+	return nil
+}
+
+func errTooOldResourceVersion(rev, currentRev int64) error {
+	return apierrors.NewResourceExpired(fmt.Sprintf("too old resource version: %d (%d)", rev, currentRev))
+}
+
+func prepareKey(key string) (string, error) {
+	if key == ".." ||
+		strings.HasPrefix(key, "../") ||
+		strings.HasSuffix(key, "/..") ||
+		strings.Contains(key, "/../") {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	if key == "." ||
+		strings.HasPrefix(key, "./") ||
+		strings.HasSuffix(key, "/.") ||
+		strings.Contains(key, "/./") {
+		return "", fmt.Errorf("invalid key: %q", key)
+	}
+	if key == "" || key == "/" {
+		return "", fmt.Errorf("empty key: %q", key)
+	}
+	if key[0] != '/' {
+		key = "/" + key
+	}
+	return key, nil
+}
@@ -0,0 +1,250 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"context"
+	"crypto/aes"
+	"path/filepath"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/apis/example"
+	examplev1 "k8s.io/apiserver/pkg/apis/example/v1"
+	"k8s.io/apiserver/pkg/storage"
+	storagetesting "k8s.io/apiserver/pkg/storage/testing"
+	aestransformer "k8s.io/apiserver/pkg/storage/value/encrypt/aes"
+)
+
+var scheme = runtime.NewScheme()
+var codecs = serializer.NewCodecFactory(scheme)
+
+func init() {
+	metav1.AddToGroupVersion(scheme, metav1.SchemeGroupVersion)
+	utilruntime.Must(example.AddToScheme(scheme))
+	utilruntime.Must(examplev1.AddToScheme(scheme))
+}
+
+func testSetup(t *testing.T) (context.Context, *DB, storage.Interface) {
+	db, err := Open(filepath.Join(t.TempDir(), "agent.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	store := NewStore(db, codecs.LegacyCodec(examplev1.SchemeGroupVersion), nil, func() runtime.Object { return &example.Pod{} })
+	return context.Background(), db, store
+}
+
+func checkStorageInvariants(db *DB) storagetesting.KeyValidation {
+	return func(ctx context.Context, t *testing.T, key string) {
+		data, _, _, err := db.get(key)
+		if err != nil {
+			t.Fatalf("unable to get %s: %v", key, err)
+		}
+		if data == nil {
+			t.Fatalf("key %s is not found", key)
+		}
+	}
+}
+
+func TestCreate(t *testing.T) {
+	ctx, db, store := testSetup(t)
+	storagetesting.RunTestCreate(ctx, t, store, checkStorageInvariants(db))
+}
+
+func TestCreateWithKeyExist(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestCreateWithKeyExist(ctx, t, store)
+}
+
+func TestGet(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestGet(ctx, t, store)
+}
+
+func TestUnconditionalDelete(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestUnconditionalDelete(ctx, t, store)
+}
+
+func TestConditionalDelete(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestConditionalDelete(ctx, t, store)
+}
+
+func TestDeleteWithSuggestionAndConflict(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestDeleteWithSuggestionAndConflict(ctx, t, store)
+}
+
+func TestValidateDeletionWithSuggestion(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestValidateDeletionWithSuggestion(ctx, t, store)
+}
+
+func TestListContinuationWithFilter(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestListContinuationWithFilter(ctx, t, store, func(*testing.T, uint64, uint64) {})
+}
+
+func TestGuaranteedUpdateWithConflict(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestGuaranteedUpdateWithConflict(ctx, t, store)
+}
+
+func TestGuaranteedUpdateWithSuggestionAndConflict(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestGuaranteedUpdateWithSuggestionAndConflict(ctx, t, store)
+}
+
+func TestCount(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestCount(ctx, t, store)
+}
+
+func TestGetListEmpty(t *testing.T) {
+	g := NewWithT(t)
+	ctx, _, store := testSetup(t)
+	list := &example.PodList{}
+	g.Expect(store.GetList(ctx, "/pods", storage.ListOptions{Predicate: storage.Everything, Recursive: true}, list)).To(Succeed())
+	g.Expect(list.Items).To(BeEmpty())
+	g.Expect(list.ResourceVersion).To(Equal("1"))
+}
+
+func TestWatch(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestWatch(ctx, t, store)
+}
+
+func TestDeleteTriggerWatch(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestDeleteTriggerWatch(ctx, t, store)
+}
+
+func TestWatchFromNoneZero(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestWatchFromNoneZero(ctx, t, store)
+}
+
+func TestWatchContextCancel(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestWatchContextCancel(ctx, t, store)
+}
+
+func TestWatchDeleteEventObjectHaveLatestRV(t *testing.T) {
+	ctx, _, store := testSetup(t)
+	storagetesting.RunTestWatchDeleteEventObjectHaveLatestRV(ctx, t, store)
+}
+
+func TestWatchAfterReopen(t *testing.T) {
+	g := NewWithT(t)
+	path := filepath.Join(t.TempDir(), "agent.db")
+	newFunc := func() runtime.Object { return &example.Pod{} }
+	codec := codecs.LegacyCodec(examplev1.SchemeGroupVersion)
+	ctx := context.Background()
+
+	db, err := Open(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	out := &example.Pod{}
+	pod := &example.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo"}}
+	g.Expect(NewStore(db, codec, nil, newFunc).Create(ctx, "/pods/foo", pod, out, 0)).To(Succeed())
+	g.Expect(db.Close()).To(Succeed())
+
+	db, err = Open(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	store := NewStore(db, codec, nil, newFunc)
+	rev, err := db.Revision()
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(out.ResourceVersion).To(Equal("2"))
+	g.Expect(rev).To(Equal(int64(2)))
+
+	w, err := store.Watch(ctx, "/pods", storage.ListOptions{ResourceVersion: "0", Predicate: storage.Everything, Recursive: true})
+	g.Expect(err).NotTo(HaveOccurred())
+	e := <-w.ResultChan()
+	g.Expect(e.Type).To(Equal(watch.Added))
+	w.Stop()
+
+	pod = &example.Pod{ObjectMeta: metav1.ObjectMeta{Name: "bar"}}
+	g.Expect(store.Create(ctx, "/pods/bar", pod, &example.Pod{}, 0)).To(Succeed())
+	w, err = store.Watch(ctx, "/pods", storage.ListOptions{ResourceVersion: "2", Predicate: storage.Everything, Recursive: true})
+	g.Expect(err).NotTo(HaveOccurred())
+	e = <-w.ResultChan()
+	g.Expect(e.Type).To(Equal(watch.Added))
+	g.Expect(e.Object.(*example.Pod).Name).To(Equal("bar"))
+	w.Stop()
+
+	// the history is lost after a restart, the client has to list objects again
+	g.Expect(db.Close()).To(Succeed())
+	db, err = Open(path)
+	g.Expect(err).NotTo(HaveOccurred())
+	defer db.Close()
+	store = NewStore(db, codec, nil, newFunc)
+	w, err = store.Watch(ctx, "/pods", storage.ListOptions{ResourceVersion: "2", Predicate: storage.Everything, Recursive: true})
+	g.Expect(err).NotTo(HaveOccurred())
+	e = <-w.ResultChan()
+	g.Expect(e.Type).To(Equal(watch.Error))
+	g.Expect(apierrors.IsResourceExpired(apierrors.FromObject(e.Object))).To(BeTrue())
+}
+
+func TestEncryptedStore(t *testing.T) {
+	g := NewWithT(t)
+	block, err := aes.NewCipher([]byte("0123456789abcdef0123456789abcdef"))
+	g.Expect(err).NotTo(HaveOccurred())
+	db, err := Open(filepath.Join(t.TempDir(), "agent.db"))
+	g.Expect(err).NotTo(HaveOccurred())
+	defer db.Close()
+	ctx := context.Background()
+	store := NewStore(db, codecs.LegacyCodec(examplev1.SchemeGroupVersion), aestransformer.NewCBCTransformer(block), func() runtime.Object { return &example.Pod{} })
+
+	pod := &example.Pod{ObjectMeta: metav1.ObjectMeta{Name: "foo"}, Spec: example.PodSpec{Hostname: "secret-hostname"}}
+	g.Expect(store.Create(ctx, "/pods/foo", pod, &example.Pod{}, 0)).To(Succeed())
+	data, _, _, err := db.get("/pods/foo")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).NotTo(ContainSubstring("secret-hostname"))
+
+	out := &example.Pod{}
+	g.Expect(store.Get(ctx, "/pods/foo", storage.GetOptions{}, out)).To(Succeed())
+	g.Expect(out.Spec.Hostname).To(Equal("secret-hostname"))
+
+	list := &example.PodList{}
+	g.Expect(store.GetList(ctx, "/pods", storage.ListOptions{Predicate: storage.Everything, Recursive: true}, list)).To(Succeed())
+	g.Expect(list.Items).To(HaveLen(1))
+	g.Expect(list.Items[0].Spec.Hostname).To(Equal("secret-hostname"))
+
+	w, err := store.Watch(ctx, "/pods", storage.ListOptions{ResourceVersion: "0", Predicate: storage.Everything, Recursive: true})
+	g.Expect(err).NotTo(HaveOccurred())
+	defer w.Stop()
+	e := <-w.ResultChan()
+	g.Expect(e.Type).To(Equal(watch.Added))
+	g.Expect(e.Object.(*example.Pod).Spec.Hostname).To(Equal("secret-hostname"))
+
+	// the unchanged object is not stored again
+	updated := &example.Pod{}
+	g.Expect(store.GuaranteedUpdate(ctx, "/pods/foo", updated, false, nil,
+		func(input runtime.Object, _ storage.ResponseMeta) (runtime.Object, *uint64, error) {
+			return input, nil, nil
+		}, nil)).To(Succeed())
+	g.Expect(updated.ResourceVersion).To(Equal(out.ResourceVersion))
+}
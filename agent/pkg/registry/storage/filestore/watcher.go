@@ -0,0 +1,212 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filestore
+
+import (
+	"context"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/apiserver/pkg/storage"
+	"k8s.io/klog/v2"
+)
+
+const resultChanSize = 100
+
+// watcher sends events of the database to the client.
+type watcher struct {
+	store     *store
+	key       string
+	recursive bool
+	pred      storage.SelectionPredicate
+	// incoming is closed by the database if the watcher is not able to keep up.
+	incoming chan event
+	result   chan watch.Event
+	ctx      context.Context
+	cancel   context.CancelFunc
+}
+
+var _ watch.Interface = &watcher{}
+
+func newWatcher(ctx context.Context, s *store, key string, rev int64, recursive bool, pred storage.SelectionPredicate) *watcher {
+	w := &watcher{
+		store:     s,
+		key:       key,
+		recursive: recursive,
+		pred:      pred,
+		incoming:  make(chan event, watcherBufferSize),
+		result:    make(chan watch.Event, resultChanSize),
+	}
+	w.ctx, w.cancel = context.WithCancel(ctx)
+	initialEvents, err := s.db.addWatcher(w, rev)
+	go w.run(initialEvents, err)
+	return w
+}
+
+// Stop implements watch.Interface.
+func (w *watcher) Stop() {
+	w.cancel()
+}
+
+// ResultChan implements watch.Interface.
+func (w *watcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *watcher) run(initialEvents []event, err error) {
+	defer close(w.result)
+	if err != nil {
+		w.sendError(err)
+		return
+	}
+	defer w.store.db.removeWatcher(w)
+	for _, e := range initialEvents {
+		if !w.process(e) {
+			return
+		}
+	}
+	for {
+		select {
+		case <-w.ctx.Done():
+			return
+		case e, ok := <-w.incoming:
+			if !ok {
+				w.sendError(apierrors.NewResourceExpired("the watch is too slow to process events"))
+				return
+			}
+			if !w.process(e) {
+				return
+			}
+		}
+	}
+}
+
+func (w *watcher) matchKey(key string) bool {
+	if w.recursive {
+		return strings.HasPrefix(key, w.key)
+	}
+	return key == w.key
+}
+
+// process converts the database event to the watch event and sends it to the client.
+// It returns false if the watcher has to be stopped.
+func (w *watcher) process(e event) bool {
+	res, err := w.transform(e)
+	if err != nil {
+		klog.Errorf("unable to decode the watch event for %s: %v", e.key, err)
+		w.sendError(apierrors.NewInternalError(err))
+		return false
+	}
+	if res == nil {
+		return true
+	}
+	select {
+	case w.result <- *res:
+		return true
+	case <-w.ctx.Done():
+		return false
+	}
+}
+
+// transform returns the watch event for the database event if the object matches the predicate.
+func (w *watcher) transform(e event) (*watch.Event, error) {
+	var curObj, oldObj runtime.Object
+	var err error
+	if !e.deleted {
+		if curObj, err = w.decode(e.key, e.value, e.rev); err != nil {
+			return nil, err
+		}
+	}
+	// the previous object is needed to send the deleted object
+	// or to detect objects that stop matching the predicate
+	if e.prevValue != nil && (e.deleted || !w.pred.Empty()) {
+		// the deleted object has the resourceVersion of the deletion
+		rev := e.rev
+		if !e.deleted {
+			rev = e.prevRev
+		}
+		if oldObj, err = w.decode(e.key, e.prevValue, rev); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case e.deleted:
+		if !w.filter(oldObj) {
+			return nil, nil
+		}
+		return &watch.Event{Type: watch.Deleted, Object: oldObj}, nil
+	case e.prevValue == nil:
+		if !w.filter(curObj) {
+			return nil, nil
+		}
+		return &watch.Event{Type: watch.Added, Object: curObj}, nil
+	case w.pred.Empty():
+		return &watch.Event{Type: watch.Modified, Object: curObj}, nil
+	}
+	curObjPasses := w.filter(curObj)
+	oldObjPasses := w.filter(oldObj)
+	switch {
+	case curObjPasses && oldObjPasses:
+		return &watch.Event{Type: watch.Modified, Object: curObj}, nil
+	case curObjPasses && !oldObjPasses:
+		return &watch.Event{Type: watch.Added, Object: curObj}, nil
+	case !curObjPasses && oldObjPasses:
+		if err := w.store.versioner.UpdateObject(oldObj, uint64(e.rev)); err != nil {
+			return nil, err
+		}
+		return &watch.Event{Type: watch.Deleted, Object: oldObj}, nil
+	}
+	return nil, nil
+}
+
+func (w *watcher) filter(obj runtime.Object) bool {
+	if w.pred.Empty() {
+		return true
+	}
+	matched, err := w.pred.Matches(obj)
+	return err == nil && matched
+}
+
+func (w *watcher) decode(key string, data []byte, rev int64) (runtime.Object, error) {
+	data, err := w.store.fromStorage(w.ctx, key, data)
+	if err != nil {
+		return nil, err
+	}
+	obj := w.store.newFunc()
+	if err := w.store.decode(data, obj, rev); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (w *watcher) sendError(err error) {
+	errResult := &watch.Event{
+		Type:   watch.Error,
+		Object: &apierrors.NewInternalError(err).ErrStatus,
+	}
+	if statusErr, ok := err.(apierrors.APIStatus); ok {
+		status := statusErr.Status()
+		errResult.Object = &status
+	}
+	select {
+	case w.result <- *errResult:
+	case <-w.ctx.Done():
+	}
+}
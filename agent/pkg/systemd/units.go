@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemd
+
+import (
+	"context"
+
+	"github.com/coreos/go-systemd/v22/dbus"
+	"github.com/pkg/errors"
+)
+
+// ServiceState describes the state of the systemd service.
+type ServiceState struct {
+	// LoadState is the load state of the unit, e.g. "loaded" or "not-found".
+	LoadState string
+	// ActiveState is the high-level state of the unit, e.g. "active", "activating" or "failed".
+	ActiveState string
+	// SubState is the low-level state of the unit, e.g. "running" or "exited".
+	SubState string
+	// Result is the result of the last run of the service, e.g. "success", "exit-code" or "timeout".
+	Result string
+}
+
+// IsLoaded returns true if the unit exists.
+func (s ServiceState) IsLoaded() bool {
+	return s.LoadState == "loaded"
+}
+
+// IsRunning returns true if the main process of the service has not been completed yet.
+func (s ServiceState) IsRunning() bool {
+	switch s.ActiveState {
+	case "activating", "reloading", "deactivating":
+		return true
+	case "active":
+		return s.SubState != "exited"
+	}
+	return false
+}
+
+// IsSucceeded returns true if the main process of the service has been completed successfully.
+func (s ServiceState) IsSucceeded() bool {
+	return !s.IsRunning() && s.ActiveState != "failed" && s.Result == "success"
+}
+
+// UnitManager manages transient systemd units.
+type UnitManager interface {
+	// StartTransientService starts the transient service with the properties.
+	StartTransientService(ctx context.Context, name string, properties []dbus.Property) error
+	// GetServiceState returns the state of the service.
+	GetServiceState(ctx context.Context, name string) (*ServiceState, error)
+	// RemoveService stops the service and resets its failed state, so the transient unit is unloaded.
+	RemoveService(ctx context.Context, name string) error
+}
+
+// NewUnitManager returns the UnitManager that works with systemd over dbus.
+func NewUnitManager() UnitManager {
+	return &unitManager{}
+}
+
+type unitManager struct{}
+
+func (m *unitManager) StartTransientService(ctx context.Context, name string, properties []dbus.Property) error {
+	conn, err := dbus.NewWithContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to dbus")
+	}
+	defer conn.Close()
+
+	responseCh := make(chan string, 1)
+	if _, err := conn.StartTransientUnitContext(ctx, name, "fail", properties, responseCh); err != nil {
+		return errors.Wrapf(err, "unable to start unit %s", name)
+	}
+	select {
+	case response := <-responseCh:
+		if response != "done" {
+			return errors.Errorf("unable to start unit %s, response: %s", name, response)
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return nil
+}
+
+func (m *unitManager) GetServiceState(ctx context.Context, name string) (*ServiceState, error) {
+	conn, err := dbus.NewWithContext(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to connect to dbus")
+	}
+	defer conn.Close()
+
+	props, err := conn.GetUnitPropertiesContext(ctx, name)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get properties of unit %s", name)
+	}
+	state := &ServiceState{
+		LoadState:   stringProperty(props, "LoadState"),
+		ActiveState: stringProperty(props, "ActiveState"),
+		SubState:    stringProperty(props, "SubState"),
+	}
+	if !state.IsLoaded() {
+		return state, nil
+	}
+	result, err := conn.GetServicePropertyContext(ctx, name, "Result")
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to get result of unit %s", name)
+	}
+	state.Result, _ = result.Value.Value().(string)
+	return state, nil
+}
+
+func (m *unitManager) RemoveService(ctx context.Context, name string) error {
+	conn, err := dbus.NewWithContext(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to connect to dbus")
+	}
+	defer conn.Close()
+
+	responseCh := make(chan string, 1)
+	if _, err := conn.StopUnitContext(ctx, name, "replace", responseCh); err != nil {
+		return errors.Wrapf(err, "unable to stop unit %s", name)
+	}
+	select {
+	case <-responseCh:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	// the failed unit is not unloaded until its state is reset
+	if err := conn.ResetFailedUnitContext(ctx, name); err != nil {
+		props, propsErr := conn.GetUnitPropertiesContext(ctx, name)
+		if propsErr == nil && stringProperty(props, "LoadState") != "loaded" {
+			return nil
+		}
+		return errors.Wrapf(err, "unable to reset unit %s", name)
+	}
+	return nil
+}
+
+func stringProperty(props map[string]interface{}, name string) string {
+	value, _ := props[name].(string)
+	return value
+}
@@ -0,0 +1,64 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemd
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestServiceState(t *testing.T) {
+	tests := []struct {
+		name          string
+		state         ServiceState
+		wantRunning   bool
+		wantSucceeded bool
+	}{
+		{
+			name:        "starting",
+			state:       ServiceState{LoadState: "loaded", ActiveState: "activating", SubState: "start"},
+			wantRunning: true,
+		},
+		{
+			name:        "running",
+			state:       ServiceState{LoadState: "loaded", ActiveState: "active", SubState: "running", Result: "success"},
+			wantRunning: true,
+		},
+		{
+			name:          "exited successfully",
+			state:         ServiceState{LoadState: "loaded", ActiveState: "active", SubState: "exited", Result: "success"},
+			wantSucceeded: true,
+		},
+		{
+			name:  "failed",
+			state: ServiceState{LoadState: "loaded", ActiveState: "failed", SubState: "failed", Result: "exit-code"},
+		},
+		{
+			name:  "killed by timeout",
+			state: ServiceState{LoadState: "loaded", ActiveState: "failed", SubState: "failed", Result: "timeout"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(tt.state.IsLoaded()).To(BeTrue())
+			g.Expect(tt.state.IsRunning()).To(Equal(tt.wantRunning))
+			g.Expect(tt.state.IsSucceeded()).To(Equal(tt.wantSucceeded))
+		})
+	}
+}
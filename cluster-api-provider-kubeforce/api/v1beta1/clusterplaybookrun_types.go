@@ -0,0 +1,222 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// ClusterPlaybookRunNameLabelName is the name of the ClusterPlaybookRun that controls the Playbook.
+	ClusterPlaybookRunNameLabelName = "clusterplaybookrun.infrastructure.cluster.x-k8s.io/name"
+
+	// ClusterPlaybookRunMachineLabelName is the name of the KubeforceMachine of the Playbook.
+	ClusterPlaybookRunMachineLabelName = "clusterplaybookrun.infrastructure.cluster.x-k8s.io/machine"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=clusterplaybookruns,scope=Namespaced,shortName=cpbr
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Cluster",type="string",JSONPath=".spec.clusterName",description="Cluster"
+// +kubebuilder:printcolumn:name="Template",type="string",JSONPath=".spec.templateRef.name",description="PlaybookTemplate"
+// +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
+// +kubebuilder:printcolumn:name="Machines",type="integer",JSONPath=".status.machines",description="Number of the machines"
+// +kubebuilder:printcolumn:name="Succeeded",type="integer",JSONPath=".status.succeeded",description="Succeeded Playbooks"
+// +kubebuilder:printcolumn:name="Failed",type="integer",JSONPath=".status.failed",description="Failed Playbooks"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Time duration since creation"
+
+// ClusterPlaybookRun is the Schema for the clusterplaybookruns API.
+// It runs the playbook once on every KubeforceMachine of the cluster,
+// the control plane machines are processed first, then the worker machines.
+type ClusterPlaybookRun struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterPlaybookRunSpec   `json:"spec,omitempty"`
+	Status ClusterPlaybookRunStatus `json:"status,omitempty"`
+}
+
+// ClusterPlaybookRunSpec defines the desired state of ClusterPlaybookRun.
+type ClusterPlaybookRunSpec struct {
+	// ClusterName is the name of the Cluster in the namespace of the run.
+	// +kubebuilder:validation:MinLength=1
+	ClusterName string `json:"clusterName"`
+
+	// TemplateRef is a reference to the PlaybookTemplate in the namespace of the run.
+	// The ".tmpl" files of the template are rendered for every KubeforceMachine.
+	TemplateRef corev1.LocalObjectReference `json:"templateRef"`
+
+	// Variables are the variables of the playbook.
+	// +optional
+	Variables map[string]runtime.RawExtension `json:"variables,omitempty"`
+
+	// VariablesFrom are the variables whose values are loaded from the Secrets and ConfigMaps
+	// in the namespace of the run. They override the Variables with the same name
+	// and are delivered to the agents in the Secrets instead of the Playbook specs.
+	// +optional
+	VariablesFrom []TemplateVariable `json:"variablesFrom,omitempty"`
+
+	// Strategy describes the order of the machines and the failure threshold.
+	// +optional
+	Strategy *ClusterPlaybookRunStrategy `json:"strategy,omitempty"`
+}
+
+// ClusterPlaybookRunStrategy describes how the Playbooks are run on the machines.
+// The machines are ordered by name and split into batches, a batch is started
+// when all Playbooks of the previous batches have completed.
+type ClusterPlaybookRunStrategy struct {
+	// ControlPlaneBatchSize is the number of the control plane machines in a batch.
+	// Defaults to 1.
+	// +optional
+	// +kubebuilder:validation:Minimum=1
+	ControlPlaneBatchSize *int32 `json:"controlPlaneBatchSize,omitempty"`
+
+	// WorkerBatchSize is the number of the worker machines in a batch.
+	// Value can be an absolute number (ex: 5) or a percentage of the worker machines (ex: 10%).
+	// Absolute number is calculated from percentage by rounding up.
+	// Defaults to 1.
+	// +optional
+	WorkerBatchSize *intstr.IntOrString `json:"workerBatchSize,omitempty"`
+
+	// MaxFailures is the number of the failed Playbooks that are tolerated.
+	// Value can be an absolute number (ex: 5) or a percentage of the machines (ex: 10%).
+	// Absolute number is calculated from percentage by rounding down.
+	// No new batches are started once the number of the failed Playbooks exceeds this value.
+	// Defaults to 0.
+	// +optional
+	MaxFailures *intstr.IntOrString `json:"maxFailures,omitempty"`
+}
+
+// ClusterPlaybookRunPhase is a string representation of a ClusterPlaybookRun Phase.
+type ClusterPlaybookRunPhase string
+
+const (
+	// ClusterPlaybookRunPhaseRunning is the state when the Playbooks are being run on the machines.
+	ClusterPlaybookRunPhaseRunning ClusterPlaybookRunPhase = "Running"
+
+	// ClusterPlaybookRunPhaseSucceeded is the state when the Playbooks have completed on all machines
+	// and the number of the failed Playbooks does not exceed the threshold.
+	ClusterPlaybookRunPhaseSucceeded ClusterPlaybookRunPhase = "Succeeded"
+
+	// ClusterPlaybookRunPhaseFailed is the state when the number of the failed Playbooks exceeds the threshold.
+	ClusterPlaybookRunPhaseFailed ClusterPlaybookRunPhase = "Failed"
+)
+
+// MachinePlaybookPhase is a string representation of the Playbook phase of a machine.
+type MachinePlaybookPhase string
+
+const (
+	// MachinePlaybookPhasePending is the state when the Playbook has not been created yet.
+	MachinePlaybookPhasePending MachinePlaybookPhase = "Pending"
+
+	// MachinePlaybookPhaseRunning is the state when the Playbook has been created and has not completed yet.
+	MachinePlaybookPhaseRunning MachinePlaybookPhase = "Running"
+
+	// MachinePlaybookPhaseSucceeded is the state when the Playbook has succeeded.
+	MachinePlaybookPhaseSucceeded MachinePlaybookPhase = "Succeeded"
+
+	// MachinePlaybookPhaseFailed is the state when the Playbook has failed
+	// or the machine of the current batch has no agent to run the Playbook.
+	MachinePlaybookPhaseFailed MachinePlaybookPhase = "Failed"
+)
+
+// MachinePlaybookStatus is the result of the Playbook of a machine.
+type MachinePlaybookStatus struct {
+	// Name is the name of the KubeforceMachine.
+	Name string `json:"name"`
+
+	// ControlPlane is true if the machine is a control plane machine.
+	// +optional
+	ControlPlane bool `json:"controlPlane,omitempty"`
+
+	// Agent is the name of the KubeforceAgent of the machine.
+	// +optional
+	Agent string `json:"agent,omitempty"`
+
+	// Playbook is the name of the Playbook of the machine.
+	// +optional
+	Playbook string `json:"playbook,omitempty"`
+
+	// Phase is the phase of the Playbook.
+	Phase MachinePlaybookPhase `json:"phase"`
+
+	// Message is a human readable message with the details of the failed Playbook.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
+// ClusterPlaybookRunStatus defines the observed state of ClusterPlaybookRun.
+type ClusterPlaybookRunStatus struct {
+	// Phase is the phase of the run.
+	// +optional
+	Phase ClusterPlaybookRunPhase `json:"phase,omitempty"`
+
+	// Machines is the number of the machines of the run.
+	// +optional
+	Machines int32 `json:"machines"`
+
+	// Succeeded is the number of the succeeded Playbooks.
+	// +optional
+	Succeeded int32 `json:"succeeded"`
+
+	// Failed is the number of the failed Playbooks.
+	// +optional
+	Failed int32 `json:"failed"`
+
+	// MachineStatuses are the results of the Playbooks by the machine.
+	// +optional
+	MachineStatuses []MachinePlaybookStatus `json:"machineStatuses,omitempty"`
+
+	// CompletionTime is the time when the run reached the Succeeded or Failed phase.
+	// +optional
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+
+	// Conditions defines current service state of the ClusterPlaybookRun.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the latest generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// GetConditions returns the set of conditions for this object.
+func (in *ClusterPlaybookRun) GetConditions() clusterv1.Conditions {
+	return in.Status.Conditions
+}
+
+// SetConditions sets the conditions on this object.
+func (in *ClusterPlaybookRun) SetConditions(conditions clusterv1.Conditions) {
+	in.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterPlaybookRunList contains a list of ClusterPlaybookRun.
+type ClusterPlaybookRunList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterPlaybookRun `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterPlaybookRun{}, &ClusterPlaybookRunList{})
+}
@@ -37,6 +37,12 @@ const (
 	// an error while installing the agent; those kind of errors are usually transient and failed provisioning
 	// are automatically re-tried by the controller.
 	AgentInstallingFailedReason = "AgentInstallingFailed"
+
+	// SSHHostKeyMismatchReason (Severity=Error) documents a KubeforceAgent controller detecting
+	// the host key of the ssh server that does not match the trusted host keys.
+	// The controller does not connect to the host until the KubeforceAgent is changed, e.g. the trusted host keys
+	// are updated or the accepted host keys are reset by the ResetSSHHostKeysAnnotation.
+	SSHHostKeyMismatchReason = "SSHHostKeyMismatch"
 )
 
 const (
@@ -68,6 +74,27 @@ const (
 	AgentInfoFailedReason = "AgentInfoFailedReason"
 )
 
+const (
+	// AgentUpgradedCondition documents that the installed agent has the version from the agent source.
+	AgentUpgradedCondition clusterv1.ConditionType = "AgentUpgraded"
+	// AgentUpgradingReason (Severity=Info) documents a KubeforceAgent waiting for the agent to be upgraded.
+	AgentUpgradingReason = "AgentUpgrading"
+	// WaitingForMachineBootstrapReason (Severity=Info) documents a KubeforceAgent waiting for the KubeforceMachine
+	// that uses the agent to finish the bootstrap process before the upgrade.
+	WaitingForMachineBootstrapReason = "WaitingForMachineBootstrap"
+	// AgentUpgradeFailedReason (Severity=Warning) documents a KubeforceAgent controller detecting
+	// an error while upgrading the agent; the upgrade is automatically re-tried by the controller.
+	AgentUpgradeFailedReason = "AgentUpgradeFailed"
+)
+
+const (
+	// AnsibleBundleUploadedCondition documents that the wheel bundle of ansible-core has been uploaded to the agent.
+	AnsibleBundleUploadedCondition clusterv1.ConditionType = "AnsibleBundleUploaded"
+	// AnsibleBundleUploadFailedReason (Severity=Warning) documents a KubeforceAgent controller detecting
+	// an error while uploading the ansible bundle to the agent.
+	AnsibleBundleUploadFailedReason = "AnsibleBundleUploadFailed"
+)
+
 const (
 	// InitPlaybooksCondition provides an observation for the Playbooks during initialization process of the Object.
 	InitPlaybooksCondition clusterv1.ConditionType = "InitPlaybooksCompleted"
@@ -83,6 +110,14 @@ const (
 	// WaitingForCompletionPhaseReason (Severity=Info).
 	WaitingForCompletionPhaseReason = "WaitingForCompletionPhase"
 
+	// TemplateRenderingFailedReason (Severity=Error) documents a KubeforceMachine detecting
+	// an error while rendering the templates of the playbook files.
+	TemplateRenderingFailedReason = "TemplateRenderingFailed"
+
+	// PlaybookSourceFailedReason (Severity=Error) documents a KubeforceMachine detecting
+	// an error while loading the files of the playbook source.
+	PlaybookSourceFailedReason = "PlaybookSourceFailed"
+
 	// WaitingForClusterInfrastructureReason (Severity=Info) documents a KubeforceMachine waiting for the cluster
 	// infrastructure to be ready before starting.
 	WaitingForClusterInfrastructureReason = "WaitingForClusterInfrastructure"
@@ -91,6 +126,18 @@ const (
 const (
 	// CleanupPlaybooksCondition provides an observation for the Playbooks of the cleanup process of the Object.
 	CleanupPlaybooksCondition clusterv1.ConditionType = "CleanupPlaybooksCompleted"
+
+	// PreBootstrapPlaybooksCondition provides an observation for the Playbooks that are executed before the bootstrap.
+	PreBootstrapPlaybooksCondition clusterv1.ConditionType = "PreBootstrapPlaybooksCompleted"
+
+	// PostBootstrapPlaybooksCondition provides an observation for the Playbooks that are executed after the bootstrap.
+	PostBootstrapPlaybooksCondition clusterv1.ConditionType = "PostBootstrapPlaybooksCompleted"
+
+	// PreDeletePlaybooksCondition provides an observation for the Playbooks that are executed before the deletion.
+	PreDeletePlaybooksCondition clusterv1.ConditionType = "PreDeletePlaybooksCompleted"
+
+	// UpgradePlaybooksCondition provides an observation for the Playbooks of the Kubernetes version upgrade.
+	UpgradePlaybooksCondition clusterv1.ConditionType = "UpgradePlaybooksCompleted"
 )
 
 const (
@@ -144,6 +191,10 @@ const (
 	// SynchronizationFailedReason (Severity=Error) documents a controller detecting
 	// an error while synchronizing the object.
 	SynchronizationFailedReason = "SynchronizationFailed"
+
+	// WaitingForApprovalReason (Severity=Info) documents a PlaybookDeployment waiting for
+	// the approval of the new revision before the revision is propagated to the agent.
+	WaitingForApprovalReason = "WaitingForApproval"
 )
 const (
 	// BootstrapExecSucceededCondition provides an observation of the KubeforceMachine bootstrap process.
@@ -178,3 +229,39 @@ const (
 	// errors are usually transient and failed provisioning are automatically re-tried by the controller.
 	LoadBalancerProvisioningFailedReason = "LoadBalancerProvisioningFailed"
 )
+
+// Conditions and condition Reasons for the PlaybookDeploymentSet object.
+const (
+	// RolloutCompletedCondition documents that the PlaybookDeployments of all selected agents
+	// have been updated to the current revision and have succeeded.
+	RolloutCompletedCondition clusterv1.ConditionType = "RolloutCompleted"
+
+	// RollingUpdateReason (Severity=Info) documents a PlaybookDeploymentSet waiting for
+	// the PlaybookDeployments to be updated and completed.
+	RollingUpdateReason = "RollingUpdate"
+
+	// RolloutPausedOnFailureReason (Severity=Warning) documents a PlaybookDeploymentSet that stopped
+	// the update because a PlaybookDeployment of the current revision has failed.
+	RolloutPausedOnFailureReason = "RolloutPausedOnFailure"
+
+	// RolloutPausedReason (Severity=Info) documents a paused PlaybookDeploymentSet.
+	RolloutPausedReason = "RolloutPaused"
+
+	// TemplateFailedReason (Severity=Error) documents a PlaybookDeploymentSet controller detecting
+	// an error while getting the template or loading the files of the template source.
+	TemplateFailedReason = "TemplateFailed"
+)
+
+// Conditions and condition Reasons for the ClusterPlaybookRun object.
+const (
+	// RunCompletedCondition documents that the Playbooks have completed on all machines of the cluster.
+	RunCompletedCondition clusterv1.ConditionType = "RunCompleted"
+
+	// RunInProgressReason (Severity=Info) documents a ClusterPlaybookRun waiting for
+	// the Playbooks of the current batch to complete.
+	RunInProgressReason = "RunInProgress"
+
+	// FailureThresholdExceededReason (Severity=Error) documents a ClusterPlaybookRun that stopped
+	// because the number of the failed Playbooks exceeds the threshold.
+	FailureThresholdExceededReason = "FailureThresholdExceeded"
+)
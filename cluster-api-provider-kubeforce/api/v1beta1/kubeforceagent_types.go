@@ -32,6 +32,11 @@ const (
 
 	// AgentMachineLabel is a name of the KubeforceMachine using this agent.
 	AgentMachineLabel = "kubeforceagent.infrastructure.cluster.x-k8s.io/machine"
+
+	// ResetSSHHostKeysAnnotation requests the controller to forget the ssh host keys
+	// accepted by the TrustOnFirstUse host key policy, so the new host keys of the reinstalled host are accepted.
+	// The controller removes the annotation after the host keys are reset.
+	ResetSSHHostKeysAnnotation = "kubeforceagent.infrastructure.cluster.x-k8s.io/reset-ssh-host-keys"
 )
 
 // +kubebuilder:resource:path=kubeforceagents,scope=Namespaced,shortName=kfa
@@ -109,6 +114,51 @@ type AgentConfigSpec struct {
 	// Authentication specifies how requests to the Agent's server are authenticated
 	// +optional
 	Authentication AgentAuthentication `json:"authentication"`
+	// Ansible defines the managed ansible runtime of the agent.
+	// Ansible is installed system-wide by pip if it is not specified.
+	// +optional
+	Ansible *AnsibleRuntime `json:"ansible,omitempty"`
+	// Encryption enables the encryption at rest of the objects stored by the agent.
+	// The objects are stored in plaintext if it is not specified.
+	// +optional
+	Encryption *AgentEncryption `json:"encryption,omitempty"`
+}
+
+// AgentEncryption defines the encryption at rest of the agent objects.
+// The encryption key is generated on the host when the agent starts and is stored outside the agent data directory.
+type AgentEncryption struct {
+	// Provider is the provider that encrypts the objects. The default is "aescbc".
+	// +kubebuilder:validation:Enum=aescbc;secretbox
+	// +optional
+	Provider string `json:"provider,omitempty"`
+}
+
+// AnsibleRuntime defines the managed ansible runtime of the agent.
+// Every version of ansible-core is installed into a separate virtualenv on the host.
+type AnsibleRuntime struct {
+	// Version is the version of ansible-core for the playbooks that do not specify it.
+	// The default version of the agent is used if it is not specified.
+	// +optional
+	Version string `json:"version,omitempty"`
+	// Offline specifies that ansible-core is installed from the wheel bundle without access to the package index.
+	// The bundle is uploaded from the BundleSource or through the agent API by the user.
+	// +optional
+	Offline bool `json:"offline,omitempty"`
+	// BundleSource is the source of the wheel bundle for the offline mode.
+	// +optional
+	BundleSource *AnsibleBundleSource `json:"bundleSource,omitempty"`
+}
+
+// AnsibleBundleSource describes the repository from where the wheel bundle of ansible-core is downloaded.
+// The bundle is a tar.gz archive of the wheels of ansible-core and all its dependencies
+// with the name "ansible-core-<version>.tar.gz".
+type AnsibleBundleSource struct {
+	// RepoRef specifies a repository of the bundle.
+	RepoRef RepositoryReference `json:"repoRef"`
+	// Path to the directory containing the bundle.
+	// The default is empty, which translates to the root path of the RepositoryReference.
+	// +optional
+	Path string `json:"path,omitempty"`
 }
 
 // CertificateTemplate is a template for Certificate object.
@@ -225,14 +275,124 @@ type SSHParams struct {
 	Username string `json:"username,omitempty"`
 	// SecretName is the name of the secret that stores the password or private ssh key.
 	SecretName string `json:"secretName,omitempty"`
+	// HostKeyPolicy defines how the host key of the ssh server is verified.
+	// Defaults to Strict if KnownHostsSecretName or HostKeyFingerprints is specified, otherwise to TrustOnFirstUse.
+	// +kubebuilder:validation:Enum=Strict;TrustOnFirstUse;Insecure
+	// +optional
+	HostKeyPolicy SSHHostKeyPolicy `json:"hostKeyPolicy,omitempty"`
+	// KnownHostsSecretName is the name of the secret that stores the known_hosts file in the OpenSSH format
+	// under the known_hosts key. It is used by the Strict host key policy.
+	// +optional
+	KnownHostsSecretName string `json:"knownHostsSecretName,omitempty"`
+	// HostKeyFingerprints are the pinned SHA256 fingerprints of the host keys,
+	// e.g. SHA256:nThbg6kXUpJWGl7E1IGOCspRomTxdCARLviKw6E5SY8. They are used by the Strict host key policy.
+	// +optional
+	HostKeyFingerprints []string `json:"hostKeyFingerprints,omitempty"`
+	// ProxyJump is the list of jump hosts that are used to reach the host, in the order of the connection.
+	// The first jump host is dialed directly and each following host is dialed through the previous one.
+	// A KubeforceAgentGroup template can set a shared bastion for all hosts of the group.
+	// +optional
+	ProxyJump []SSHJumpHost `json:"proxyJump,omitempty"`
+	// Become defines how the privileges are escalated to install the agent.
+	// Defaults to sudo without a password.
+	// +optional
+	Become *BecomeParams `json:"become,omitempty"`
+	// UploadDir is the directory on the host where the agent files are uploaded before the installation.
+	// It is created if it does not exist. Defaults to the home directory of the user.
+	// +optional
+	UploadDir string `json:"uploadDir,omitempty"`
 }
 
+// BecomeParams describes the privilege escalation on the host.
+type BecomeParams struct {
+	// Method is the privilege escalation method.
+	// None runs the commands as the ssh user, e.g. if the user is root.
+	// +kubebuilder:validation:Enum=sudo;su;doas;none
+	// +kubebuilder:default=sudo
+	// +optional
+	Method BecomeMethod `json:"method,omitempty"`
+	// PasswordSecretName is the name of the secret that stores the password for the privilege escalation.
+	// Defaults to the secret of the ssh connection if PasswordKey is specified.
+	// +optional
+	PasswordSecretName string `json:"passwordSecretName,omitempty"`
+	// PasswordKey is the key of the password in the secret.
+	// Defaults to become-password if PasswordSecretName is specified.
+	// +optional
+	PasswordKey string `json:"passwordKey,omitempty"`
+}
+
+// BecomeMethod is the method of the privilege escalation.
+type BecomeMethod string
+
+const (
+	// BecomeMethodSudo escalates the privileges with sudo.
+	BecomeMethodSudo BecomeMethod = "sudo"
+
+	// BecomeMethodSu escalates the privileges with su, the password is the password of root.
+	BecomeMethodSu BecomeMethod = "su"
+
+	// BecomeMethodDoas escalates the privileges with doas.
+	BecomeMethodDoas BecomeMethod = "doas"
+
+	// BecomeMethodNone does not escalate the privileges.
+	BecomeMethodNone BecomeMethod = "none"
+)
+
+// SSHJumpHost describes the ssh server that is used as a jump host.
+type SSHJumpHost struct {
+	// Host is the address of the jump host.
+	// +kubebuilder:validation:MinLength=1
+	Host string `json:"host"`
+	// Port is the port for ssh connection.
+	// +kubebuilder:default=22
+	// +optional
+	Port int `json:"port,omitempty"`
+	// Username is a name of user to connect via ssh.
+	Username string `json:"username,omitempty"`
+	// SecretName is the name of the secret that stores the password or private ssh key.
+	SecretName string `json:"secretName,omitempty"`
+	// HostKeyPolicy defines how the host key of the jump host is verified.
+	// Defaults to Strict if KnownHostsSecretName or HostKeyFingerprints is specified, otherwise to TrustOnFirstUse.
+	// +kubebuilder:validation:Enum=Strict;TrustOnFirstUse;Insecure
+	// +optional
+	HostKeyPolicy SSHHostKeyPolicy `json:"hostKeyPolicy,omitempty"`
+	// KnownHostsSecretName is the name of the secret that stores the known_hosts file in the OpenSSH format
+	// under the known_hosts key. It is used by the Strict host key policy.
+	// +optional
+	KnownHostsSecretName string `json:"knownHostsSecretName,omitempty"`
+	// HostKeyFingerprints are the pinned SHA256 fingerprints of the host keys. They are used by the Strict host key policy.
+	// +optional
+	HostKeyFingerprints []string `json:"hostKeyFingerprints,omitempty"`
+}
+
+// SSHHostKeyPolicy defines how the host key of the ssh server is verified.
+type SSHHostKeyPolicy string
+
+const (
+	// SSHHostKeyPolicyStrict accepts only the host keys of the known hosts or the pinned fingerprints.
+	SSHHostKeyPolicyStrict SSHHostKeyPolicy = "Strict"
+
+	// SSHHostKeyPolicyTrustOnFirstUse accepts the host key of the first connection and records it
+	// in the status of the agent, the following connections must present the recorded key.
+	SSHHostKeyPolicyTrustOnFirstUse SSHHostKeyPolicy = "TrustOnFirstUse"
+
+	// SSHHostKeyPolicyInsecure accepts any host key.
+	SSHHostKeyPolicyInsecure SSHHostKeyPolicy = "Insecure"
+)
+
 // Addresses is addresses assigned to the node.
 type Addresses struct {
 	// +optional
 	ExternalIP string `json:"externalIP,omitempty"`
 	// +optional
 	InternalIP string `json:"internalIP,omitempty"`
+	// ExternalIPv6 is the external IPv6 address of the host.
+	// It is used to connect to the host if ExternalDNS and ExternalIP are empty.
+	// +optional
+	ExternalIPv6 string `json:"externalIPv6,omitempty"`
+	// InternalIPv6 is the internal IPv6 address of the host.
+	// +optional
+	InternalIPv6 string `json:"internalIPv6,omitempty"`
 	// +optional
 	ExternalDNS string `json:"externalDNS,omitempty"`
 	// +optional
@@ -276,6 +436,35 @@ type KubeforceAgentStatus struct {
 	// AgentInfo is information that describes the installed agent.
 	// +optional
 	SystemInfo *SystemInfo `json:"systemInfo,omitempty"`
+
+	// LastUpgrade describes the last attempt to upgrade the agent.
+	// +optional
+	LastUpgrade *AgentUpgradeStatus `json:"lastUpgrade,omitempty"`
+
+	// AnsibleBundles are the file names of the ansible bundles uploaded to the agent.
+	// The bundles of the default version and the versions of the Playbooks
+	// and PlaybookDeployments of the agent are uploaded.
+	// +optional
+	AnsibleBundles []string `json:"ansibleBundles,omitempty"`
+
+	// SSHHostKey is the host key of the ssh server in the authorized_keys format
+	// that has been accepted by the TrustOnFirstUse host key policy.
+	// Set the ResetSSHHostKeysAnnotation on the KubeforceAgent to accept the new host key of the reinstalled host.
+	// +optional
+	SSHHostKey string `json:"sshHostKey,omitempty"`
+
+	// SSHJumpHostKeys are the host keys of the jump hosts in the authorized_keys format
+	// that have been accepted by the TrustOnFirstUse host key policy, keyed by the address of the jump host.
+	// +optional
+	SSHJumpHostKeys map[string]string `json:"sshJumpHostKeys,omitempty"`
+}
+
+// AgentUpgradeStatus describes an attempt to upgrade the agent.
+type AgentUpgradeStatus struct {
+	// Version is the target version of the agent.
+	Version string `json:"version"`
+	// StartTime is the time when the upgrade was started.
+	StartTime metav1.Time `json:"startTime"`
 }
 
 // AgentInfo is information that describes the installed agent.
@@ -305,6 +494,12 @@ type NetworkInfo struct {
 	// DefaultIPAddress is an ip address from default route
 	// +optional
 	DefaultIPAddress string `json:"defaultIPAddress"`
+	// DefaultIPv4Address is an ip address from the IPv4 default route
+	// +optional
+	DefaultIPv4Address string `json:"defaultIPv4Address,omitempty"`
+	// DefaultIPv6Address is an ip address from the IPv6 default route
+	// +optional
+	DefaultIPv6Address string `json:"defaultIPv6Address,omitempty"`
 	// DefaultInterfaceName is a network interface from default route
 	// +optional
 	DefaultInterfaceName string `json:"defaultInterfaceName"`
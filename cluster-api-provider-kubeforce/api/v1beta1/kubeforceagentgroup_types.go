@@ -18,6 +18,7 @@ package v1beta1
 
 import (
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/conditions"
 )
@@ -33,6 +34,7 @@ const (
 // +kubebuilder:subresource:status
 // +kubebuilder:storageversion
 // +kubebuilder:printcolumn:name="Replicas",type="integer",JSONPath=".status.replicas",description="Replicas"
+// +kubebuilder:printcolumn:name="Updated",type="integer",JSONPath=".status.updatedReplicas",description="Agents running the version from the template"
 // +kubebuilder:printcolumn:name="Ready",type="boolean",JSONPath=".status.ready",description="KubeforceAgentGroup ready state"
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Time duration since creation of KubeforceAgentGroup"
 
@@ -54,6 +56,20 @@ type KubeforceAgentGroupSpec struct {
 	// Template defines the agents that will be created from this kubeforce agent template.
 	// +optional
 	Template KubeforceAgentTemplateSpec `json:"template,omitempty"`
+
+	// UpgradeStrategy describes how to upgrade the agents to the version from the template.
+	// +optional
+	UpgradeStrategy *AgentUpgradeStrategy `json:"upgradeStrategy,omitempty"`
+}
+
+// AgentUpgradeStrategy describes how to upgrade the agents of the group.
+type AgentUpgradeStrategy struct {
+	// MaxUnavailable is the maximum number of agents that can be unavailable during the upgrade.
+	// Value can be an absolute number (ex: 5) or a percentage of agents (ex: 10%).
+	// Absolute number is calculated from percentage by rounding down, but it is at least 1.
+	// Defaults to 1.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
 }
 
 // KubeforceAgentTemplateSpec describes the data a KubeforceAgent should have when created from a template.
@@ -85,6 +101,10 @@ type KubeforceAgentGroupStatus struct {
 	// +optional
 	ReadyReplicas int32 `json:"readyReplicas"`
 
+	// UpdatedReplicas is the number of agents that run the version from the template.
+	// +optional
+	UpdatedReplicas int32 `json:"updatedReplicas"`
+
 	// ObservedGeneration is the latest generation observed by the controller.
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
@@ -102,6 +102,36 @@ type PlaybookTemplates struct {
 	// +kubebuilder:pruning:PreserveUnknownFields
 	// +kubebuilder:validation:Schemaless
 	Variables map[string]runtime.RawExtension `json:"variables,omitempty"`
+
+	// VariablesFrom are the sensitive variables whose values are loaded from Secrets or ConfigMaps
+	// in the namespace of the object. They are resolved when the Playbook or PlaybookDeployment is created,
+	// the PlaybookDeployments are updated when the values are changed. The variables are delivered to the agent
+	// as a separate secret file, so their values are not stored in the spec.
+	// The agent removes the file with the other playbook files if PurgeFilesAfterSuccess is enabled.
+	// The file is placed in the group_vars directory next to the entrypoint of the playbook,
+	// so these variables must not be defined in the vars of the play.
+	// +optional
+	VariablesFrom []TemplateVariable `json:"variablesFrom,omitempty"`
+}
+
+// TemplateVariable is a variable whose value is loaded from a Secret or a ConfigMap.
+type TemplateVariable struct {
+	// Name is the name of the variable.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+	// ValueFrom is the source of the value of the variable.
+	ValueFrom TemplateVariableSource `json:"valueFrom"`
+}
+
+// TemplateVariableSource selects the value of the variable.
+// Exactly one of SecretKeyRef and ConfigMapKeyRef must be specified.
+type TemplateVariableSource struct {
+	// SecretKeyRef selects a key of the Secret in the namespace of the object.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+	// ConfigMapKeyRef selects a key of the ConfigMap in the namespace of the object.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
 }
 
 // TemplateReference is the reference to the PlaybookTemplate or PlaybookDeploymentTemplate.
@@ -121,10 +151,17 @@ type TemplateReference struct {
 	APIVersion string `json:"apiVersion,omitempty"`
 	// The priority value.
 	// The higher the value, the higher the priority.
+	// A role without DependsOn is executed after all roles of the same type with a higher priority.
+	// The roles without DependsOn that have the same priority are executed one by one in the order of the role names.
 	Priority int32 `json:"priority,omitempty"`
+	// DependsOn are the roles of the same type that must be completed before this role is executed.
+	// If it is specified, the priority does not affect the order of this role.
+	// The roles that do not depend on each other are executed in parallel.
+	// +optional
+	DependsOn []string `json:"dependsOn,omitempty"`
 	// Type indicates in which phase of the KubeforceMachine life cycle this template will be executed.
 	// +optional
-	// +kubebuilder:validation:Enum=install;delete
+	// +kubebuilder:validation:Enum=install;delete;preBootstrap;postBootstrap;preDelete;upgrade
 	Type TemplateType `json:"type,omitempty"`
 }
 
@@ -136,8 +173,29 @@ const (
 	TemplateTypeInstall = "install"
 	// TemplateTypeDelete generated Playbooks from this template when the object is deleted.
 	TemplateTypeDelete = "delete"
+	// TemplateTypePreBootstrap creates Playbooks from this template right before the bootstrap playbook.
+	TemplateTypePreBootstrap = "preBootstrap"
+	// TemplateTypePostBootstrap creates Playbooks from this template after the node joins the cluster
+	// and the ProviderID is set.
+	TemplateTypePostBootstrap = "postBootstrap"
+	// TemplateTypePreDelete creates Playbooks from this template when the object is deleted,
+	// before the playbooks of the object are removed and the cleanup playbooks are executed.
+	TemplateTypePreDelete = "preDelete"
+	// TemplateTypeUpgrade creates Playbooks from this template when the Kubernetes version of the Machine changes.
+	// The Playbooks are removed after the upgrade, so they are executed again on the next upgrade.
+	TemplateTypeUpgrade = "upgrade"
 )
 
+// TemplateTypes are all supported template types.
+var TemplateTypes = []TemplateType{
+	TemplateTypeInstall,
+	TemplateTypeDelete,
+	TemplateTypePreBootstrap,
+	TemplateTypePostBootstrap,
+	TemplateTypePreDelete,
+	TemplateTypeUpgrade,
+}
+
 // KubeforceMachineStatus defines the observed state of KubeforceMachine.
 type KubeforceMachineStatus struct {
 	// Ready denotes that the machine is ready
@@ -156,6 +214,20 @@ type KubeforceMachineStatus struct {
 	// DefaultIPAddress is an ip address from default route.
 	DefaultIPAddress string `json:"defaultIPAddress,omitempty"`
 
+	// DefaultIPv6Address is an ip address from the IPv6 default route.
+	// +optional
+	DefaultIPv6Address string `json:"defaultIPv6Address,omitempty"`
+
+	// KubernetesVersion is the Kubernetes version that the machine has been bootstrapped or upgraded to.
+	// The upgrade playbooks are executed when it differs from the version of the Machine.
+	// +optional
+	KubernetesVersion string `json:"kubernetesVersion,omitempty"`
+
+	// UpgradeVersion is the Kubernetes version whose upgrade playbooks have been completed.
+	// The KubernetesVersion is set to this version after the upgrade playbooks are removed.
+	// +optional
+	UpgradeVersion string `json:"upgradeVersion,omitempty"`
+
 	// Conditions defines current service state of the KubeforceMachine.
 	// +optional
 	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
@@ -175,6 +247,12 @@ type PlaybookCondition struct {
 	// Phase is the phase of a Playbook, high-level summary of where the Playbook is in its lifecycle.
 	// +optional
 	Phase string `json:"externalPhase,omitempty"`
+	// State is the state of the role in the dependency graph.
+	// +optional
+	State PlaybookRoleState `json:"state,omitempty"`
+	// BlockedBy are the roles that must be completed before the playbook of this role is created.
+	// +optional
+	BlockedBy []string `json:"blockedBy,omitempty"`
 	// Last time the condition transitioned from one status to another.
 	// This should be when the underlying condition changed. If that is not known, then using the time when
 	// the API field changed is acceptable.
@@ -182,6 +260,18 @@ type PlaybookCondition struct {
 	LastTransitionTime metav1.Time `json:"lastTransitionTime"`
 }
 
+// PlaybookRoleState is the state of the role in the dependency graph.
+type PlaybookRoleState string
+
+const (
+	// PlaybookRoleBlocked means that the role waits for the roles it depends on.
+	PlaybookRoleBlocked PlaybookRoleState = "Blocked"
+	// PlaybookRoleWaiting means that the playbook of the role is being executed.
+	PlaybookRoleWaiting PlaybookRoleState = "Waiting"
+	// PlaybookRoleCompleted means that the playbook of the role has been completed successfully.
+	PlaybookRoleCompleted PlaybookRoleState = "Completed"
+)
+
 // PlaybookInfo describes the high-level summary of controlled playbooks.
 type PlaybookInfo struct {
 	// Name is a name of playbook
@@ -17,6 +17,7 @@ limitations under the License.
 package v1beta1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
@@ -49,6 +50,74 @@ type PlaybookTemplateSpec struct {
 	// More info: https://git.k8s.io/community/contributors/devel/sig-architecture/api-conventions.md#spec-and-status
 	// +optional
 	Spec RemotePlaybookSpec `json:"spec,omitempty"`
+
+	// Source is the external source of the playbook files.
+	// It is used only in the PlaybookTemplate and PlaybookDeploymentTemplate, the files of the source
+	// are loaded when the playbook is created from the template, and the Files of the Spec override them.
+	// The source files must be text files, the binary files can be added with the FileSources.
+	// +optional
+	Source *PlaybookSource `json:"source,omitempty"`
+}
+
+// PlaybookSource describes where the file tree of the playbook is loaded from.
+// Exactly one of Git, OCI and ConfigMaps must be specified.
+type PlaybookSource struct {
+	// Git loads the files from the git repository.
+	// +optional
+	Git *GitSource `json:"git,omitempty"`
+	// OCI loads the files from the layers of the OCI artifact.
+	// +optional
+	OCI *OCISource `json:"oci,omitempty"`
+	// ConfigMaps loads the files from the ConfigMaps in the namespace of the object.
+	// +optional
+	ConfigMaps []ConfigMapSource `json:"configMaps,omitempty"`
+}
+
+// GitSource selects the directory of the git repository.
+type GitSource struct {
+	// URL is the URL of the git repository, e.g. https://github.com/org/playbooks.git or ssh://git@github.com/org/playbooks.git.
+	URL string `json:"url"`
+	// Ref is the branch, the tag or the commit of the repository.
+	// Defaults to the default branch.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+	// Path is the directory of the repository with the playbook files.
+	// Defaults to the root of the repository.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// SecretRef is a reference to the Secret in the namespace of the object with the credentials.
+	// The Secret contains the username and password keys for HTTP(S) repositories,
+	// or the ssh-privatekey and known_hosts keys for SSH repositories.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+}
+
+// OCISource selects the directory of the OCI artifact.
+// The layers of the artifact must be tar archives, optionally compressed with gzip.
+type OCISource struct {
+	// Image is the reference of the artifact, e.g. ghcr.io/org/playbooks:v1.0.0 or ghcr.io/org/playbooks@sha256:<digest>.
+	Image string `json:"image"`
+	// Path is the directory of the artifact with the playbook files.
+	// Defaults to the root of the artifact.
+	// +optional
+	Path string `json:"path,omitempty"`
+	// SecretRef is a reference to the Secret in the namespace of the object
+	// with the username and password keys for the registry.
+	// +optional
+	SecretRef *corev1.LocalObjectReference `json:"secretRef,omitempty"`
+	// Insecure allows connecting to the registry over plain HTTP.
+	// +optional
+	Insecure bool `json:"insecure,omitempty"`
+}
+
+// ConfigMapSource places the keys of the ConfigMap into the directory.
+type ConfigMapSource struct {
+	// Name is the name of the ConfigMap.
+	Name string `json:"name"`
+	// Path is the directory of the files with the keys of the ConfigMap.
+	// Defaults to the root of the playbook.
+	// +optional
+	Path string `json:"path,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -50,8 +50,57 @@ type PlaybookSpec struct {
 
 // RemotePlaybookSpec describes the remote Playbook in the agent.
 type RemotePlaybookSpec struct {
+	// Files are the playbook files, the key is the path of the file and the value is the content.
+	// In the PlaybookTemplate and PlaybookDeploymentTemplate, the files with the ".tmpl" suffix are rendered
+	// as Go templates with the .Cluster, .Machine, .Agent and .Variables fields when the playbook is created,
+	// and the suffix is removed from the path. The secret variables are not available in the templates.
 	Files      map[string]string `json:"files,omitempty"`
 	Entrypoint string            `json:"entrypoint,omitempty"`
+	// AnsibleVersion is the version of ansible-core that executes the playbook.
+	// It requires the managed ansible runtime of the agent.
+	// +optional
+	AnsibleVersion string `json:"ansibleVersion,omitempty"`
+	// FileSources are the playbook files with binary or large content.
+	// The content is uploaded to the agent separately and is not stored in the remote playbook.
+	// +optional
+	FileSources []PlaybookFileSource `json:"fileSources,omitempty"`
+	// PurgeFilesAfterSuccess specifies that the agent deletes the playbook files from the disk
+	// once the playbook succeeds, e.g. the files with bootstrap tokens and certificate keys.
+	// +optional
+	PurgeFilesAfterSuccess bool `json:"purgeFilesAfterSuccess,omitempty"`
+}
+
+// PlaybookFileSource describes where the content of a playbook file is loaded from.
+// Exactly one of Repository, ConfigMapKeyRef and SecretKeyRef must be specified.
+type PlaybookFileSource struct {
+	// Path is the path of the file relative to the playbook directory.
+	Path string `json:"path"`
+	// SHA256 is the expected hex encoded SHA-256 checksum of the content.
+	// +optional
+	// +kubebuilder:validation:Pattern=`^[0-9a-f]{64}$`
+	SHA256 string `json:"sha256,omitempty"`
+	// Mode is the permission bits of the file. Defaults to 0600.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	// +kubebuilder:validation:Maximum=511
+	Mode *int32 `json:"mode,omitempty"`
+	// Repository selects the file of the repository.
+	// +optional
+	Repository *RepositoryFileSource `json:"repository,omitempty"`
+	// ConfigMapKeyRef selects a key of the ConfigMap in the namespace of the object.
+	// +optional
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+	// SecretKeyRef selects a key of the Secret in the namespace of the object.
+	// +optional
+	SecretKeyRef *corev1.SecretKeySelector `json:"secretKeyRef,omitempty"`
+}
+
+// RepositoryFileSource selects the file of the repository.
+type RepositoryFileSource struct {
+	// RepoRef is a reference to the repository.
+	RepoRef RepositoryReference `json:"repoRef"`
+	// Path is the relative path of the file in the repository.
+	Path string `json:"path"`
 }
 
 // PlaybookStatus defines the observed state of Playbook.
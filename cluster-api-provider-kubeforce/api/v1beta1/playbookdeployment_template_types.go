@@ -47,6 +47,12 @@ type PlaybookDeploymentTemplateSpec struct {
 	// Defaults to 10.
 	// +optional
 	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+
+	// Approval defines whether the new revisions of the PlaybookDeployments require approval.
+	// Defaults to Automatic.
+	// +optional
+	// +kubebuilder:validation:Enum=Automatic;Required
+	Approval PlaybookApprovalMode `json:"approval,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -26,6 +26,36 @@ const (
 	// PlaybookDeploymentFinalizer allows PlaybookDeploymentReconciler to clean up resources associated
 	// with PlaybookDeployment before removing it from the apiserver.
 	PlaybookDeploymentFinalizer = "playbookdeployment.infrastructure.cluster.x-k8s.io"
+
+	// PlaybookDeploymentApprovedRevisionAnnotation is the revision of the PlaybookDeployment
+	// that has been approved to be propagated to the agent.
+	PlaybookDeploymentApprovedRevisionAnnotation = "playbookdeployment.infrastructure.cluster.x-k8s.io/approved-revision"
+)
+
+// PlaybookApprovalMode defines whether the new revisions of the playbook require approval.
+type PlaybookApprovalMode string
+
+const (
+	// PlaybookApprovalAutomatic propagates the new revisions to the agent immediately.
+	PlaybookApprovalAutomatic PlaybookApprovalMode = "Automatic"
+
+	// PlaybookApprovalRequired propagates the new revision to the agent only after
+	// the PlaybookDeploymentApprovedRevisionAnnotation is set to the revision.
+	PlaybookApprovalRequired PlaybookApprovalMode = "Required"
+)
+
+// PlaybookFileOperation is the change of the playbook file in the new revision.
+type PlaybookFileOperation string
+
+const (
+	// PlaybookFileAdded means that the file does not exist in the current revision.
+	PlaybookFileAdded PlaybookFileOperation = "Added"
+
+	// PlaybookFileModified means that the content of the file has been changed.
+	PlaybookFileModified PlaybookFileOperation = "Modified"
+
+	// PlaybookFileRemoved means that the file does not exist in the new revision.
+	PlaybookFileRemoved PlaybookFileOperation = "Removed"
 )
 
 // +kubebuilder:object:root=true
@@ -35,6 +65,7 @@ const (
 // +kubebuilder:printcolumn:name="Phase",type="string",JSONPath=".status.phase"
 // +kubebuilder:printcolumn:name="ExternalPhase",type="string",JSONPath=".status.externalPhase"
 // +kubebuilder:printcolumn:name="ExternalName",type="string",JSONPath=".status.externalName"
+// +kubebuilder:printcolumn:name="PendingRevision",type="string",JSONPath=".status.pendingRevision.revision",priority=1
 // +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Time duration since creation"
 
 // PlaybookDeployment is the Schema for the playbookdeployments API.
@@ -79,6 +110,14 @@ type PlaybookDeploymentSpec struct {
 	// Indicates that the deployment is paused.
 	// +optional
 	Paused bool `json:"paused,omitempty"`
+	// Approval defines whether the new revisions of the template require approval.
+	// If the approval is required, the new revision is propagated to the agent only after
+	// the "playbookdeployment.infrastructure.cluster.x-k8s.io/approved-revision" annotation is set to the revision.
+	// The other changes of the spec are propagated together with the approved revision.
+	// Defaults to Automatic.
+	// +optional
+	// +kubebuilder:validation:Enum=Automatic;Required
+	Approval PlaybookApprovalMode `json:"approval,omitempty"`
 }
 
 // PlaybookDeploymentStatus defines the observed state of PlaybookDeployment.
@@ -119,11 +158,50 @@ type PlaybookDeploymentStatus struct {
 	// +optional
 	LastSpecChecksum string `json:"lastSpecChecksum,omitempty"`
 
+	// Revision is the checksum of the template and the files that have been propagated to the agent.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+
+	// FileChecksums are the SHA-256 checksums of the files of the revision by the path.
+	// +optional
+	FileChecksums map[string]string `json:"fileChecksums,omitempty"`
+
+	// PendingRevision is the new revision that is waiting for approval.
+	// +optional
+	PendingRevision *PendingPlaybookRevision `json:"pendingRevision,omitempty"`
+
 	// ObservedGeneration is the latest generation observed by the controller.
 	// +optional
 	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
 }
 
+// PendingPlaybookRevision describes the revision that is waiting for approval.
+type PendingPlaybookRevision struct {
+	// Revision is the checksum of the template and the files of the revision.
+	Revision string `json:"revision"`
+
+	// Files are the files that are changed by the revision.
+	// +optional
+	Files []PlaybookFileChange `json:"files,omitempty"`
+}
+
+// PlaybookFileChange describes the change of the playbook file.
+type PlaybookFileChange struct {
+	// Path is the path of the file relative to the playbook directory.
+	Path string `json:"path"`
+
+	// Operation is the change of the file.
+	Operation PlaybookFileOperation `json:"operation"`
+
+	// SHA256 is the checksum of the file in the new revision.
+	// +optional
+	SHA256 string `json:"sha256,omitempty"`
+
+	// PreviousSHA256 is the checksum of the file in the current revision.
+	// +optional
+	PreviousSHA256 string `json:"previousSHA256,omitempty"`
+}
+
 func init() {
 	SchemeBuilder.Register(&PlaybookDeployment{}, &PlaybookDeploymentList{})
 }
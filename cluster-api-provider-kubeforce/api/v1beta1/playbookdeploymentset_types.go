@@ -0,0 +1,155 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+)
+
+const (
+	// PlaybookDeploymentSetNameLabelName is the name of the PlaybookDeploymentSet that controls the PlaybookDeployment.
+	PlaybookDeploymentSetNameLabelName = "playbookdeploymentset.infrastructure.cluster.x-k8s.io/name"
+
+	// PlaybookDeploymentSetRevisionAnnotation is the revision of the PlaybookDeploymentSet
+	// that the PlaybookDeployment has been updated to.
+	PlaybookDeploymentSetRevisionAnnotation = "playbookdeploymentset.infrastructure.cluster.x-k8s.io/revision"
+)
+
+// +kubebuilder:object:root=true
+// +kubebuilder:resource:path=playbookdeploymentsets,scope=Namespaced,shortName=pbds
+// +kubebuilder:subresource:status
+// +kubebuilder:printcolumn:name="Template",type="string",JSONPath=".spec.templateRef.name",description="PlaybookDeploymentTemplate"
+// +kubebuilder:printcolumn:name="Agents",type="integer",JSONPath=".status.agents",description="Number of the selected agents"
+// +kubebuilder:printcolumn:name="Updated",type="integer",JSONPath=".status.updated",description="PlaybookDeployments of the current revision"
+// +kubebuilder:printcolumn:name="Succeeded",type="integer",JSONPath=".status.succeeded",description="Succeeded PlaybookDeployments of the current revision"
+// +kubebuilder:printcolumn:name="Failed",type="integer",JSONPath=".status.failed",description="Failed PlaybookDeployments"
+// +kubebuilder:printcolumn:name="Age",type="date",JSONPath=".metadata.creationTimestamp",description="Time duration since creation"
+
+// PlaybookDeploymentSet is the Schema for the playbookdeploymentsets API.
+// It deploys the playbook to every KubeforceAgent selected by the set, claimed by a machine or free.
+type PlaybookDeploymentSet struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   PlaybookDeploymentSetSpec   `json:"spec,omitempty"`
+	Status PlaybookDeploymentSetStatus `json:"status,omitempty"`
+}
+
+// PlaybookDeploymentSetSpec defines the desired state of PlaybookDeploymentSet.
+type PlaybookDeploymentSetSpec struct {
+	// AgentSelector selects the KubeforceAgents in the namespace of the set.
+	// An empty selector selects all agents.
+	// +optional
+	AgentSelector *metav1.LabelSelector `json:"agentSelector,omitempty"`
+
+	// ClusterSelector selects the Clusters in the namespace of the set,
+	// the agents of the KubeforceMachines of these clusters are selected.
+	// If both selectors are specified, the agent must match both of them.
+	// +optional
+	ClusterSelector *metav1.LabelSelector `json:"clusterSelector,omitempty"`
+
+	// TemplateRef is a reference to the PlaybookDeploymentTemplate in the namespace of the set.
+	// The ".tmpl" files of the template are not rendered, because the agents may not belong to a machine.
+	TemplateRef corev1.LocalObjectReference `json:"templateRef"`
+
+	// UpdateStrategy describes how to update the PlaybookDeployments to the new revision of the template.
+	// +optional
+	UpdateStrategy *PlaybookDeploymentSetUpdateStrategy `json:"updateStrategy,omitempty"`
+
+	// Paused indicates that the PlaybookDeployments are neither created, updated nor deleted.
+	// +optional
+	Paused bool `json:"paused,omitempty"`
+}
+
+// PlaybookDeploymentSetUpdateStrategy describes how to update the PlaybookDeployments of the set.
+type PlaybookDeploymentSetUpdateStrategy struct {
+	// MaxUnavailable is the maximum number of PlaybookDeployments that can be in progress or failed during the update.
+	// Value can be an absolute number (ex: 5) or a percentage of agents (ex: 10%).
+	// Absolute number is calculated from percentage by rounding down, but it is at least 1.
+	// Defaults to 1.
+	// +optional
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+
+	// Partition is the number of agents, ordered by name, whose PlaybookDeployments keep the previous revision.
+	// The PlaybookDeployments of the new agents are always created with the current revision.
+	// Defaults to 0.
+	// +optional
+	// +kubebuilder:validation:Minimum=0
+	Partition *int32 `json:"partition,omitempty"`
+
+	// PauseOnFailure stops the update when a PlaybookDeployment of the current revision fails.
+	// The update continues once the failed PlaybookDeployment succeeds or is removed from the set.
+	// +optional
+	PauseOnFailure bool `json:"pauseOnFailure,omitempty"`
+}
+
+// PlaybookDeploymentSetStatus defines the observed state of PlaybookDeploymentSet.
+type PlaybookDeploymentSetStatus struct {
+	// Revision is the current revision of the template.
+	// +optional
+	Revision string `json:"revision,omitempty"`
+
+	// Agents is the number of the selected agents.
+	// +optional
+	Agents int32 `json:"agents"`
+
+	// Updated is the number of the PlaybookDeployments of the current revision.
+	// +optional
+	Updated int32 `json:"updated"`
+
+	// Succeeded is the number of the succeeded PlaybookDeployments of the current revision.
+	// +optional
+	Succeeded int32 `json:"succeeded"`
+
+	// Failed is the number of the failed PlaybookDeployments of any revision.
+	// +optional
+	Failed int32 `json:"failed"`
+
+	// Conditions defines current service state of the PlaybookDeploymentSet.
+	// +optional
+	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+
+	// ObservedGeneration is the latest generation observed by the controller.
+	// +optional
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+}
+
+// GetConditions returns the set of conditions for this object.
+func (in *PlaybookDeploymentSet) GetConditions() clusterv1.Conditions {
+	return in.Status.Conditions
+}
+
+// SetConditions sets the conditions on this object.
+func (in *PlaybookDeploymentSet) SetConditions(conditions clusterv1.Conditions) {
+	in.Status.Conditions = conditions
+}
+
+//+kubebuilder:object:root=true
+
+// PlaybookDeploymentSetList contains a list of PlaybookDeploymentSet.
+type PlaybookDeploymentSetList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []PlaybookDeploymentSet `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&PlaybookDeploymentSet{}, &PlaybookDeploymentSetList{})
+}
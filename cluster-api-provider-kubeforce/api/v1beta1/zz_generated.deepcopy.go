@@ -25,6 +25,7 @@ import (
 	"k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	apiv1beta1 "sigs.k8s.io/cluster-api/api/v1beta1"
 )
 
@@ -64,6 +65,16 @@ func (in *AgentConfigSpec) DeepCopyInto(out *AgentConfigSpec) {
 	*out = *in
 	in.CertTemplate.DeepCopyInto(&out.CertTemplate)
 	out.Authentication = in.Authentication
+	if in.Ansible != nil {
+		in, out := &in.Ansible, &out.Ansible
+		*out = new(AnsibleRuntime)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(AgentEncryption)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentConfigSpec.
@@ -76,6 +87,21 @@ func (in *AgentConfigSpec) DeepCopy() *AgentConfigSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentEncryption) DeepCopyInto(out *AgentEncryption) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentEncryption.
+func (in *AgentEncryption) DeepCopy() *AgentEncryption {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentEncryption)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AgentInfo) DeepCopyInto(out *AgentInfo) {
 	*out = *in
@@ -111,6 +137,42 @@ func (in *AgentSource) DeepCopy() *AgentSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentUpgradeStatus) DeepCopyInto(out *AgentUpgradeStatus) {
+	*out = *in
+	in.StartTime.DeepCopyInto(&out.StartTime)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentUpgradeStatus.
+func (in *AgentUpgradeStatus) DeepCopy() *AgentUpgradeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentUpgradeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AgentUpgradeStrategy) DeepCopyInto(out *AgentUpgradeStrategy) {
+	*out = *in
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AgentUpgradeStrategy.
+func (in *AgentUpgradeStrategy) DeepCopy() *AgentUpgradeStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(AgentUpgradeStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *AgentX509Authentication) DeepCopyInto(out *AgentX509Authentication) {
 	*out = *in
@@ -126,6 +188,57 @@ func (in *AgentX509Authentication) DeepCopy() *AgentX509Authentication {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnsibleBundleSource) DeepCopyInto(out *AnsibleBundleSource) {
+	*out = *in
+	out.RepoRef = in.RepoRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnsibleBundleSource.
+func (in *AnsibleBundleSource) DeepCopy() *AnsibleBundleSource {
+	if in == nil {
+		return nil
+	}
+	out := new(AnsibleBundleSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *AnsibleRuntime) DeepCopyInto(out *AnsibleRuntime) {
+	*out = *in
+	if in.BundleSource != nil {
+		in, out := &in.BundleSource, &out.BundleSource
+		*out = new(AnsibleBundleSource)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new AnsibleRuntime.
+func (in *AnsibleRuntime) DeepCopy() *AnsibleRuntime {
+	if in == nil {
+		return nil
+	}
+	out := new(AnsibleRuntime)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *BecomeParams) DeepCopyInto(out *BecomeParams) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new BecomeParams.
+func (in *BecomeParams) DeepCopy() *BecomeParams {
+	if in == nil {
+		return nil
+	}
+	out := new(BecomeParams)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *CertObjectReference) DeepCopyInto(out *CertObjectReference) {
 	*out = *in
@@ -197,6 +310,196 @@ func (in *CertificateTemplate) DeepCopy() *CertificateTemplate {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPlaybookRun) DeepCopyInto(out *ClusterPlaybookRun) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPlaybookRun.
+func (in *ClusterPlaybookRun) DeepCopy() *ClusterPlaybookRun {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPlaybookRun)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPlaybookRun) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPlaybookRunList) DeepCopyInto(out *ClusterPlaybookRunList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterPlaybookRun, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPlaybookRunList.
+func (in *ClusterPlaybookRunList) DeepCopy() *ClusterPlaybookRunList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPlaybookRunList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterPlaybookRunList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPlaybookRunSpec) DeepCopyInto(out *ClusterPlaybookRunSpec) {
+	*out = *in
+	out.TemplateRef = in.TemplateRef
+	if in.Variables != nil {
+		in, out := &in.Variables, &out.Variables
+		*out = make(map[string]runtime.RawExtension, len(*in))
+		for key, val := range *in {
+			(*out)[key] = *val.DeepCopy()
+		}
+	}
+	if in.VariablesFrom != nil {
+		in, out := &in.VariablesFrom, &out.VariablesFrom
+		*out = make([]TemplateVariable, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Strategy != nil {
+		in, out := &in.Strategy, &out.Strategy
+		*out = new(ClusterPlaybookRunStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPlaybookRunSpec.
+func (in *ClusterPlaybookRunSpec) DeepCopy() *ClusterPlaybookRunSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPlaybookRunSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPlaybookRunStatus) DeepCopyInto(out *ClusterPlaybookRunStatus) {
+	*out = *in
+	if in.MachineStatuses != nil {
+		in, out := &in.MachineStatuses, &out.MachineStatuses
+		*out = make([]MachinePlaybookStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		*out = (*in).DeepCopy()
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1beta1.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPlaybookRunStatus.
+func (in *ClusterPlaybookRunStatus) DeepCopy() *ClusterPlaybookRunStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPlaybookRunStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterPlaybookRunStrategy) DeepCopyInto(out *ClusterPlaybookRunStrategy) {
+	*out = *in
+	if in.ControlPlaneBatchSize != nil {
+		in, out := &in.ControlPlaneBatchSize, &out.ControlPlaneBatchSize
+		*out = new(int32)
+		**out = **in
+	}
+	if in.WorkerBatchSize != nil {
+		in, out := &in.WorkerBatchSize, &out.WorkerBatchSize
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxFailures != nil {
+		in, out := &in.MaxFailures, &out.MaxFailures
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterPlaybookRunStrategy.
+func (in *ClusterPlaybookRunStrategy) DeepCopy() *ClusterPlaybookRunStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterPlaybookRunStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConfigMapSource) DeepCopyInto(out *ConfigMapSource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConfigMapSource.
+func (in *ConfigMapSource) DeepCopy() *ConfigMapSource {
+	if in == nil {
+		return nil
+	}
+	out := new(ConfigMapSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitSource) DeepCopyInto(out *GitSource) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitSource.
+func (in *GitSource) DeepCopy() *GitSource {
+	if in == nil {
+		return nil
+	}
+	out := new(GitSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *HTTPRepository) DeepCopyInto(out *HTTPRepository) {
 	*out = *in
@@ -377,6 +680,11 @@ func (in *KubeforceAgentGroupSpec) DeepCopyInto(out *KubeforceAgentGroupSpec) {
 		}
 	}
 	in.Template.DeepCopyInto(&out.Template)
+	if in.UpgradeStrategy != nil {
+		in, out := &in.UpgradeStrategy, &out.UpgradeStrategy
+		*out = new(AgentUpgradeStrategy)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeforceAgentGroupSpec.
@@ -457,7 +765,7 @@ func (in *KubeforceAgentSpec) DeepCopyInto(out *KubeforceAgentSpec) {
 		**out = **in
 	}
 	out.System = in.System
-	out.SSH = in.SSH
+	in.SSH.DeepCopyInto(&out.SSH)
 	in.Config.DeepCopyInto(&out.Config)
 }
 
@@ -491,6 +799,23 @@ func (in *KubeforceAgentStatus) DeepCopyInto(out *KubeforceAgentStatus) {
 		*out = new(SystemInfo)
 		**out = **in
 	}
+	if in.LastUpgrade != nil {
+		in, out := &in.LastUpgrade, &out.LastUpgrade
+		*out = new(AgentUpgradeStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.AnsibleBundles != nil {
+		in, out := &in.AnsibleBundles, &out.AnsibleBundles
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SSHJumpHostKeys != nil {
+		in, out := &in.SSHJumpHostKeys, &out.SSHJumpHostKeys
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new KubeforceAgentStatus.
@@ -871,6 +1196,21 @@ func (in *LoadbalancerConfig) DeepCopy() *LoadbalancerConfig {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MachinePlaybookStatus) DeepCopyInto(out *MachinePlaybookStatus) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MachinePlaybookStatus.
+func (in *MachinePlaybookStatus) DeepCopy() *MachinePlaybookStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MachinePlaybookStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *NetworkInfo) DeepCopyInto(out *NetworkInfo) {
 	*out = *in
@@ -886,6 +1226,26 @@ func (in *NetworkInfo) DeepCopy() *NetworkInfo {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OCISource) DeepCopyInto(out *OCISource) {
+	*out = *in
+	if in.SecretRef != nil {
+		in, out := &in.SecretRef, &out.SecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OCISource.
+func (in *OCISource) DeepCopy() *OCISource {
+	if in == nil {
+		return nil
+	}
+	out := new(OCISource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ObjectMeta) DeepCopyInto(out *ObjectMeta) {
 	*out = *in
@@ -915,6 +1275,26 @@ func (in *ObjectMeta) DeepCopy() *ObjectMeta {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PendingPlaybookRevision) DeepCopyInto(out *PendingPlaybookRevision) {
+	*out = *in
+	if in.Files != nil {
+		in, out := &in.Files, &out.Files
+		*out = make([]PlaybookFileChange, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PendingPlaybookRevision.
+func (in *PendingPlaybookRevision) DeepCopy() *PendingPlaybookRevision {
+	if in == nil {
+		return nil
+	}
+	out := new(PendingPlaybookRevision)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Playbook) DeepCopyInto(out *Playbook) {
 	*out = *in
@@ -950,6 +1330,11 @@ func (in *PlaybookCondition) DeepCopyInto(out *PlaybookCondition) {
 		*out = new(v1.ObjectReference)
 		**out = **in
 	}
+	if in.BlockedBy != nil {
+		in, out := &in.BlockedBy, &out.BlockedBy
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	in.LastTransitionTime.DeepCopyInto(&out.LastTransitionTime)
 }
 
@@ -1051,6 +1436,143 @@ func (in *PlaybookDeploymentList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookDeploymentSet) DeepCopyInto(out *PlaybookDeploymentSet) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookDeploymentSet.
+func (in *PlaybookDeploymentSet) DeepCopy() *PlaybookDeploymentSet {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookDeploymentSet)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PlaybookDeploymentSet) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookDeploymentSetList) DeepCopyInto(out *PlaybookDeploymentSetList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]PlaybookDeploymentSet, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookDeploymentSetList.
+func (in *PlaybookDeploymentSetList) DeepCopy() *PlaybookDeploymentSetList {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookDeploymentSetList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *PlaybookDeploymentSetList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookDeploymentSetSpec) DeepCopyInto(out *PlaybookDeploymentSetSpec) {
+	*out = *in
+	if in.AgentSelector != nil {
+		in, out := &in.AgentSelector, &out.AgentSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ClusterSelector != nil {
+		in, out := &in.ClusterSelector, &out.ClusterSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	out.TemplateRef = in.TemplateRef
+	if in.UpdateStrategy != nil {
+		in, out := &in.UpdateStrategy, &out.UpdateStrategy
+		*out = new(PlaybookDeploymentSetUpdateStrategy)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookDeploymentSetSpec.
+func (in *PlaybookDeploymentSetSpec) DeepCopy() *PlaybookDeploymentSetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookDeploymentSetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookDeploymentSetStatus) DeepCopyInto(out *PlaybookDeploymentSetStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make(apiv1beta1.Conditions, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookDeploymentSetStatus.
+func (in *PlaybookDeploymentSetStatus) DeepCopy() *PlaybookDeploymentSetStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookDeploymentSetStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookDeploymentSetUpdateStrategy) DeepCopyInto(out *PlaybookDeploymentSetUpdateStrategy) {
+	*out = *in
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.Partition != nil {
+		in, out := &in.Partition, &out.Partition
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookDeploymentSetUpdateStrategy.
+func (in *PlaybookDeploymentSetUpdateStrategy) DeepCopy() *PlaybookDeploymentSetUpdateStrategy {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookDeploymentSetUpdateStrategy)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlaybookDeploymentSpec) DeepCopyInto(out *PlaybookDeploymentSpec) {
 	*out = *in
@@ -1083,6 +1605,18 @@ func (in *PlaybookDeploymentStatus) DeepCopyInto(out *PlaybookDeploymentStatus)
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.FileChecksums != nil {
+		in, out := &in.FileChecksums, &out.FileChecksums
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.PendingRevision != nil {
+		in, out := &in.PendingRevision, &out.PendingRevision
+		*out = new(PendingPlaybookRevision)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookDeploymentStatus.
@@ -1175,6 +1709,56 @@ func (in *PlaybookDeploymentTemplateSpec) DeepCopy() *PlaybookDeploymentTemplate
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookFileChange) DeepCopyInto(out *PlaybookFileChange) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookFileChange.
+func (in *PlaybookFileChange) DeepCopy() *PlaybookFileChange {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookFileChange)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookFileSource) DeepCopyInto(out *PlaybookFileSource) {
+	*out = *in
+	if in.Mode != nil {
+		in, out := &in.Mode, &out.Mode
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Repository != nil {
+		in, out := &in.Repository, &out.Repository
+		*out = new(RepositoryFileSource)
+		**out = **in
+	}
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookFileSource.
+func (in *PlaybookFileSource) DeepCopy() *PlaybookFileSource {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookFileSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlaybookInfo) DeepCopyInto(out *PlaybookInfo) {
 	*out = *in
@@ -1222,6 +1806,36 @@ func (in *PlaybookList) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PlaybookSource) DeepCopyInto(out *PlaybookSource) {
+	*out = *in
+	if in.Git != nil {
+		in, out := &in.Git, &out.Git
+		*out = new(GitSource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OCI != nil {
+		in, out := &in.OCI, &out.OCI
+		*out = new(OCISource)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigMaps != nil {
+		in, out := &in.ConfigMaps, &out.ConfigMaps
+		*out = make([]ConfigMapSource, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookSource.
+func (in *PlaybookSource) DeepCopy() *PlaybookSource {
+	if in == nil {
+		return nil
+	}
+	out := new(PlaybookSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PlaybookSpec) DeepCopyInto(out *PlaybookSpec) {
 	*out = *in
@@ -1324,6 +1938,11 @@ func (in *PlaybookTemplateSpec) DeepCopyInto(out *PlaybookTemplateSpec) {
 	*out = *in
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
+	if in.Source != nil {
+		in, out := &in.Source, &out.Source
+		*out = new(PlaybookSource)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookTemplateSpec.
@@ -1349,7 +1968,7 @@ func (in *PlaybookTemplates) DeepCopyInto(out *PlaybookTemplates) {
 			} else {
 				in, out := &val, &outVal
 				*out = new(TemplateReference)
-				**out = **in
+				(*in).DeepCopyInto(*out)
 			}
 			(*out)[key] = outVal
 		}
@@ -1361,6 +1980,13 @@ func (in *PlaybookTemplates) DeepCopyInto(out *PlaybookTemplates) {
 			(*out)[key] = *val.DeepCopy()
 		}
 	}
+	if in.VariablesFrom != nil {
+		in, out := &in.VariablesFrom, &out.VariablesFrom
+		*out = make([]TemplateVariable, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PlaybookTemplates.
@@ -1383,6 +2009,13 @@ func (in *RemotePlaybookSpec) DeepCopyInto(out *RemotePlaybookSpec) {
 			(*out)[key] = val
 		}
 	}
+	if in.FileSources != nil {
+		in, out := &in.FileSources, &out.FileSources
+		*out = make([]PlaybookFileSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RemotePlaybookSpec.
@@ -1395,6 +2028,22 @@ func (in *RemotePlaybookSpec) DeepCopy() *RemotePlaybookSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RepositoryFileSource) DeepCopyInto(out *RepositoryFileSource) {
+	*out = *in
+	out.RepoRef = in.RepoRef
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RepositoryFileSource.
+func (in *RepositoryFileSource) DeepCopy() *RepositoryFileSource {
+	if in == nil {
+		return nil
+	}
+	out := new(RepositoryFileSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *RepositoryReference) DeepCopyInto(out *RepositoryReference) {
 	*out = *in
@@ -1410,9 +2059,46 @@ func (in *RepositoryReference) DeepCopy() *RepositoryReference {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHJumpHost) DeepCopyInto(out *SSHJumpHost) {
+	*out = *in
+	if in.HostKeyFingerprints != nil {
+		in, out := &in.HostKeyFingerprints, &out.HostKeyFingerprints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHJumpHost.
+func (in *SSHJumpHost) DeepCopy() *SSHJumpHost {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHJumpHost)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *SSHParams) DeepCopyInto(out *SSHParams) {
 	*out = *in
+	if in.HostKeyFingerprints != nil {
+		in, out := &in.HostKeyFingerprints, &out.HostKeyFingerprints
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ProxyJump != nil {
+		in, out := &in.ProxyJump, &out.ProxyJump
+		*out = make([]SSHJumpHost, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Become != nil {
+		in, out := &in.Become, &out.Become
+		*out = new(BecomeParams)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHParams.
@@ -1459,6 +2145,11 @@ func (in *SystemParams) DeepCopy() *SystemParams {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TemplateReference) DeepCopyInto(out *TemplateReference) {
 	*out = *in
+	if in.DependsOn != nil {
+		in, out := &in.DependsOn, &out.DependsOn
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateReference.
@@ -1470,3 +2161,44 @@ func (in *TemplateReference) DeepCopy() *TemplateReference {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateVariable) DeepCopyInto(out *TemplateVariable) {
+	*out = *in
+	in.ValueFrom.DeepCopyInto(&out.ValueFrom)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateVariable.
+func (in *TemplateVariable) DeepCopy() *TemplateVariable {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateVariable)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TemplateVariableSource) DeepCopyInto(out *TemplateVariableSource) {
+	*out = *in
+	if in.SecretKeyRef != nil {
+		in, out := &in.SecretKeyRef, &out.SecretKeyRef
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigMapKeyRef != nil {
+		in, out := &in.ConfigMapKeyRef, &out.ConfigMapKeyRef
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TemplateVariableSource.
+func (in *TemplateVariableSource) DeepCopy() *TemplateVariableSource {
+	if in == nil {
+		return nil
+	}
+	out := new(TemplateVariableSource)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,480 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/controllers/playbook"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/util/names"
+)
+
+// ClusterPlaybookRunReconciler reconciles a ClusterPlaybookRun object.
+type ClusterPlaybookRunReconciler struct {
+	Client             client.Client
+	Log                logr.Logger
+	TemplateReconciler playbook.TemplateReconciler
+}
+
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=clusterplaybookruns,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=clusterplaybookruns/status,verbs=get;update;patch
+
+// Reconcile handles ClusterPlaybookRun events.
+func (r *ClusterPlaybookRunReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, rerr error) {
+	if ctx.Err() != nil {
+		return reconcile.Result{}, nil
+	}
+	log := r.Log.WithValues("run", req)
+	run := &infrav1.ClusterPlaybookRun{}
+	if err := r.Client.Get(ctx, req.NamespacedName, run); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	// the Playbooks are deleted by the garbage collector
+	if !run.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	cluster := &clusterv1.Cluster{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: run.Namespace, Name: run.Spec.ClusterName}, cluster); err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "unable to get Cluster %s", run.Spec.ClusterName)
+	}
+	if cluster.Spec.Paused {
+		log.Info("Reconciliation is paused for this object")
+		return ctrl.Result{}, nil
+	}
+
+	// Initialize the patch helper
+	patchHelper, err := patch.NewHelper(run, r.Client)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Always attempt to Patch the ClusterPlaybookRun object and status after each reconciliation.
+	defer func() {
+		// We want to save the last status even if the context was closed.
+		if err := patchClusterPlaybookRun(context.Background(), patchHelper, run); err != nil {
+			log.Error(err, "failed to patch ClusterPlaybookRun")
+			if rerr == nil {
+				rerr = err
+			}
+		}
+	}()
+
+	return ctrl.Result{}, r.reconcileNormal(ctrl.LoggerInto(ctx, log), run)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterPlaybookRunReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.ClusterPlaybookRun{}).
+		WithOptions(options).
+		Owns(&infrav1.Playbook{}).
+		Watches(
+			&source.Kind{Type: &infrav1.KubeforceMachine{}},
+			handler.EnqueueRequestsFromMapFunc(r.toClusterPlaybookRuns),
+		).
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(r.toClusterPlaybookRuns),
+		).
+		Complete(r)
+}
+
+// toClusterPlaybookRuns returns the ClusterPlaybookRuns of the cluster of the KubeforceMachine or the Cluster.
+func (r *ClusterPlaybookRunReconciler) toClusterPlaybookRuns(o client.Object) []ctrl.Request {
+	clusterName := o.GetLabels()[clusterv1.ClusterNameLabel]
+	if _, ok := o.(*clusterv1.Cluster); ok {
+		clusterName = o.GetName()
+	}
+	if clusterName == "" {
+		return nil
+	}
+	list := &infrav1.ClusterPlaybookRunList{}
+	if err := r.Client.List(context.TODO(), list, client.InNamespace(o.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list ClusterPlaybookRuns", "namespace", o.GetNamespace())
+		return nil
+	}
+	result := make([]ctrl.Request, 0)
+	for _, run := range list.Items {
+		if run.Spec.ClusterName != clusterName {
+			continue
+		}
+		//nolint:gosec
+		result = append(result, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&run)})
+	}
+	return result
+}
+
+func (r *ClusterPlaybookRunReconciler) reconcileNormal(ctx context.Context, run *infrav1.ClusterPlaybookRun) error {
+	playbooks, err := r.playbooksByMachine(ctx, run)
+	if err != nil {
+		return err
+	}
+	// the completed run only reports the results of the Playbooks
+	if isClusterPlaybookRunCompleted(run) {
+		for i := range run.Status.MachineStatuses {
+			s := &run.Status.MachineStatuses[i]
+			setMachinePlaybookStatus(s, playbooks[s.Name])
+		}
+		setClusterPlaybookRunCounters(run)
+		return nil
+	}
+
+	machines, err := r.clusterMachines(ctx, run)
+	if err != nil {
+		return err
+	}
+	previous := make(map[string]infrav1.MachinePlaybookStatus, len(run.Status.MachineStatuses))
+	for _, s := range run.Status.MachineStatuses {
+		previous[s.Name] = s
+	}
+	statuses := make([]infrav1.MachinePlaybookStatus, 0, len(machines))
+	machineNames := make(map[string]bool, len(machines))
+	for _, m := range machines {
+		s := infrav1.MachinePlaybookStatus{
+			Name:         m.Name,
+			ControlPlane: isControlPlaneKubeforceMachine(m),
+		}
+		// the machine that has failed without the Playbook is not started again
+		if p, ok := previous[m.Name]; ok && p.Phase == infrav1.MachinePlaybookPhaseFailed && p.Playbook == "" {
+			s.Phase = p.Phase
+			s.Message = p.Message
+		}
+		if m.Status.AgentRef != nil {
+			s.Agent = m.Status.AgentRef.Name
+		}
+		setMachinePlaybookStatus(&s, playbooks[m.Name])
+		statuses = append(statuses, s)
+		machineNames[m.Name] = true
+	}
+	// the results of the Playbooks of the deleted machines are kept
+	for machineName, pb := range playbooks {
+		if machineNames[machineName] {
+			continue
+		}
+		s := infrav1.MachinePlaybookStatus{
+			Name:  machineName,
+			Agent: pb.Spec.AgentRef.Name,
+		}
+		setMachinePlaybookStatus(&s, pb)
+		statuses = append(statuses, s)
+	}
+	run.Status.MachineStatuses = statuses
+	setClusterPlaybookRunCounters(run)
+
+	maxFailures, err := getMaxFailures(run, len(statuses))
+	if err != nil {
+		return err
+	}
+	if int(run.Status.Failed) > maxFailures {
+		run.Status.Phase = infrav1.ClusterPlaybookRunPhaseFailed
+		now := metav1.Now()
+		run.Status.CompletionTime = &now
+		conditions.MarkFalse(run, infrav1.RunCompletedCondition, infrav1.FailureThresholdExceededReason, clusterv1.ConditionSeverityError,
+			"%d Playbooks have failed, the maximum number of failures is %d", run.Status.Failed, maxFailures)
+		return nil
+	}
+
+	workerBatchSize, err := getWorkerBatchSize(run, statuses)
+	if err != nil {
+		return err
+	}
+	batch := currentBatch(statuses[:len(machines)], getControlPlaneBatchSize(run), workerBatchSize)
+	if batch == nil {
+		run.Status.Phase = infrav1.ClusterPlaybookRunPhaseSucceeded
+		now := metav1.Now()
+		run.Status.CompletionTime = &now
+		conditions.MarkTrue(run, infrav1.RunCompletedCondition)
+		return nil
+	}
+	run.Status.Phase = infrav1.ClusterPlaybookRunPhaseRunning
+	waiting := make([]string, 0, len(batch))
+	for _, i := range batch {
+		waiting = append(waiting, machines[i].Name)
+	}
+	conditions.MarkFalse(run, infrav1.RunCompletedCondition, infrav1.RunInProgressReason, clusterv1.ConditionSeverityInfo,
+		"waiting for Playbooks of machines: %s", strings.Join(waiting, ", "))
+	err = r.startBatch(ctx, run, machines, batch)
+	// the machines without the agents are failed by the batch
+	setClusterPlaybookRunCounters(run)
+	return err
+}
+
+// startBatch creates the Playbooks of the machines of the batch.
+// The machine without the agent is failed, otherwise the batch would never complete.
+func (r *ClusterPlaybookRunReconciler) startBatch(ctx context.Context, run *infrav1.ClusterPlaybookRun, machines []*infrav1.KubeforceMachine, batch []int) error {
+	var tmpl *infrav1.PlaybookTemplate
+	for _, i := range batch {
+		s := &run.Status.MachineStatuses[i]
+		if s.Phase != infrav1.MachinePlaybookPhasePending {
+			continue
+		}
+		if s.Agent == "" {
+			s.Phase = infrav1.MachinePlaybookPhaseFailed
+			s.Message = "the machine has no agent"
+			continue
+		}
+		if tmpl == nil {
+			tmpl = &infrav1.PlaybookTemplate{}
+			key := client.ObjectKey{Namespace: run.Namespace, Name: run.Spec.TemplateRef.Name}
+			if err := r.Client.Get(ctx, key, tmpl); err != nil {
+				conditions.MarkFalse(run, infrav1.RunCompletedCondition, infrav1.TemplateFailedReason, clusterv1.ConditionSeverityError,
+					"unable to get PlaybookTemplate %s: %v", run.Spec.TemplateRef.Name, err)
+				return errors.WithStack(err)
+			}
+		}
+		name, err := r.createPlaybook(ctx, run, machines[i], tmpl)
+		if err != nil {
+			conditions.MarkFalse(run, infrav1.RunCompletedCondition, infrav1.TemplateFailedReason, clusterv1.ConditionSeverityError, err.Error())
+			return err
+		}
+		s.Playbook = name
+		s.Phase = infrav1.MachinePlaybookPhaseRunning
+		s.Message = ""
+	}
+	return nil
+}
+
+// createPlaybook creates the Playbook of the machine and returns its name.
+func (r *ClusterPlaybookRunReconciler) createPlaybook(ctx context.Context, run *infrav1.ClusterPlaybookRun, kfm *infrav1.KubeforceMachine, tmpl *infrav1.PlaybookTemplate) (string, error) {
+	vars := make(map[string]interface{}, len(run.Spec.Variables))
+	for k, v := range run.Spec.Variables {
+		vars[k] = v
+	}
+	meta := metav1.ObjectMeta{
+		Name:      names.BuildName(run.Name, "-"+kfm.Name),
+		Namespace: run.Namespace,
+		Labels: map[string]string{
+			clusterv1.ClusterNameLabel:                 run.Spec.ClusterName,
+			infrav1.ClusterPlaybookRunNameLabelName:    run.Name,
+			infrav1.ClusterPlaybookRunMachineLabelName: kfm.Name,
+			infrav1.PlaybookAgentNameLabelName:         kfm.Status.AgentRef.Name,
+		},
+		OwnerReferences: []metav1.OwnerReference{
+			*metav1.NewControllerRef(run, infrav1.GroupVersion.WithKind("ClusterPlaybookRun")),
+		},
+	}
+	ctrl.LoggerFrom(ctx).Info("creating Playbook", "machine", kfm.Name, "agent", kfm.Status.AgentRef.Name)
+	_, err := r.TemplateReconciler.CreatePlaybook(ctx, kfm, meta, tmpl, vars, run.Spec.VariablesFrom)
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return "", errors.Wrapf(err, "unable to create Playbook for the machine %s", kfm.Name)
+	}
+	return meta.Name, nil
+}
+
+// clusterMachines returns the KubeforceMachines of the cluster,
+// the control plane machines are followed by the worker machines, both ordered by name.
+func (r *ClusterPlaybookRunReconciler) clusterMachines(ctx context.Context, run *infrav1.ClusterPlaybookRun) ([]*infrav1.KubeforceMachine, error) {
+	list := &infrav1.KubeforceMachineList{}
+	listOpts := []client.ListOption{
+		client.InNamespace(run.Namespace),
+		client.MatchingLabels{clusterv1.ClusterNameLabel: run.Spec.ClusterName},
+	}
+	if err := r.Client.List(ctx, list, listOpts...); err != nil {
+		return nil, errors.Wrap(err, "unable to list KubeforceMachines")
+	}
+	result := make([]*infrav1.KubeforceMachine, 0, len(list.Items))
+	for i := range list.Items {
+		if !list.Items[i].DeletionTimestamp.IsZero() {
+			continue
+		}
+		result = append(result, &list.Items[i])
+	}
+	sort.Slice(result, func(i, j int) bool {
+		iCP, jCP := isControlPlaneKubeforceMachine(result[i]), isControlPlaneKubeforceMachine(result[j])
+		if iCP != jCP {
+			return iCP
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// playbooksByMachine returns the Playbooks controlled by the ClusterPlaybookRun by the machine name.
+func (r *ClusterPlaybookRunReconciler) playbooksByMachine(ctx context.Context, run *infrav1.ClusterPlaybookRun) (map[string]*infrav1.Playbook, error) {
+	list := &infrav1.PlaybookList{}
+	listOpts := []client.ListOption{
+		client.InNamespace(run.Namespace),
+		client.MatchingLabels{infrav1.ClusterPlaybookRunNameLabelName: run.Name},
+	}
+	if err := r.Client.List(ctx, list, listOpts...); err != nil {
+		return nil, errors.Wrap(err, "unable to list Playbooks")
+	}
+	result := make(map[string]*infrav1.Playbook, len(list.Items))
+	for i := range list.Items {
+		pb := &list.Items[i]
+		if !metav1.IsControlledBy(pb, run) {
+			continue
+		}
+		result[pb.Labels[infrav1.ClusterPlaybookRunMachineLabelName]] = pb
+	}
+	return result, nil
+}
+
+// setMachinePlaybookStatus sets the phase of the machine from the Playbook.
+// The machine that has failed without the Playbook stays failed.
+func setMachinePlaybookStatus(s *infrav1.MachinePlaybookStatus, pb *infrav1.Playbook) {
+	if pb == nil {
+		if s.Phase != infrav1.MachinePlaybookPhaseFailed {
+			s.Phase = infrav1.MachinePlaybookPhasePending
+		}
+		return
+	}
+	s.Playbook = pb.Name
+	s.Message = ""
+	switch {
+	case pb.Status.ExternalPhase == string(v1alpha1.PlaybookFailed) ||
+		conditions.IsTrue(pb, clusterv1.ConditionType(v1alpha1.PlaybookFailedCondition)):
+		s.Phase = infrav1.MachinePlaybookPhaseFailed
+		s.Message = pb.Status.FailureMessage
+	case conditions.IsTrue(pb, infrav1.SynchronizationCondition) && pb.Status.ExternalPhase == string(v1alpha1.PlaybookSucceeded):
+		s.Phase = infrav1.MachinePlaybookPhaseSucceeded
+	default:
+		s.Phase = infrav1.MachinePlaybookPhaseRunning
+	}
+}
+
+// currentBatch returns the indexes of the machines of the first batch that has not completed,
+// or nil if the Playbooks of all machines have completed.
+// The statuses of the control plane machines must precede the statuses of the worker machines.
+func currentBatch(statuses []infrav1.MachinePlaybookStatus, controlPlaneBatchSize, workerBatchSize int) []int {
+	batch := make([]int, 0)
+	completed := true
+	for i := range statuses {
+		batchSize := workerBatchSize
+		if statuses[i].ControlPlane {
+			batchSize = controlPlaneBatchSize
+		}
+		// the control plane machines and the worker machines are never in the same batch
+		if len(batch) > 0 && (len(batch) == batchSize || statuses[batch[0]].ControlPlane != statuses[i].ControlPlane) {
+			if !completed {
+				return batch
+			}
+			batch = batch[:0]
+		}
+		batch = append(batch, i)
+		switch statuses[i].Phase {
+		case infrav1.MachinePlaybookPhasePending, infrav1.MachinePlaybookPhaseRunning:
+			completed = false
+		}
+	}
+	if !completed {
+		return batch
+	}
+	return nil
+}
+
+func isClusterPlaybookRunCompleted(run *infrav1.ClusterPlaybookRun) bool {
+	return run.Status.Phase == infrav1.ClusterPlaybookRunPhaseSucceeded || run.Status.Phase == infrav1.ClusterPlaybookRunPhaseFailed
+}
+
+func setClusterPlaybookRunCounters(run *infrav1.ClusterPlaybookRun) {
+	var succeeded, failed int32
+	for _, s := range run.Status.MachineStatuses {
+		switch s.Phase {
+		case infrav1.MachinePlaybookPhaseSucceeded:
+			succeeded++
+		case infrav1.MachinePlaybookPhaseFailed:
+			failed++
+		}
+	}
+	run.Status.Machines = int32(len(run.Status.MachineStatuses))
+	run.Status.Succeeded = succeeded
+	run.Status.Failed = failed
+}
+
+func getControlPlaneBatchSize(run *infrav1.ClusterPlaybookRun) int {
+	if s := run.Spec.Strategy; s != nil && s.ControlPlaneBatchSize != nil && *s.ControlPlaneBatchSize > 0 {
+		return int(*s.ControlPlaneBatchSize)
+	}
+	return 1
+}
+
+func getWorkerBatchSize(run *infrav1.ClusterPlaybookRun, statuses []infrav1.MachinePlaybookStatus) (int, error) {
+	if s := run.Spec.Strategy; s == nil || s.WorkerBatchSize == nil {
+		return 1, nil
+	}
+	workers := 0
+	for _, s := range statuses {
+		if !s.ControlPlane {
+			workers++
+		}
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(run.Spec.Strategy.WorkerBatchSize, workers, true)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid workerBatchSize value")
+	}
+	if value < 1 {
+		value = 1
+	}
+	return value, nil
+}
+
+func getMaxFailures(run *infrav1.ClusterPlaybookRun, machines int) (int, error) {
+	if s := run.Spec.Strategy; s == nil || s.MaxFailures == nil {
+		return 0, nil
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(run.Spec.Strategy.MaxFailures, machines, false)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid maxFailures value")
+	}
+	return value, nil
+}
+
+func patchClusterPlaybookRun(ctx context.Context, patchHelper *patch.Helper, run *infrav1.ClusterPlaybookRun) error {
+	conditions.SetSummary(run,
+		conditions.WithConditions(
+			infrav1.RunCompletedCondition,
+		),
+	)
+	// Patch the object, ignoring conflicts on the conditions owned by this controller.
+	return patchHelper.Patch(
+		ctx,
+		run,
+		patch.WithStatusObservedGeneration{},
+		patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.ReadyCondition,
+			infrav1.RunCompletedCondition,
+		}},
+	)
+}
+
+func isControlPlaneKubeforceMachine(kfm *infrav1.KubeforceMachine) bool {
+	_, isControlPlane := kfm.ObjectMeta.Labels[clusterv1.MachineControlPlaneLabel]
+	return isControlPlane
+}
@@ -0,0 +1,335 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/controllers/playbook"
+)
+
+func TestCurrentBatch(t *testing.T) {
+	machine := func(controlPlane bool, phase infrav1.MachinePlaybookPhase) infrav1.MachinePlaybookStatus {
+		return infrav1.MachinePlaybookStatus{ControlPlane: controlPlane, Phase: phase}
+	}
+	tests := []struct {
+		name                  string
+		statuses              []infrav1.MachinePlaybookStatus
+		controlPlaneBatchSize int
+		workerBatchSize       int
+		want                  []int
+	}{
+		{
+			name: "control plane machines are processed first",
+			statuses: []infrav1.MachinePlaybookStatus{
+				machine(true, infrav1.MachinePlaybookPhaseSucceeded),
+				machine(true, infrav1.MachinePlaybookPhasePending),
+				machine(false, infrav1.MachinePlaybookPhasePending),
+			},
+			controlPlaneBatchSize: 1,
+			workerBatchSize:       2,
+			want:                  []int{1},
+		},
+		{
+			name: "the batch of control plane machines is not mixed with worker machines",
+			statuses: []infrav1.MachinePlaybookStatus{
+				machine(true, infrav1.MachinePlaybookPhasePending),
+				machine(false, infrav1.MachinePlaybookPhasePending),
+			},
+			controlPlaneBatchSize: 3,
+			workerBatchSize:       3,
+			want:                  []int{0},
+		},
+		{
+			name: "workers in batches",
+			statuses: []infrav1.MachinePlaybookStatus{
+				machine(true, infrav1.MachinePlaybookPhaseSucceeded),
+				machine(false, infrav1.MachinePlaybookPhaseSucceeded),
+				machine(false, infrav1.MachinePlaybookPhaseFailed),
+				machine(false, infrav1.MachinePlaybookPhaseRunning),
+				machine(false, infrav1.MachinePlaybookPhasePending),
+				machine(false, infrav1.MachinePlaybookPhasePending),
+			},
+			controlPlaneBatchSize: 1,
+			workerBatchSize:       2,
+			want:                  []int{3, 4},
+		},
+		{
+			name: "all batches have completed",
+			statuses: []infrav1.MachinePlaybookStatus{
+				machine(true, infrav1.MachinePlaybookPhaseSucceeded),
+				machine(false, infrav1.MachinePlaybookPhaseFailed),
+			},
+			controlPlaneBatchSize: 1,
+			workerBatchSize:       1,
+			want:                  nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(currentBatch(tt.statuses, tt.controlPlaneBatchSize, tt.workerBatchSize)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestClusterPlaybookRunReconcile(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+
+	newMachine := func(name string, controlPlane bool) *infrav1.KubeforceMachine {
+		kfm := &infrav1.KubeforceMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				Labels:    map[string]string{clusterv1.ClusterNameLabel: "cluster"},
+			},
+			Status: infrav1.KubeforceMachineStatus{
+				AgentRef: &corev1.LocalObjectReference{Name: name + "-agent"},
+			},
+		}
+		if controlPlane {
+			kfm.Labels[clusterv1.MachineControlPlaneLabel] = ""
+		}
+		return kfm
+	}
+	maxFailures := intstr.FromInt(1)
+	run := &infrav1.ClusterPlaybookRun{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "containerd", UID: "uid"},
+		Spec: infrav1.ClusterPlaybookRunSpec{
+			ClusterName: "cluster",
+			TemplateRef: corev1.LocalObjectReference{Name: "containerd"},
+			Variables: map[string]runtime.RawExtension{
+				"mirror": {Raw: []byte(`"registry.local"`)},
+				"token":  {Raw: []byte(`"plain"`)},
+			},
+			VariablesFrom: []infrav1.TemplateVariable{
+				{
+					Name: "token",
+					ValueFrom: infrav1.TemplateVariableSource{
+						SecretKeyRef: &corev1.SecretKeySelector{
+							LocalObjectReference: corev1.LocalObjectReference{Name: "registry"},
+							Key:                  "token",
+						},
+					},
+				},
+			},
+			Strategy: &infrav1.ClusterPlaybookRunStrategy{
+				MaxFailures: &maxFailures,
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}},
+		&corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "registry"},
+			Data:       map[string][]byte{"token": []byte("s3cr3t")},
+		},
+		&infrav1.PlaybookTemplate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "containerd"},
+			Spec: infrav1.PlaybookTemplateSpec{
+				Spec: infrav1.RemotePlaybookSpec{
+					Files:      map[string]string{"site.yaml": "- hosts: all\n"},
+					Entrypoint: "site.yaml",
+				},
+			},
+		},
+		newMachine("worker-1", false),
+		newMachine("worker-2", false),
+		newMachine("cp-1", true),
+		run,
+	).Build()
+	r := &ClusterPlaybookRunReconciler{
+		Client:             c,
+		Log:                logr.Discard(),
+		TemplateReconciler: playbook.TemplateReconciler{Client: c, Log: logr.Discard()},
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(run)}
+	reconcileRun := func() *infrav1.ClusterPlaybookRun {
+		_, err := r.Reconcile(ctx, req)
+		g.Expect(err).NotTo(HaveOccurred())
+		result := &infrav1.ClusterPlaybookRun{}
+		g.Expect(c.Get(ctx, req.NamespacedName, result)).To(Succeed())
+		return result
+	}
+	completePlaybook := func(machineName string, phase string) {
+		list := &infrav1.PlaybookList{}
+		g.Expect(c.List(ctx, list, client.MatchingLabels{infrav1.ClusterPlaybookRunMachineLabelName: machineName})).To(Succeed())
+		g.Expect(list.Items).To(HaveLen(1))
+		pb := &list.Items[0]
+		pb.Status.ExternalPhase = phase
+		pb.Status.Conditions = clusterv1.Conditions{{Type: infrav1.SynchronizationCondition, Status: corev1.ConditionTrue}}
+		g.Expect(c.Status().Update(ctx, pb)).To(Succeed())
+	}
+	playbookCount := func() int {
+		list := &infrav1.PlaybookList{}
+		g.Expect(c.List(ctx, list)).To(Succeed())
+		return len(list.Items)
+	}
+
+	// the control plane machine is the first
+	result := reconcileRun()
+	g.Expect(result.Status.Phase).To(Equal(infrav1.ClusterPlaybookRunPhaseRunning))
+	g.Expect(result.Status.Machines).To(Equal(int32(3)))
+	g.Expect(result.Status.MachineStatuses[0].Name).To(Equal("cp-1"))
+	g.Expect(result.Status.MachineStatuses[0].Phase).To(Equal(infrav1.MachinePlaybookPhaseRunning))
+	g.Expect(playbookCount()).To(Equal(1))
+	pb := &infrav1.Playbook{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: result.Status.MachineStatuses[0].Playbook}, pb)).To(Succeed())
+	g.Expect(pb.Spec.AgentRef.Name).To(Equal("cp-1-agent"))
+	g.Expect(metav1.IsControlledBy(pb, result)).To(BeTrue())
+
+	// the secret variables are delivered by the Secret owned by the playbook
+	g.Expect(pb.Spec.Files["variables.yaml"]).To(Equal("mirror: registry.local\n"))
+	g.Expect(pb.Spec.FileSources).To(HaveLen(1))
+	g.Expect(pb.Spec.FileSources[0].SecretKeyRef).NotTo(BeNil())
+	secret := &corev1.Secret{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: pb.Spec.FileSources[0].SecretKeyRef.Name}, secret)).To(Succeed())
+	g.Expect(metav1.IsControlledBy(secret, pb)).To(BeTrue())
+	g.Expect(string(secret.Data[pb.Spec.FileSources[0].SecretKeyRef.Key])).To(HaveSuffix("\ntoken: s3cr3t\n"))
+
+	// the workers are run one by one
+	completePlaybook("cp-1", "Succeeded")
+	result = reconcileRun()
+	g.Expect(playbookCount()).To(Equal(2))
+	g.Expect(result.Status.MachineStatuses[1].Phase).To(Equal(infrav1.MachinePlaybookPhaseRunning))
+	g.Expect(result.Status.MachineStatuses[2].Phase).To(Equal(infrav1.MachinePlaybookPhasePending))
+
+	// one failure is tolerated
+	completePlaybook("worker-1", "Failed")
+	result = reconcileRun()
+	g.Expect(playbookCount()).To(Equal(3))
+	g.Expect(result.Status.Failed).To(Equal(int32(1)))
+
+	completePlaybook("worker-2", "Succeeded")
+	result = reconcileRun()
+	g.Expect(result.Status.Phase).To(Equal(infrav1.ClusterPlaybookRunPhaseSucceeded))
+	g.Expect(result.Status.Succeeded).To(Equal(int32(2)))
+	g.Expect(result.Status.CompletionTime).NotTo(BeNil())
+
+	// the completed run does not create new Playbooks
+	g.Expect(c.Create(ctx, newMachine("worker-3", false))).To(Succeed())
+	result = reconcileRun()
+	g.Expect(playbookCount()).To(Equal(3))
+	g.Expect(result.Status.Machines).To(Equal(int32(3)))
+}
+
+func TestClusterPlaybookRunMachineWithoutAgent(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+
+	newMachine := func(name string, agent bool) *infrav1.KubeforceMachine {
+		kfm := &infrav1.KubeforceMachine{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      name,
+				Labels:    map[string]string{clusterv1.ClusterNameLabel: "cluster"},
+			},
+		}
+		if agent {
+			kfm.Status.AgentRef = &corev1.LocalObjectReference{Name: name + "-agent"}
+		}
+		return kfm
+	}
+	maxFailures := intstr.FromInt(1)
+	run := &infrav1.ClusterPlaybookRun{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "containerd", UID: "uid"},
+		Spec: infrav1.ClusterPlaybookRunSpec{
+			ClusterName: "cluster",
+			TemplateRef: corev1.LocalObjectReference{Name: "containerd"},
+			Strategy: &infrav1.ClusterPlaybookRunStrategy{
+				MaxFailures: &maxFailures,
+			},
+		},
+	}
+	withoutAgent := newMachine("worker-1", false)
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"}},
+		&infrav1.PlaybookTemplate{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "containerd"},
+			Spec: infrav1.PlaybookTemplateSpec{
+				Spec: infrav1.RemotePlaybookSpec{
+					Files:      map[string]string{"site.yaml": "- hosts: all\n"},
+					Entrypoint: "site.yaml",
+				},
+			},
+		},
+		withoutAgent,
+		newMachine("worker-2", true),
+		run,
+	).Build()
+	r := &ClusterPlaybookRunReconciler{
+		Client:             c,
+		Log:                logr.Discard(),
+		TemplateReconciler: playbook.TemplateReconciler{Client: c, Log: logr.Discard()},
+	}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(run)}
+	reconcileRun := func() *infrav1.ClusterPlaybookRun {
+		_, err := r.Reconcile(ctx, req)
+		g.Expect(err).NotTo(HaveOccurred())
+		result := &infrav1.ClusterPlaybookRun{}
+		g.Expect(c.Get(ctx, req.NamespacedName, result)).To(Succeed())
+		return result
+	}
+
+	// the machine without the agent does not block the run
+	result := reconcileRun()
+	g.Expect(result.Status.MachineStatuses[0].Phase).To(Equal(infrav1.MachinePlaybookPhaseFailed))
+	g.Expect(result.Status.MachineStatuses[0].Message).NotTo(BeEmpty())
+	g.Expect(result.Status.Failed).To(Equal(int32(1)))
+
+	// the failed machine is not started when the agent appears
+	withoutAgent.Status.AgentRef = &corev1.LocalObjectReference{Name: "worker-1-agent"}
+	g.Expect(c.Update(ctx, withoutAgent)).To(Succeed())
+	result = reconcileRun()
+	g.Expect(result.Status.MachineStatuses[0].Phase).To(Equal(infrav1.MachinePlaybookPhaseFailed))
+	g.Expect(result.Status.MachineStatuses[1].Phase).To(Equal(infrav1.MachinePlaybookPhaseRunning))
+	list := &infrav1.PlaybookList{}
+	g.Expect(c.List(ctx, list)).To(Succeed())
+	g.Expect(list.Items).To(HaveLen(1))
+	g.Expect(list.Items[0].Spec.AgentRef.Name).To(Equal("worker-2-agent"))
+
+	// the run fails if the failures of the machines without the agents exceed the threshold
+	maxFailures = intstr.FromInt(0)
+	result.Spec.Strategy.MaxFailures = &maxFailures
+	g.Expect(c.Update(ctx, result)).To(Succeed())
+	result = reconcileRun()
+	g.Expect(result.Status.Phase).To(Equal(infrav1.ClusterPlaybookRunPhaseFailed))
+	g.Expect(result.Status.MachineStatuses[0].Phase).To(Equal(infrav1.MachinePlaybookPhaseFailed))
+}
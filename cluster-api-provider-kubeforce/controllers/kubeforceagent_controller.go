@@ -30,6 +30,7 @@ import (
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	capiutil "sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/annotations"
@@ -55,6 +56,15 @@ import (
 	stringutil "k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/util/strings"
 )
 
+const (
+	// agentReadinessTimeout is the time for the upgraded agent to become ready before it is rolled back.
+	agentReadinessTimeout = 2 * time.Minute
+	// agentUpgradeTimeout is the time to wait for the new agent version to be reported.
+	agentUpgradeTimeout = 5 * time.Minute
+	// agentUpgradeRetryPeriod is the time before the failed upgrade is re-tried.
+	agentUpgradeRetryPeriod = 10 * time.Minute
+)
+
 // KubeforceAgentReconciler reconciles a KubeforceAgent object.
 type KubeforceAgentReconciler struct {
 	Client           client.Client
@@ -170,6 +180,14 @@ func (r *KubeforceAgentReconciler) SetupWithManager(logger logr.Logger, mgr ctrl
 			&source.Kind{Type: &certv1.Certificate{}},
 			&handler.EnqueueRequestForOwner{OwnerType: &infrav1.KubeforceAgent{}},
 		).
+		Watches(
+			&source.Kind{Type: &infrav1.Playbook{}},
+			handler.EnqueueRequestsFromMapFunc(r.playbookToKubeforceAgent),
+		).
+		Watches(
+			&source.Kind{Type: &infrav1.PlaybookDeployment{}},
+			handler.EnqueueRequestsFromMapFunc(r.playbookToKubeforceAgent),
+		).
 		Build(r)
 	if err != nil {
 		return err
@@ -348,6 +366,7 @@ func (r *KubeforceAgentReconciler) reconcileNormal(ctx context.Context, kfAgent
 		}
 		return result, err
 	}
+	resetSSHHostKeys(ctx, kfAgent)
 	if result, err := r.reconcileAgentInstallation(ctx, kfAgent); !result.IsZero() || err != nil {
 		if err != nil {
 			log.Error(err, "failed to reconcile the agent installation")
@@ -379,9 +398,199 @@ func (r *KubeforceAgentReconciler) reconcileNormal(ctx context.Context, kfAgent
 		conditions.MarkFalse(kfAgent, infrav1.AgentInfoCondition, infrav1.AgentInfoFailedReason, clusterv1.ConditionSeverityError, err.Error())
 		return ctrl.Result{}, err
 	}
+	if result, err := r.reconcileAgentUpgrade(ctx, kfAgent); !result.IsZero() || err != nil {
+		return result, err
+	}
+	return r.reconcileAnsibleBundle(ctx, kfAgent)
+}
+
+// reconcileAnsibleBundle uploads the ansible bundles from the bundle source to the agent
+// if the ansible runtime of the agent is installed offline.
+func (r *KubeforceAgentReconciler) reconcileAnsibleBundle(ctx context.Context, kfAgent *infrav1.KubeforceAgent) (ctrl.Result, error) {
+	if !agent.IsAnsibleBundleRequired(kfAgent) {
+		kfAgent.Status.AnsibleBundles = nil
+		conditions.Delete(kfAgent, infrav1.AnsibleBundleUploadedCondition)
+		return ctrl.Result{}, nil
+	}
+	versions, err := r.ansibleVersions(ctx, kfAgent)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	uploaded := make(map[string]bool, len(kfAgent.Status.AnsibleBundles))
+	for _, fileName := range kfAgent.Status.AnsibleBundles {
+		uploaded[fileName] = true
+	}
+	missing := make([]string, 0)
+	for _, version := range versions {
+		if !uploaded[agent.AnsibleBundleFileName(version)] {
+			missing = append(missing, version)
+		}
+	}
+	if len(missing) == 0 {
+		conditions.MarkTrue(kfAgent, infrav1.AnsibleBundleUploadedCondition)
+		return ctrl.Result{}, nil
+	}
+	agentHelper, err := agent.GetHelper(ctx, r.Client, r.Storage, kfAgent)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	clientset, err := r.AgentClientCache.GetClientSet(ctx, client.ObjectKeyFromObject(kfAgent))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	for _, version := range missing {
+		if err := agentHelper.UploadAnsibleBundle(ctx, clientset, version); err != nil {
+			conditions.MarkFalse(kfAgent, infrav1.AnsibleBundleUploadedCondition, infrav1.AnsibleBundleUploadFailedReason,
+				clusterv1.ConditionSeverityWarning, err.Error())
+			return ctrl.Result{}, err
+		}
+		fileName := agent.AnsibleBundleFileName(version)
+		ctrl.LoggerFrom(ctx).Info("the ansible bundle has been uploaded to the agent", "bundle", fileName)
+		kfAgent.Status.AnsibleBundles = append(kfAgent.Status.AnsibleBundles, fileName)
+	}
+	conditions.MarkTrue(kfAgent, infrav1.AnsibleBundleUploadedCondition)
 	return ctrl.Result{}, nil
 }
 
+// ansibleVersions returns the sorted versions of ansible-core that are used on the agent:
+// the default version and the versions of the Playbooks and PlaybookDeployments of the agent.
+func (r *KubeforceAgentReconciler) ansibleVersions(ctx context.Context, kfAgent *infrav1.KubeforceAgent) ([]string, error) {
+	versions := sets.NewString(agent.DefaultAnsibleVersion(kfAgent))
+	playbooks := &infrav1.PlaybookList{}
+	if err := r.Client.List(ctx, playbooks, client.InNamespace(kfAgent.Namespace)); err != nil {
+		return nil, errors.Wrap(err, "unable to list Playbooks")
+	}
+	for _, pb := range playbooks.Items {
+		if pb.Spec.AgentRef.Name == kfAgent.Name && pb.Spec.AnsibleVersion != "" {
+			versions.Insert(pb.Spec.AnsibleVersion)
+		}
+	}
+	deployments := &infrav1.PlaybookDeploymentList{}
+	if err := r.Client.List(ctx, deployments, client.InNamespace(kfAgent.Namespace)); err != nil {
+		return nil, errors.Wrap(err, "unable to list PlaybookDeployments")
+	}
+	for _, pd := range deployments.Items {
+		if pd.Spec.AgentRef.Name == kfAgent.Name && pd.Spec.Template.Spec.AnsibleVersion != "" {
+			versions.Insert(pd.Spec.Template.Spec.AnsibleVersion)
+		}
+	}
+	return versions.List(), nil
+}
+
+// playbookToKubeforceAgent returns the KubeforceAgent of the Playbook or the PlaybookDeployment
+// that requires the specific version of ansible-core.
+func (r *KubeforceAgentReconciler) playbookToKubeforceAgent(o client.Object) []ctrl.Request {
+	var agentName string
+	switch obj := o.(type) {
+	case *infrav1.Playbook:
+		if obj.Spec.AnsibleVersion == "" {
+			return nil
+		}
+		agentName = obj.Spec.AgentRef.Name
+	case *infrav1.PlaybookDeployment:
+		if obj.Spec.Template.Spec.AnsibleVersion == "" {
+			return nil
+		}
+		agentName = obj.Spec.AgentRef.Name
+	default:
+		return nil
+	}
+	return []ctrl.Request{{NamespacedName: client.ObjectKey{Namespace: o.GetNamespace(), Name: agentName}}}
+}
+
+// reconcileAgentUpgrade upgrades the agent if the installed version differs from the version of the agent source.
+func (r *KubeforceAgentReconciler) reconcileAgentUpgrade(ctx context.Context, kfAgent *infrav1.KubeforceAgent) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	if kfAgent.Spec.Source == nil || kfAgent.Spec.Source.Version == "" || kfAgent.Status.AgentInfo == nil {
+		return ctrl.Result{}, nil
+	}
+	desiredVersion := kfAgent.Spec.Source.Version
+	if kfAgent.Status.AgentInfo.Version == desiredVersion {
+		kfAgent.Status.LastUpgrade = nil
+		conditions.MarkTrue(kfAgent, infrav1.AgentUpgradedCondition)
+		return ctrl.Result{}, nil
+	}
+	bootstrapping, err := isMachineBootstrapping(ctx, r.Client, kfAgent)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if bootstrapping {
+		conditions.MarkFalse(kfAgent, infrav1.AgentUpgradedCondition, infrav1.WaitingForMachineBootstrapReason, clusterv1.ConditionSeverityInfo,
+			"the agent will be upgraded to %s after the KubeforceMachine is bootstrapped", desiredVersion)
+		return ctrl.Result{RequeueAfter: 30 * time.Second}, nil
+	}
+
+	if upgrade := kfAgent.Status.LastUpgrade; upgrade != nil && upgrade.Version == desiredVersion {
+		elapsed := time.Since(upgrade.StartTime.Time)
+		if elapsed < agentUpgradeTimeout {
+			conditions.MarkFalse(kfAgent, infrav1.AgentUpgradedCondition, infrav1.AgentUpgradingReason, clusterv1.ConditionSeverityInfo,
+				"upgrading from %s to %s", kfAgent.Status.AgentInfo.Version, desiredVersion)
+			return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+		}
+		conditions.MarkFalse(kfAgent, infrav1.AgentUpgradedCondition, infrav1.AgentUpgradeFailedReason, clusterv1.ConditionSeverityWarning,
+			"the agent has not been upgraded to %s within %s", desiredVersion, agentUpgradeTimeout)
+		if elapsed < agentUpgradeTimeout+agentUpgradeRetryPeriod {
+			return ctrl.Result{RequeueAfter: agentUpgradeTimeout + agentUpgradeRetryPeriod - elapsed}, nil
+		}
+	}
+
+	log.Info("upgrading the agent", "from", kfAgent.Status.AgentInfo.Version, "to", desiredVersion)
+	if err := r.upgradeAgent(ctx, kfAgent); err != nil {
+		if errors.As(err, &agent.HostKeyError{}) {
+			// the upgrade is not retried until the KubeforceAgent is changed
+			conditions.MarkFalse(kfAgent, infrav1.AgentUpgradedCondition, infrav1.SSHHostKeyMismatchReason, clusterv1.ConditionSeverityError, err.Error())
+			return ctrl.Result{}, nil
+		}
+		conditions.MarkFalse(kfAgent, infrav1.AgentUpgradedCondition, infrav1.AgentUpgradeFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return ctrl.Result{}, err
+	}
+	conditions.MarkFalse(kfAgent, infrav1.AgentUpgradedCondition, infrav1.AgentUpgradingReason, clusterv1.ConditionSeverityInfo,
+		"upgrading from %s to %s", kfAgent.Status.AgentInfo.Version, desiredVersion)
+	kfAgent.Status.LastUpgrade = &infrav1.AgentUpgradeStatus{
+		Version:   desiredVersion,
+		StartTime: metav1.Now(),
+	}
+	return ctrl.Result{RequeueAfter: 10 * time.Second}, nil
+}
+
+// upgradeAgent upgrades the agent through the agent API and falls back to ssh if it is configured.
+func (r *KubeforceAgentReconciler) upgradeAgent(ctx context.Context, kfAgent *infrav1.KubeforceAgent) error {
+	agentHelper, err := agent.GetHelper(ctx, r.Client, r.Storage, kfAgent)
+	if err != nil {
+		return err
+	}
+	clientset, err := r.AgentClientCache.GetClientSet(ctx, client.ObjectKeyFromObject(kfAgent))
+	if err != nil {
+		return err
+	}
+	err = agentHelper.Upgrade(ctx, clientset, agentReadinessTimeout)
+	if err == nil || kfAgent.Spec.SSH.SecretName == "" {
+		return err
+	}
+	ctrl.LoggerFrom(ctx).Error(err, "unable to upgrade the agent through the agent API, trying ssh")
+	return agentHelper.UpgradeBySSH(ctx, agentReadinessTimeout)
+}
+
+// isMachineBootstrapping returns true if the KubeforceMachine that uses the agent has not been bootstrapped yet.
+func isMachineBootstrapping(ctx context.Context, c client.Client, kfAgent *infrav1.KubeforceAgent) (bool, error) {
+	kfMachineName := kfAgent.Labels[infrav1.AgentMachineLabel]
+	if kfMachineName == "" {
+		return false, nil
+	}
+	kfMachine := &infrav1.KubeforceMachine{}
+	key := client.ObjectKey{
+		Namespace: kfAgent.Namespace,
+		Name:      kfMachineName,
+	}
+	if err := c.Get(ctx, key, kfMachine); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to get KubeforceMachine %q", key)
+	}
+	return !kfMachine.Status.Ready || !kfMachine.DeletionTimestamp.IsZero(), nil
+}
+
 func (r *KubeforceAgentReconciler) syncAgentTLSSecret(ctx context.Context, kfAgent *infrav1.KubeforceAgent, needUpload bool) (bool, error) {
 	issuedTLSKey := agent.GetAgentTLSObjectKey(kfAgent, agent.IssuedKey)
 	issuedTLSSecret := &corev1.Secret{}
@@ -503,7 +712,7 @@ func (r *KubeforceAgentReconciler) syncAgentClientSecret(ctx context.Context, kf
 }
 
 func (r *KubeforceAgentReconciler) reconcileAgentInfo(ctx context.Context, kfAgent *infrav1.KubeforceAgent) error {
-	if kfAgent.Status.AgentInfo != nil && kfAgent.Status.SystemInfo != nil {
+	if kfAgent.Status.AgentInfo != nil && kfAgent.Status.SystemInfo != nil && !isAgentUpgrading(kfAgent) {
 		conditions.MarkTrue(kfAgent, infrav1.AgentInfoCondition)
 		return nil
 	}
@@ -534,6 +743,25 @@ func (r *KubeforceAgentReconciler) reconcileAgentInfo(ctx context.Context, kfAge
 	return nil
 }
 
+// isAgentUpgrading returns true if the agent has been requested to upgrade to the version that is not running yet.
+// The agent info is requested again during the upgrade to check the running version.
+func isAgentUpgrading(kfAgent *infrav1.KubeforceAgent) bool {
+	upgrade := kfAgent.Status.LastUpgrade
+	return upgrade != nil && kfAgent.Status.AgentInfo != nil && kfAgent.Status.AgentInfo.Version != upgrade.Version
+}
+
+// resetSSHHostKeys removes the host keys accepted by the TrustOnFirstUse policy
+// if the KubeforceAgent has the ResetSSHHostKeysAnnotation. The annotation is removed after that.
+func resetSSHHostKeys(ctx context.Context, kfAgent *infrav1.KubeforceAgent) {
+	if _, ok := kfAgent.Annotations[infrav1.ResetSSHHostKeysAnnotation]; !ok {
+		return
+	}
+	ctrl.LoggerFrom(ctx).Info("resetting the accepted ssh host keys")
+	kfAgent.Status.SSHHostKey = ""
+	kfAgent.Status.SSHJumpHostKeys = nil
+	delete(kfAgent.Annotations, infrav1.ResetSSHHostKeysAnnotation)
+}
+
 func (r *KubeforceAgentReconciler) reconcileAgentInstallation(ctx context.Context, kfAgent *infrav1.KubeforceAgent) (ctrl.Result, error) {
 	if kfAgent.Spec.Installed {
 		if !conditions.IsTrue(kfAgent, infrav1.AgentInstalledCondition) {
@@ -566,10 +794,17 @@ func (r *KubeforceAgentReconciler) reconcileAgentInstallation(ctx context.Contex
 		}, nil
 	}
 	kfAgent.Status.AgentInfo = nil
+	// the files uploaded to the previous installation may be removed by the reinstallation
+	kfAgent.Status.AnsibleBundles = nil
 	err = agentHelper.Install(ctx)
 	if err != nil {
 		kfAgent.Status.FailureReason = infrav1.InstallAgentError
 		kfAgent.Status.FailureMessage = err.Error()
+		if errors.As(err, &agent.HostKeyError{}) {
+			// the installation is not retried until the KubeforceAgent is changed
+			conditions.MarkFalse(kfAgent, infrav1.AgentInstalledCondition, infrav1.SSHHostKeyMismatchReason, clusterv1.ConditionSeverityError, err.Error())
+			return ctrl.Result{}, nil
+		}
 		conditions.MarkFalse(kfAgent, infrav1.AgentInstalledCondition, infrav1.AgentInstallingFailedReason, clusterv1.ConditionSeverityError, err.Error())
 		return ctrl.Result{RequeueAfter: 20 * time.Second}, nil
 	}
@@ -650,7 +885,8 @@ func (r *KubeforceAgentReconciler) createAgentServCertificate(ctx context.Contex
 	dnsNames := agent.Spec.Config.CertTemplate.DNSNames
 	dnsNames = append(dnsNames, stringutil.Filter(stringutil.IsNotEmpty, agent.Spec.Addresses.ExternalDNS, agent.Spec.Addresses.InternalDNS)...)
 	ipAddresses := agent.Spec.Config.CertTemplate.IPAddresses
-	ipAddresses = append(ipAddresses, stringutil.Filter(stringutil.IsNotEmpty, agent.Spec.Addresses.ExternalIP, agent.Spec.Addresses.InternalIP)...)
+	ipAddresses = append(ipAddresses, stringutil.Filter(stringutil.IsNotEmpty, agent.Spec.Addresses.ExternalIP, agent.Spec.Addresses.InternalIP,
+		agent.Spec.Addresses.ExternalIPv6, agent.Spec.Addresses.InternalIPv6)...)
 	cert := &certv1.Certificate{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      certKey.Name,
@@ -693,6 +929,8 @@ func (r *KubeforceAgentReconciler) toSystemInfo(info v1alpha1.SysInfo) *infrav1.
 		Network: infrav1.NetworkInfo{
 			Hostname:             info.Spec.Network.Hostname,
 			DefaultIPAddress:     info.Spec.Network.DefaultIPAddress,
+			DefaultIPv4Address:   info.Spec.Network.DefaultIPv4Address,
+			DefaultIPv6Address:   info.Spec.Network.DefaultIPv6Address,
 			DefaultInterfaceName: info.Spec.Network.DefaultInterfaceName,
 		},
 	}
@@ -720,6 +958,7 @@ func patchKubeforceAgent(ctx context.Context, patchHelper *patch.Helper, agent *
 			infrav1.HealthyCondition,
 			infrav1.AgentInfoCondition,
 			infrav1.AgentTLSCondition,
+			infrav1.AgentUpgradedCondition,
 		}},
 	)
 }
@@ -0,0 +1,402 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func TestReconcileAgentUpgrade(t *testing.T) {
+	g := NewWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	newAgent := func(running string, lastUpgrade *infrav1.AgentUpgradeStatus) *infrav1.KubeforceAgent {
+		return &infrav1.KubeforceAgent{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: "default",
+				Name:      "agent",
+				Labels:    map[string]string{infrav1.AgentMachineLabel: "machine"},
+			},
+			Spec: infrav1.KubeforceAgentSpec{
+				Installed: true,
+				Source:    &infrav1.AgentSource{Version: "v0.2.0"},
+			},
+			Status: infrav1.KubeforceAgentStatus{
+				AgentInfo:   &infrav1.AgentInfo{Version: running},
+				LastUpgrade: lastUpgrade,
+			},
+		}
+	}
+	newMachine := func(ready bool) *infrav1.KubeforceMachine {
+		return &infrav1.KubeforceMachine{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+			Status:     infrav1.KubeforceMachineStatus{Ready: ready},
+		}
+	}
+
+	tests := []struct {
+		name            string
+		agent           *infrav1.KubeforceAgent
+		machine         *infrav1.KubeforceMachine
+		wantErr         bool
+		wantRequeue     bool
+		wantStatus      corev1.ConditionStatus
+		wantReason      string
+		wantAgentInfo   bool
+		wantLastUpgrade bool
+	}{
+		{
+			name: "the agent runs the desired version",
+			agent: newAgent("v0.2.0", &infrav1.AgentUpgradeStatus{
+				Version:   "v0.2.0",
+				StartTime: metav1.NewTime(time.Now().Add(-time.Minute)),
+			}),
+			machine:       newMachine(true),
+			wantStatus:    corev1.ConditionTrue,
+			wantAgentInfo: true,
+		},
+		{
+			name:          "version skew waits for the machine bootstrap",
+			agent:         newAgent("v0.1.0", nil),
+			machine:       newMachine(false),
+			wantRequeue:   true,
+			wantStatus:    corev1.ConditionFalse,
+			wantReason:    infrav1.WaitingForMachineBootstrapReason,
+			wantAgentInfo: true,
+		},
+		{
+			name: "the upgrade is in progress",
+			agent: newAgent("v0.1.0", &infrav1.AgentUpgradeStatus{
+				Version:   "v0.2.0",
+				StartTime: metav1.NewTime(time.Now().Add(-time.Minute)),
+			}),
+			machine:     newMachine(true),
+			wantRequeue: true,
+			wantStatus:  corev1.ConditionFalse,
+			wantReason:  infrav1.AgentUpgradingReason,
+			// the agent info is kept and refreshed by reconcileAgentInfo
+			wantAgentInfo:   true,
+			wantLastUpgrade: true,
+		},
+		{
+			name: "the upgrade timed out and waits for the retry",
+			agent: newAgent("v0.1.0", &infrav1.AgentUpgradeStatus{
+				Version:   "v0.2.0",
+				StartTime: metav1.NewTime(time.Now().Add(-agentUpgradeTimeout - time.Second)),
+			}),
+			machine:         newMachine(true),
+			wantRequeue:     true,
+			wantStatus:      corev1.ConditionFalse,
+			wantReason:      infrav1.AgentUpgradeFailedReason,
+			wantAgentInfo:   true,
+			wantLastUpgrade: true,
+		},
+		{
+			name: "the failed upgrade is retried after the retry period",
+			agent: newAgent("v0.1.0", &infrav1.AgentUpgradeStatus{
+				Version:   "v0.2.0",
+				StartTime: metav1.NewTime(time.Now().Add(-agentUpgradeTimeout - agentUpgradeRetryPeriod - time.Second)),
+			}),
+			machine: newMachine(true),
+			// the agent keys are missing, so the upgrade attempt fails
+			wantErr:         true,
+			wantStatus:      corev1.ConditionFalse,
+			wantReason:      infrav1.AgentUpgradeFailedReason,
+			wantAgentInfo:   true,
+			wantLastUpgrade: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tt.machine).Build()
+			r := &KubeforceAgentReconciler{Client: c}
+			res, err := r.reconcileAgentUpgrade(context.Background(), tt.agent)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+			g.Expect(res.RequeueAfter > 0).To(Equal(tt.wantRequeue))
+			cond := conditions.Get(tt.agent, infrav1.AgentUpgradedCondition)
+			g.Expect(cond).NotTo(BeNil())
+			g.Expect(cond.Status).To(Equal(tt.wantStatus))
+			g.Expect(cond.Reason).To(Equal(tt.wantReason))
+			g.Expect(tt.agent.Status.AgentInfo != nil).To(Equal(tt.wantAgentInfo))
+			g.Expect(tt.agent.Status.LastUpgrade != nil).To(Equal(tt.wantLastUpgrade))
+		})
+	}
+}
+
+func TestIsAgentUpgrading(t *testing.T) {
+	g := NewWithT(t)
+	upgrade := &infrav1.AgentUpgradeStatus{Version: "v0.2.0"}
+	newAgent := func(info *infrav1.AgentInfo, lastUpgrade *infrav1.AgentUpgradeStatus) *infrav1.KubeforceAgent {
+		return &infrav1.KubeforceAgent{
+			Status: infrav1.KubeforceAgentStatus{AgentInfo: info, LastUpgrade: lastUpgrade},
+		}
+	}
+	g.Expect(isAgentUpgrading(newAgent(&infrav1.AgentInfo{Version: "v0.1.0"}, upgrade))).To(BeTrue())
+	g.Expect(isAgentUpgrading(newAgent(&infrav1.AgentInfo{Version: "v0.2.0"}, upgrade))).To(BeFalse())
+	g.Expect(isAgentUpgrading(newAgent(&infrav1.AgentInfo{Version: "v0.1.0"}, nil))).To(BeFalse())
+	g.Expect(isAgentUpgrading(newAgent(nil, upgrade))).To(BeFalse())
+}
+
+func TestAgentGroupReconcileUpgrade(t *testing.T) {
+	g := NewWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	// newAgent creates the ready agent that runs the version or the agent that is not ready.
+	newAgent := func(name, version string, ready bool) *infrav1.KubeforceAgent {
+		a := &infrav1.KubeforceAgent{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+			Spec: infrav1.KubeforceAgentSpec{
+				Installed: true,
+				Source:    &infrav1.AgentSource{Version: version},
+			},
+			Status: infrav1.KubeforceAgentStatus{
+				AgentInfo: &infrav1.AgentInfo{Version: version},
+			},
+		}
+		if ready {
+			conditions.MarkTrue(a, infrav1.HealthyCondition)
+			conditions.MarkTrue(a, clusterv1.ReadyCondition)
+		}
+		return a
+	}
+	newGroup := func(maxUnavailable string) *infrav1.KubeforceAgentGroup {
+		group := &infrav1.KubeforceAgentGroup{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "group"},
+		}
+		group.Spec.Template.Spec.Source = &infrav1.AgentSource{Version: "v0.2.0"}
+		if maxUnavailable != "" {
+			value := intstr.Parse(maxUnavailable)
+			group.Spec.UpgradeStrategy = &infrav1.AgentUpgradeStrategy{MaxUnavailable: &value}
+		}
+		return group
+	}
+
+	tests := []struct {
+		name         string
+		group        *infrav1.KubeforceAgentGroup
+		agents       []*infrav1.KubeforceAgent
+		bootstrapped map[string]bool
+		wantUpgraded []string
+		wantRequeue  bool
+	}{
+		{
+			name:  "one agent at a time by default",
+			group: newGroup(""),
+			agents: []*infrav1.KubeforceAgent{
+				newAgent("a", "v0.1.0", true),
+				newAgent("b", "v0.1.0", true),
+				newAgent("c", "v0.1.0", true),
+			},
+			wantUpgraded: []string{"a"},
+		},
+		{
+			name:  "percentage of agents",
+			group: newGroup("50%"),
+			agents: []*infrav1.KubeforceAgent{
+				newAgent("a", "v0.1.0", true),
+				newAgent("b", "v0.1.0", true),
+				newAgent("c", "v0.1.0", true),
+				newAgent("d", "v0.1.0", true),
+			},
+			wantUpgraded: []string{"a", "b"},
+		},
+		{
+			name:  "the upgrading agent is counted as unavailable",
+			group: newGroup("1"),
+			agents: []*infrav1.KubeforceAgent{
+				func() *infrav1.KubeforceAgent {
+					a := newAgent("a", "v0.1.0", true)
+					a.Spec.Source.Version = "v0.2.0"
+					return a
+				}(),
+				newAgent("b", "v0.1.0", true),
+			},
+			wantUpgraded: []string{"a"},
+		},
+		{
+			name:  "the unavailable agent does not block the upgrade of itself",
+			group: newGroup("1"),
+			agents: []*infrav1.KubeforceAgent{
+				newAgent("a", "v0.1.0", true),
+				newAgent("b", "v0.1.0", false),
+			},
+			wantUpgraded: []string{"b"},
+		},
+		{
+			name:  "the agent of the bootstrapping machine is skipped",
+			group: newGroup("1"),
+			agents: []*infrav1.KubeforceAgent{
+				func() *infrav1.KubeforceAgent {
+					a := newAgent("a", "v0.1.0", true)
+					a.Labels = map[string]string{infrav1.AgentMachineLabel: "machine"}
+					return a
+				}(),
+				newAgent("b", "v0.1.0", true),
+			},
+			bootstrapped: map[string]bool{"machine": false},
+			wantUpgraded: []string{"b"},
+			wantRequeue:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			objects := make([]client.Object, 0, len(tt.agents))
+			for _, a := range tt.agents {
+				objects = append(objects, a)
+			}
+			for name, ready := range tt.bootstrapped {
+				objects = append(objects, &infrav1.KubeforceMachine{
+					ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+					Status:     infrav1.KubeforceMachineStatus{Ready: ready},
+				})
+			}
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objects...).Build()
+			r := &KubeforceAgentGroupReconciler{Client: c}
+			res, err := r.reconcileUpgrade(context.Background(), tt.group, tt.agents)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(res.RequeueAfter > 0).To(Equal(tt.wantRequeue))
+
+			list := &infrav1.KubeforceAgentList{}
+			g.Expect(c.List(context.Background(), list)).To(Succeed())
+			upgraded := make([]string, 0)
+			for _, a := range list.Items {
+				if a.Spec.Source.Version == "v0.2.0" {
+					upgraded = append(upgraded, a.Name)
+				}
+			}
+			g.Expect(upgraded).To(ConsistOf(tt.wantUpgraded))
+		})
+	}
+}
+
+func TestReconcileAnsibleBundleVersions(t *testing.T) {
+	g := NewWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	newPlaybook := func(name, agentName, version string) *infrav1.Playbook {
+		pb := &infrav1.Playbook{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name},
+		}
+		pb.Spec.AgentRef.Name = agentName
+		pb.Spec.AnsibleVersion = version
+		return pb
+	}
+	pd := &infrav1.PlaybookDeployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "deployment"},
+	}
+	pd.Spec.AgentRef.Name = "agent"
+	pd.Spec.Template.Spec.AnsibleVersion = "2.16.0"
+	kfAgent := &infrav1.KubeforceAgent{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent"},
+		Spec: infrav1.KubeforceAgentSpec{
+			Config: infrav1.AgentConfigSpec{
+				Ansible: &infrav1.AnsibleRuntime{
+					Version: "2.14.0",
+					Offline: true,
+					BundleSource: &infrav1.AnsibleBundleSource{
+						RepoRef: infrav1.RepositoryReference{Name: "bundles"},
+					},
+				},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newPlaybook("default", "agent", ""),
+		newPlaybook("pinned", "agent", "2.15.0"),
+		newPlaybook("other", "other", "2.17.0"),
+		pd,
+	).Build()
+	r := &KubeforceAgentReconciler{Client: c}
+
+	// the bundles of the default version and the versions of the playbooks of the agent are required
+	versions, err := r.ansibleVersions(context.Background(), kfAgent)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(versions).To(Equal([]string{"2.14.0", "2.15.0", "2.16.0"}))
+
+	// nothing is uploaded when all bundles have been uploaded
+	kfAgent.Status.AnsibleBundles = []string{
+		"ansible-core-2.14.0.tar.gz",
+		"ansible-core-2.15.0.tar.gz",
+		"ansible-core-2.16.0.tar.gz",
+	}
+	res, err := r.reconcileAnsibleBundle(context.Background(), kfAgent)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.IsZero()).To(BeTrue())
+	g.Expect(conditions.IsTrue(kfAgent, infrav1.AnsibleBundleUploadedCondition)).To(BeTrue())
+
+	// the missing bundle of the new playbook is uploaded
+	g.Expect(c.Create(context.Background(), newPlaybook("new", "agent", "2.17.0"))).To(Succeed())
+	g.Expect(r.playbookToKubeforceAgent(newPlaybook("new", "agent", "2.17.0"))).To(HaveLen(1))
+	_, err = r.reconcileAnsibleBundle(context.Background(), kfAgent)
+	// the agent keys are missing, so the upload attempt fails
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(kfAgent.Status.AnsibleBundles).To(HaveLen(3))
+}
+
+func TestResetSSHHostKeys(t *testing.T) {
+	g := NewWithT(t)
+	kfAgent := &infrav1.KubeforceAgent{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "agent",
+			Annotations: map[string]string{
+				infrav1.ResetSSHHostKeysAnnotation: "",
+				"other":                            "value",
+			},
+		},
+		Status: infrav1.KubeforceAgentStatus{
+			SSHHostKey:      "ssh-ed25519 AAAA",
+			SSHJumpHostKeys: map[string]string{"jump:22": "ssh-ed25519 BBBB"},
+		},
+	}
+	resetSSHHostKeys(context.Background(), kfAgent)
+	g.Expect(kfAgent.Status.SSHHostKey).To(BeEmpty())
+	g.Expect(kfAgent.Status.SSHJumpHostKeys).To(BeEmpty())
+	g.Expect(kfAgent.Annotations).To(Equal(map[string]string{"other": "value"}))
+
+	// the host keys accepted after the reset are kept
+	kfAgent.Status.SSHHostKey = "ssh-ed25519 CCCC"
+	resetSSHHostKeys(context.Background(), kfAgent)
+	g.Expect(kfAgent.Status.SSHHostKey).To(Equal("ssh-ed25519 CCCC"))
+}
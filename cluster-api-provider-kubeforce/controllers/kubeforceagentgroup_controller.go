@@ -20,12 +20,15 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
@@ -39,6 +42,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/agent"
 	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/util/names"
 	patchutil "k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/util/patch"
 )
@@ -159,10 +163,18 @@ func (r *KubeforceAgentGroupReconciler) reconcileNormal(ctx context.Context, age
 	if err != nil {
 		return ctrl.Result{}, errors.Wrap(err, "unable to get agents by the group")
 	}
+	result, err := r.reconcileUpgrade(ctx, agentGroup, agents)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
 
 	readyReplicas := 0
+	updatedReplicas := 0
 	waitForAgents := make([]string, 0)
 	for _, agent := range agents {
+		if isAgentUpdated(agent, agentGroup.Spec.Template.Spec.Source) {
+			updatedReplicas++
+		}
 		if agent.Status.Phase == infrav1.AgentPhaseRunning &&
 			conditions.IsTrue(agent, infrav1.HealthyCondition) &&
 			agent.Status.ObservedGeneration == agent.Generation {
@@ -174,6 +186,7 @@ func (r *KubeforceAgentGroupReconciler) reconcileNormal(ctx context.Context, age
 
 	agentGroup.Status.Replicas = int32(len(agentGroup.Spec.Addresses))
 	agentGroup.Status.ReadyReplicas = int32(readyReplicas)
+	agentGroup.Status.UpdatedReplicas = int32(updatedReplicas)
 
 	agentGroup.Status.Ready = agentGroup.Status.Replicas == agentGroup.Status.ReadyReplicas
 	if agentGroup.Status.Ready {
@@ -186,7 +199,7 @@ func (r *KubeforceAgentGroupReconciler) reconcileNormal(ctx context.Context, age
 			clusterv1.ConditionSeverityInfo,
 			"waiting for KubeforceAgents with names %q", waitForAgents)
 	}
-	return ctrl.Result{}, nil
+	return result, nil
 }
 
 func buildKubeforceAgentLabels(sourceLabels map[string]string, agentGroup string) map[string]string {
@@ -271,9 +284,11 @@ func (r *KubeforceAgentGroupReconciler) updateAgent(ctx context.Context, agent *
 		agent.Labels[key] = value
 	}
 
-	// only SSH and CertIssuerRef fields can be changed
+	// only SSH, CertIssuerRef, Ansible and Encryption fields can be changed
 	agent.Spec.SSH = desiredAgent.Spec.SSH
 	agent.Spec.Config.CertTemplate = desiredAgent.Spec.Config.CertTemplate
+	agent.Spec.Config.Ansible = desiredAgent.Spec.Config.Ansible
+	agent.Spec.Config.Encryption = desiredAgent.Spec.Config.Encryption
 
 	changed, err := patchutil.HasChanges(patchObj, agent)
 	if err != nil {
@@ -288,6 +303,94 @@ func (r *KubeforceAgentGroupReconciler) updateAgent(ctx context.Context, agent *
 	return nil
 }
 
+// reconcileUpgrade propagates the agent source from the template to the agents of the group,
+// so that no more than maxUnavailable agents are upgraded at the same time.
+// Agents whose KubeforceMachine is being bootstrapped are skipped until the bootstrap is finished.
+func (r *KubeforceAgentGroupReconciler) reconcileUpgrade(ctx context.Context, agentGroup *infrav1.KubeforceAgentGroup, agents []*infrav1.KubeforceAgent) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	desiredSource := agentGroup.Spec.Template.Spec.Source
+	if desiredSource == nil || desiredSource.Version == "" {
+		return ctrl.Result{}, nil
+	}
+	maxUnavailable, err := r.getMaxUnavailable(agentGroup, len(agents))
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	result := ctrl.Result{}
+	unavailable := 0
+	for _, kfAgent := range agents {
+		if isAgentUnavailable(kfAgent) {
+			unavailable++
+		}
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		return agents[i].Name < agents[j].Name
+	})
+	for _, kfAgent := range agents {
+		if kfAgent.Spec.Source != nil && kfAgent.Spec.Source.Version == desiredSource.Version {
+			continue
+		}
+		// the agent that is already unavailable does not affect the availability of the group
+		agentUnavailable := isAgentUnavailable(kfAgent)
+		if !agentUnavailable && unavailable >= maxUnavailable {
+			continue
+		}
+		bootstrapping, err := isMachineBootstrapping(ctx, r.Client, kfAgent)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if bootstrapping {
+			log.V(4).Info("skip upgrade of the agent, the machine is being bootstrapped", "agent", kfAgent.Name)
+			result.RequeueAfter = 30 * time.Second
+			continue
+		}
+		patchObj := client.MergeFrom(kfAgent.DeepCopy())
+		kfAgent.Spec.Source = desiredSource.DeepCopy()
+		if err := r.Client.Patch(ctx, kfAgent, patchObj); err != nil {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to patch KubeforceAgent %s", kfAgent.Name)
+		}
+		log.Info("the agent is scheduled for upgrade", "agent", kfAgent.Name, "version", desiredSource.Version)
+		if !agentUnavailable {
+			unavailable++
+		}
+	}
+	return result, nil
+}
+
+func (r *KubeforceAgentGroupReconciler) getMaxUnavailable(agentGroup *infrav1.KubeforceAgentGroup, replicas int) (int, error) {
+	maxUnavailable := intstr.FromInt(1)
+	if agentGroup.Spec.UpgradeStrategy != nil && agentGroup.Spec.UpgradeStrategy.MaxUnavailable != nil {
+		maxUnavailable = *agentGroup.Spec.UpgradeStrategy.MaxUnavailable
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, replicas, false)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid maxUnavailable value")
+	}
+	if value < 1 {
+		value = 1
+	}
+	return value, nil
+}
+
+// isAgentUnavailable returns true if the agent is not ready or is being upgraded.
+func isAgentUnavailable(kfAgent *infrav1.KubeforceAgent) bool {
+	if !kfAgent.Spec.Installed {
+		return false
+	}
+	if !agent.IsReady(kfAgent) {
+		return true
+	}
+	return kfAgent.Spec.Source != nil && !isAgentUpdated(kfAgent, kfAgent.Spec.Source)
+}
+
+// isAgentUpdated returns true if the agent runs the version from the source.
+func isAgentUpdated(kfAgent *infrav1.KubeforceAgent, source *infrav1.AgentSource) bool {
+	if source == nil || source.Version == "" {
+		return true
+	}
+	return kfAgent.Status.AgentInfo != nil && kfAgent.Status.AgentInfo.Version == source.Version
+}
+
 func patchKubeforceAgentGroup(ctx context.Context, patchHelper *patch.Helper, agentGroup *infrav1.KubeforceAgentGroup) error {
 	conditions.SetSummary(agentGroup,
 		conditions.WithConditions(
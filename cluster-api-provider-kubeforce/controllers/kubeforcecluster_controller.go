@@ -21,6 +21,7 @@ import (
 	"context"
 	_ "embed"
 	"fmt"
+	"net"
 	"sort"
 	"strings"
 	"text/template"
@@ -204,8 +205,9 @@ func (r *KubeforceClusterReconciler) getExternalAddresses(ctx context.Context, m
 				}
 				return nil, errors.Wrapf(err, "unable to get agent for machine %s", kfMachine.Name)
 			}
-			address := stringutil.Find(stringutil.IsNotEmpty, kfAgent.Spec.Addresses.ExternalDNS, kfAgent.Spec.Addresses.ExternalIP)
-			adresses = append(adresses, address)
+			address := stringutil.Find(stringutil.IsNotEmpty, kfAgent.Spec.Addresses.ExternalDNS, kfAgent.Spec.Addresses.ExternalIP,
+				kfAgent.Spec.Addresses.ExternalIPv6)
+			adresses = append(adresses, net.JoinHostPort(address, "6443"))
 		}
 	}
 	return adresses, nil
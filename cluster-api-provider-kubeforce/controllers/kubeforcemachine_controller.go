@@ -55,6 +55,7 @@ import (
 	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/agent"
 	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/ansible"
 	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/cloudinit"
+	stringutil "k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/util/strings"
 )
 
 // KubeforceMachineReconciler reconciles a KubeforceMachine object.
@@ -162,8 +163,10 @@ func patchKubeforceMachine(ctx context.Context, patchHelper *patch.Helper, kubef
 		conditions.WithConditions(
 			infrav1.AgentProvisionedCondition,
 			infrav1.InitPlaybooksCondition,
+			infrav1.PreBootstrapPlaybooksCondition,
 			infrav1.BootstrapExecSucceededCondition,
 			infrav1.ProviderIDSucceededCondition,
+			infrav1.PostBootstrapPlaybooksCondition,
 			bootstrapv1.DataSecretAvailableCondition,
 		),
 		conditions.WithStepCounterIf(kubeforceMachine.ObjectMeta.DeletionTimestamp.IsZero()),
@@ -178,8 +181,12 @@ func patchKubeforceMachine(ctx context.Context, patchHelper *patch.Helper, kubef
 			clusterv1.ReadyCondition,
 			infrav1.AgentProvisionedCondition,
 			infrav1.InitPlaybooksCondition,
+			infrav1.PreBootstrapPlaybooksCondition,
 			infrav1.BootstrapExecSucceededCondition,
 			infrav1.ProviderIDSucceededCondition,
+			infrav1.PostBootstrapPlaybooksCondition,
+			infrav1.UpgradePlaybooksCondition,
+			infrav1.PreDeletePlaybooksCondition,
 			bootstrapv1.DataSecretAvailableCondition,
 		}},
 	)
@@ -211,7 +218,10 @@ func (r *KubeforceMachineReconciler) reconcileNormal(ctx context.Context, cluste
 	}
 
 	if kfAgent.Status.SystemInfo != nil {
-		kfm.Status.DefaultIPAddress = kfAgent.Status.SystemInfo.Network.DefaultIPAddress
+		network := kfAgent.Status.SystemInfo.Network
+		// the IPv6 address is used on the hosts without the IPv4 default route
+		kfm.Status.DefaultIPAddress = stringutil.Find(stringutil.IsNotEmpty, network.DefaultIPAddress, network.DefaultIPv6Address)
+		kfm.Status.DefaultIPv6Address = network.DefaultIPv6Address
 	}
 
 	vars := make(map[string]interface{})
@@ -246,6 +256,17 @@ func (r *KubeforceMachineReconciler) reconcileNormal(ctx context.Context, cluste
 	}
 	conditions.MarkTrue(kfm, bootstrapv1.DataSecretAvailableCondition)
 
+	// the preBootstrap playbooks are not executed on the machine that has already been bootstrapped
+	if !conditions.IsTrue(kfm, infrav1.BootstrapExecSucceededCondition) {
+		ready, err = r.TemplateReconciler.Reconcile(ctx, kfm, infrav1.TemplateTypePreBootstrap, vars)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !ready {
+			return ctrl.Result{}, nil
+		}
+	}
+
 	ready, err = r.reconcileCloudInitPlaybook(ctx, config, kfm, kfAgent, vars)
 	if err != nil {
 		conditions.MarkFalse(kfm, infrav1.BootstrapExecSucceededCondition, infrav1.BootstrappingReason, clusterv1.ConditionSeverityError, err.Error())
@@ -262,9 +283,79 @@ func (r *KubeforceMachineReconciler) reconcileNormal(ctx context.Context, cluste
 		return ctrl.Result{}, err
 	}
 	conditions.MarkTrue(kfm, infrav1.ProviderIDSucceededCondition)
+
+	ready, err = r.TemplateReconciler.Reconcile(ctx, kfm, infrav1.TemplateTypePostBootstrap, vars)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !ready {
+		return ctrl.Result{}, nil
+	}
 	kfm.Status.Ready = true
 
-	return ctrl.Result{}, nil
+	return ctrl.Result{}, r.reconcileUpgrade(ctx, kfm, config.GetKubernetesVersion(), vars)
+}
+
+// reconcileUpgrade executes the upgrade playbooks when the Kubernetes version of the Machine changes.
+// The version of the machine is updated after the completed upgrade playbooks are removed,
+// so the playbooks are executed again on the next upgrade.
+func (r *KubeforceMachineReconciler) reconcileUpgrade(ctx context.Context, kfm *infrav1.KubeforceMachine, version string, vars map[string]interface{}) error {
+	if kfm.Status.KubernetesVersion == "" {
+		// the machine has been bootstrapped with this version
+		kfm.Status.KubernetesVersion = version
+		return nil
+	}
+	if kfm.Status.KubernetesVersion == version {
+		kfm.Status.UpgradeVersion = ""
+		return nil
+	}
+	if kfm.Status.UpgradeVersion != version {
+		upgradeVars := make(map[string]interface{}, len(vars)+1)
+		for k, v := range vars {
+			upgradeVars[k] = v
+		}
+		upgradeVars["previousKubernetesVersion"] = kfm.Status.KubernetesVersion
+		ready, err := r.TemplateReconciler.Reconcile(ctx, kfm, infrav1.TemplateTypeUpgrade, upgradeVars)
+		if err != nil || !ready {
+			return err
+		}
+		// the playbooks must not be created again while they are being removed
+		kfm.Status.UpgradeVersion = version
+	}
+	upgradeRoles := r.rolesByTypes(kfm, infrav1.TemplateTypeUpgrade)
+	playbooksDeleted, err := r.reconcileDeletePlaybooks(ctx, kfm, func(pb infrav1.Playbook) bool {
+		return slices.Contains(upgradeRoles, pb.Labels[infrav1.PlaybookRoleLabelName])
+	})
+	if err != nil {
+		return err
+	}
+	deploymentsDeleted, err := r.reconcileDeletePlaybookDeployments(ctx, kfm, func(pd infrav1.PlaybookDeployment) bool {
+		return slices.Contains(upgradeRoles, pd.Labels[infrav1.PlaybookRoleLabelName])
+	})
+	if err != nil || !playbooksDeleted || !deploymentsDeleted {
+		// the machine is reconciled again when the playbooks are deleted
+		return err
+	}
+	kfm.Status.KubernetesVersion = version
+	kfm.Status.UpgradeVersion = ""
+	return nil
+}
+
+// rolesByTypes returns the roles of the template references with the template types.
+func (r *KubeforceMachineReconciler) rolesByTypes(kfm *infrav1.KubeforceMachine, templateTypes ...infrav1.TemplateType) []string {
+	roles := make([]string, 0)
+	if kfm.Spec.PlaybookTemplates == nil {
+		return roles
+	}
+	for role, ref := range kfm.Spec.PlaybookTemplates.References {
+		for _, t := range templateTypes {
+			if ref.Type == t {
+				roles = append(roles, role)
+				break
+			}
+		}
+	}
+	return roles
 }
 
 // providerID return the provider identifier for this machine.
@@ -373,16 +464,24 @@ func (r *KubeforceMachineReconciler) reconcileDelete(ctx context.Context, kfm *i
 		conditions.MarkFalse(kfm, infrav1.AgentProvisionedCondition, infrav1.AgentProvisioningFailedReason, clusterv1.ConditionSeverityError, err.Error())
 		return ctrl.Result{}, err
 	}
-	installRoles := make([]string, 0)
-	installRoles = append(installRoles, "boot")
-	if kfm.Spec.PlaybookTemplates != nil {
-		for role, ref := range kfm.Spec.PlaybookTemplates.References {
-			if ref.Type == infrav1.TemplateTypeInstall {
-				installRoles = append(installRoles, role)
-			}
+	// execute the playbooks before the deletion while the node is still intact
+	if !conditions.IsTrue(kfm, infrav1.PreDeletePlaybooksCondition) {
+		ready, err := r.reconcileDeletionTemplates(ctx, kfm, kfAgent, infrav1.TemplateTypePreDelete, infrav1.PreDeletePlaybooksCondition)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !ready {
+			return ctrl.Result{}, nil
 		}
 	}
-	// delete playbooks with type "install"
+	installRoles := r.rolesByTypes(kfm,
+		infrav1.TemplateTypeInstall,
+		infrav1.TemplateTypePreBootstrap,
+		infrav1.TemplateTypePostBootstrap,
+		infrav1.TemplateTypeUpgrade,
+	)
+	installRoles = append(installRoles, "boot")
+	// delete playbooks that have been created during the machine lifecycle
 	ready, err := r.reconcileDeletePlaybooks(ctx, kfm, func(pb infrav1.Playbook) bool {
 		return slices.Contains(installRoles, pb.Labels[infrav1.PlaybookRoleLabelName])
 	})
@@ -393,7 +492,7 @@ func (r *KubeforceMachineReconciler) reconcileDelete(ctx context.Context, kfm *i
 		return ctrl.Result{}, nil
 	}
 
-	// delete playbookDeployments with type "install"
+	// delete playbookDeployments that have been created during the machine lifecycle
 	ready, err = r.reconcileDeletePlaybookDeployments(ctx, kfm, func(pd infrav1.PlaybookDeployment) bool {
 		return slices.Contains(installRoles, pd.Labels[infrav1.PlaybookRoleLabelName])
 	})
@@ -405,7 +504,7 @@ func (r *KubeforceMachineReconciler) reconcileDelete(ctx context.Context, kfm *i
 	}
 	// execute cleanup playbooks
 	if !conditions.IsTrue(kfm, infrav1.CleanupPlaybooksCondition) {
-		ready, err = r.reconcileCleaner(ctx, kfm, kfAgent)
+		ready, err = r.reconcileDeletionTemplates(ctx, kfm, kfAgent, infrav1.TemplateTypeDelete, infrav1.CleanupPlaybooksCondition)
 		if err != nil {
 			return ctrl.Result{}, err
 		}
@@ -550,6 +649,24 @@ func (r *KubeforceMachineReconciler) KubeforceClusterToKubeforceMachines(o clien
 	return result
 }
 
+// VariablesSourceToKubeforceMachines returns the KubeforceMachines whose variables are loaded from the Secret or the ConfigMap,
+// so the playbooks are rendered again with the changed values.
+func (r *KubeforceMachineReconciler) VariablesSourceToKubeforceMachines(o client.Object) []ctrl.Request {
+	machineList := &infrav1.KubeforceMachineList{}
+	if err := r.Client.List(context.TODO(), machineList, client.InNamespace(o.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list KubeforceMachines", "namespace", o.GetNamespace())
+		return nil
+	}
+	result := []ctrl.Request{}
+	for i := range machineList.Items {
+		m := &machineList.Items[i]
+		if playbook.ReferencesVariablesSource(m.GetTemplates(), o) {
+			result = append(result, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(m)})
+		}
+	}
+	return result
+}
+
 type agentFilter func(*infrav1.KubeforceAgent) bool
 
 func findAgent(agents []*infrav1.KubeforceAgent, filterFn agentFilter) *infrav1.KubeforceAgent {
@@ -594,6 +711,14 @@ func (r *KubeforceMachineReconciler) SetupWithManager(logger logr.Logger, mgr ct
 				IsController: true,
 			},
 		).
+		Watches(
+			&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.VariablesSourceToKubeforceMachines),
+		).
+		Watches(
+			&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.VariablesSourceToKubeforceMachines),
+		).
 		Build(r)
 	if err != nil {
 		return err
@@ -605,26 +730,29 @@ func (r *KubeforceMachineReconciler) SetupWithManager(logger logr.Logger, mgr ct
 	)
 }
 
-func (r *KubeforceMachineReconciler) reconcileCleaner(ctx context.Context, kfMachine *infrav1.KubeforceMachine, kfAgent *infrav1.KubeforceAgent) (bool, error) {
+// reconcileDeletionTemplates executes the playbooks of the template type during the deletion of the machine.
+// The playbooks are skipped if the agent is removed.
+func (r *KubeforceMachineReconciler) reconcileDeletionTemplates(ctx context.Context, kfMachine *infrav1.KubeforceMachine, kfAgent *infrav1.KubeforceAgent,
+	templateType infrav1.TemplateType, condType clusterv1.ConditionType) (bool, error) {
 	// wait 60 seconds for the agent to be ready
 	if !agent.IsHealthy(kfAgent) && time.Since(kfMachine.DeletionTimestamp.Time) < time.Second*60 {
-		conditions.MarkFalse(kfMachine, infrav1.CleanupPlaybooksCondition, infrav1.AgentProvisioningFailedReason, clusterv1.ConditionSeverityError, "Wait for agent to be ready")
+		conditions.MarkFalse(kfMachine, condType, infrav1.AgentProvisioningFailedReason, clusterv1.ConditionSeverityError, "Wait for agent to be ready")
 		return false, nil
 	}
 
 	// wait for force deletion
 	if !agent.IsHealthy(kfAgent) && kfAgent.DeletionTimestamp.IsZero() {
 		msg := fmt.Sprintf("Waiting for the agent to be ready. If you want to force deletion then remove the %q KubeforceAgent", client.ObjectKeyFromObject(kfAgent))
-		conditions.MarkFalse(kfMachine, infrav1.CleanupPlaybooksCondition, infrav1.AgentProvisioningFailedReason, clusterv1.ConditionSeverityError, msg)
+		conditions.MarkFalse(kfMachine, condType, infrav1.AgentProvisioningFailedReason, clusterv1.ConditionSeverityError, msg)
 		return false, nil
 	}
 
 	if !agent.IsHealthy(kfAgent) {
-		conditions.MarkTrue(kfMachine, infrav1.CleanupPlaybooksCondition)
+		conditions.MarkTrue(kfMachine, condType)
 		return true, nil
 	}
 
-	ready, err := r.TemplateReconciler.Reconcile(ctx, kfMachine, infrav1.TemplateTypeDelete, nil)
+	ready, err := r.TemplateReconciler.Reconcile(ctx, kfMachine, templateType, nil)
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,353 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	bootstrapv1 "sigs.k8s.io/cluster-api/bootstrap/kubeadm/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/controllers/playbook"
+)
+
+// machineTestEnv contains the objects of a KubeforceMachine that is reconciled with the fake client.
+type machineTestEnv struct {
+	client  client.Client
+	r       *KubeforceMachineReconciler
+	cluster *clusterv1.Cluster
+	machine *clusterv1.Machine
+	kfm     *infrav1.KubeforceMachine
+	kfc     *infrav1.KubeforceCluster
+	agent   *infrav1.KubeforceAgent
+}
+
+// newMachineTestEnv creates the KubeforceMachine with the templates of the roles
+// and the ready agent, the Machine has no bootstrap data.
+func newMachineTestEnv(g *WithT, roles map[string]infrav1.TemplateType) *machineTestEnv {
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(bootstrapv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+	}
+	conditions.MarkTrue(cluster, clusterv1.ControlPlaneInitializedCondition)
+	machine := &clusterv1.Machine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+		Spec: clusterv1.MachineSpec{
+			ClusterName: cluster.Name,
+			Version:     pointer.String("v1.26.0"),
+			Bootstrap: clusterv1.Bootstrap{
+				ConfigRef: &corev1.ObjectReference{Kind: "KubeadmConfig", Namespace: "default", Name: "machine"},
+			},
+		},
+	}
+	tmpl := &infrav1.PlaybookTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tmpl"},
+		Spec: infrav1.PlaybookTemplateSpec{
+			Spec: infrav1.RemotePlaybookSpec{
+				Files:      map[string]string{"site.yaml": "- hosts: all\n"},
+				Entrypoint: "site.yaml",
+			},
+		},
+	}
+	refs := make(map[string]*infrav1.TemplateReference, len(roles))
+	for role, templateType := range roles {
+		refs[role] = &infrav1.TemplateReference{
+			Kind:      "PlaybookTemplate",
+			Namespace: tmpl.Namespace,
+			Name:      tmpl.Name,
+			Type:      templateType,
+		}
+	}
+	kfm := &infrav1.KubeforceMachine{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: infrav1.GroupVersion.String(),
+			Kind:       "KubeforceMachine",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:  "default",
+			Name:       "machine",
+			Labels:     map[string]string{clusterv1.ClusterNameLabel: cluster.Name},
+			Finalizers: []string{infrav1.MachineFinalizer},
+			OwnerReferences: []metav1.OwnerReference{
+				{APIVersion: clusterv1.GroupVersion.String(), Kind: "Machine", Name: machine.Name},
+			},
+		},
+		Spec: infrav1.KubeforceMachineSpec{
+			// the provider ID is known, so the node of the workload cluster is not patched
+			ProviderID:        pointer.String("kf://agent"),
+			AgentSelector:     &metav1.LabelSelector{},
+			PlaybookTemplates: &infrav1.PlaybookTemplates{References: refs},
+		},
+		Status: infrav1.KubeforceMachineStatus{
+			AgentRef: &corev1.LocalObjectReference{Name: "agent"},
+		},
+	}
+	kfc := &infrav1.KubeforceCluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+		Spec: infrav1.KubeforceClusterSpec{
+			Loadbalancer: &infrav1.LoadbalancerConfig{Disabled: true},
+		},
+	}
+	kfAgent := &infrav1.KubeforceAgent{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "agent",
+			Labels:    map[string]string{infrav1.AgentMachineLabel: kfm.Name},
+		},
+		Spec: infrav1.KubeforceAgentSpec{Installed: true},
+	}
+	conditions.MarkTrue(kfAgent, infrav1.HealthyCondition)
+	conditions.MarkTrue(kfAgent, clusterv1.ReadyCondition)
+	kubeadmConfig := &bootstrapv1.KubeadmConfig{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+	}
+	bootstrapData := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine-bootstrap"},
+		Data: map[string][]byte{
+			"value": []byte("#cloud-config\nruncmd:\n- kubeadm join\n"),
+		},
+	}
+
+	c := fake.NewClientBuilder().WithScheme(scheme).
+		WithObjects(cluster, machine, tmpl, kfm, kfc, kfAgent, kubeadmConfig, bootstrapData).
+		Build()
+	return &machineTestEnv{
+		client: c,
+		r: &KubeforceMachineReconciler{
+			TemplateReconciler: playbook.TemplateReconciler{Client: c, Log: logr.Discard()},
+			Client:             c,
+			Log:                logr.Discard(),
+		},
+		cluster: cluster,
+		machine: machine,
+		kfm:     kfm,
+		kfc:     kfc,
+		agent:   kfAgent,
+	}
+}
+
+// playbookRoles returns the roles of the playbooks of the machine that are not being deleted.
+func (e *machineTestEnv) playbookRoles(g *WithT) []string {
+	list := &infrav1.PlaybookList{}
+	g.Expect(e.client.List(context.Background(), list, client.InNamespace("default"))).To(Succeed())
+	roles := make([]string, 0, len(list.Items))
+	for _, pb := range list.Items {
+		if pb.DeletionTimestamp.IsZero() {
+			roles = append(roles, pb.Labels[infrav1.PlaybookRoleLabelName])
+		}
+	}
+	return roles
+}
+
+// completePlaybook marks the playbook of the role as succeeded on the agent.
+func (e *machineTestEnv) completePlaybook(g *WithT, role string) {
+	list := &infrav1.PlaybookList{}
+	selector := labels.SelectorFromSet(playbook.CreateLabels(e.kfm, role))
+	g.Expect(e.client.List(context.Background(), list, client.MatchingLabelsSelector{Selector: selector})).To(Succeed())
+	g.Expect(list.Items).To(HaveLen(1))
+	pb := &list.Items[0]
+	pb.Status.ExternalPhase = "Succeeded"
+	conditions.MarkTrue(pb, infrav1.SynchronizationCondition)
+	g.Expect(e.client.Update(context.Background(), pb)).To(Succeed())
+}
+
+func TestKubeforceMachineBootstrapPlaybooks(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	env := newMachineTestEnv(g, map[string]infrav1.TemplateType{
+		"pre":  infrav1.TemplateTypePreBootstrap,
+		"post": infrav1.TemplateTypePostBootstrap,
+	})
+	reconcile := func() {
+		_, err := env.r.reconcileNormal(ctx, env.cluster, env.kfm, env.kfc)
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+
+	// the preBootstrap playbooks wait for the bootstrap data
+	reconcile()
+	g.Expect(env.playbookRoles(g)).To(BeEmpty())
+	g.Expect(conditions.IsFalse(env.kfm, bootstrapv1.DataSecretAvailableCondition)).To(BeTrue())
+
+	env.machine.Spec.Bootstrap.DataSecretName = pointer.String("machine-bootstrap")
+	g.Expect(env.client.Update(ctx, env.machine)).To(Succeed())
+	reconcile()
+	g.Expect(env.playbookRoles(g)).To(ConsistOf("pre"))
+
+	// the machine is bootstrapped after the preBootstrap playbooks are completed
+	reconcile()
+	g.Expect(env.playbookRoles(g)).To(ConsistOf("pre"))
+	env.completePlaybook(g, "pre")
+	reconcile()
+	g.Expect(env.playbookRoles(g)).To(ConsistOf("pre", "boot"))
+
+	// the postBootstrap playbooks are executed after the bootstrap
+	reconcile()
+	g.Expect(env.playbookRoles(g)).To(ConsistOf("pre", "boot"))
+	env.completePlaybook(g, "boot")
+	reconcile()
+	g.Expect(env.playbookRoles(g)).To(ConsistOf("pre", "boot", "post"))
+	g.Expect(env.kfm.Status.Ready).To(BeFalse())
+
+	env.completePlaybook(g, "post")
+	reconcile()
+	g.Expect(env.kfm.Status.Ready).To(BeTrue())
+	g.Expect(env.kfm.Status.KubernetesVersion).To(Equal("v1.26.0"))
+
+	// the preBootstrap template added to the bootstrapped machine is not executed
+	late := *env.kfm.Spec.PlaybookTemplates.References["pre"]
+	env.kfm.Spec.PlaybookTemplates.References["late"] = &late
+	reconcile()
+	g.Expect(env.playbookRoles(g)).To(ConsistOf("pre", "boot", "post"))
+	g.Expect(env.kfm.Status.Ready).To(BeTrue())
+}
+
+func TestKubeforceMachineReconcileUpgrade(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	env := newMachineTestEnv(g, map[string]infrav1.TemplateType{
+		"upgrade": infrav1.TemplateTypeUpgrade,
+	})
+	upgrade := func(version string) {
+		g.Expect(env.r.reconcileUpgrade(ctx, env.kfm, version, nil)).To(Succeed())
+	}
+
+	// the machine is bootstrapped with the version
+	upgrade("v1.26.0")
+	g.Expect(env.kfm.Status.KubernetesVersion).To(Equal("v1.26.0"))
+	g.Expect(env.playbookRoles(g)).To(BeEmpty())
+
+	upgrade("v1.27.0")
+	g.Expect(env.playbookRoles(g)).To(ConsistOf("upgrade"))
+	g.Expect(env.kfm.Status.KubernetesVersion).To(Equal("v1.26.0"))
+
+	// the completed playbook is kept by the finalizer of the playbook controller
+	list := &infrav1.PlaybookList{}
+	g.Expect(env.client.List(ctx, list)).To(Succeed())
+	pb := &list.Items[0]
+	pb.Finalizers = []string{infrav1.PlaybookFinalizer}
+	g.Expect(env.client.Update(ctx, pb)).To(Succeed())
+	env.completePlaybook(g, "upgrade")
+	upgrade("v1.27.0")
+	g.Expect(env.kfm.Status.UpgradeVersion).To(Equal("v1.27.0"))
+	g.Expect(env.kfm.Status.KubernetesVersion).To(Equal("v1.26.0"))
+
+	// the playbook is not created again while the completed one is being deleted
+	upgrade("v1.27.0")
+	g.Expect(env.kfm.Status.KubernetesVersion).To(Equal("v1.26.0"))
+	g.Expect(env.client.List(ctx, list)).To(Succeed())
+	g.Expect(list.Items).To(HaveLen(1))
+	g.Expect(list.Items[0].DeletionTimestamp.IsZero()).To(BeFalse())
+
+	// the version is updated after the playbook is deleted
+	pb = &list.Items[0]
+	pb.Finalizers = nil
+	g.Expect(env.client.Update(ctx, pb)).To(Succeed())
+	upgrade("v1.27.0")
+	g.Expect(env.kfm.Status.KubernetesVersion).To(Equal("v1.27.0"))
+	g.Expect(env.kfm.Status.UpgradeVersion).To(BeEmpty())
+	g.Expect(env.playbookRoles(g)).To(BeEmpty())
+
+	// the next upgrade executes the playbook again
+	upgrade("v1.28.0")
+	g.Expect(env.playbookRoles(g)).To(ConsistOf("upgrade"))
+}
+
+func TestReconcileDeletionTemplates(t *testing.T) {
+	tests := []struct {
+		name          string
+		deletedBefore time.Duration
+		healthy       bool
+		agentDeleted  bool
+		want          bool
+		wantPlaybook  bool
+		wantCondition corev1.ConditionStatus
+	}{
+		{
+			name:          "the machine waits for the agent to be ready",
+			deletedBefore: time.Second,
+			wantCondition: corev1.ConditionFalse,
+		},
+		{
+			name:          "the machine waits for the force deletion of the agent",
+			deletedBefore: 2 * time.Minute,
+			wantCondition: corev1.ConditionFalse,
+		},
+		{
+			name:          "the playbooks are skipped if the agent is deleted",
+			deletedBefore: 2 * time.Minute,
+			agentDeleted:  true,
+			want:          true,
+			wantCondition: corev1.ConditionTrue,
+		},
+		{
+			name:          "the playbooks are executed by the healthy agent",
+			deletedBefore: time.Second,
+			healthy:       true,
+			wantPlaybook:  true,
+			wantCondition: corev1.ConditionFalse,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			env := newMachineTestEnv(g, map[string]infrav1.TemplateType{
+				"predelete": infrav1.TemplateTypePreDelete,
+			})
+			env.kfm.DeletionTimestamp = &metav1.Time{Time: time.Now().Add(-tt.deletedBefore)}
+			if !tt.healthy {
+				conditions.MarkFalse(env.agent, infrav1.HealthyCondition, "", clusterv1.ConditionSeverityWarning, "")
+			}
+			if tt.agentDeleted {
+				env.agent.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			}
+			ready, err := env.r.reconcileDeletionTemplates(context.Background(), env.kfm, env.agent,
+				infrav1.TemplateTypePreDelete, infrav1.PreDeletePlaybooksCondition)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ready).To(Equal(tt.want))
+			g.Expect(conditions.Get(env.kfm, infrav1.PreDeletePlaybooksCondition).Status).To(Equal(tt.wantCondition))
+			if tt.wantPlaybook {
+				g.Expect(env.playbookRoles(g)).To(ConsistOf("predelete"))
+				env.completePlaybook(g, "predelete")
+				ready, err = env.r.reconcileDeletionTemplates(context.Background(), env.kfm, env.agent,
+					infrav1.TemplateTypePreDelete, infrav1.PreDeletePlaybooksCondition)
+				g.Expect(err).NotTo(HaveOccurred())
+				g.Expect(ready).To(BeTrue())
+			} else {
+				g.Expect(env.playbookRoles(g)).To(BeEmpty())
+			}
+		})
+	}
+}
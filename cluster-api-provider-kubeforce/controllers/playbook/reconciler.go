@@ -19,7 +19,7 @@ package playbook
 import (
 	"context"
 	"fmt"
-	"sort"
+	"strings"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
@@ -37,13 +37,17 @@ import (
 	"sigs.k8s.io/yaml"
 
 	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/repository"
 	patchutil "k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/util/patch"
+	utiltmpl "k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/util/templates"
 )
 
 // TemplateReconciler manages playbooks for PlaybookControlObject.
 type TemplateReconciler struct {
 	Client client.Client
 	Log    logr.Logger
+	// Storage caches the files of the playbook sources.
+	Storage *repository.Storage
 }
 
 // Reconcile reconciles playbooks controlled by the PlaybookControlObject.
@@ -69,25 +73,86 @@ func (r *TemplateReconciler) Reconcile(ctx context.Context, obj infrav1.Playbook
 		condType = infrav1.InitPlaybooksCondition
 	case infrav1.TemplateTypeDelete:
 		condType = infrav1.CleanupPlaybooksCondition
+	case infrav1.TemplateTypePreBootstrap:
+		condType = infrav1.PreBootstrapPlaybooksCondition
+	case infrav1.TemplateTypePostBootstrap:
+		condType = infrav1.PostBootstrapPlaybooksCondition
+	case infrav1.TemplateTypePreDelete:
+		condType = infrav1.PreDeletePlaybooksCondition
+	case infrav1.TemplateTypeUpgrade:
+		condType = infrav1.UpgradePlaybooksCondition
 	default:
 		return false, errors.Errorf("unsupported templateType %q", templateType)
 	}
-	references := r.getReferences(obj.GetTemplates().References, templateType)
-	vars = r.mergeVars(vars, obj.GetTemplates().Variables)
+	references, err := r.getReferences(obj.GetTemplates().References, templateType)
+	if err != nil {
+		conditions.MarkFalse(obj, condType, infrav1.PlaybooksDeployingFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return false, err
+	}
+	vars = removeVariables(r.mergeVars(vars, obj.GetTemplates().Variables), obj.GetTemplates().VariablesFrom)
+	secretVars, err := r.resolveVariables(ctx, obj.GetNamespace(), obj.GetTemplates().VariablesFrom)
+	if err != nil {
+		conditions.MarkFalse(obj, condType, infrav1.PlaybooksDeployingFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return false, err
+	}
+	// the roles that do not depend on each other are reconciled in parallel
+	completed := make(map[string]bool, len(references))
+	waiting := make([]string, 0)
 	for _, ref := range references {
-		ready, err := r.reconcileReference(ctx, obj, ref, vars)
+		blockedBy := make([]string, 0)
+		for _, dep := range ref.dependsOn {
+			if !completed[dep] {
+				blockedBy = append(blockedBy, dep)
+			}
+		}
+		if len(blockedBy) > 0 {
+			r.setRoleState(obj, ref.role, infrav1.PlaybookRoleBlocked, blockedBy)
+			waiting = append(waiting, ref.role)
+			continue
+		}
+		ready, err := r.reconcileReference(ctx, obj, ref, vars, secretVars)
 		if err != nil {
-			conditions.MarkFalse(obj, condType, infrav1.PlaybooksDeployingFailedReason, clusterv1.ConditionSeverityError, err.Error())
+			reason := infrav1.PlaybooksDeployingFailedReason
+			switch {
+			case errors.As(err, &renderError{}):
+				reason = infrav1.TemplateRenderingFailedReason
+			case errors.As(err, &sourceError{}):
+				reason = infrav1.PlaybookSourceFailedReason
+			}
+			conditions.MarkFalse(obj, condType, reason, clusterv1.ConditionSeverityError, err.Error())
 			return false, err
 		}
 		if !ready {
-			msg := fmt.Sprintf("waiting for playbook with role: %s", ref.role)
-			conditions.MarkFalse(obj, condType, infrav1.WaitingForCompletionPhaseReason, clusterv1.ConditionSeverityInfo, msg)
-			return false, nil
+			r.setRoleState(obj, ref.role, infrav1.PlaybookRoleWaiting, nil)
+			waiting = append(waiting, ref.role)
+			continue
 		}
+		r.setRoleState(obj, ref.role, infrav1.PlaybookRoleCompleted, nil)
+		completed[ref.role] = true
+	}
+	if len(waiting) > 0 {
+		msg := fmt.Sprintf("waiting for playbooks with roles: %s", strings.Join(waiting, ", "))
+		conditions.MarkFalse(obj, condType, infrav1.WaitingForCompletionPhaseReason, clusterv1.ConditionSeverityInfo, msg)
+		return false, nil
 	}
 	conditions.MarkTrue(obj, condType)
-	return true, err
+	return true, nil
+}
+
+// setRoleState sets the state of the role in the playbook conditions of the object.
+func (r *TemplateReconciler) setRoleState(obj infrav1.PlaybookControlObject, role string, state infrav1.PlaybookRoleState, blockedBy []string) {
+	playbookConditions := obj.GetPlaybookConditions()
+	if playbookConditions == nil {
+		playbookConditions = make(infrav1.PlaybookConditions)
+	}
+	cond := playbookConditions[role]
+	if cond == nil {
+		cond = &infrav1.PlaybookCondition{}
+		playbookConditions[role] = cond
+	}
+	cond.State = state
+	cond.BlockedBy = blockedBy
+	obj.SetPlaybookConditions(playbookConditions)
 }
 
 func (r *TemplateReconciler) mergeVars(vars1 map[string]interface{}, vars2 map[string]runtime.RawExtension) map[string]interface{} {
@@ -104,32 +169,33 @@ func (r *TemplateReconciler) mergeVars(vars1 map[string]interface{}, vars2 map[s
 	return result
 }
 
-func (r *TemplateReconciler) reconcileReference(ctx context.Context, obj infrav1.PlaybookControlObject, ref reference, vars map[string]interface{}) (bool, error) {
+func (r *TemplateReconciler) reconcileReference(ctx context.Context, obj infrav1.PlaybookControlObject, ref reference, vars map[string]interface{}, secretVars secretVariables) (bool, error) {
 	switch ref.ref.Kind {
 	case "PlaybookTemplate":
-		return r.reconcilePlaybook(ctx, obj, ref, vars)
+		return r.reconcilePlaybook(ctx, obj, ref, vars, secretVars)
 	case "PlaybookDeploymentTemplate":
-		return r.reconcilePlaybookDeployment(ctx, obj, ref, vars)
+		return r.reconcilePlaybookDeployment(ctx, obj, ref, vars, secretVars)
 	default:
 		return false, errors.Errorf("unsupported kind %q", ref.ref.Kind)
 	}
 }
 
-func (r *TemplateReconciler) getReferences(templates map[string]*infrav1.TemplateReference, templateType infrav1.TemplateType) []reference {
-	refs := make([]reference, 0)
-	for role, ref := range templates {
-		if ref.Type != templateType {
-			continue
-		}
+// getReferences returns the references of the template type in the order of their dependencies.
+func (r *TemplateReconciler) getReferences(templates map[string]*infrav1.TemplateReference, templateType infrav1.TemplateType) ([]reference, error) {
+	deps := utiltmpl.Dependencies(templates, templateType)
+	roles, err := utiltmpl.SortRoles(templates, deps)
+	if err != nil {
+		return nil, err
+	}
+	refs := make([]reference, 0, len(roles))
+	for _, role := range roles {
 		refs = append(refs, reference{
-			role: role,
-			ref:  *ref,
+			role:      role,
+			ref:       *templates[role],
+			dependsOn: deps[role],
 		})
 	}
-	sort.SliceStable(refs, func(i, j int) bool {
-		return refs[i].ref.Priority > refs[j].ref.Priority
-	})
-	return refs
+	return refs, nil
 }
 
 func (r *TemplateReconciler) getPlaybookTemplate(ctx context.Context, ref infrav1.TemplateReference) (*infrav1.PlaybookTemplate, error) {
@@ -158,7 +224,7 @@ func (r *TemplateReconciler) getPlaybookDeploymentTemplate(ctx context.Context,
 	return template, nil
 }
 
-func (r *TemplateReconciler) reconcilePlaybookDeployment(ctx context.Context, obj infrav1.PlaybookControlObject, ref reference, vars map[string]interface{}) (bool, error) {
+func (r *TemplateReconciler) reconcilePlaybookDeployment(ctx context.Context, obj infrav1.PlaybookControlObject, ref reference, vars map[string]interface{}, secretVars secretVariables) (bool, error) {
 	role := ref.role
 	pd, err := r.findPlaybookDeploymentByRole(ctx, obj, role)
 	if err != nil {
@@ -178,7 +244,7 @@ func (r *TemplateReconciler) reconcilePlaybookDeployment(ctx context.Context, ob
 			Phase: pd.Status.ExternalPhase,
 		}
 		obj.SetPlaybookConditions(playbookConditions)
-		updated, err := r.updatePlaybookDeployment(ctx, obj, pd, template, role, vars)
+		updated, err := r.updatePlaybookDeployment(ctx, obj, pd, template, role, vars, secretVars)
 		if err != nil {
 			return false, err
 		}
@@ -190,7 +256,7 @@ func (r *TemplateReconciler) reconcilePlaybookDeployment(ctx context.Context, ob
 		}
 		return false, nil
 	}
-	pd, err = r.createPlaybookDeployment(ctx, obj, template, role, vars)
+	pd, err = r.createPlaybookDeployment(ctx, obj, template, role, vars, secretVars)
 	if err != nil {
 		return false, err
 	}
@@ -202,7 +268,7 @@ func (r *TemplateReconciler) reconcilePlaybookDeployment(ctx context.Context, ob
 	return false, nil
 }
 
-func (r *TemplateReconciler) reconcilePlaybook(ctx context.Context, obj infrav1.PlaybookControlObject, ref reference, vars map[string]interface{}) (bool, error) {
+func (r *TemplateReconciler) reconcilePlaybook(ctx context.Context, obj infrav1.PlaybookControlObject, ref reference, vars map[string]interface{}, secretVars secretVariables) (bool, error) {
 	role := ref.role
 	playbook, err := r.findPlaybookByRole(ctx, obj, role)
 	if err != nil {
@@ -227,7 +293,7 @@ func (r *TemplateReconciler) reconcilePlaybook(ctx context.Context, obj infrav1.
 		}
 		return false, nil
 	}
-	playbook, err = r.createPlaybook(ctx, obj, template, role, vars)
+	playbook, err = r.createPlaybook(ctx, obj, template, role, vars, secretVars)
 	if err != nil {
 		return false, err
 	}
@@ -293,7 +359,7 @@ func (r *TemplateReconciler) findPlaybookDeploymentByRole(ctx context.Context, o
 	return &list.Items[0], nil
 }
 
-func (r *TemplateReconciler) updatePlaybookDeployment(ctx context.Context, obj infrav1.PlaybookControlObject, pd *infrav1.PlaybookDeployment, tmpl *infrav1.PlaybookDeploymentTemplate, role string, vars map[string]interface{}) (bool, error) {
+func (r *TemplateReconciler) updatePlaybookDeployment(ctx context.Context, obj infrav1.PlaybookControlObject, pd *infrav1.PlaybookDeployment, tmpl *infrav1.PlaybookDeploymentTemplate, role string, vars map[string]interface{}, secretVars secretVariables) (bool, error) {
 	patchObj := client.MergeFrom(pd.DeepCopy())
 	for key, value := range CreateLabels(obj, role) {
 		pd.Labels[key] = value
@@ -301,9 +367,25 @@ func (r *TemplateReconciler) updatePlaybookDeployment(ctx context.Context, obj i
 	pd.Spec.AgentRef = corev1.LocalObjectReference{
 		Name: obj.GetAgent().Name,
 	}
+	pd.Spec.Approval = tmpl.Spec.Approval
+	files, err := r.templateFiles(ctx, obj, tmpl.Namespace, tmpl.Spec.Template, vars)
+	if err != nil {
+		return false, errors.Wrapf(err, "unable to render the files of PlaybookDeployment %s", pd.Name)
+	}
+	// the Secret must be updated before the PlaybookDeployment refers to the new checksum
+	secretContent, err := r.variablesContent(ctx, pd.Namespace, pd.Name, secretVars)
+	if err != nil {
+		return false, err
+	}
+	if err := r.reconcileVariablesSecret(ctx, pd, "PlaybookDeployment", secretContent); err != nil {
+		return false, err
+	}
 	pd.Spec.Template.Spec = infrav1.RemotePlaybookSpec{
-		Files:      tmpl.Spec.Template.Spec.Files,
-		Entrypoint: tmpl.Spec.Template.Spec.Entrypoint,
+		Files:                  files,
+		Entrypoint:             tmpl.Spec.Template.Spec.Entrypoint,
+		AnsibleVersion:         tmpl.Spec.Template.Spec.AnsibleVersion,
+		FileSources:            withSecretVariables(tmpl.Spec.Template.Spec.FileSources, tmpl.Spec.Template.Spec.Entrypoint, variablesSecretName(pd.Name), secretContent),
+		PurgeFilesAfterSuccess: tmpl.Spec.Template.Spec.PurgeFilesAfterSuccess,
 	}
 	if vars != nil {
 		varsData, err := yaml.Marshal(vars)
@@ -329,7 +411,11 @@ func (r *TemplateReconciler) updatePlaybookDeployment(ctx context.Context, obj i
 	return false, nil
 }
 
-func (r *TemplateReconciler) createPlaybookDeployment(ctx context.Context, obj infrav1.PlaybookControlObject, tmpl *infrav1.PlaybookDeploymentTemplate, role string, vars map[string]interface{}) (*infrav1.PlaybookDeployment, error) {
+func (r *TemplateReconciler) createPlaybookDeployment(ctx context.Context, obj infrav1.PlaybookControlObject, tmpl *infrav1.PlaybookDeploymentTemplate, role string, vars map[string]interface{}, secretVars secretVariables) (*infrav1.PlaybookDeployment, error) {
+	files, err := r.templateFiles(ctx, obj, tmpl.Namespace, tmpl.Spec.Template, vars)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to render the files of the PlaybookDeploymentTemplate %s", client.ObjectKeyFromObject(tmpl))
+	}
 	suffix := fmt.Sprintf("-%s-", role)
 	pd := &infrav1.PlaybookDeployment{
 		ObjectMeta: metav1.ObjectMeta{
@@ -353,13 +439,22 @@ func (r *TemplateReconciler) createPlaybookDeployment(ctx context.Context, obj i
 			},
 			Template: infrav1.PlaybookTemplateSpec{
 				Spec: infrav1.RemotePlaybookSpec{
-					Files:      tmpl.Spec.Template.Spec.Files,
-					Entrypoint: tmpl.Spec.Template.Spec.Entrypoint,
+					Files:                  files,
+					Entrypoint:             tmpl.Spec.Template.Spec.Entrypoint,
+					AnsibleVersion:         tmpl.Spec.Template.Spec.AnsibleVersion,
+					FileSources:            tmpl.Spec.Template.Spec.FileSources,
+					PurgeFilesAfterSuccess: tmpl.Spec.Template.Spec.PurgeFilesAfterSuccess,
 				},
 			},
-			Paused: false,
+			Paused:   false,
+			Approval: tmpl.Spec.Approval,
 		},
 	}
+	secretContent, err := r.variablesContent(ctx, pd.Namespace, pd.Name, secretVars)
+	if err != nil {
+		return nil, err
+	}
+	pd.Spec.Template.Spec.FileSources = withSecretVariables(pd.Spec.Template.Spec.FileSources, pd.Spec.Template.Spec.Entrypoint, variablesSecretName(pd.Name), secretContent)
 	if len(vars) > 0 {
 		varsData, err := yaml.Marshal(vars)
 		if err != nil {
@@ -368,41 +463,73 @@ func (r *TemplateReconciler) createPlaybookDeployment(ctx context.Context, obj i
 		pd.Spec.Template.Spec.Files["variables.yaml"] = string(varsData)
 	}
 	r.Log.Info("creating PlaybookDeployment", "key", client.ObjectKeyFromObject(pd))
-	err := r.Client.Create(ctx, pd)
+	err = r.Client.Create(ctx, pd)
 	if err != nil {
 		return nil, err
 	}
+	// the Secret is created after the PlaybookDeployment to be owned by it
+	if err := r.reconcileVariablesSecret(ctx, pd, "PlaybookDeployment", secretContent); err != nil {
+		return nil, r.deleteCreated(ctx, pd, err)
+	}
 	return pd, nil
 }
 
-func (r *TemplateReconciler) createPlaybook(ctx context.Context, obj infrav1.PlaybookControlObject, tmpl *infrav1.PlaybookTemplate, role string, vars map[string]interface{}) (*infrav1.Playbook, error) {
+func (r *TemplateReconciler) createPlaybook(ctx context.Context, obj infrav1.PlaybookControlObject, tmpl *infrav1.PlaybookTemplate, role string, vars map[string]interface{}, secretVars secretVariables) (*infrav1.Playbook, error) {
 	suffix := fmt.Sprintf("-%s-", role)
-	p := &infrav1.Playbook{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      names.SimpleNameGenerator.GenerateName(obj.GetName() + suffix),
-			Namespace: obj.GetNamespace(),
-			Labels:    CreateLabels(obj, role),
-			OwnerReferences: []metav1.OwnerReference{
-				{
-					APIVersion:         infrav1.GroupVersion.String(),
-					Kind:               obj.GetObjectKind().GroupVersionKind().Kind,
-					Name:               obj.GetName(),
-					UID:                obj.GetUID(),
-					Controller:         pointer.Bool(true),
-					BlockOwnerDeletion: pointer.Bool(true),
-				},
+	meta := metav1.ObjectMeta{
+		Name:      names.SimpleNameGenerator.GenerateName(obj.GetName() + suffix),
+		Namespace: obj.GetNamespace(),
+		Labels:    CreateLabels(obj, role),
+		OwnerReferences: []metav1.OwnerReference{
+			{
+				APIVersion:         infrav1.GroupVersion.String(),
+				Kind:               obj.GetObjectKind().GroupVersionKind().Kind,
+				Name:               obj.GetName(),
+				UID:                obj.GetUID(),
+				Controller:         pointer.Bool(true),
+				BlockOwnerDeletion: pointer.Bool(true),
 			},
 		},
+	}
+	return r.newPlaybook(ctx, obj, meta, tmpl, vars, secretVars)
+}
+
+// CreatePlaybook creates the Playbook with the metadata from the PlaybookTemplate rendered for the object.
+// The Playbook is run by the agent of the object. The variables of variablesFrom are resolved
+// in the namespace of the Playbook and delivered by the Secret that is owned by the Playbook.
+func (r *TemplateReconciler) CreatePlaybook(ctx context.Context, obj infrav1.PlaybookControlObject, meta metav1.ObjectMeta, tmpl *infrav1.PlaybookTemplate, vars map[string]interface{}, variablesFrom []infrav1.TemplateVariable) (*infrav1.Playbook, error) {
+	secretVars, err := r.resolveVariables(ctx, meta.Namespace, variablesFrom)
+	if err != nil {
+		return nil, err
+	}
+	return r.newPlaybook(ctx, obj, meta, tmpl, removeVariables(vars, variablesFrom), secretVars)
+}
+
+func (r *TemplateReconciler) newPlaybook(ctx context.Context, obj infrav1.PlaybookControlObject, meta metav1.ObjectMeta, tmpl *infrav1.PlaybookTemplate, vars map[string]interface{}, secretVars secretVariables) (*infrav1.Playbook, error) {
+	files, err := r.templateFiles(ctx, obj, tmpl.Namespace, tmpl.Spec, vars)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to render the files of the PlaybookTemplate %s", client.ObjectKeyFromObject(tmpl))
+	}
+	p := &infrav1.Playbook{
+		ObjectMeta: meta,
 		Spec: infrav1.PlaybookSpec{
 			AgentRef: corev1.LocalObjectReference{
 				Name: obj.GetAgent().Name,
 			},
 			RemotePlaybookSpec: infrav1.RemotePlaybookSpec{
-				Files:      tmpl.Spec.Spec.Files,
-				Entrypoint: tmpl.Spec.Spec.Entrypoint,
+				Files:                  files,
+				Entrypoint:             tmpl.Spec.Spec.Entrypoint,
+				AnsibleVersion:         tmpl.Spec.Spec.AnsibleVersion,
+				FileSources:            tmpl.Spec.Spec.FileSources,
+				PurgeFilesAfterSuccess: tmpl.Spec.Spec.PurgeFilesAfterSuccess,
 			},
 		},
 	}
+	secretContent, err := r.variablesContent(ctx, p.Namespace, p.Name, secretVars)
+	if err != nil {
+		return nil, err
+	}
+	p.Spec.FileSources = withSecretVariables(p.Spec.FileSources, p.Spec.Entrypoint, variablesSecretName(p.Name), secretContent)
 	if len(vars) > 0 {
 		varsData, err := yaml.Marshal(vars)
 		if err != nil {
@@ -411,16 +538,30 @@ func (r *TemplateReconciler) createPlaybook(ctx context.Context, obj infrav1.Pla
 		p.Spec.Files["variables.yaml"] = string(varsData)
 	}
 	r.Log.Info("creating playbook", "key", client.ObjectKeyFromObject(p))
-	err := r.Client.Create(ctx, p)
+	err = r.Client.Create(ctx, p)
 	if err != nil {
 		return nil, err
 	}
+	// the Secret is created after the Playbook to be owned by it
+	if err := r.reconcileVariablesSecret(ctx, p, "Playbook", secretContent); err != nil {
+		return nil, r.deleteCreated(ctx, p, err)
+	}
 	return p, nil
 }
 
+// deleteCreated deletes the object that is created without the Secret with variables,
+// so the object is created again by the next reconciliation.
+func (r *TemplateReconciler) deleteCreated(ctx context.Context, obj client.Object, err error) error {
+	if deleteErr := r.Client.Delete(ctx, obj); deleteErr != nil && !apierrors.IsNotFound(deleteErr) {
+		r.Log.Error(deleteErr, "unable to delete the object without the Secret with variables", "key", client.ObjectKeyFromObject(obj))
+	}
+	return err
+}
+
 type reference struct {
-	role string
-	ref  infrav1.TemplateReference
+	role      string
+	ref       infrav1.TemplateReference
+	dependsOn []string
 }
 
 // objToRef returns a reference to the given object.
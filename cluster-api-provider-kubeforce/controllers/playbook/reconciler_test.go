@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package playbook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func TestReconcileDependencies(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	tmpl := &infrav1.PlaybookTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tmpl"},
+		Spec: infrav1.PlaybookTemplateSpec{
+			Spec: infrav1.RemotePlaybookSpec{
+				Files:      map[string]string{"site.yaml": "#empty"},
+				Entrypoint: "site.yaml",
+			},
+		},
+	}
+	ref := func(priority int32, dependsOn ...string) *infrav1.TemplateReference {
+		return &infrav1.TemplateReference{
+			Kind:      "PlaybookTemplate",
+			Namespace: "default",
+			Name:      "tmpl",
+			Priority:  priority,
+			Type:      infrav1.TemplateTypeInstall,
+			DependsOn: dependsOn,
+		}
+	}
+	kfm := &infrav1.KubeforceMachine{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: infrav1.GroupVersion.String(),
+			Kind:       "KubeforceMachine",
+		},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+		Spec: infrav1.KubeforceMachineSpec{
+			PlaybookTemplates: &infrav1.PlaybookTemplates{
+				References: map[string]*infrav1.TemplateReference{
+					"hardening":    ref(10),
+					"installer":    ref(10),
+					"loadbalancer": ref(1, "installer"),
+				},
+			},
+		},
+		Status: infrav1.KubeforceMachineStatus{
+			AgentRef: &corev1.LocalObjectReference{Name: "agent"},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tmpl, kfm).Build()
+	r := &TemplateReconciler{Client: c, Log: logr.Discard()}
+
+	ready, err := r.Reconcile(ctx, kfm, infrav1.TemplateTypeInstall, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ready).To(BeFalse())
+
+	list := &infrav1.PlaybookList{}
+	g.Expect(c.List(ctx, list)).To(Succeed())
+	g.Expect(list.Items).To(HaveLen(1))
+
+	// the roles with the same priority are executed one by one
+	status := kfm.Status.Playbooks
+	g.Expect(status).To(HaveLen(3))
+	g.Expect(status["hardening"].State).To(Equal(infrav1.PlaybookRoleWaiting))
+	g.Expect(status["installer"].State).To(Equal(infrav1.PlaybookRoleBlocked))
+	g.Expect(status["installer"].BlockedBy).To(Equal([]string{"hardening"}))
+	g.Expect(status["loadbalancer"].State).To(Equal(infrav1.PlaybookRoleBlocked))
+	g.Expect(status["loadbalancer"].BlockedBy).To(Equal([]string{"installer"}))
+	g.Expect(status["loadbalancer"].Ref).To(BeNil())
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package playbook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+// TemplateFileSuffix marks the files of the playbook templates that are rendered by the controller.
+// The suffix is removed from the name of the rendered file.
+const TemplateFileSuffix = ".tmpl"
+
+// TemplateData is the data that is available in the templates of the playbook files.
+type TemplateData struct {
+	// Cluster is the Cluster of the object. It is nil if the object does not belong to the Cluster.
+	Cluster *clusterv1.Cluster
+	// Machine is the object that controls the playbooks, e.g. the KubeforceMachine.
+	Machine infrav1.PlaybookControlObject
+	// Agent is the agent of the object.
+	Agent *infrav1.KubeforceAgent
+	// Variables are the variables of the playbook.
+	Variables map[string]interface{}
+}
+
+// renderError is an error in the template of a playbook file.
+type renderError struct {
+	error
+}
+
+var templateFuncs = template.FuncMap{
+	"toYaml": func(v interface{}) (string, error) {
+		data, err := yaml.Marshal(v)
+		return strings.TrimSuffix(string(data), "\n"), err
+	},
+	"toJson": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	"indent": func(spaces int, v string) string {
+		pad := strings.Repeat(" ", spaces)
+		return pad + strings.ReplaceAll(v, "\n", "\n"+pad)
+	},
+}
+
+// renderFiles returns a copy of the files with the rendered templates.
+func (r *TemplateReconciler) renderFiles(ctx context.Context, obj infrav1.PlaybookControlObject, files map[string]string, vars map[string]interface{}) (map[string]string, error) {
+	result := make(map[string]string, len(files))
+	var data *TemplateData
+	for name, content := range files {
+		if !strings.HasSuffix(name, TemplateFileSuffix) {
+			result[name] = content
+			continue
+		}
+		if data == nil {
+			var err error
+			data, err = r.templateData(ctx, obj, vars)
+			if err != nil {
+				return nil, err
+			}
+		}
+		target := strings.TrimSuffix(name, TemplateFileSuffix)
+		if _, ok := files[target]; ok {
+			return nil, renderError{errors.Errorf("the rendered file %s conflicts with the file of the template", target)}
+		}
+		rendered, err := renderFile(name, content, data)
+		if err != nil {
+			return nil, renderError{err}
+		}
+		result[target] = rendered
+	}
+	return result, nil
+}
+
+func renderFile(name, content string, data *TemplateData) (string, error) {
+	tmpl, err := template.New(name).Option("missingkey=error").Funcs(templateFuncs).Parse(content)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to parse the template %s", name)
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", errors.Wrapf(err, "unable to render the template %s", name)
+	}
+	return buf.String(), nil
+}
+
+func (r *TemplateReconciler) templateData(ctx context.Context, obj infrav1.PlaybookControlObject, vars map[string]interface{}) (*TemplateData, error) {
+	data := &TemplateData{
+		Machine:   obj,
+		Variables: make(map[string]interface{}, len(vars)),
+	}
+	for k, v := range vars {
+		// the variables of the object are raw JSON values
+		if raw, ok := v.(runtime.RawExtension); ok {
+			var value interface{}
+			if err := json.Unmarshal(raw.Raw, &value); err != nil {
+				return nil, errors.Wrapf(err, "unable to decode the variable %s", k)
+			}
+			v = value
+		}
+		data.Variables[k] = v
+	}
+	if clusterName := obj.GetLabels()[clusterv1.ClusterNameLabel]; clusterName != "" {
+		cluster := &clusterv1.Cluster{}
+		key := client.ObjectKey{Namespace: obj.GetNamespace(), Name: clusterName}
+		if err := r.Client.Get(ctx, key, cluster); err != nil {
+			return nil, errors.Wrapf(err, "unable to get the Cluster %s", key)
+		}
+		data.Cluster = cluster
+	}
+	kfAgent := &infrav1.KubeforceAgent{}
+	if err := r.Client.Get(ctx, obj.GetAgent(), kfAgent); err != nil {
+		return nil, errors.Wrapf(err, "unable to get the KubeforceAgent %s", obj.GetAgent())
+	}
+	data.Agent = kfAgent
+	return data, nil
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package playbook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func TestRenderFiles(t *testing.T) {
+	g := NewWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "cluster"},
+	}
+	kfAgent := &infrav1.KubeforceAgent{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent"},
+		Spec: infrav1.KubeforceAgentSpec{
+			System: infrav1.SystemParams{Arch: "amd64"},
+		},
+	}
+	kfm := &infrav1.KubeforceMachine{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: "default",
+			Name:      "machine",
+			Labels:    map[string]string{clusterv1.ClusterNameLabel: "cluster"},
+		},
+		Status: infrav1.KubeforceMachineStatus{
+			AgentRef: &corev1.LocalObjectReference{Name: "agent"},
+		},
+	}
+	vars := map[string]interface{}{
+		"apiServerPort": "6443",
+		"servers":       runtime.RawExtension{Raw: []byte(`["10.0.0.1","10.0.0.2"]`)},
+	}
+
+	tests := []struct {
+		name    string
+		files   map[string]string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "files without the suffix are not rendered",
+			files: map[string]string{
+				"site.yaml": "{{ .Machine.Name }}",
+			},
+			want: map[string]string{
+				"site.yaml": "{{ .Machine.Name }}",
+			},
+		},
+		{
+			name: "templates are rendered with the context",
+			files: map[string]string{
+				"site.yaml": "#empty",
+				"etc/apiserver.yaml.tmpl": "cluster: {{ .Cluster.Name }}\n" +
+					"machine: {{ .Machine.Name }}\n" +
+					"arch: {{ .Agent.Spec.System.Arch }}\n" +
+					"port: {{ .Variables.apiServerPort }}\n" +
+					"servers:\n{{ toYaml .Variables.servers | indent 2 }}\n",
+			},
+			want: map[string]string{
+				"site.yaml": "#empty",
+				"etc/apiserver.yaml": "cluster: cluster\n" +
+					"machine: machine\n" +
+					"arch: amd64\n" +
+					"port: 6443\n" +
+					"servers:\n  - 10.0.0.1\n  - 10.0.0.2\n",
+			},
+		},
+		{
+			name: "unknown variable",
+			files: map[string]string{
+				"config.yaml.tmpl": "{{ .Variables.unknown }}",
+			},
+			wantErr: true,
+		},
+		{
+			name: "conflict with the rendered file",
+			files: map[string]string{
+				"config.yaml":      "",
+				"config.yaml.tmpl": "",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cluster, kfAgent).Build()
+			r := &TemplateReconciler{Client: c, Log: logr.Discard()}
+			got, err := r.renderFiles(context.Background(), kfm, tt.files, vars)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err).To(BeAssignableToTypeOf(renderError{}))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
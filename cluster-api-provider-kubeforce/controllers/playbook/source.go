@@ -0,0 +1,52 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package playbook
+
+import (
+	"context"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/agent"
+)
+
+// sourceError is an error loading the files of the playbook source.
+type sourceError struct {
+	error
+}
+
+// templateFiles returns the files of the template rendered for the object.
+// The files of the source are loaded from the namespace of the template,
+// the Files of the template override the files of the source with the same path.
+func (r *TemplateReconciler) templateFiles(ctx context.Context, obj infrav1.PlaybookControlObject, namespace string, tmpl infrav1.PlaybookTemplateSpec, vars map[string]interface{}) (map[string]string, error) {
+	files := tmpl.Spec.Files
+	if tmpl.Source != nil {
+		sourceFiles, err := agent.LoadPlaybookSource(ctx, r.Client, r.Storage, namespace, tmpl.Source)
+		if err != nil {
+			return nil, sourceError{err}
+		}
+		for name, content := range tmpl.Spec.Files {
+			sourceFiles[name] = content
+		}
+		files = sourceFiles
+	}
+	return r.renderFiles(ctx, obj, files, vars)
+}
+
+// PlaybookFiles returns the files of the PlaybookTemplate rendered for the object.
+func (r *TemplateReconciler) PlaybookFiles(ctx context.Context, obj infrav1.PlaybookControlObject, tmpl *infrav1.PlaybookTemplate, vars map[string]interface{}) (map[string]string, error) {
+	return r.templateFiles(ctx, obj, tmpl.Namespace, tmpl.Spec, vars)
+}
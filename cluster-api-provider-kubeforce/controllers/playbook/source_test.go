@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package playbook
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func TestTemplateFiles(t *testing.T) {
+	g := NewWithT(t)
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "templates", Name: "playbook"},
+		Data: map[string]string{
+			"site.yaml":        "- hosts: all\n",
+			"config.yaml":      "from source",
+			"machine.txt.tmpl": "{{ .Machine.Name }}",
+		},
+	}
+	kfAgent := &infrav1.KubeforceAgent{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent"},
+	}
+	kfm := &infrav1.KubeforceMachine{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+		Status: infrav1.KubeforceMachineStatus{
+			AgentRef: &corev1.LocalObjectReference{Name: "agent"},
+		},
+	}
+	tests := []struct {
+		name          string
+		tmpl          infrav1.PlaybookTemplateSpec
+		want          map[string]string
+		wantSourceErr bool
+	}{
+		{
+			name: "files without the source",
+			tmpl: infrav1.PlaybookTemplateSpec{
+				Spec: infrav1.RemotePlaybookSpec{Files: map[string]string{"site.yaml": "inline"}},
+			},
+			want: map[string]string{"site.yaml": "inline"},
+		},
+		{
+			name: "inline files override the source",
+			tmpl: infrav1.PlaybookTemplateSpec{
+				Spec: infrav1.RemotePlaybookSpec{Files: map[string]string{"config.yaml": "inline"}},
+				Source: &infrav1.PlaybookSource{
+					ConfigMaps: []infrav1.ConfigMapSource{{Name: "playbook"}},
+				},
+			},
+			want: map[string]string{
+				"site.yaml":   "- hosts: all\n",
+				"config.yaml": "inline",
+				"machine.txt": "machine",
+			},
+		},
+		{
+			name: "missing source",
+			tmpl: infrav1.PlaybookTemplateSpec{
+				Source: &infrav1.PlaybookSource{
+					ConfigMaps: []infrav1.ConfigMapSource{{Name: "missing"}},
+				},
+			},
+			wantSourceErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cm, kfAgent).Build()
+			r := &TemplateReconciler{Client: c, Log: logr.Discard()}
+			got, err := r.templateFiles(context.Background(), kfm, "templates", tt.tmpl, nil)
+			if tt.wantSourceErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(err).To(BeAssignableToTypeOf(sourceError{}))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package playbook
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/utils/pointer"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+const (
+	// secretVariablesKey is the key of the secret variables file in the Secret.
+	secretVariablesKey = "variables.yaml"
+	// secretVariablesFile is the path of the secret variables file relative to the entrypoint of the playbook.
+	// Ansible loads the group_vars directory next to the playbook automatically.
+	secretVariablesFile = "group_vars/all/kubeforce-secret-variables.yaml"
+	// secretVariablesSaltPrefix starts the first line of the secret variables file with the salt.
+	// The salt is a YAML comment, so it is ignored by ansible.
+	secretVariablesSaltPrefix = "# salt: "
+)
+
+// secretVariables is the content of the secret variables file.
+// The content must never be logged.
+type secretVariables []byte
+
+// resolveVariables loads the values of the variables from the Secrets and ConfigMaps in the namespace.
+// It returns nil if there are no variables to deliver.
+func (r *TemplateReconciler) resolveVariables(ctx context.Context, namespace string, vars []infrav1.TemplateVariable) (secretVariables, error) {
+	values := make(map[string]string, len(vars))
+	for _, v := range vars {
+		value, found, err := r.resolveVariable(ctx, namespace, v.ValueFrom)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to resolve the variable %s", v.Name)
+		}
+		if found {
+			values[v.Name] = value
+		}
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	data, err := yaml.Marshal(values)
+	if err != nil {
+		// the error may contain the values
+		return nil, errors.New("unable to marshal the secret variables")
+	}
+	return data, nil
+}
+
+func (r *TemplateReconciler) resolveVariable(ctx context.Context, namespace string, source infrav1.TemplateVariableSource) (string, bool, error) {
+	switch {
+	case source.SecretKeyRef != nil:
+		ref := source.SecretKeyRef
+		optional := pointer.BoolDeref(ref.Optional, false)
+		s := &corev1.Secret{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, s); err != nil {
+			if apierrors.IsNotFound(err) && optional {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		if data, ok := s.Data[ref.Key]; ok {
+			return string(data), true, nil
+		}
+		if optional {
+			return "", false, nil
+		}
+		return "", false, errors.Errorf("key %q is not found in the Secret %s", ref.Key, ref.Name)
+	case source.ConfigMapKeyRef != nil:
+		ref := source.ConfigMapKeyRef
+		optional := pointer.BoolDeref(ref.Optional, false)
+		cm := &corev1.ConfigMap{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, cm); err != nil {
+			if apierrors.IsNotFound(err) && optional {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		if data, ok := cm.Data[ref.Key]; ok {
+			return data, true, nil
+		}
+		if optional {
+			return "", false, nil
+		}
+		return "", false, errors.Errorf("key %q is not found in the ConfigMap %s", ref.Key, ref.Name)
+	}
+	return "", false, errors.New("the source of the value is not specified")
+}
+
+// ReferencesVariablesSource returns true if the variables of the templates are loaded from the Secret or the ConfigMap.
+func ReferencesVariablesSource(templates *infrav1.PlaybookTemplates, o client.Object) bool {
+	if templates == nil {
+		return false
+	}
+	for _, v := range templates.VariablesFrom {
+		switch o.(type) {
+		case *corev1.Secret:
+			if ref := v.ValueFrom.SecretKeyRef; ref != nil && ref.Name == o.GetName() {
+				return true
+			}
+		case *corev1.ConfigMap:
+			if ref := v.ValueFrom.ConfigMapKeyRef; ref != nil && ref.Name == o.GetName() {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// removeVariables returns the variables without the secret ones, so their values are not stored in the playbook files.
+func removeVariables(vars map[string]interface{}, secretVars []infrav1.TemplateVariable) map[string]interface{} {
+	if len(secretVars) == 0 || len(vars) == 0 {
+		return vars
+	}
+	result := make(map[string]interface{}, len(vars))
+	for k, v := range vars {
+		result[k] = v
+	}
+	for _, v := range secretVars {
+		delete(result, v.Name)
+	}
+	return result
+}
+
+// variablesSecretName returns the name of the Secret with the secret variables of the playbook.
+func variablesSecretName(playbookName string) string {
+	return playbookName + "-variables"
+}
+
+// withSecretVariables returns the file sources of the playbook with the secret variables file.
+// The checksum of the file changes the spec of the playbook when the values change,
+// but the values are not stored in the spec. The data must be salted by reconcileVariablesSecret,
+// otherwise the values could be guessed by the checksum.
+func withSecretVariables(sources []infrav1.PlaybookFileSource, entrypoint, secretName string, data secretVariables) []infrav1.PlaybookFileSource {
+	if data == nil {
+		return sources
+	}
+	hash := sha256.Sum256(data)
+	result := make([]infrav1.PlaybookFileSource, 0, len(sources)+1)
+	result = append(result, sources...)
+	return append(result, infrav1.PlaybookFileSource{
+		Path:   path.Join(path.Dir(entrypoint), secretVariablesFile),
+		SHA256: hex.EncodeToString(hash[:]),
+		Mode:   pointer.Int32(0o600),
+		SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: secretName},
+			Key:                  secretVariablesKey,
+		},
+	})
+}
+
+// saltVariables returns the content of the secret variables file with the salt on the first line.
+func saltVariables(salt string, data secretVariables) secretVariables {
+	return append([]byte(secretVariablesSaltPrefix+salt+"\n"), data...)
+}
+
+// variablesSalt returns the salt of the secret variables file or an empty string if the file is not salted.
+func variablesSalt(content []byte) string {
+	line, _, _ := bytes.Cut(content, []byte("\n"))
+	salt, ok := bytes.CutPrefix(line, []byte(secretVariablesSaltPrefix))
+	if !ok {
+		return ""
+	}
+	return string(salt)
+}
+
+// newVariablesSalt generates a random salt for the secret variables file.
+func newVariablesSalt() (string, error) {
+	salt := make([]byte, 32)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.Wrap(err, "unable to generate the salt of the secret variables")
+	}
+	return hex.EncodeToString(salt), nil
+}
+
+// variablesContent returns the salted content of the secret variables file of the playbook.
+// The salt of the existing Secret is kept, so the checksum of the content changes only when the values change.
+func (r *TemplateReconciler) variablesContent(ctx context.Context, namespace, playbookName string, data secretVariables) (secretVariables, error) {
+	if data == nil {
+		return nil, nil
+	}
+	s := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: namespace, Name: variablesSecretName(playbookName)}
+	salt := ""
+	if err := r.Client.Get(ctx, key, s); err == nil {
+		salt = variablesSalt(s.Data[secretVariablesKey])
+	} else if !apierrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "unable to get the Secret %s", key)
+	}
+	if salt == "" {
+		var err error
+		salt, err = newVariablesSalt()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return saltVariables(salt, data), nil
+}
+
+// reconcileVariablesSecret creates or updates the Secret with the salted content of the secret variables.
+// The Secret is controlled by the Playbook or the PlaybookDeployment, so it is deleted together with its owner.
+// The data is compared directly instead of the patch diff to keep the values out of the logs.
+func (r *TemplateReconciler) reconcileVariablesSecret(ctx context.Context, owner client.Object, kind string, content secretVariables) error {
+	if content == nil {
+		return nil
+	}
+	ownerRef := metav1.OwnerReference{
+		APIVersion:         infrav1.GroupVersion.String(),
+		Kind:               kind,
+		Name:               owner.GetName(),
+		UID:                owner.GetUID(),
+		Controller:         pointer.Bool(true),
+		BlockOwnerDeletion: pointer.Bool(true),
+	}
+	s := &corev1.Secret{}
+	key := client.ObjectKey{Namespace: owner.GetNamespace(), Name: variablesSecretName(owner.GetName())}
+	err := r.Client.Get(ctx, key, s)
+	if err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "unable to get the Secret %s", key)
+	}
+	if err != nil {
+		s = &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels: map[string]string{
+					clusterv1.ClusterNameLabel: owner.GetLabels()[clusterv1.ClusterNameLabel],
+				},
+				OwnerReferences: []metav1.OwnerReference{ownerRef},
+			},
+			Type: corev1.SecretTypeOpaque,
+			Data: map[string][]byte{
+				secretVariablesKey: content,
+			},
+		}
+		r.Log.Info("creating the Secret with variables", "key", key)
+		return errors.Wrapf(r.Client.Create(ctx, s), "unable to create the Secret %s", key)
+	}
+	owned := metav1.IsControlledBy(s, owner)
+	if owned && bytes.Equal(s.Data[secretVariablesKey], content) {
+		return nil
+	}
+	if !owned {
+		// the Secret may remain from the deleted playbook with the same name
+		s.OwnerReferences = []metav1.OwnerReference{ownerRef}
+	}
+	if s.Data == nil {
+		s.Data = make(map[string][]byte)
+	}
+	s.Data[secretVariablesKey] = content
+	r.Log.Info("updating the Secret with variables", "key", key)
+	return errors.Wrapf(r.Client.Update(ctx, s), "unable to update the Secret %s", key)
+}
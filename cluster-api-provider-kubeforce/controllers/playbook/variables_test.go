@@ -0,0 +1,150 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package playbook
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func TestReconcileSecretVariables(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	tmpl := &infrav1.PlaybookTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "init"},
+		Spec: infrav1.PlaybookTemplateSpec{
+			Spec: infrav1.RemotePlaybookSpec{
+				Files:      map[string]string{"playbooks/site.yaml": "#empty"},
+				Entrypoint: "playbooks/site.yaml",
+			},
+		},
+	}
+	tokens := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "tokens"},
+		Data:       map[string][]byte{"token": []byte("s3cr3t")},
+	}
+	kfm := &infrav1.KubeforceMachine{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: infrav1.GroupVersion.String(),
+			Kind:       "KubeforceMachine",
+		},
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "machine"},
+		Spec: infrav1.KubeforceMachineSpec{
+			PlaybookTemplates: &infrav1.PlaybookTemplates{
+				References: map[string]*infrav1.TemplateReference{
+					"init": {
+						Kind:      "PlaybookTemplate",
+						Namespace: "default",
+						Name:      "init",
+						Priority:  1,
+						Type:      infrav1.TemplateTypeInstall,
+					},
+				},
+				VariablesFrom: []infrav1.TemplateVariable{
+					{
+						Name: "token",
+						ValueFrom: infrav1.TemplateVariableSource{
+							SecretKeyRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "tokens"},
+								Key:                  "token",
+							},
+						},
+					},
+				},
+			},
+		},
+		Status: infrav1.KubeforceMachineStatus{
+			AgentRef: &corev1.LocalObjectReference{Name: "agent"},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(tmpl, tokens, kfm).Build()
+	r := &TemplateReconciler{Client: c, Log: logr.Discard()}
+
+	ready, err := r.Reconcile(ctx, kfm, infrav1.TemplateTypeInstall, map[string]interface{}{"token": "plain", "name": "value"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(ready).To(BeFalse())
+
+	list := &infrav1.PlaybookList{}
+	g.Expect(c.List(ctx, list)).To(Succeed())
+	g.Expect(list.Items).To(HaveLen(1))
+	pb := list.Items[0]
+	g.Expect(pb.Spec.Files["variables.yaml"]).To(Equal("name: value\n"))
+	g.Expect(pb.Spec.FileSources).To(HaveLen(1))
+	source := pb.Spec.FileSources[0]
+	g.Expect(source.Path).To(Equal("playbooks/group_vars/all/kubeforce-secret-variables.yaml"))
+	g.Expect(source.SHA256).NotTo(BeEmpty())
+	g.Expect(source.SecretKeyRef).NotTo(BeNil())
+	g.Expect(source.SecretKeyRef.Name).To(Equal(pb.Name + "-variables"))
+	g.Expect(tmpl.Spec.Spec.FileSources).To(BeEmpty())
+
+	secret := &corev1.Secret{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: source.SecretKeyRef.Name}, secret)).To(Succeed())
+	content := secret.Data[secretVariablesKey]
+	g.Expect(string(content)).To(HavePrefix(secretVariablesSaltPrefix))
+	g.Expect(string(content)).To(HaveSuffix("\ntoken: s3cr3t\n"))
+	// the Secret is deleted together with the playbook
+	g.Expect(metav1.IsControlledBy(secret, &pb)).To(BeTrue())
+	// the checksum is calculated for the salted content, so the value can not be guessed by the checksum
+	unsalted := sha256.Sum256([]byte("token: s3cr3t\n"))
+	salted := sha256.Sum256(content)
+	g.Expect(source.SHA256).To(Equal(hex.EncodeToString(salted[:])))
+	g.Expect(source.SHA256).NotTo(Equal(hex.EncodeToString(unsalted[:])))
+
+	// the salt is kept when the values are changed
+	salt := variablesSalt(content)
+	updated, err := r.variablesContent(ctx, pb.Namespace, pb.Name, []byte("token: changed\n"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(variablesSalt(updated)).To(Equal(salt))
+	g.Expect(r.reconcileVariablesSecret(ctx, &pb, "Playbook", updated)).To(Succeed())
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: source.SecretKeyRef.Name}, secret)).To(Succeed())
+	g.Expect(secret.Data[secretVariablesKey]).To(Equal([]byte(updated)))
+
+	// the Secret that remains from the deleted playbook with the same name is owned by the new playbook
+	recreated := pb.DeepCopy()
+	recreated.UID = "recreated"
+	g.Expect(r.reconcileVariablesSecret(ctx, recreated, "Playbook", updated)).To(Succeed())
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: source.SecretKeyRef.Name}, secret)).To(Succeed())
+	g.Expect(metav1.IsControlledBy(secret, recreated)).To(BeTrue())
+	g.Expect(secret.OwnerReferences).To(HaveLen(1))
+
+	// the salts of the different Secrets are different
+	other, err := r.variablesContent(ctx, "default", "other", []byte("token: s3cr3t\n"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(variablesSalt(other)).NotTo(BeEmpty())
+	g.Expect(variablesSalt(other)).NotTo(Equal(salt))
+
+	g.Expect(ReferencesVariablesSource(kfm.GetTemplates(), tokens)).To(BeTrue())
+	g.Expect(ReferencesVariablesSource(kfm.GetTemplates(), &corev1.ConfigMap{ObjectMeta: tokens.ObjectMeta})).To(BeFalse())
+	g.Expect(ReferencesVariablesSource(kfm.GetTemplates(), secret)).To(BeFalse())
+}
@@ -47,6 +47,7 @@ import (
 	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
 	agentctrl "k3f.io/kubeforce/cluster-api-provider-kubeforce/controllers/agent"
 	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/agent"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/repository"
 )
 
 // PlaybookReconciler reconciles a Playbook object.
@@ -54,6 +55,7 @@ type PlaybookReconciler struct {
 	Log              logr.Logger
 	Client           client.Client
 	AgentClientCache *agentctrl.ClientCache
+	Storage          *repository.Storage
 }
 
 const (
@@ -455,6 +457,13 @@ func (r *PlaybookReconciler) findExternalPlaybook(ctx context.Context, agentClie
 }
 
 func (r *PlaybookReconciler) createExternalPlaybook(ctx context.Context, agentClient *agentclient.Clientset, playbook *infrav1.Playbook) (*v1alpha1.Playbook, error) {
+	files, err := agent.LoadPlaybookFiles(ctx, r.Client, r.Storage, playbook.Namespace, playbook.Spec.FileSources)
+	if err != nil {
+		return nil, err
+	}
+	if err := files.Upload(ctx, agentClient); err != nil {
+		return nil, err
+	}
 	agentPlaybook := &v1alpha1.Playbook{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: playbook.Name + "-",
@@ -463,8 +472,11 @@ func (r *PlaybookReconciler) createExternalPlaybook(ctx context.Context, agentCl
 			Annotations:  map[string]string{},
 		},
 		Spec: v1alpha1.PlaybookSpec{
-			Files:      playbook.Spec.Files,
-			Entrypoint: playbook.Spec.Entrypoint,
+			Files:          playbook.Spec.Files,
+			Entrypoint:     playbook.Spec.Entrypoint,
+			AnsibleVersion: playbook.Spec.AnsibleVersion,
+			BinaryFiles:    files.Files,
+			Policy:         externalPolicy(playbook.Spec.RemotePlaybookSpec),
 		},
 	}
 	resultPlaybook, err := agentClient.AgentV1alpha1().Playbooks().Create(ctx, agentPlaybook, metav1.CreateOptions{})
@@ -474,6 +486,17 @@ func (r *PlaybookReconciler) createExternalPlaybook(ctx context.Context, agentCl
 	return resultPlaybook, nil
 }
 
+// externalPolicy returns the execution policy of the remote playbook.
+// The default policy of the agent is used if it returns nil.
+func externalPolicy(spec infrav1.RemotePlaybookSpec) *v1alpha1.Policy {
+	if !spec.PurgeFilesAfterSuccess {
+		return nil
+	}
+	return &v1alpha1.Policy{
+		PurgeFilesAfterSuccess: true,
+	}
+}
+
 func (r *PlaybookReconciler) shouldAdopt(p *infrav1.Playbook) bool {
 	return metav1.GetControllerOf(p) == nil && !capiutil.HasOwner(p.OwnerReferences, infrav1.GroupVersion.String(), []string{"KubeforceAgent"})
 }
@@ -19,6 +19,7 @@ package controllers
 import (
 	"context"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -46,6 +47,7 @@ import (
 	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
 	agentctrl "k3f.io/kubeforce/cluster-api-provider-kubeforce/controllers/agent"
 	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/agent"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/repository"
 	patchutil "k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/util/patch"
 )
 
@@ -54,6 +56,7 @@ type PlaybookDeploymentReconciler struct {
 	Log              logr.Logger
 	Client           client.Client
 	AgentClientCache *agentctrl.ClientCache
+	Storage          *repository.Storage
 }
 
 //+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=playbookdeployments,verbs=get;list;watch;create;update;patch;delete
@@ -313,6 +316,31 @@ func (r *PlaybookDeploymentReconciler) reconcileNormal(ctx context.Context, pd *
 		return ctrl.Result{}, nil
 	}
 
+	files, err := agent.LoadPlaybookFiles(ctx, r.Client, r.Storage, pd.Namespace, pd.Spec.Template.Spec.FileSources)
+	if err != nil {
+		pd.Status.FailureMessage = fmt.Sprintf("unable to load the playbook files err: %v", err)
+		pd.Status.FailureReason = infrav1.ExternalPlaybookError
+		conditions.MarkFalse(pd, infrav1.SynchronizationCondition, infrav1.SynchronizationFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{}, err
+	}
+	revision, fileChecksums, err := playbookDeploymentRevision(pd, files)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if !isRevisionApproved(pd, revision) {
+		pd.Status.PendingRevision = &infrav1.PendingPlaybookRevision{
+			Revision: revision,
+			Files:    diffPlaybookFiles(pd.Status.FileChecksums, fileChecksums),
+		}
+		pd.Status.FailureMessage = ""
+		pd.Status.FailureReason = ""
+		msg := fmt.Sprintf("revision %s is waiting for approval", revision)
+		log.Info(msg)
+		conditions.MarkFalse(pd, infrav1.SynchronizationCondition, infrav1.WaitingForApprovalReason, clusterv1.ConditionSeverityInfo, msg)
+		return ctrl.Result{}, nil
+	}
+	pd.Status.PendingRevision = nil
+
 	// Fetch the Agent.
 	kfAgent, err := r.getKubeforceAgent(ctx, pd)
 	if err != nil {
@@ -362,7 +390,7 @@ func (r *PlaybookDeploymentReconciler) reconcileNormal(ctx context.Context, pd *
 			conditions.MarkFalse(pd, infrav1.SynchronizationCondition, infrav1.SynchronizationFailedReason, clusterv1.ConditionSeverityError, msg)
 			return ctrl.Result{}, nil
 		}
-		externalPlaybookDeployment, err := r.createExternalPlaybookDeployment(ctx, agentClient, pd)
+		externalPlaybookDeployment, err := r.createExternalPlaybookDeployment(ctx, agentClient, pd, files)
 		if err != nil {
 			pd.Status.FailureMessage = fmt.Sprintf("unable to create ExternalPlaybook err: %v", err)
 			pd.Status.FailureReason = infrav1.ExternalPlaybookError
@@ -370,6 +398,8 @@ func (r *PlaybookDeploymentReconciler) reconcileNormal(ctx context.Context, pd *
 			return ctrl.Result{}, err
 		}
 		pd.Status.LastSpecChecksum = currentChecksum
+		pd.Status.Revision = revision
+		pd.Status.FileChecksums = fileChecksums
 		pd.Status.ExternalName = externalPlaybookDeployment.Name
 		pd.Status.FailureMessage = ""
 		pd.Status.FailureReason = ""
@@ -389,7 +419,7 @@ func (r *PlaybookDeploymentReconciler) reconcileNormal(ctx context.Context, pd *
 	}
 	pd.Status.ExternalName = extPlaybookDeployment.Name
 	pd.Status.ExternalPhase = string(extPlaybookDeployment.Status.Phase)
-	updated, err := r.updateExternalPlaybookDeployment(ctx, agentClient, extPlaybookDeployment, pd)
+	updated, err := r.updateExternalPlaybookDeployment(ctx, agentClient, extPlaybookDeployment, pd, files)
 	if err != nil {
 		msg := fmt.Sprintf("unable to update ExternalPlaybook err: %v", err)
 		pd.Status.FailureMessage = msg
@@ -399,6 +429,8 @@ func (r *PlaybookDeploymentReconciler) reconcileNormal(ctx context.Context, pd *
 	}
 	pd.Status.FailureMessage = ""
 	pd.Status.FailureReason = ""
+	pd.Status.Revision = revision
+	pd.Status.FileChecksums = fileChecksums
 	if updated {
 		msg := "external PlaybookDeployment has been updated"
 		log.Info(msg)
@@ -445,7 +477,11 @@ func (r *PlaybookDeploymentReconciler) findExternalPlaybookDeployment(ctx contex
 	return &list.Items[0], nil
 }
 
-func (r *PlaybookDeploymentReconciler) createExternalPlaybookDeployment(ctx context.Context, agentClient *agentclient.Clientset, pd *infrav1.PlaybookDeployment) (*v1alpha1.PlaybookDeployment, error) {
+func (r *PlaybookDeploymentReconciler) createExternalPlaybookDeployment(ctx context.Context, agentClient *agentclient.Clientset,
+	pd *infrav1.PlaybookDeployment, files *agent.PlaybookFiles) (*v1alpha1.PlaybookDeployment, error) {
+	if err := files.Upload(ctx, agentClient); err != nil {
+		return nil, err
+	}
 	agentPlaybookDeployment := &v1alpha1.PlaybookDeployment{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: pd.Name + "-",
@@ -453,7 +489,7 @@ func (r *PlaybookDeploymentReconciler) createExternalPlaybookDeployment(ctx cont
 			Labels:       externalPlaybookDeploymentLabels(pd),
 			Annotations:  map[string]string{},
 		},
-		Spec: toExternalPlaybookDeploymentSpec(pd.Spec),
+		Spec: toExternalPlaybookDeploymentSpec(pd.Spec, files.Files),
 	}
 	resultPlaybookDeployment, err := agentClient.AgentV1alpha1().PlaybookDeployments().Create(ctx, agentPlaybookDeployment, metav1.CreateOptions{})
 	if err != nil {
@@ -462,7 +498,7 @@ func (r *PlaybookDeploymentReconciler) createExternalPlaybookDeployment(ctx cont
 	return resultPlaybookDeployment, err
 }
 
-func toExternalPlaybookDeploymentSpec(pdSpec infrav1.PlaybookDeploymentSpec) v1alpha1.PlaybookDeploymentSpec {
+func toExternalPlaybookDeploymentSpec(pdSpec infrav1.PlaybookDeploymentSpec, binaryFiles []v1alpha1.PlaybookFile) v1alpha1.PlaybookDeploymentSpec {
 	return v1alpha1.PlaybookDeploymentSpec{
 		Template: v1alpha1.PlaybookTemplateSpec{
 			ObjectMeta: metav1.ObjectMeta{
@@ -470,8 +506,11 @@ func toExternalPlaybookDeploymentSpec(pdSpec infrav1.PlaybookDeploymentSpec) v1a
 				Annotations: pdSpec.Template.Annotations,
 			},
 			Spec: v1alpha1.PlaybookSpec{
-				Files:      pdSpec.Template.Spec.Files,
-				Entrypoint: pdSpec.Template.Spec.Entrypoint,
+				Files:          pdSpec.Template.Spec.Files,
+				Entrypoint:     pdSpec.Template.Spec.Entrypoint,
+				AnsibleVersion: pdSpec.Template.Spec.AnsibleVersion,
+				BinaryFiles:    binaryFiles,
+				Policy:         externalPolicy(pdSpec.Template.Spec),
 			},
 		},
 		RevisionHistoryLimit: pdSpec.RevisionHistoryLimit,
@@ -481,12 +520,20 @@ func toExternalPlaybookDeploymentSpec(pdSpec infrav1.PlaybookDeploymentSpec) v1a
 
 func (r *PlaybookDeploymentReconciler) updateExternalPlaybookDeployment(
 	ctx context.Context, agentClient *agentclient.Clientset,
-	extPd *v1alpha1.PlaybookDeployment, pd *infrav1.PlaybookDeployment) (bool, error) {
+	extPd *v1alpha1.PlaybookDeployment, pd *infrav1.PlaybookDeployment, files *agent.PlaybookFiles) (bool, error) {
 	patchObj := client.MergeFrom(extPd.DeepCopy())
 	extPd.Spec.Template.ObjectMeta.Labels = pd.Spec.Template.Labels
 	extPd.Spec.Template.ObjectMeta.Annotations = pd.Spec.Template.Annotations
 	extPd.Spec.Template.Spec.Files = pd.Spec.Template.Spec.Files
 	extPd.Spec.Template.Spec.Entrypoint = pd.Spec.Template.Spec.Entrypoint
+	extPd.Spec.Template.Spec.AnsibleVersion = pd.Spec.Template.Spec.AnsibleVersion
+	extPd.Spec.Template.Spec.BinaryFiles = files.Files
+	if policy := extPd.Spec.Template.Spec.Policy; policy != nil {
+		// the other fields of the policy are defaulted by the agent
+		policy.PurgeFilesAfterSuccess = pd.Spec.Template.Spec.PurgeFilesAfterSuccess
+	} else {
+		extPd.Spec.Template.Spec.Policy = externalPolicy(pd.Spec.Template.Spec)
+	}
 	extPd.Spec.Paused = pd.Spec.Paused
 	if pd.Spec.RevisionHistoryLimit != nil {
 		extPd.Spec.RevisionHistoryLimit = pd.Spec.RevisionHistoryLimit
@@ -502,6 +549,13 @@ func (r *PlaybookDeploymentReconciler) updateExternalPlaybookDeployment(
 		return false, errors.Wrapf(err, "failed to calculate patch data")
 	}
 
+	// the artifacts may be removed from the agent, e.g. by the reinstallation of the agent,
+	// they are not required anymore if the playbook has succeeded and its files are purged
+	if changed || extPd.Status.Phase != v1alpha1.PlaybookDeploymentSucceeded {
+		if err := files.Upload(ctx, agentClient); err != nil {
+			return false, err
+		}
+	}
 	if changed {
 		_, err := agentClient.AgentV1alpha1().PlaybookDeployments().Patch(ctx, extPd.Name, patchObj.Type(), diff, metav1.PatchOptions{})
 		if err != nil {
@@ -512,6 +566,64 @@ func (r *PlaybookDeploymentReconciler) updateExternalPlaybookDeployment(
 	return false, nil
 }
 
+// playbookDeploymentRevision returns the revision of the template and the checksums of the playbook files.
+// The revision includes the content of the file sources, so the changed ConfigMap or Secret requires approval too.
+func playbookDeploymentRevision(pd *infrav1.PlaybookDeployment, files *agent.PlaybookFiles) (string, map[string]string, error) {
+	fileChecksums := make(map[string]string, len(pd.Spec.Template.Spec.Files)+len(files.Files))
+	for path, content := range pd.Spec.Template.Spec.Files {
+		sum, err := checksum.CalcSHA256Sum([]byte(content))
+		if err != nil {
+			return "", nil, err
+		}
+		fileChecksums[path] = sum
+	}
+	for _, f := range files.Files {
+		fileChecksums[f.Path] = f.SHA256
+	}
+	revision, err := checksum.CalcSHA256ForObject(struct {
+		Template      infrav1.PlaybookTemplateSpec
+		FileChecksums map[string]string
+	}{
+		Template:      pd.Spec.Template,
+		FileChecksums: fileChecksums,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return revision, fileChecksums, nil
+}
+
+// isRevisionApproved returns true if the revision can be propagated to the agent.
+func isRevisionApproved(pd *infrav1.PlaybookDeployment, revision string) bool {
+	if pd.Spec.Approval != infrav1.PlaybookApprovalRequired {
+		return true
+	}
+	return revision == pd.Status.Revision || revision == pd.Annotations[infrav1.PlaybookDeploymentApprovedRevisionAnnotation]
+}
+
+// diffPlaybookFiles returns the changes of the files ordered by the path.
+func diffPlaybookFiles(current, desired map[string]string) []infrav1.PlaybookFileChange {
+	result := make([]infrav1.PlaybookFileChange, 0)
+	for path, sum := range desired {
+		previous, ok := current[path]
+		switch {
+		case !ok:
+			result = append(result, infrav1.PlaybookFileChange{Path: path, Operation: infrav1.PlaybookFileAdded, SHA256: sum})
+		case previous != sum:
+			result = append(result, infrav1.PlaybookFileChange{Path: path, Operation: infrav1.PlaybookFileModified, SHA256: sum, PreviousSHA256: previous})
+		}
+	}
+	for path, previous := range current {
+		if _, ok := desired[path]; !ok {
+			result = append(result, infrav1.PlaybookFileChange{Path: path, Operation: infrav1.PlaybookFileRemoved, PreviousSHA256: previous})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result
+}
+
 func (r *PlaybookDeploymentReconciler) shouldAdopt(p *infrav1.PlaybookDeployment) bool {
 	return metav1.GetControllerOf(p) == nil && !capiutil.HasOwner(p.OwnerReferences, infrav1.GroupVersion.String(), []string{"KubeforceAgent"})
 }
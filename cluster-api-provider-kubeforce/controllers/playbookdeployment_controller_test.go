@@ -0,0 +1,104 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func TestDiffPlaybookFiles(t *testing.T) {
+	g := NewWithT(t)
+	current := map[string]string{"site.yaml": "1", "removed.yaml": "2", "same.yaml": "3"}
+	desired := map[string]string{"site.yaml": "4", "added.yaml": "5", "same.yaml": "3"}
+	g.Expect(diffPlaybookFiles(current, desired)).To(Equal([]infrav1.PlaybookFileChange{
+		{Path: "added.yaml", Operation: infrav1.PlaybookFileAdded, SHA256: "5"},
+		{Path: "removed.yaml", Operation: infrav1.PlaybookFileRemoved, PreviousSHA256: "2"},
+		{Path: "site.yaml", Operation: infrav1.PlaybookFileModified, SHA256: "4", PreviousSHA256: "1"},
+	}))
+	g.Expect(diffPlaybookFiles(current, current)).To(BeEmpty())
+}
+
+func TestPlaybookDeploymentApproval(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+
+	pd := &infrav1.PlaybookDeployment{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "pd", Labels: map[string]string{}},
+		Spec: infrav1.PlaybookDeploymentSpec{
+			AgentRef: corev1.LocalObjectReference{Name: "agent"},
+			Template: infrav1.PlaybookTemplateSpec{
+				Spec: infrav1.RemotePlaybookSpec{
+					Files:      map[string]string{"site.yaml": "- hosts: all\n"},
+					Entrypoint: "site.yaml",
+				},
+			},
+			Approval: infrav1.PlaybookApprovalRequired,
+		},
+		Status: infrav1.PlaybookDeploymentStatus{
+			FileChecksums: map[string]string{"site.yaml": "previous"},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).Build()
+	r := &PlaybookDeploymentReconciler{Client: c, Log: logr.Discard()}
+
+	// the new revision waits for approval
+	_, err := r.reconcileNormal(ctx, pd)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pd.Status.PendingRevision).NotTo(BeNil())
+	revision := pd.Status.PendingRevision.Revision
+	g.Expect(revision).To(HaveLen(64))
+	g.Expect(pd.Status.PendingRevision.Files).To(HaveLen(1))
+	g.Expect(pd.Status.PendingRevision.Files[0].Operation).To(Equal(infrav1.PlaybookFileModified))
+	g.Expect(pd.Status.PendingRevision.Files[0].PreviousSHA256).To(Equal("previous"))
+	g.Expect(conditions.GetReason(pd, infrav1.SynchronizationCondition)).To(Equal(infrav1.WaitingForApprovalReason))
+
+	// the approval of the other revision is ignored
+	pd.Annotations = map[string]string{infrav1.PlaybookDeploymentApprovedRevisionAnnotation: "other"}
+	_, err = r.reconcileNormal(ctx, pd)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pd.Status.PendingRevision).NotTo(BeNil())
+
+	// the approved revision is propagated to the agent
+	pd.Annotations[infrav1.PlaybookDeploymentApprovedRevisionAnnotation] = revision
+	_, err = r.reconcileNormal(ctx, pd)
+	// the agent does not exist
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(pd.Status.PendingRevision).To(BeNil())
+	g.Expect(conditions.GetReason(pd, infrav1.SynchronizationCondition)).To(Equal(infrav1.SynchronizationFailedReason))
+
+	// the automatic approval
+	pd.Annotations = nil
+	pd.Spec.Approval = infrav1.PlaybookApprovalAutomatic
+	_, err = r.reconcileNormal(ctx, pd)
+	g.Expect(err).To(HaveOccurred())
+	g.Expect(pd.Status.PendingRevision).To(BeNil())
+}
@@ -0,0 +1,536 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/sets"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/patch"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+	"k3f.io/kubeforce/agent/pkg/util/checksum"
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/agent"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/repository"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/util/names"
+	patchutil "k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/util/patch"
+)
+
+// sourceResyncPeriod is the period of checking the template source for the new revision.
+const sourceResyncPeriod = 5 * time.Minute
+
+// PlaybookDeploymentSetReconciler reconciles a PlaybookDeploymentSet object.
+type PlaybookDeploymentSetReconciler struct {
+	Client  client.Client
+	Log     logr.Logger
+	Storage *repository.Storage
+}
+
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=playbookdeploymentsets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=playbookdeploymentsets/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=infrastructure.cluster.x-k8s.io,resources=playbookdeploymenttemplates,verbs=get;list;watch
+
+// Reconcile handles PlaybookDeploymentSet events.
+func (r *PlaybookDeploymentSetReconciler) Reconcile(ctx context.Context, req ctrl.Request) (_ ctrl.Result, rerr error) {
+	if ctx.Err() != nil {
+		return reconcile.Result{}, nil
+	}
+	log := r.Log.WithValues("pds", req)
+	pds := &infrav1.PlaybookDeploymentSet{}
+	if err := r.Client.Get(ctx, req.NamespacedName, pds); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+	// the PlaybookDeployments are deleted by the garbage collector
+	if !pds.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	// Initialize the patch helper
+	patchHelper, err := patch.NewHelper(pds, r.Client)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Always attempt to Patch the PlaybookDeploymentSet object and status after each reconciliation.
+	defer func() {
+		// We want to save the last status even if the context was closed.
+		if err := patchPlaybookDeploymentSet(context.Background(), patchHelper, pds); err != nil {
+			log.Error(err, "failed to patch PlaybookDeploymentSet")
+			if rerr == nil {
+				rerr = err
+			}
+		}
+	}()
+
+	return r.reconcileNormal(ctrl.LoggerInto(ctx, log), pds)
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *PlaybookDeploymentSetReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&infrav1.PlaybookDeploymentSet{}).
+		WithOptions(options).
+		Owns(&infrav1.PlaybookDeployment{}).
+		Watches(
+			&source.Kind{Type: &infrav1.KubeforceAgent{}},
+			handler.EnqueueRequestsFromMapFunc(r.toPlaybookDeploymentSets),
+		).
+		Watches(
+			&source.Kind{Type: &infrav1.KubeforceMachine{}},
+			handler.EnqueueRequestsFromMapFunc(r.toPlaybookDeploymentSets),
+		).
+		Watches(
+			&source.Kind{Type: &clusterv1.Cluster{}},
+			handler.EnqueueRequestsFromMapFunc(r.toPlaybookDeploymentSets),
+		).
+		Watches(
+			&source.Kind{Type: &infrav1.PlaybookDeploymentTemplate{}},
+			handler.EnqueueRequestsFromMapFunc(r.toPlaybookDeploymentSets),
+		).
+		Complete(r)
+}
+
+// toPlaybookDeploymentSets returns the PlaybookDeploymentSets in the namespace of the object,
+// because any agent, machine, cluster or template can change the PlaybookDeployments of the set.
+func (r *PlaybookDeploymentSetReconciler) toPlaybookDeploymentSets(o client.Object) []ctrl.Request {
+	list := &infrav1.PlaybookDeploymentSetList{}
+	if err := r.Client.List(context.TODO(), list, client.InNamespace(o.GetNamespace())); err != nil {
+		r.Log.Error(err, "unable to list PlaybookDeploymentSets", "namespace", o.GetNamespace())
+		return nil
+	}
+	result := make([]ctrl.Request, 0, len(list.Items))
+	for _, pds := range list.Items {
+		if _, ok := o.(*infrav1.PlaybookDeploymentTemplate); ok && pds.Spec.TemplateRef.Name != o.GetName() {
+			continue
+		}
+		//nolint:gosec
+		result = append(result, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(&pds)})
+	}
+	return result
+}
+
+func (r *PlaybookDeploymentSetReconciler) reconcileNormal(ctx context.Context, pds *infrav1.PlaybookDeploymentSet) (ctrl.Result, error) {
+	log := ctrl.LoggerFrom(ctx)
+	tmpl := &infrav1.PlaybookDeploymentTemplate{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: pds.Namespace, Name: pds.Spec.TemplateRef.Name}, tmpl); err != nil {
+		conditions.MarkFalse(pds, infrav1.RolloutCompletedCondition, infrav1.TemplateFailedReason, clusterv1.ConditionSeverityError,
+			"unable to get PlaybookDeploymentTemplate %s: %v", pds.Spec.TemplateRef.Name, err)
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+	template, err := r.playbookTemplate(ctx, tmpl)
+	if err != nil {
+		conditions.MarkFalse(pds, infrav1.RolloutCompletedCondition, infrav1.TemplateFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return ctrl.Result{}, err
+	}
+	revision, err := checksum.CalcSHA256ForObject(template)
+	if err != nil {
+		return ctrl.Result{}, errors.WithStack(err)
+	}
+	revision = revision[:10]
+	pds.Status.Revision = revision
+
+	agentNames, err := r.selectAgents(ctx, pds)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	pdByAgent, err := r.playbookDeploymentsByAgent(ctx, pds)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+
+	result := ctrl.Result{}
+	if tmpl.Spec.Template.Source != nil {
+		result.RequeueAfter = sourceResyncPeriod
+	}
+	pausedOnFailure := false
+	if !pds.Spec.Paused {
+		if err := r.deleteUnselected(ctx, pdByAgent, agentNames); err != nil {
+			return ctrl.Result{}, err
+		}
+		selected := make([]*infrav1.PlaybookDeployment, 0, len(agentNames))
+		for _, agentName := range agentNames {
+			pd, ok := pdByAgent[agentName]
+			if !ok {
+				pd = newSetPlaybookDeployment(pds, agentName, template, revision)
+				log.Info("creating PlaybookDeployment", "agent", agentName, "revision", revision)
+				if err := r.Client.Create(ctx, pd); err != nil {
+					return ctrl.Result{}, errors.Wrapf(err, "unable to create PlaybookDeployment for the agent %s", agentName)
+				}
+				pdByAgent[agentName] = pd
+			}
+			selected = append(selected, pd)
+		}
+		maxUnavailable, err := getSetMaxUnavailable(pds, len(agentNames))
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		var toUpdate []*infrav1.PlaybookDeployment
+		toUpdate, pausedOnFailure = planRollout(selected, revision, maxUnavailable, getSetPartition(pds), isPauseOnFailure(pds))
+		for _, pd := range toUpdate {
+			log.Info("updating PlaybookDeployment", "agent", pd.Spec.AgentRef.Name, "revision", revision)
+			if err := r.updatePlaybookDeployment(ctx, pd, template, revision); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	}
+
+	r.reconcileStatus(pds, agentNames, pdByAgent, pausedOnFailure)
+	return result, nil
+}
+
+// playbookTemplate returns the template of the PlaybookDeployments with the files of the template source.
+func (r *PlaybookDeploymentSetReconciler) playbookTemplate(ctx context.Context, tmpl *infrav1.PlaybookDeploymentTemplate) (*infrav1.PlaybookDeploymentTemplateSpec, error) {
+	result := tmpl.Spec.DeepCopy()
+	if result.Template.Source == nil {
+		return result, nil
+	}
+	files, err := agent.LoadPlaybookSource(ctx, r.Client, r.Storage, tmpl.Namespace, result.Template.Source)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to load the source of PlaybookDeploymentTemplate %s", tmpl.Name)
+	}
+	for name, content := range result.Template.Spec.Files {
+		files[name] = content
+	}
+	result.Template.Spec.Files = files
+	result.Template.Source = nil
+	return result, nil
+}
+
+// selectAgents returns the names of the agents selected by the PlaybookDeploymentSet ordered by name.
+func (r *PlaybookDeploymentSetReconciler) selectAgents(ctx context.Context, pds *infrav1.PlaybookDeploymentSet) ([]string, error) {
+	if pds.Spec.AgentSelector == nil && pds.Spec.ClusterSelector == nil {
+		return []string{}, nil
+	}
+	agentSelector, err := metav1.LabelSelectorAsSelector(pds.Spec.AgentSelector)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid agentSelector")
+	}
+	if pds.Spec.AgentSelector == nil {
+		agentSelector = labels.Everything()
+	}
+	agents, err := agentsBySelector(ctx, r.Client, pds.Namespace, agentSelector)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to list KubeforceAgents")
+	}
+	var clusterAgents sets.Set[string]
+	if pds.Spec.ClusterSelector != nil {
+		clusterAgents, err = r.clusterAgents(ctx, pds)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := make([]string, 0, len(agents))
+	for _, kfAgent := range agents {
+		if !kfAgent.DeletionTimestamp.IsZero() {
+			continue
+		}
+		if clusterAgents != nil && !clusterAgents.Has(kfAgent.Name) {
+			continue
+		}
+		result = append(result, kfAgent.Name)
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// clusterAgents returns the names of the agents of the KubeforceMachines of the selected clusters.
+func (r *PlaybookDeploymentSetReconciler) clusterAgents(ctx context.Context, pds *infrav1.PlaybookDeploymentSet) (sets.Set[string], error) {
+	clusterSelector, err := metav1.LabelSelectorAsSelector(pds.Spec.ClusterSelector)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid clusterSelector")
+	}
+	clusters := &clusterv1.ClusterList{}
+	if err := r.Client.List(ctx, clusters, client.InNamespace(pds.Namespace), client.MatchingLabelsSelector{Selector: clusterSelector}); err != nil {
+		return nil, errors.Wrap(err, "unable to list Clusters")
+	}
+	result := sets.New[string]()
+	if len(clusters.Items) == 0 {
+		return result, nil
+	}
+	clusterNames := sets.New[string]()
+	for _, cluster := range clusters.Items {
+		clusterNames.Insert(cluster.Name)
+	}
+	machines := &infrav1.KubeforceMachineList{}
+	if err := r.Client.List(ctx, machines, client.InNamespace(pds.Namespace)); err != nil {
+		return nil, errors.Wrap(err, "unable to list KubeforceMachines")
+	}
+	for _, m := range machines.Items {
+		if m.Status.AgentRef != nil && clusterNames.Has(m.Labels[clusterv1.ClusterNameLabel]) {
+			result.Insert(m.Status.AgentRef.Name)
+		}
+	}
+	return result, nil
+}
+
+// playbookDeploymentsByAgent returns the PlaybookDeployments controlled by the PlaybookDeploymentSet by the agent name.
+func (r *PlaybookDeploymentSetReconciler) playbookDeploymentsByAgent(ctx context.Context, pds *infrav1.PlaybookDeploymentSet) (map[string]*infrav1.PlaybookDeployment, error) {
+	list := &infrav1.PlaybookDeploymentList{}
+	listOpts := []client.ListOption{
+		client.InNamespace(pds.Namespace),
+		client.MatchingLabels{infrav1.PlaybookDeploymentSetNameLabelName: pds.Name},
+	}
+	if err := r.Client.List(ctx, list, listOpts...); err != nil {
+		return nil, errors.Wrap(err, "unable to list PlaybookDeployments")
+	}
+	result := make(map[string]*infrav1.PlaybookDeployment, len(list.Items))
+	for i := range list.Items {
+		pd := &list.Items[i]
+		if !metav1.IsControlledBy(pd, pds) || !pd.DeletionTimestamp.IsZero() {
+			continue
+		}
+		result[pd.Spec.AgentRef.Name] = pd
+	}
+	return result, nil
+}
+
+func (r *PlaybookDeploymentSetReconciler) deleteUnselected(ctx context.Context, pdByAgent map[string]*infrav1.PlaybookDeployment, agentNames []string) error {
+	selected := sets.New[string](agentNames...)
+	for agentName, pd := range pdByAgent {
+		if selected.Has(agentName) {
+			continue
+		}
+		r.Log.Info("deleting PlaybookDeployment of the unselected agent", "key", client.ObjectKeyFromObject(pd))
+		if err := r.Client.Delete(ctx, pd); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "unable to delete PlaybookDeployment %s", pd.Name)
+		}
+		delete(pdByAgent, agentName)
+	}
+	return nil
+}
+
+func newSetPlaybookDeployment(pds *infrav1.PlaybookDeploymentSet, agentName string, template *infrav1.PlaybookDeploymentTemplateSpec, revision string) *infrav1.PlaybookDeployment {
+	pdLabels := make(map[string]string, len(template.Labels)+2)
+	for key, value := range template.Labels {
+		pdLabels[key] = value
+	}
+	pdLabels[infrav1.PlaybookDeploymentSetNameLabelName] = pds.Name
+	pdLabels[infrav1.PlaybookAgentNameLabelName] = agentName
+	return &infrav1.PlaybookDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      names.BuildName(pds.Name, "-"+agentName),
+			Namespace: pds.Namespace,
+			Labels:    pdLabels,
+			Annotations: map[string]string{
+				infrav1.PlaybookDeploymentSetRevisionAnnotation: revision,
+			},
+			OwnerReferences: []metav1.OwnerReference{
+				*metav1.NewControllerRef(pds, infrav1.GroupVersion.WithKind("PlaybookDeploymentSet")),
+			},
+		},
+		Spec: infrav1.PlaybookDeploymentSpec{
+			AgentRef: corev1.LocalObjectReference{
+				Name: agentName,
+			},
+			Template:             *template.Template.DeepCopy(),
+			RevisionHistoryLimit: template.RevisionHistoryLimit,
+			Approval:             template.Approval,
+		},
+	}
+}
+
+func (r *PlaybookDeploymentSetReconciler) updatePlaybookDeployment(ctx context.Context, pd *infrav1.PlaybookDeployment, template *infrav1.PlaybookDeploymentTemplateSpec, revision string) error {
+	patchObj := client.MergeFrom(pd.DeepCopy())
+	if pd.Annotations == nil {
+		pd.Annotations = make(map[string]string)
+	}
+	pd.Annotations[infrav1.PlaybookDeploymentSetRevisionAnnotation] = revision
+	pd.Spec.Template = *template.Template.DeepCopy()
+	pd.Spec.RevisionHistoryLimit = template.RevisionHistoryLimit
+	pd.Spec.Approval = template.Approval
+	changed, err := patchutil.HasChanges(patchObj, pd)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !changed {
+		return nil
+	}
+	if err := r.Client.Patch(ctx, pd, patchObj); err != nil {
+		return errors.Wrapf(err, "failed to patch PlaybookDeployment %s", pd.Name)
+	}
+	return nil
+}
+
+// planRollout returns the PlaybookDeployments that can be updated to the revision.
+// The PlaybookDeployments are ordered by the agent name, the first partition of them are not updated.
+// No more than maxUnavailable PlaybookDeployments can be in progress or failed at the same time.
+// The second result is true if the rollout is paused because of the failed PlaybookDeployment.
+func planRollout(pdList []*infrav1.PlaybookDeployment, revision string, maxUnavailable, partition int, pauseOnFailure bool) ([]*infrav1.PlaybookDeployment, bool) {
+	unavailable := 0
+	for _, pd := range pdList {
+		state := playbookDeploymentSetState(pd)
+		if pauseOnFailure && state == pdStateFailed && isPlaybookDeploymentUpdated(pd, revision) {
+			return nil, true
+		}
+		if state != pdStateSucceeded {
+			unavailable++
+		}
+	}
+	result := make([]*infrav1.PlaybookDeployment, 0)
+	for i, pd := range pdList {
+		if i < partition || isPlaybookDeploymentUpdated(pd, revision) {
+			continue
+		}
+		// the PlaybookDeployment that is already unavailable does not affect the availability of the set
+		if playbookDeploymentSetState(pd) != pdStateSucceeded {
+			result = append(result, pd)
+			continue
+		}
+		if unavailable >= maxUnavailable {
+			continue
+		}
+		result = append(result, pd)
+		unavailable++
+	}
+	return result, false
+}
+
+type pdState int
+
+const (
+	pdStateProgressing pdState = iota
+	pdStateSucceeded
+	pdStateFailed
+)
+
+// playbookDeploymentSetState returns the state of the last observed spec of the PlaybookDeployment.
+func playbookDeploymentSetState(pd *infrav1.PlaybookDeployment) pdState {
+	if pd.Status.ObservedGeneration != pd.Generation {
+		return pdStateProgressing
+	}
+	if pd.Status.Phase == infrav1.PlaybookPhaseFailed || pd.Status.ExternalPhase == string(v1alpha1.PlaybookDeploymentFailed) {
+		return pdStateFailed
+	}
+	if conditions.IsTrue(pd, infrav1.SynchronizationCondition) && pd.Status.ExternalPhase == string(v1alpha1.PlaybookDeploymentSucceeded) {
+		return pdStateSucceeded
+	}
+	return pdStateProgressing
+}
+
+func isPlaybookDeploymentUpdated(pd *infrav1.PlaybookDeployment, revision string) bool {
+	return pd.Annotations[infrav1.PlaybookDeploymentSetRevisionAnnotation] == revision
+}
+
+func (r *PlaybookDeploymentSetReconciler) reconcileStatus(pds *infrav1.PlaybookDeploymentSet, agentNames []string, pdByAgent map[string]*infrav1.PlaybookDeployment, pausedOnFailure bool) {
+	revision := pds.Status.Revision
+	var updated, succeeded, failed int32
+	waiting := make([]string, 0)
+	for _, agentName := range agentNames {
+		pd, ok := pdByAgent[agentName]
+		if !ok {
+			waiting = append(waiting, agentName)
+			continue
+		}
+		state := playbookDeploymentSetState(pd)
+		if state == pdStateFailed {
+			failed++
+		}
+		if !isPlaybookDeploymentUpdated(pd, revision) {
+			waiting = append(waiting, agentName)
+			continue
+		}
+		updated++
+		if state == pdStateSucceeded {
+			succeeded++
+		} else {
+			waiting = append(waiting, agentName)
+		}
+	}
+	pds.Status.Agents = int32(len(agentNames))
+	pds.Status.Updated = updated
+	pds.Status.Succeeded = succeeded
+	pds.Status.Failed = failed
+
+	switch {
+	case len(waiting) == 0:
+		conditions.MarkTrue(pds, infrav1.RolloutCompletedCondition)
+	case pds.Spec.Paused:
+		conditions.MarkFalse(pds, infrav1.RolloutCompletedCondition, infrav1.RolloutPausedReason, clusterv1.ConditionSeverityInfo,
+			"the PlaybookDeploymentSet is paused")
+	case pausedOnFailure:
+		conditions.MarkFalse(pds, infrav1.RolloutCompletedCondition, infrav1.RolloutPausedOnFailureReason, clusterv1.ConditionSeverityWarning,
+			"the rollout of revision %s is paused, %d PlaybookDeployments have failed", revision, failed)
+	default:
+		conditions.MarkFalse(pds, infrav1.RolloutCompletedCondition, infrav1.RollingUpdateReason, clusterv1.ConditionSeverityInfo,
+			"waiting for PlaybookDeployments of agents: %s", strings.Join(waiting, ", "))
+	}
+}
+
+func getSetMaxUnavailable(pds *infrav1.PlaybookDeploymentSet, agents int) (int, error) {
+	maxUnavailable := intstr.FromInt(1)
+	if s := pds.Spec.UpdateStrategy; s != nil && s.MaxUnavailable != nil {
+		maxUnavailable = *s.MaxUnavailable
+	}
+	value, err := intstr.GetScaledValueFromIntOrPercent(&maxUnavailable, agents, false)
+	if err != nil {
+		return 0, errors.Wrap(err, "invalid maxUnavailable value")
+	}
+	if value < 1 {
+		value = 1
+	}
+	return value, nil
+}
+
+func getSetPartition(pds *infrav1.PlaybookDeploymentSet) int {
+	if s := pds.Spec.UpdateStrategy; s != nil && s.Partition != nil {
+		return int(*s.Partition)
+	}
+	return 0
+}
+
+func isPauseOnFailure(pds *infrav1.PlaybookDeploymentSet) bool {
+	return pds.Spec.UpdateStrategy != nil && pds.Spec.UpdateStrategy.PauseOnFailure
+}
+
+func patchPlaybookDeploymentSet(ctx context.Context, patchHelper *patch.Helper, pds *infrav1.PlaybookDeploymentSet) error {
+	conditions.SetSummary(pds,
+		conditions.WithConditions(
+			infrav1.RolloutCompletedCondition,
+		),
+	)
+	// Patch the object, ignoring conflicts on the conditions owned by this controller.
+	return patchHelper.Patch(
+		ctx,
+		pds,
+		patch.WithStatusObservedGeneration{},
+		patch.WithOwnedConditions{Conditions: []clusterv1.ConditionType{
+			clusterv1.ReadyCondition,
+			infrav1.RolloutCompletedCondition,
+		}},
+	)
+}
@@ -0,0 +1,253 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func newSetTestPlaybookDeployment(agentName, revision string, state pdState) *infrav1.PlaybookDeployment {
+	pd := &infrav1.PlaybookDeployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "pd-" + agentName,
+			Generation:  1,
+			Annotations: map[string]string{infrav1.PlaybookDeploymentSetRevisionAnnotation: revision},
+		},
+		Spec: infrav1.PlaybookDeploymentSpec{
+			AgentRef: corev1.LocalObjectReference{Name: agentName},
+		},
+		Status: infrav1.PlaybookDeploymentStatus{
+			ObservedGeneration: 1,
+		},
+	}
+	switch state {
+	case pdStateSucceeded:
+		pd.Status.ExternalPhase = "Succeeded"
+		pd.Status.Conditions = clusterv1.Conditions{{Type: infrav1.SynchronizationCondition, Status: corev1.ConditionTrue}}
+	case pdStateFailed:
+		pd.Status.ExternalPhase = "Failed"
+	default:
+		pd.Status.ExternalPhase = "Progressing"
+	}
+	return pd
+}
+
+func TestPlanRollout(t *testing.T) {
+	pdNames := func(pdList []*infrav1.PlaybookDeployment) []string {
+		result := make([]string, 0, len(pdList))
+		for _, pd := range pdList {
+			result = append(result, pd.Spec.AgentRef.Name)
+		}
+		return result
+	}
+	tests := []struct {
+		name           string
+		pdList         []*infrav1.PlaybookDeployment
+		maxUnavailable int
+		partition      int
+		pauseOnFailure bool
+		want           []string
+		wantPaused     bool
+	}{
+		{
+			name: "one at a time",
+			pdList: []*infrav1.PlaybookDeployment{
+				newSetTestPlaybookDeployment("a", "old", pdStateSucceeded),
+				newSetTestPlaybookDeployment("b", "old", pdStateSucceeded),
+				newSetTestPlaybookDeployment("c", "old", pdStateSucceeded),
+			},
+			maxUnavailable: 1,
+			want:           []string{"a"},
+		},
+		{
+			name: "the update in progress is counted",
+			pdList: []*infrav1.PlaybookDeployment{
+				newSetTestPlaybookDeployment("a", "new", pdStateProgressing),
+				newSetTestPlaybookDeployment("b", "old", pdStateSucceeded),
+				newSetTestPlaybookDeployment("c", "old", pdStateSucceeded),
+			},
+			maxUnavailable: 2,
+			want:           []string{"b"},
+		},
+		{
+			name: "unavailable deployments are updated regardless of the budget",
+			pdList: []*infrav1.PlaybookDeployment{
+				newSetTestPlaybookDeployment("a", "new", pdStateProgressing),
+				newSetTestPlaybookDeployment("b", "old", pdStateFailed),
+				newSetTestPlaybookDeployment("c", "old", pdStateSucceeded),
+			},
+			maxUnavailable: 1,
+			want:           []string{"b"},
+		},
+		{
+			name: "partition",
+			pdList: []*infrav1.PlaybookDeployment{
+				newSetTestPlaybookDeployment("a", "old", pdStateSucceeded),
+				newSetTestPlaybookDeployment("b", "old", pdStateSucceeded),
+				newSetTestPlaybookDeployment("c", "old", pdStateSucceeded),
+			},
+			maxUnavailable: 3,
+			partition:      2,
+			want:           []string{"c"},
+		},
+		{
+			name: "pause on failure",
+			pdList: []*infrav1.PlaybookDeployment{
+				newSetTestPlaybookDeployment("a", "new", pdStateFailed),
+				newSetTestPlaybookDeployment("b", "old", pdStateSucceeded),
+			},
+			maxUnavailable: 2,
+			pauseOnFailure: true,
+			want:           []string{},
+			wantPaused:     true,
+		},
+		{
+			name: "failure of the previous revision does not pause the rollout",
+			pdList: []*infrav1.PlaybookDeployment{
+				newSetTestPlaybookDeployment("a", "old", pdStateFailed),
+				newSetTestPlaybookDeployment("b", "old", pdStateSucceeded),
+			},
+			maxUnavailable: 1,
+			pauseOnFailure: true,
+			want:           []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			got, paused := planRollout(tt.pdList, "new", tt.maxUnavailable, tt.partition, tt.pauseOnFailure)
+			g.Expect(paused).To(Equal(tt.wantPaused))
+			g.Expect(pdNames(got)).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestPlaybookDeploymentSetReconcile(t *testing.T) {
+	g := NewWithT(t)
+	ctx := context.Background()
+	scheme := runtime.NewScheme()
+	g.Expect(clientgoscheme.AddToScheme(scheme)).To(Succeed())
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+
+	newAgent := func(name string, agentLabels map[string]string) *infrav1.KubeforceAgent {
+		return &infrav1.KubeforceAgent{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: name, Labels: agentLabels},
+		}
+	}
+	tmpl := &infrav1.PlaybookDeploymentTemplate{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "hardening"},
+		Spec: infrav1.PlaybookDeploymentTemplateSpec{
+			Template: infrav1.PlaybookTemplateSpec{
+				Spec: infrav1.RemotePlaybookSpec{
+					Files:      map[string]string{"site.yaml": "- hosts: all\n"},
+					Entrypoint: "site.yaml",
+				},
+			},
+		},
+	}
+	maxUnavailable := intstr.FromString("50%")
+	pds := &infrav1.PlaybookDeploymentSet{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "hardening", UID: "uid"},
+		Spec: infrav1.PlaybookDeploymentSetSpec{
+			AgentSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"os": "linux"}},
+			TemplateRef:   corev1.LocalObjectReference{Name: "hardening"},
+			UpdateStrategy: &infrav1.PlaybookDeploymentSetUpdateStrategy{
+				MaxUnavailable: &maxUnavailable,
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		newAgent("agent-1", map[string]string{"os": "linux"}),
+		newAgent("agent-2", map[string]string{"os": "linux"}),
+		newAgent("agent-3", map[string]string{"os": "linux"}),
+		newAgent("agent-4", map[string]string{"os": "linux"}),
+		newAgent("other", map[string]string{"os": "windows"}),
+		tmpl, pds,
+	).Build()
+	r := &PlaybookDeploymentSetReconciler{Client: c, Log: logr.Discard()}
+	req := ctrl.Request{NamespacedName: client.ObjectKeyFromObject(pds)}
+	listPlaybookDeployments := func() map[string]*infrav1.PlaybookDeployment {
+		list := &infrav1.PlaybookDeploymentList{}
+		g.Expect(c.List(ctx, list)).To(Succeed())
+		result := make(map[string]*infrav1.PlaybookDeployment)
+		for i := range list.Items {
+			result[list.Items[i].Spec.AgentRef.Name] = &list.Items[i]
+		}
+		return result
+	}
+
+	_, err := r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	pdByAgent := listPlaybookDeployments()
+	g.Expect(pdByAgent).To(HaveLen(4))
+	g.Expect(pdByAgent).NotTo(HaveKey("other"))
+	g.Expect(c.Get(ctx, req.NamespacedName, pds)).To(Succeed())
+	g.Expect(pds.Status.Agents).To(Equal(int32(4)))
+	g.Expect(pds.Status.Updated).To(Equal(int32(4)))
+	g.Expect(pds.Status.Succeeded).To(BeZero())
+	oldRevision := pds.Status.Revision
+
+	// all PlaybookDeployments succeed
+	for _, pd := range pdByAgent {
+		pd.Status = newSetTestPlaybookDeployment(pd.Spec.AgentRef.Name, oldRevision, pdStateSucceeded).Status
+		pd.Status.ObservedGeneration = pd.Generation
+		g.Expect(c.Status().Update(ctx, pd)).To(Succeed())
+	}
+	_, err = r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(c.Get(ctx, req.NamespacedName, pds)).To(Succeed())
+	g.Expect(pds.Status.Succeeded).To(Equal(int32(4)))
+	g.Expect(pds.Status.Conditions).To(ContainElement(HaveField("Type", infrav1.RolloutCompletedCondition)))
+
+	// the new revision is rolled out to the half of the agents
+	tmpl.Spec.Template.Spec.Files["site.yaml"] = "- hosts: all\n  tasks: []\n"
+	g.Expect(c.Update(ctx, tmpl)).To(Succeed())
+	_, err = r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(c.Get(ctx, req.NamespacedName, pds)).To(Succeed())
+	g.Expect(pds.Status.Revision).NotTo(Equal(oldRevision))
+	g.Expect(pds.Status.Updated).To(Equal(int32(2)))
+	pdByAgent = listPlaybookDeployments()
+	g.Expect(pdByAgent["agent-1"].Spec.Template.Spec.Files["site.yaml"]).To(ContainSubstring("tasks"))
+	g.Expect(pdByAgent["agent-2"].Annotations[infrav1.PlaybookDeploymentSetRevisionAnnotation]).To(Equal(pds.Status.Revision))
+	g.Expect(pdByAgent["agent-3"].Annotations[infrav1.PlaybookDeploymentSetRevisionAnnotation]).To(Equal(oldRevision))
+
+	// the PlaybookDeployment of the unselected agent is deleted
+	agent := &infrav1.KubeforceAgent{}
+	g.Expect(c.Get(ctx, client.ObjectKey{Namespace: "default", Name: "agent-4"}, agent)).To(Succeed())
+	agent.Labels["os"] = "windows"
+	g.Expect(c.Update(ctx, agent)).To(Succeed())
+	_, err = r.Reconcile(ctx, req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(listPlaybookDeployments()).NotTo(HaveKey("agent-4"))
+}
@@ -156,6 +156,13 @@ func setupReconcilers(ctx context.Context, mgr ctrl.Manager) {
 		os.Exit(1)
 	}
 	storage := repository.NewStorage(logger.WithName("storage"), "/var/lib/kubeforce/storage")
+	if err := mgr.Add(&repository.DirsCollector{
+		Storage: storage,
+		Log:     logger.WithName("storage.collector"),
+	}); err != nil {
+		setupLog.Error(err, "unable to add the collector of the storage directories")
+		os.Exit(1)
+	}
 	if err = (&agentctrl.CacheReconciler{
 		Client:      mgr.GetClient(),
 		ClientCache: agentClientCache,
@@ -200,8 +207,9 @@ func setupReconcilers(ctx context.Context, mgr ctrl.Manager) {
 		os.Exit(1)
 	}
 	templateReconciler := playbook.TemplateReconciler{
-		Client: mgr.GetClient(),
-		Log:    logger.WithName("playbook-template-reconculer"),
+		Client:  mgr.GetClient(),
+		Log:     logger.WithName("playbook-template-reconculer"),
+		Storage: storage,
 	}
 	if err = (&controllers.KubeforceMachineReconciler{
 		TemplateReconciler: templateReconciler,
@@ -215,6 +223,7 @@ func setupReconcilers(ctx context.Context, mgr ctrl.Manager) {
 	}
 	if err = (&controllers.PlaybookReconciler{
 		Client:           mgr.GetClient(),
+		Storage:          storage,
 		Log:              logger.WithName("playbook-controller"),
 		AgentClientCache: agentClientCache,
 	}).SetupWithManager(mgr); err != nil {
@@ -223,10 +232,27 @@ func setupReconcilers(ctx context.Context, mgr ctrl.Manager) {
 	}
 	if err = (&controllers.PlaybookDeploymentReconciler{
 		Client:           mgr.GetClient(),
+		Storage:          storage,
 		Log:              logger.WithName("playbookdeployment-controller"),
 		AgentClientCache: agentClientCache,
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PlaybookDeployment")
 		os.Exit(1)
 	}
+	if err = (&controllers.PlaybookDeploymentSetReconciler{
+		Client:  mgr.GetClient(),
+		Log:     logger.WithName("playbookdeploymentset-controller"),
+		Storage: storage,
+	}).SetupWithManager(mgr, controller.Options{}); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "PlaybookDeploymentSet")
+		os.Exit(1)
+	}
+	if err = (&controllers.ClusterPlaybookRunReconciler{
+		Client:             mgr.GetClient(),
+		Log:                logger.WithName("clusterplaybookrun-controller"),
+		TemplateReconciler: templateReconciler,
+	}).SetupWithManager(mgr, controller.Options{}); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterPlaybookRun")
+		os.Exit(1)
+	}
 }
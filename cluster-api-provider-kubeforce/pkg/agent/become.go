@@ -0,0 +1,204 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/secret"
+)
+
+// sudoPrompt is the password prompt of sudo, it is set explicitly to be recognized regardless of the locale.
+const sudoPrompt = "[kubeforce] password: "
+
+var (
+	sudoPromptRegexp     = regexp.MustCompile(regexp.QuoteMeta(strings.TrimSpace(sudoPrompt)) + `\s*$`)
+	passwordPromptRegexp = regexp.MustCompile(`(?i)password[^\n]*:\s*$`)
+
+	// errBecomePassword is returned when the password for the privilege escalation is rejected.
+	errBecomePassword = errors.New("the password for the privilege escalation is incorrect")
+)
+
+// getBecomeMethod returns the privilege escalation method of the agent with the default applied.
+func (h *Helper) getBecomeMethod() infrav1.BecomeMethod {
+	become := h.agent.Spec.SSH.Become
+	if become == nil || become.Method == "" {
+		return infrav1.BecomeMethodSudo
+	}
+	return become.Method
+}
+
+// becomeCommand wraps the command to run it with the escalated privileges.
+func (h *Helper) becomeCommand(cmd string) (string, error) {
+	switch method := h.getBecomeMethod(); method {
+	case infrav1.BecomeMethodSudo:
+		if h.agent.Spec.SSH.Become == nil {
+			return "sudo " + cmd, nil
+		}
+		return "sudo -p " + shellQuote(sudoPrompt) + " " + cmd, nil
+	case infrav1.BecomeMethodSu:
+		return "su -c " + shellQuote(cmd), nil
+	case infrav1.BecomeMethodDoas:
+		return "doas " + cmd, nil
+	case infrav1.BecomeMethodNone:
+		return cmd, nil
+	default:
+		return "", errors.Errorf("unsupported become method %q", method)
+	}
+}
+
+// becomePromptRegexp returns the regexp of the password prompt of the privilege escalation method.
+func (h *Helper) becomePromptRegexp() *regexp.Regexp {
+	if h.getBecomeMethod() == infrav1.BecomeMethodSudo {
+		return sudoPromptRegexp
+	}
+	return passwordPromptRegexp
+}
+
+// getBecomePassword returns the password for the privilege escalation or nil if it is not configured.
+func (h *Helper) getBecomePassword(ctx context.Context) ([]byte, error) {
+	become := h.agent.Spec.SSH.Become
+	if become == nil || (become.PasswordSecretName == "" && become.PasswordKey == "") ||
+		become.Method == infrav1.BecomeMethodNone {
+		return nil, nil
+	}
+	key := types.NamespacedName{
+		Namespace: h.agent.Namespace,
+		Name:      become.PasswordSecretName,
+	}
+	if key.Name == "" {
+		key.Name = h.agent.Spec.SSH.SecretName
+	}
+	field := become.PasswordKey
+	if field == "" {
+		field = secret.BecomePassword
+	}
+	s := &corev1.Secret{}
+	if err := h.client.Get(ctx, key, s); err != nil {
+		return nil, err
+	}
+	password := s.Data[field]
+	if len(password) == 0 {
+		return nil, errors.Errorf("field %q is required for secret %v", field, key)
+	}
+	return password, nil
+}
+
+// remotePath returns the path of the uploaded file on the host.
+func (h *Helper) remotePath(name string) string {
+	if h.agent.Spec.SSH.UploadDir == "" {
+		return name
+	}
+	return path.Join(h.agent.Spec.SSH.UploadDir, name)
+}
+
+// inUploadDir changes the working directory of the command to the upload directory.
+func (h *Helper) inUploadDir(cmd string) string {
+	if h.agent.Spec.SSH.UploadDir == "" {
+		return cmd
+	}
+	return "cd " + shellQuote(h.agent.Spec.SSH.UploadDir) + " && " + cmd
+}
+
+// shellQuote quotes the string for the POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// maxPromptLength is the length of the output tail that is matched with the password prompt.
+const maxPromptLength = 256
+
+// passwordResponder writes the password to the stdin of the command when the command prompts for it.
+// The terminal echo is disabled, so the password never gets to the output.
+type passwordResponder struct {
+	mu       sync.Mutex
+	out      *bytes.Buffer
+	prompt   *regexp.Regexp
+	password []byte
+	stdin    io.Writer
+	// onRejected is called when the command prompts for the password again.
+	onRejected func()
+	// uniquePrompt is true if the prompt can not be printed by the command itself.
+	// Otherwise, the output is not matched with the prompt after the command prints the first line,
+	// because the prompt of su or doas may be a part of the command output.
+	uniquePrompt bool
+	answered     bool
+	rejected     bool
+	// stopped is true if the output is not matched with the prompt anymore.
+	stopped bool
+	tail    []byte
+}
+
+func (r *passwordResponder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.out.Write(p)
+	if r.rejected || r.stopped {
+		return len(p), nil
+	}
+	r.tail = append(r.tail, p...)
+	if r.answered && !r.uniquePrompt && hasOutputLine(r.tail) {
+		r.stopped = true
+		r.tail = nil
+		return len(p), nil
+	}
+	if len(r.tail) > maxPromptLength {
+		r.tail = r.tail[len(r.tail)-maxPromptLength:]
+	}
+	if !r.prompt.Match(r.tail) {
+		return len(p), nil
+	}
+	r.tail = r.tail[:0]
+	if r.answered {
+		r.rejected = true
+		r.onRejected()
+		return len(p), nil
+	}
+	r.answered = true
+	if _, err := r.stdin.Write(append(append([]byte{}, r.password...), '\n')); err != nil {
+		return 0, errors.Wrap(err, "unable to write the password")
+	}
+	return len(p), nil
+}
+
+// hasOutputLine returns true if the output contains the complete line that is not empty.
+func hasOutputLine(out []byte) bool {
+	lines := bytes.Split(out, []byte("\n"))
+	for _, line := range lines[:len(lines)-1] {
+		if len(bytes.TrimSpace(line)) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *passwordResponder) isRejected() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.rejected
+}
@@ -0,0 +1,199 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/secret"
+)
+
+func TestBecomeCommand(t *testing.T) {
+	tests := []struct {
+		name      string
+		ssh       infrav1.SSHParams
+		want      string
+		wantInDir string
+	}{
+		{
+			name:      "passwordless sudo by default",
+			want:      "sudo ./agent init",
+			wantInDir: "sudo ./agent init",
+		},
+		{
+			name:      "sudo with the prompt",
+			ssh:       infrav1.SSHParams{Become: &infrav1.BecomeParams{Method: infrav1.BecomeMethodSudo}},
+			want:      "sudo -p '[kubeforce] password: ' ./agent init",
+			wantInDir: "sudo -p '[kubeforce] password: ' ./agent init",
+		},
+		{
+			name:      "su",
+			ssh:       infrav1.SSHParams{Become: &infrav1.BecomeParams{Method: infrav1.BecomeMethodSu}},
+			want:      "su -c './agent init'",
+			wantInDir: "su -c './agent init'",
+		},
+		{
+			name:      "doas in the upload directory",
+			ssh:       infrav1.SSHParams{Become: &infrav1.BecomeParams{Method: infrav1.BecomeMethodDoas}, UploadDir: "/opt/it's"},
+			want:      "doas ./agent init",
+			wantInDir: `cd '/opt/it'\''s' && doas ./agent init`,
+		},
+		{
+			name:      "none",
+			ssh:       infrav1.SSHParams{Become: &infrav1.BecomeParams{Method: infrav1.BecomeMethodNone}},
+			want:      "./agent init",
+			wantInDir: "./agent init",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			h := &Helper{agent: &infrav1.KubeforceAgent{Spec: infrav1.KubeforceAgentSpec{SSH: tt.ssh}}}
+			got, err := h.becomeCommand("./agent init")
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+			g.Expect(h.inUploadDir(got)).To(Equal(tt.wantInDir))
+		})
+	}
+}
+
+func TestGetBecomePassword(t *testing.T) {
+	sshSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "ssh", Namespace: "default"},
+		Data: map[string][]byte{
+			secret.SSHAuthPassword: []byte("ssh"),
+			secret.BecomePassword:  []byte("default"),
+			"sudo":                 []byte("custom"),
+		},
+	}
+	tests := []struct {
+		name    string
+		become  *infrav1.BecomeParams
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "not configured",
+		},
+		{
+			name:   "method without the password",
+			become: &infrav1.BecomeParams{Method: infrav1.BecomeMethodSudo},
+		},
+		{
+			name:   "default key",
+			become: &infrav1.BecomeParams{PasswordSecretName: "ssh"},
+			want:   []byte("default"),
+		},
+		{
+			name:   "key of the ssh secret",
+			become: &infrav1.BecomeParams{PasswordKey: "sudo"},
+			want:   []byte("custom"),
+		},
+		{
+			name:    "missing key",
+			become:  &infrav1.BecomeParams{PasswordKey: "doas"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			kfAgent := &infrav1.KubeforceAgent{
+				ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "default"},
+				Spec: infrav1.KubeforceAgentSpec{
+					SSH: infrav1.SSHParams{SecretName: "ssh", Become: tt.become},
+				},
+			}
+			h := &Helper{client: fake.NewClientBuilder().WithObjects(sshSecret).Build(), agent: kfAgent}
+			got, err := h.getBecomePassword(context.Background())
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestPasswordResponder(t *testing.T) {
+	tests := []struct {
+		name         string
+		prompt       *regexp.Regexp
+		uniquePrompt bool
+		output       []string
+		wantRejected bool
+	}{
+		{
+			name:   "accepted",
+			prompt: passwordPromptRegexp,
+			output: []string{"Pass", "word: ", "\r\ninstalled\r\n"},
+		},
+		{
+			name:         "rejected",
+			prompt:       passwordPromptRegexp,
+			output:       []string{"Password: ", "\r\nPassword: "},
+			wantRejected: true,
+		},
+		{
+			name:   "prompt in the output of the command",
+			prompt: passwordPromptRegexp,
+			output: []string{"Password: ", "\r\ninstalled\r\n", "New password: "},
+		},
+		{
+			name:         "sudo rejected after the output",
+			prompt:       sudoPromptRegexp,
+			uniquePrompt: true,
+			output:       []string{sudoPrompt, "\r\nSorry, try again.\r\n", sudoPrompt},
+			wantRejected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			out := new(bytes.Buffer)
+			stdin := new(bytes.Buffer)
+			rejected := false
+			r := &passwordResponder{
+				out:          out,
+				prompt:       tt.prompt,
+				password:     []byte("secret"),
+				stdin:        stdin,
+				onRejected:   func() { rejected = true },
+				uniquePrompt: tt.uniquePrompt,
+			}
+			for _, o := range tt.output {
+				_, err := r.Write([]byte(o))
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+			g.Expect(stdin.String()).To(Equal("secret\n"))
+			g.Expect(r.isRejected()).To(Equal(tt.wantRejected))
+			g.Expect(rejected).To(Equal(tt.wantRejected))
+			g.Expect(out.String()).To(Equal(strings.Join(tt.output, "")))
+		})
+	}
+}
@@ -42,7 +42,7 @@ func NewClientConfigByAddress(keys *Keys, addresses infrav1.Addresses) (*restcli
 
 // GetServer returns http url for address.
 func GetServer(addresses infrav1.Addresses) (string, error) {
-	address := stringutil.Find(stringutil.IsNotEmpty, addresses.ExternalDNS, addresses.ExternalIP)
+	address := stringutil.Find(stringutil.IsNotEmpty, addresses.ExternalDNS, addresses.ExternalIP, addresses.ExternalIPv6)
 	if address == "" {
 		return "", errors.Errorf("not found external address")
 	}
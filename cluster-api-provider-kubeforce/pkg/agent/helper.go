@@ -19,7 +19,10 @@ package agent
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path"
@@ -40,6 +43,7 @@ import (
 
 	"k3f.io/kubeforce/agent/pkg/config"
 	configutils "k3f.io/kubeforce/agent/pkg/config/utils"
+	agentclientset "k3f.io/kubeforce/agent/pkg/generated/clientset/versioned"
 	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
 	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/repository"
 	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/secret"
@@ -87,15 +91,7 @@ func (h *Helper) getAgentFilepath(ctx context.Context) (string, error) {
 	if h.agent.Spec.Source == nil || h.agent.Spec.Source.RepoRef == nil {
 		return "", errors.Errorf("source is not specified for the agent %v", client.ObjectKeyFromObject(h.agent))
 	}
-	repo := &infrav1.HTTPRepository{}
-	key := client.ObjectKey{
-		Namespace: h.agent.Spec.Source.RepoRef.Namespace,
-		Name:      h.agent.Spec.Source.RepoRef.Name,
-	}
-	if key.Namespace == "" {
-		key.Namespace = h.agent.Namespace
-	}
-	err := h.client.Get(ctx, key, repo)
+	repo, err := h.getRepository(ctx, *h.agent.Spec.Source.RepoRef)
 	if err != nil {
 		return "", err
 	}
@@ -113,7 +109,39 @@ func (h *Helper) getAgentFilepath(ctx context.Context) (string, error) {
 	return f.Path, nil
 }
 
+func (h *Helper) getRepository(ctx context.Context, ref infrav1.RepositoryReference) (*infrav1.HTTPRepository, error) {
+	repo := &infrav1.HTTPRepository{}
+	key := client.ObjectKey{
+		Namespace: ref.Namespace,
+		Name:      ref.Name,
+	}
+	if key.Namespace == "" {
+		key.Namespace = h.agent.Namespace
+	}
+	if err := h.client.Get(ctx, key, repo); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// prepareUploadDir creates the upload directory on the host if it is specified.
+func (h *Helper) prepareUploadDir(ctx context.Context, sshClient *ssh.Client) error {
+	if h.agent.Spec.SSH.UploadDir == "" {
+		return nil
+	}
+	ctx, cancelFunc := context.WithTimeout(ctx, time.Minute)
+	defer cancelFunc()
+	cmd := "mkdir -p -m 0700 " + shellQuote(h.agent.Spec.SSH.UploadDir)
+	if out, err := h.runCommand(ctx, sshClient, cmd); err != nil {
+		return errors.Wrapf(err, "unable to create the upload directory, output: %q", out)
+	}
+	return nil
+}
+
 func (h *Helper) copyAgent(ctx context.Context, sshClient *ssh.Client) error {
+	if err := h.prepareUploadDir(ctx, sshClient); err != nil {
+		return err
+	}
 	scpClient, err := scp.NewClientBySSH(sshClient)
 	if err != nil {
 		return err
@@ -130,7 +158,7 @@ func (h *Helper) copyAgent(ctx context.Context, sshClient *ssh.Client) error {
 	defer agentFile.Close()
 	ctx, cancelFunc := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancelFunc()
-	err = scpClient.CopyFromFile(ctx, *agentFile, "agent", "0777")
+	err = scpClient.CopyFromFile(ctx, *agentFile, h.remotePath("agent"), "0777")
 	if err != nil {
 		return errors.Wrap(err, "unable to copy the agent binary to remote machine via ssh")
 	}
@@ -149,7 +177,7 @@ func (h *Helper) copyAgentConfig(ctx context.Context, sshClient *ssh.Client) err
 	}
 	ctx, cancelFunc := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancelFunc()
-	err = scpClient.Copy(ctx, bytes.NewReader(cfg), "config.yaml", "0600", int64(len(cfg)))
+	err = scpClient.Copy(ctx, bytes.NewReader(cfg), h.remotePath("config.yaml"), "0600", int64(len(cfg)))
 	if err != nil {
 		return errors.Wrap(err, "unable to copy the agent configuration to remote machine via ssh")
 	}
@@ -169,7 +197,7 @@ func (h *Helper) copyAgentClientConfig(ctx context.Context, sshClient *ssh.Clien
 	}
 	ctx, cancelFunc := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancelFunc()
-	err = scpClient.Copy(ctx, bytes.NewReader(content), "agent-kubeconfig.yaml", "0600", int64(len(content)))
+	err = scpClient.Copy(ctx, bytes.NewReader(content), h.remotePath("agent-kubeconfig.yaml"), "0600", int64(len(content)))
 	if err != nil {
 		return errors.Wrap(err, "unable to copy kubeconfig for the agent to remote machine via ssh")
 	}
@@ -195,8 +223,12 @@ func (h *Helper) Install(ctx context.Context) error {
 	}
 	ctxTimeout, cancelFunc := context.WithTimeout(ctx, time.Minute)
 	defer cancelFunc()
-	cmd := "sudo ./agent init --config config.yaml && rm agent config.yaml"
-	if out, err := h.runCommand(ctxTimeout, sshClient, cmd); err != nil {
+	cmd, err := h.becomeCommand("./agent init --config config.yaml --admin-kubeconfig agent-kubeconfig.yaml")
+	if err != nil {
+		return err
+	}
+	cmd = h.inUploadDir(cmd + " && rm agent config.yaml")
+	if out, err := h.runBecomeCommand(ctxTimeout, sshClient, cmd); err != nil {
 		msg := fmt.Sprintf("unable to install agent, command: %q", cmd)
 		ctrl.LoggerFrom(ctx).Error(err, msg, "out", out)
 		return errors.Wrap(err, msg)
@@ -204,8 +236,127 @@ func (h *Helper) Install(ctx context.Context) error {
 	return nil
 }
 
+// Upgrade uploads the agent binary from the agent source to the running agent.
+// The agent replaces its binary and restarts itself, it rolls back if the new version is not ready within the timeout.
+func (h *Helper) Upgrade(ctx context.Context, clientset *agentclientset.Clientset, timeout time.Duration) error {
+	agentPath, err := h.getAgentFilepath(ctx)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(filepath.Clean(agentPath))
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(data)
+	ctx, cancelFunc := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancelFunc()
+	if err := clientset.Upgrade(ctx, data, "sha256:"+hex.EncodeToString(checksum[:]), timeout); err != nil {
+		return errors.Wrap(err, "unable to upgrade the agent")
+	}
+	return nil
+}
+
+// UploadAnsibleBundle downloads the wheel bundle of the ansible-core version from the bundle source
+// and uploads it to the agent for the offline installation.
+func (h *Helper) UploadAnsibleBundle(ctx context.Context, clientset *agentclientset.Clientset, version string) error {
+	if !IsAnsibleBundleRequired(h.agent) {
+		return errors.Errorf("bundle source is not specified for the agent %v", client.ObjectKeyFromObject(h.agent))
+	}
+	source := h.agent.Spec.Config.Ansible.BundleSource
+	repo, err := h.getRepository(ctx, source.RepoRef)
+	if err != nil {
+		return err
+	}
+	cfg := h.ansibleConfig()
+	fileName := config.AnsibleBundleFileName(version)
+	f, err := h.storage.GetHTTPFileGetter(*repo).GetFile(ctx, path.Join(source.Path, fileName))
+	if err != nil {
+		return err
+	}
+	bundle, err := os.Open(filepath.Clean(f.Path))
+	if err != nil {
+		return err
+	}
+	defer bundle.Close()
+	ctx, cancelFunc := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancelFunc()
+	if err := clientset.Upload(ctx, cfg.GetBundlePath(version), bundle, nil); err != nil {
+		return errors.Wrapf(err, "unable to upload the ansible bundle %s", fileName)
+	}
+	return nil
+}
+
+// IsAnsibleBundleRequired returns true if the ansible bundle has to be uploaded to the agent from the bundle source.
+func IsAnsibleBundleRequired(kfAgent *infrav1.KubeforceAgent) bool {
+	runtime := kfAgent.Spec.Config.Ansible
+	return runtime != nil && runtime.Offline && runtime.BundleSource != nil
+}
+
+// DefaultAnsibleVersion returns the version of ansible-core for the playbooks of the agent that do not specify it.
+func DefaultAnsibleVersion(kfAgent *infrav1.KubeforceAgent) string {
+	cfg := config.AnsibleConfig{}
+	if kfAgent.Spec.Config.Ansible != nil {
+		cfg.Version = kfAgent.Spec.Config.Ansible.Version
+	}
+	return cfg.GetVersion()
+}
+
+// AnsibleBundleFileName returns the file name of the ansible bundle of the ansible-core version.
+func AnsibleBundleFileName(version string) string {
+	return config.AnsibleBundleFileName(version)
+}
+
+// getAgentChecksum returns the checksum of the agent binary from the agent source in the format sha256:<hex>.
+func (h *Helper) getAgentChecksum(ctx context.Context) (string, error) {
+	agentPath, err := h.getAgentFilepath(ctx)
+	if err != nil {
+		return "", err
+	}
+	f, err := os.Open(filepath.Clean(agentPath))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// UpgradeBySSH copies the agent binary from the agent source to the host via ssh and upgrades the agent.
+func (h *Helper) UpgradeBySSH(ctx context.Context, timeout time.Duration) error {
+	sshClient, err := h.getSSHClient(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to get ssh client")
+	}
+	defer sshClient.Close()
+
+	if err := h.copyAgent(ctx, sshClient); err != nil {
+		return err
+	}
+	checksum, err := h.getAgentChecksum(ctx)
+	if err != nil {
+		return err
+	}
+	ctxTimeout, cancelFunc := context.WithTimeout(ctx, timeout+time.Minute)
+	defer cancelFunc()
+	cmd, err := h.becomeCommand(fmt.Sprintf("./agent upgrade --file agent --checksum %s --timeout %s", checksum, timeout))
+	if err != nil {
+		return err
+	}
+	cmd = h.inUploadDir(cmd + "; code=$?; rm agent; exit $code")
+	if out, err := h.runBecomeCommand(ctxTimeout, sshClient, cmd); err != nil {
+		msg := fmt.Sprintf("unable to upgrade agent, command: %q", cmd)
+		ctrl.LoggerFrom(ctx).Error(err, msg, "out", out)
+		return errors.Wrap(err, msg)
+	}
+	return nil
+}
+
 func (h *Helper) getSSHClient(ctx context.Context) (*ssh.Client, error) {
-	host := stringutil.Find(stringutil.IsNotEmpty, h.agent.Spec.Addresses.ExternalDNS, h.agent.Spec.Addresses.ExternalIP)
+	host := stringutil.Find(stringutil.IsNotEmpty, h.agent.Spec.Addresses.ExternalDNS, h.agent.Spec.Addresses.ExternalIP,
+		h.agent.Spec.Addresses.ExternalIPv6)
 	if host == "" {
 		return nil, errors.Errorf("unable to find host address for agent %s", h.agent.Name)
 	}
@@ -216,16 +367,98 @@ func (h *Helper) getSSHClient(ctx context.Context) (*ssh.Client, error) {
 		h.agent.Spec.SSH.Port = 22
 	}
 	addr := net.JoinHostPort(host, strconv.Itoa(h.agent.Spec.SSH.Port))
-	conn, err := net.DialTimeout("tcp", addr, 15*time.Second)
+	sshConfig, err := h.GetSSHConfig(ctx)
 	if err != nil {
 		return nil, err
 	}
-	sshConfig, err := h.GetSSHConfig(ctx)
+	jumpClients, err := h.getJumpHostClients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	closeJumpClients := func() {
+		for i := len(jumpClients) - 1; i >= 0; i-- {
+			jumpClients[i].Close()
+		}
+	}
+	conn, err := dialSSH(jumpClients, addr)
+	if err != nil {
+		closeJumpClients()
+		return nil, err
+	}
+	sshClient, err := newSSHClient(conn, addr, sshConfig)
 	if err != nil {
+		closeJumpClients()
 		return nil, err
 	}
+	if len(jumpClients) > 0 {
+		go func() {
+			_ = sshClient.Wait()
+			closeJumpClients()
+		}()
+	}
+	return sshClient, nil
+}
+
+// getJumpHostClients connects to the jump hosts in the order of the connection.
+func (h *Helper) getJumpHostClients(ctx context.Context) ([]*ssh.Client, error) {
+	clients := make([]*ssh.Client, 0, len(h.agent.Spec.SSH.ProxyJump))
+	closeClients := func() {
+		for i := len(clients) - 1; i >= 0; i-- {
+			clients[i].Close()
+		}
+	}
+	for _, jumpHost := range h.agent.Spec.SSH.ProxyJump {
+		if jumpHost.Port < 0 {
+			closeClients()
+			return nil, errors.Errorf("port of jump host %s can not be negative. port: %d", jumpHost.Host, jumpHost.Port)
+		}
+		port := jumpHost.Port
+		if port == 0 {
+			port = 22
+		}
+		addr := net.JoinHostPort(jumpHost.Host, strconv.Itoa(port))
+		config, err := h.getJumpHostSSHConfig(ctx, jumpHost, addr)
+		if err != nil {
+			closeClients()
+			return nil, errors.WithMessagef(err, "jump host %s", addr)
+		}
+		conn, err := dialSSH(clients, addr)
+		if err != nil {
+			closeClients()
+			return nil, errors.WithMessagef(err, "unable to connect to jump host %s", addr)
+		}
+		c, err := newSSHClient(conn, addr, config)
+		if err != nil {
+			closeClients()
+			return nil, errors.WithMessagef(err, "unable to connect to jump host %s", addr)
+		}
+		clients = append(clients, c)
+	}
+	return clients, nil
+}
+
+// dialSSH dials the address through the last jump host or directly if there are no jump hosts.
+func dialSSH(jumpClients []*ssh.Client, addr string) (net.Conn, error) {
+	if len(jumpClients) == 0 {
+		return net.DialTimeout("tcp", addr, 15*time.Second)
+	}
+	return jumpClients[len(jumpClients)-1].Dial("tcp", addr)
+}
+
+func newSSHClient(conn net.Conn, addr string, sshConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	// the ssh handshake does not keep the type of the host key error
+	var hostKeyErr error
+	hostKeyCallback := sshConfig.HostKeyCallback
+	sshConfig.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		hostKeyErr = hostKeyCallback(hostname, remote, key)
+		return hostKeyErr
+	}
 	sshCon, chans, reqs, err := ssh.NewClientConn(conn, addr, sshConfig)
 	if err != nil {
+		conn.Close()
+		if hostKeyErr != nil {
+			return nil, hostKeyErr
+		}
 		return nil, err
 	}
 	return ssh.NewClient(sshCon, chans, reqs), nil
@@ -233,9 +466,13 @@ func (h *Helper) getSSHClient(ctx context.Context) (*ssh.Client, error) {
 
 // GetSSHAuthMethod returns ssh authentication method for the KubeforceAgent.
 func (h *Helper) GetSSHAuthMethod(ctx context.Context) (ssh.AuthMethod, error) {
+	return h.getSSHAuthMethod(ctx, h.agent.Spec.SSH.SecretName)
+}
+
+func (h *Helper) getSSHAuthMethod(ctx context.Context, secretName string) (ssh.AuthMethod, error) {
 	key := types.NamespacedName{
 		Namespace: h.agent.Namespace,
-		Name:      h.agent.Spec.SSH.SecretName,
+		Name:      secretName,
 	}
 	s := &corev1.Secret{}
 	err := h.client.Get(ctx, key, s)
@@ -274,19 +511,49 @@ func (h *Helper) GetSSHConfig(ctx context.Context) (*ssh.ClientConfig, error) {
 	if h.agent.Spec.SSH.Username == "" {
 		return nil, errors.Errorf("user for ssh connection is not defined")
 	}
+	verifier := h.agentHostKeyVerifier()
+	hostKeyCallback, err := h.hostKeyCallback(ctx, verifier)
+	if err != nil {
+		return nil, err
+	}
 
 	conf := &ssh.ClientConfig{
 		User: h.agent.Spec.SSH.Username,
 		Auth: []ssh.AuthMethod{
 			authMethod,
 		},
-		Timeout: 15 * time.Second,
-		//nolint:gosec
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		Timeout:           15 * time.Second,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: verifier.hostKeyAlgorithms(),
 	}
 	return conf, nil
 }
 
+// getJumpHostSSHConfig returns ClientConfig to connect to the jump host.
+func (h *Helper) getJumpHostSSHConfig(ctx context.Context, jumpHost infrav1.SSHJumpHost, addr string) (*ssh.ClientConfig, error) {
+	authMethod, err := h.getSSHAuthMethod(ctx, jumpHost.SecretName)
+	if err != nil {
+		return nil, err
+	}
+	if jumpHost.Username == "" {
+		return nil, errors.Errorf("user for ssh connection is not defined")
+	}
+	verifier := h.jumpHostKeyVerifier(jumpHost, addr)
+	hostKeyCallback, err := h.hostKeyCallback(ctx, verifier)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ClientConfig{
+		User: jumpHost.Username,
+		Auth: []ssh.AuthMethod{
+			authMethod,
+		},
+		Timeout:           15 * time.Second,
+		HostKeyCallback:   hostKeyCallback,
+		HostKeyAlgorithms: verifier.hostKeyAlgorithms(),
+	}, nil
+}
+
 const (
 	term  = "unknown"
 	termH = 40
@@ -302,6 +569,19 @@ var (
 )
 
 func (h *Helper) runCommand(ctx context.Context, client *ssh.Client, cmd string) (string, error) {
+	return h.runSession(ctx, client, cmd, nil)
+}
+
+// runBecomeCommand runs the command that escalates the privileges and answers the password prompt.
+func (h *Helper) runBecomeCommand(ctx context.Context, client *ssh.Client, cmd string) (string, error) {
+	password, err := h.getBecomePassword(ctx)
+	if err != nil {
+		return "", errors.Wrap(err, "unable to get the password for the privilege escalation")
+	}
+	return h.runSession(ctx, client, cmd, password)
+}
+
+func (h *Helper) runSession(ctx context.Context, client *ssh.Client, cmd string, password []byte) (string, error) {
 	log := ctrl.LoggerFrom(ctx)
 	log.Info("execution command", "cmd", cmd)
 
@@ -319,6 +599,25 @@ func (h *Helper) runCommand(ctx context.Context, client *ssh.Client, cmd string)
 	out := new(bytes.Buffer)
 	session.Stdout = out
 	session.Stderr = out
+	var responder *passwordResponder
+	if len(password) > 0 {
+		stdin, err := session.StdinPipe()
+		if err != nil {
+			return "", err
+		}
+		responder = &passwordResponder{
+			out:      out,
+			prompt:   h.becomePromptRegexp(),
+			password: password,
+			stdin:    stdin,
+			onRejected: func() {
+				_ = session.Close()
+			},
+			uniquePrompt: h.getBecomeMethod() == infrav1.BecomeMethodSudo,
+		}
+		session.Stdout = responder
+		session.Stderr = responder
+	}
 
 	exit := make(chan struct{}, 1)
 	defer close(exit)
@@ -333,6 +632,10 @@ func (h *Helper) runCommand(ctx context.Context, client *ssh.Client, cmd string)
 	}()
 
 	err = session.Run(cmd)
+	if responder != nil && responder.isRejected() {
+		log.Error(errBecomePassword, "Command failed", "cmd", cmd)
+		return out.String(), errBecomePassword
+	}
 	if err != nil {
 		switch err.(type) {
 		case *ssh.ExitError:
@@ -349,6 +652,9 @@ func (h *Helper) runCommand(ctx context.Context, client *ssh.Client, cmd string)
 	return out.String(), nil
 }
 
+// agentPlaybookPath is the directory of the playbooks on the agent host.
+const agentPlaybookPath = "/var/lib/kubeforce/playbooks"
+
 func (h *Helper) agentConfig() ([]byte, error) {
 	cfg := &config.Config{
 		Spec: config.ConfigSpec{
@@ -371,9 +677,40 @@ func (h *Helper) agentConfig() ([]byte, error) {
 				CertsDir:         "/etc/kubeforce/etcd/certs",
 				ListenPeerURLs:   "https://127.0.0.1:3380",
 				ListenClientURLs: "https://127.0.0.1:3379",
+				Maintenance: &config.EtcdMaintenance{
+					SnapshotInterval: &metav1.Duration{
+						Duration: time.Hour,
+					},
+					SnapshotDir: "/var/lib/kubeforce/etcd-snapshots",
+				},
+			},
+			LocalSocket: &config.LocalSocketConfig{
+				Path: config.DefaultLocalSocketPath,
 			},
-			PlaybookPath: "/var/lib/kubeforce/playbooks",
+			PlaybookPath: agentPlaybookPath,
 		},
 	}
+	if h.agent.Spec.Addresses.ExternalIPv6 != "" || h.agent.Spec.Addresses.InternalIPv6 != "" {
+		// serve on all IPv4 and IPv6 addresses of the dual-stack host
+		cfg.Spec.BindAddresses = []string{"::"}
+	}
+	cfg.Spec.Ansible = h.ansibleConfig()
+	if encryption := h.agent.Spec.Config.Encryption; encryption != nil {
+		cfg.Spec.Encryption = &config.EncryptionConfig{
+			Provider: config.EncryptionProvider(encryption.Provider),
+		}
+	}
 	return configutils.Marshal(cfg)
 }
+
+// ansibleConfig returns the configuration of the managed ansible runtime of the agent.
+func (h *Helper) ansibleConfig() *config.AnsibleConfig {
+	runtime := h.agent.Spec.Config.Ansible
+	if runtime == nil {
+		return nil
+	}
+	return &config.AnsibleConfig{
+		Version: runtime.Version,
+		Offline: runtime.Offline,
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	"k3f.io/kubeforce/agent/pkg/config"
+	agentclientset "k3f.io/kubeforce/agent/pkg/generated/clientset/versioned"
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/repository"
+)
+
+func TestUploadAnsibleBundle(t *testing.T) {
+	g := NewWithT(t)
+	var lock sync.Mutex
+	uploaded := make(map[string]string)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bundles/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bundles/ansible-core-2.15.0.tar.gz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte("bundle"))
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		f, _, err := r.FormFile("data")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		uploaded[r.URL.Query().Get("path")] = string(data)
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	clientset, err := agentclientset.NewForConfig(&rest.Config{Host: server.URL})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	scheme := runtime.NewScheme()
+	g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+	repo := &infrav1.HTTPRepository{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "bundles"},
+		Spec:       infrav1.HTTPRepositorySpec{URL: server.URL},
+	}
+	kfAgent := &infrav1.KubeforceAgent{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "agent"},
+		Spec: infrav1.KubeforceAgentSpec{
+			Config: infrav1.AgentConfigSpec{
+				Ansible: &infrav1.AnsibleRuntime{
+					Offline: true,
+					BundleSource: &infrav1.AnsibleBundleSource{
+						RepoRef: infrav1.RepositoryReference{Name: "bundles"},
+						Path:    "bundles",
+					},
+				},
+			},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(repo).Build()
+	h, err := NewHelper(c, repository.NewStorage(logr.Discard(), t.TempDir()), kfAgent, nil, "")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// the bundle of the version that differs from the default version is uploaded
+	g.Expect(h.UploadAnsibleBundle(context.Background(), clientset, "2.15.0")).To(Succeed())
+	g.Expect(uploaded).To(Equal(map[string]string{
+		config.AnsibleConfig{}.GetBundlePath("2.15.0"): "bundle",
+	}))
+	g.Expect(h.UploadAnsibleBundle(context.Background(), clientset, "2.16.0")).NotTo(Succeed())
+	g.Expect(DefaultAnsibleVersion(kfAgent)).To(Equal(config.DefaultAnsibleVersion))
+}
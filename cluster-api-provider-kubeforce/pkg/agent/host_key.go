@@ -0,0 +1,206 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/secret"
+)
+
+// HostKeyError is returned when the host key of the ssh server is not trusted.
+type HostKeyError struct {
+	// Host is the address of the ssh server.
+	Host string
+	// Fingerprint is the SHA256 fingerprint of the host key presented by the server.
+	Fingerprint string
+}
+
+func (e HostKeyError) Error() string {
+	return fmt.Sprintf("the host key %s of %s is not trusted, the host may have been reinstalled or the connection is intercepted", e.Fingerprint, e.Host)
+}
+
+// GetSSHHostKeyPolicy returns the host key policy of the ssh parameters with the default applied.
+func GetSSHHostKeyPolicy(params infrav1.SSHParams) infrav1.SSHHostKeyPolicy {
+	return defaultHostKeyPolicy(params.HostKeyPolicy, params.KnownHostsSecretName, params.HostKeyFingerprints)
+}
+
+func defaultHostKeyPolicy(policy infrav1.SSHHostKeyPolicy, knownHostsSecretName string, fingerprints []string) infrav1.SSHHostKeyPolicy {
+	if policy != "" {
+		return policy
+	}
+	if knownHostsSecretName != "" || len(fingerprints) > 0 {
+		return infrav1.SSHHostKeyPolicyStrict
+	}
+	return infrav1.SSHHostKeyPolicyTrustOnFirstUse
+}
+
+// hostKeyVerifier describes how the host key of an ssh server is verified.
+type hostKeyVerifier struct {
+	policy               infrav1.SSHHostKeyPolicy
+	knownHostsSecretName string
+	fingerprints         []string
+	// recordedKey is the host key accepted by the TrustOnFirstUse policy.
+	recordedKey string
+	// recordKey stores the host key accepted by the TrustOnFirstUse policy.
+	recordKey func(key string)
+}
+
+// agentHostKeyVerifier returns the verifier of the host key of the agent host.
+func (h *Helper) agentHostKeyVerifier() hostKeyVerifier {
+	params := h.agent.Spec.SSH
+	return hostKeyVerifier{
+		policy:               GetSSHHostKeyPolicy(params),
+		knownHostsSecretName: params.KnownHostsSecretName,
+		fingerprints:         params.HostKeyFingerprints,
+		recordedKey:          h.agent.Status.SSHHostKey,
+		recordKey: func(key string) {
+			h.agent.Status.SSHHostKey = key
+		},
+	}
+}
+
+// jumpHostKeyVerifier returns the verifier of the host key of the jump host with the address.
+func (h *Helper) jumpHostKeyVerifier(jumpHost infrav1.SSHJumpHost, addr string) hostKeyVerifier {
+	return hostKeyVerifier{
+		policy:               defaultHostKeyPolicy(jumpHost.HostKeyPolicy, jumpHost.KnownHostsSecretName, jumpHost.HostKeyFingerprints),
+		knownHostsSecretName: jumpHost.KnownHostsSecretName,
+		fingerprints:         jumpHost.HostKeyFingerprints,
+		recordedKey:          h.agent.Status.SSHJumpHostKeys[addr],
+		recordKey: func(key string) {
+			if h.agent.Status.SSHJumpHostKeys == nil {
+				h.agent.Status.SSHJumpHostKeys = make(map[string]string)
+			}
+			h.agent.Status.SSHJumpHostKeys[addr] = key
+		},
+	}
+}
+
+// hostKeyCallback returns the callback that verifies the host key according to the host key policy.
+func (h *Helper) hostKeyCallback(ctx context.Context, v hostKeyVerifier) (ssh.HostKeyCallback, error) {
+	switch v.policy {
+	case infrav1.SSHHostKeyPolicyInsecure:
+		//nolint:gosec
+		return ssh.InsecureIgnoreHostKey(), nil
+	case infrav1.SSHHostKeyPolicyTrustOnFirstUse:
+		return v.trustOnFirstUse, nil
+	case infrav1.SSHHostKeyPolicyStrict:
+		var knownHostsCallback ssh.HostKeyCallback
+		if v.knownHostsSecretName != "" {
+			data, err := h.getKnownHosts(ctx, v.knownHostsSecretName)
+			if err != nil {
+				return nil, err
+			}
+			knownHostsCallback, err = newKnownHostsCallback(data)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if knownHostsCallback == nil && len(v.fingerprints) == 0 {
+			return nil, errors.New("knownHostsSecretName or hostKeyFingerprints is required for the Strict host key policy")
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			fingerprint := ssh.FingerprintSHA256(key)
+			for _, f := range v.fingerprints {
+				if strings.TrimSpace(f) == fingerprint {
+					return nil
+				}
+			}
+			if knownHostsCallback != nil && knownHostsCallback(hostname, remote, key) == nil {
+				return nil
+			}
+			return HostKeyError{Host: hostname, Fingerprint: fingerprint}
+		}, nil
+	default:
+		return nil, errors.Errorf("unsupported host key policy %q", v.policy)
+	}
+}
+
+// trustOnFirstUse records the host key of the first connection
+// and accepts only the recorded key afterwards.
+func (v hostKeyVerifier) trustOnFirstUse(hostname string, _ net.Addr, key ssh.PublicKey) error {
+	observed := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+	if v.recordedKey == "" {
+		v.recordKey(observed)
+		return nil
+	}
+	if v.recordedKey == observed {
+		return nil
+	}
+	return HostKeyError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key)}
+}
+
+// hostKeyAlgorithms returns the host key algorithms of the key recorded by the TrustOnFirstUse policy,
+// so the server presents the recorded key rather than the key of another type.
+func (v hostKeyVerifier) hostKeyAlgorithms() []string {
+	if v.policy != infrav1.SSHHostKeyPolicyTrustOnFirstUse || v.recordedKey == "" {
+		return nil
+	}
+	key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(v.recordedKey))
+	if err != nil {
+		return nil
+	}
+	if key.Type() == ssh.KeyAlgoRSA {
+		return []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+	}
+	return []string{key.Type()}
+}
+
+func (h *Helper) getKnownHosts(ctx context.Context, secretName string) ([]byte, error) {
+	key := types.NamespacedName{
+		Namespace: h.agent.Namespace,
+		Name:      secretName,
+	}
+	s := &corev1.Secret{}
+	if err := h.client.Get(ctx, key, s); err != nil {
+		return nil, err
+	}
+	data := s.Data[secret.SSHKnownHosts]
+	if len(data) == 0 {
+		return nil, errors.Errorf("field %q is required for secret %v", secret.SSHKnownHosts, key)
+	}
+	return data, nil
+}
+
+func newKnownHostsCallback(data []byte) (ssh.HostKeyCallback, error) {
+	// knownhosts reads only files
+	f, err := os.CreateTemp("", "known_hosts-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	callback, err := knownhosts.New(f.Name())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse known_hosts")
+	}
+	return callback, nil
+}
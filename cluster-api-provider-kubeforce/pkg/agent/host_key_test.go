@@ -0,0 +1,177 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/secret"
+)
+
+func TestHostKeyCallback(t *testing.T) {
+	newKey := func() ssh.PublicKey {
+		pub, _, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	hostKey := newKey()
+	otherKey := newKey()
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostKey)))
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+	knownHosts := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "known-hosts", Namespace: "default"},
+		Data: map[string][]byte{
+			secret.SSHKnownHosts: []byte(knownhosts.Line([]string{knownhosts.Normalize(remote.String())}, hostKey) + "\n"),
+		},
+	}
+
+	tests := []struct {
+		name         string
+		params       infrav1.SSHParams
+		recordedKey  string
+		key          ssh.PublicKey
+		wantErr      bool
+		wantMismatch bool
+		wantRecorded string
+	}{
+		{
+			name:         "trust on first use records the host key",
+			key:          hostKey,
+			wantRecorded: authorizedKey,
+		},
+		{
+			name:         "trust on first use accepts the recorded host key",
+			recordedKey:  authorizedKey,
+			key:          hostKey,
+			wantRecorded: authorizedKey,
+		},
+		{
+			name:         "trust on first use rejects a changed host key",
+			recordedKey:  authorizedKey,
+			key:          otherKey,
+			wantMismatch: true,
+			wantRecorded: authorizedKey,
+		},
+		{
+			name:   "pinned fingerprint",
+			params: infrav1.SSHParams{HostKeyFingerprints: []string{ssh.FingerprintSHA256(hostKey)}},
+			key:    hostKey,
+		},
+		{
+			name:         "pinned fingerprint does not match",
+			params:       infrav1.SSHParams{HostKeyFingerprints: []string{ssh.FingerprintSHA256(hostKey)}},
+			key:          otherKey,
+			wantMismatch: true,
+		},
+		{
+			name:   "known hosts",
+			params: infrav1.SSHParams{KnownHostsSecretName: "known-hosts"},
+			key:    hostKey,
+		},
+		{
+			name:         "known hosts does not match",
+			params:       infrav1.SSHParams{KnownHostsSecretName: "known-hosts"},
+			key:          otherKey,
+			wantMismatch: true,
+		},
+		{
+			name:    "strict policy without trusted keys",
+			params:  infrav1.SSHParams{HostKeyPolicy: infrav1.SSHHostKeyPolicyStrict},
+			wantErr: true,
+		},
+		{
+			name:   "insecure",
+			params: infrav1.SSHParams{HostKeyPolicy: infrav1.SSHHostKeyPolicyInsecure},
+			key:    otherKey,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			kfAgent := &infrav1.KubeforceAgent{
+				ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "default"},
+				Spec:       infrav1.KubeforceAgentSpec{SSH: tt.params},
+				Status:     infrav1.KubeforceAgentStatus{SSHHostKey: tt.recordedKey},
+			}
+			c := fake.NewClientBuilder().WithObjects(knownHosts).Build()
+			h := &Helper{client: c, agent: kfAgent}
+			callback, err := h.hostKeyCallback(context.Background(), h.agentHostKeyVerifier())
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			err = callback(remote.String(), remote, tt.key)
+			if tt.wantMismatch {
+				g.Expect(err).To(BeAssignableToTypeOf(HostKeyError{}))
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+			g.Expect(kfAgent.Status.SSHHostKey).To(Equal(tt.wantRecorded))
+		})
+	}
+}
+
+func TestJumpHostKeyVerifier(t *testing.T) {
+	g := NewWithT(t)
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	g.Expect(err).NotTo(HaveOccurred())
+	hostKey, err := ssh.NewPublicKey(pub)
+	g.Expect(err).NotTo(HaveOccurred())
+	authorizedKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hostKey)))
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+
+	kfAgent := &infrav1.KubeforceAgent{
+		ObjectMeta: metav1.ObjectMeta{Name: "agent", Namespace: "default"},
+		Spec: infrav1.KubeforceAgentSpec{
+			SSH: infrav1.SSHParams{
+				ProxyJump: []infrav1.SSHJumpHost{{Host: "bastion"}},
+			},
+		},
+	}
+	h := &Helper{client: fake.NewClientBuilder().Build(), agent: kfAgent}
+	verifier := h.jumpHostKeyVerifier(kfAgent.Spec.SSH.ProxyJump[0], "bastion:22")
+	g.Expect(verifier.policy).To(Equal(infrav1.SSHHostKeyPolicyTrustOnFirstUse))
+	callback, err := h.hostKeyCallback(context.Background(), verifier)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(callback("bastion:22", remote, hostKey)).To(Succeed())
+	g.Expect(kfAgent.Status.SSHJumpHostKeys).To(Equal(map[string]string{"bastion:22": authorizedKey}))
+	// the host key of the agent host is recorded separately
+	g.Expect(kfAgent.Status.SSHHostKey).To(BeEmpty())
+
+	verifier = h.jumpHostKeyVerifier(kfAgent.Spec.SSH.ProxyJump[0], "bastion:22")
+	g.Expect(verifier.hostKeyAlgorithms()).To(Equal([]string{ssh.KeyAlgoED25519}))
+}
@@ -0,0 +1,193 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"k3f.io/kubeforce/agent/pkg/apis/agent/v1alpha1"
+	"k3f.io/kubeforce/agent/pkg/config"
+	agentclientset "k3f.io/kubeforce/agent/pkg/generated/clientset/versioned"
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/repository"
+)
+
+// PlaybookFiles are the playbook files loaded from the file sources.
+type PlaybookFiles struct {
+	// Files are the files of the remote playbook that refer to the artifacts.
+	Files []v1alpha1.PlaybookFile
+	// artifacts are the sources of the content by the artifact name.
+	artifacts map[string]artifactSource
+}
+
+// artifactSource is the content of the artifact.
+// The files of the repositories are read from the storage when they are uploaded,
+// so the content of the large files is not kept in memory.
+type artifactSource struct {
+	// path is the path of the file in the storage.
+	path string
+	// data is the content of the ConfigMap or Secret key.
+	data []byte
+}
+
+func (s artifactSource) open() (io.ReadCloser, error) {
+	if s.path == "" {
+		return io.NopCloser(bytes.NewReader(s.data)), nil
+	}
+	f, err := os.Open(filepath.Clean(s.path))
+	return f, errors.WithStack(err)
+}
+
+// LoadPlaybookFiles loads the file sources and verifies the checksums.
+// The ConfigMaps and Secrets are looked up in the namespace.
+func LoadPlaybookFiles(ctx context.Context, c client.Client, storage *repository.Storage, namespace string, sources []infrav1.PlaybookFileSource) (*PlaybookFiles, error) {
+	result := &PlaybookFiles{
+		artifacts: make(map[string]artifactSource),
+	}
+	for _, source := range sources {
+		artifact, err := loadFileSource(ctx, c, storage, namespace, source)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to load the playbook file %s", source.Path)
+		}
+		checksum, err := artifactChecksum(artifact)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to calculate the checksum of the playbook file %s", source.Path)
+		}
+		if source.SHA256 != "" && source.SHA256 != checksum {
+			return nil, errors.Errorf("checksum mismatch for the playbook file %s: expected %s, got %s", source.Path, source.SHA256, checksum)
+		}
+		result.artifacts[checksum] = artifact
+		result.Files = append(result.Files, v1alpha1.PlaybookFile{
+			Path:     source.Path,
+			Artifact: checksum,
+			SHA256:   checksum,
+			Mode:     source.Mode,
+		})
+	}
+	return result, nil
+}
+
+// artifactChecksum returns the sha256 checksum of the content that is read by the stream.
+func artifactChecksum(artifact artifactSource) (string, error) {
+	r, err := artifact.open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func loadFileSource(ctx context.Context, c client.Client, storage *repository.Storage, namespace string, source infrav1.PlaybookFileSource) (artifactSource, error) {
+	switch {
+	case source.Repository != nil:
+		if storage == nil {
+			return artifactSource{}, errors.New("the repository storage is not configured")
+		}
+		repo := &infrav1.HTTPRepository{}
+		key := client.ObjectKey{
+			Namespace: source.Repository.RepoRef.Namespace,
+			Name:      source.Repository.RepoRef.Name,
+		}
+		if key.Namespace == "" {
+			key.Namespace = namespace
+		}
+		if err := c.Get(ctx, key, repo); err != nil {
+			return artifactSource{}, err
+		}
+		f, err := storage.GetHTTPFileGetter(*repo).GetFile(ctx, source.Repository.Path)
+		if err != nil {
+			return artifactSource{}, err
+		}
+		return artifactSource{path: f.Path}, nil
+	case source.ConfigMapKeyRef != nil:
+		ref := source.ConfigMapKeyRef
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, cm); err != nil {
+			return artifactSource{}, err
+		}
+		if data, ok := cm.BinaryData[ref.Key]; ok {
+			return artifactSource{data: data}, nil
+		}
+		if data, ok := cm.Data[ref.Key]; ok {
+			return artifactSource{data: []byte(data)}, nil
+		}
+		return artifactSource{}, errors.Errorf("key %q is not found in the ConfigMap %s", ref.Key, ref.Name)
+	case source.SecretKeyRef != nil:
+		ref := source.SecretKeyRef
+		s := &corev1.Secret{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, s); err != nil {
+			return artifactSource{}, err
+		}
+		if data, ok := s.Data[ref.Key]; ok {
+			return artifactSource{data: data}, nil
+		}
+		return artifactSource{}, errors.Errorf("key %q is not found in the Secret %s", ref.Key, ref.Name)
+	}
+	return artifactSource{}, errors.New("the source of the file is not specified")
+}
+
+// Upload uploads the artifacts of the files that are missing on the agent.
+// The artifact name is the checksum of the content, so the present artifacts are not uploaded again.
+// The content of the files is streamed to the agent.
+func (f *PlaybookFiles) Upload(ctx context.Context, clientset *agentclientset.Clientset) error {
+	if len(f.artifacts) == 0 {
+		return nil
+	}
+	artifactsPath := config.ConfigSpec{PlaybookPath: agentPlaybookPath}.GetArtifactsPath()
+	ctx, cancelFunc := context.WithTimeout(ctx, 5*time.Minute)
+	defer cancelFunc()
+	names, err := clientset.ListArtifacts(ctx)
+	if err != nil {
+		return errors.Wrap(err, "unable to list the artifacts of the agent")
+	}
+	present := sets.NewString(names...)
+	for name, artifact := range f.artifacts {
+		if present.Has(name) {
+			continue
+		}
+		if err := uploadArtifact(ctx, clientset, path.Join(artifactsPath, name), artifact); err != nil {
+			return errors.Wrapf(err, "unable to upload the artifact %s", name)
+		}
+	}
+	return nil
+}
+
+func uploadArtifact(ctx context.Context, clientset *agentclientset.Clientset, targetPath string, artifact artifactSource) error {
+	r, err := artifact.open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return clientset.Upload(ctx, targetPath, r, nil)
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	agentclientset "k3f.io/kubeforce/agent/pkg/generated/clientset/versioned"
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func TestLoadPlaybookFiles(t *testing.T) {
+	checksum := func(data string) string {
+		hash := sha256.Sum256([]byte(data))
+		return hex.EncodeToString(hash[:])
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "files", Namespace: "default"},
+		Data:       map[string]string{"config.txt": "text"},
+		BinaryData: map[string][]byte{"app.bin": {0x00, 0xff}},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "files", Namespace: "default"},
+		Data:       map[string][]byte{"key.pem": []byte("secret")},
+	}
+	configMapKey := func(key string) *corev1.ConfigMapKeySelector {
+		return &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "files"}, Key: key}
+	}
+	tests := []struct {
+		name          string
+		sources       []infrav1.PlaybookFileSource
+		wantChecksums []string
+		wantErr       bool
+	}{
+		{
+			name: "configmap and secret",
+			sources: []infrav1.PlaybookFileSource{
+				{Path: "files/config.txt", ConfigMapKeyRef: configMapKey("config.txt")},
+				{Path: "files/app.bin", ConfigMapKeyRef: configMapKey("app.bin"), SHA256: checksum("\x00\xff")},
+				{
+					Path: "files/key.pem",
+					SecretKeyRef: &corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "files"},
+						Key:                  "key.pem",
+					},
+				},
+			},
+			wantChecksums: []string{checksum("text"), checksum("\x00\xff"), checksum("secret")},
+		},
+		{
+			name: "checksum mismatch",
+			sources: []infrav1.PlaybookFileSource{
+				{Path: "files/config.txt", ConfigMapKeyRef: configMapKey("config.txt"), SHA256: checksum("other")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing key",
+			sources: []infrav1.PlaybookFileSource{
+				{Path: "files/config.txt", ConfigMapKeyRef: configMapKey("missing")},
+			},
+			wantErr: true,
+		},
+		{
+			name: "repository without storage",
+			sources: []infrav1.PlaybookFileSource{
+				{Path: "files/app.bin", Repository: &infrav1.RepositoryFileSource{Path: "app.bin"}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			scheme := runtime.NewScheme()
+			g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+			g.Expect(infrav1.AddToScheme(scheme)).To(Succeed())
+			c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(cm, secret).Build()
+			files, err := LoadPlaybookFiles(context.Background(), c, nil, "default", tt.sources)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(files.Files).To(HaveLen(len(tt.sources)))
+			for i, f := range files.Files {
+				g.Expect(f.Path).To(Equal(tt.sources[i].Path))
+				g.Expect(f.Artifact).To(Equal(tt.wantChecksums[i]))
+				g.Expect(f.SHA256).To(Equal(tt.wantChecksums[i]))
+				g.Expect(files.artifacts).To(HaveKey(tt.wantChecksums[i]))
+			}
+		})
+	}
+}
+
+func TestUploadMissingArtifacts(t *testing.T) {
+	g := NewWithT(t)
+	var lock sync.Mutex
+	uploaded := make(map[string]string)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/artifacts", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode([]string{"present"})
+	})
+	mux.HandleFunc("/upload", func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		f, _, err := r.FormFile("data")
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		data, err := io.ReadAll(f)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		uploaded[path.Base(r.URL.Query().Get("path"))] = string(data)
+		w.WriteHeader(http.StatusOK)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	clientset, err := agentclientset.NewForConfig(&rest.Config{Host: server.URL})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// the file of the repository is read from the storage when it is uploaded
+	repositoryFile := filepath.Join(t.TempDir(), "app.bin")
+	g.Expect(os.WriteFile(repositoryFile, []byte("repository"), 0o600)).To(Succeed())
+	files := &PlaybookFiles{
+		artifacts: map[string]artifactSource{
+			"present":    {data: []byte("present")},
+			"missing":    {data: []byte("missing")},
+			"repository": {path: repositoryFile},
+		},
+	}
+	g.Expect(files.Upload(context.Background(), clientset)).To(Succeed())
+	g.Expect(uploaded).To(Equal(map[string]string{
+		"missing":    "missing",
+		"repository": "repository",
+	}))
+}
+
+func TestArtifactChecksum(t *testing.T) {
+	g := NewWithT(t)
+	data := []byte("repository")
+	hash := sha256.Sum256(data)
+	repositoryFile := filepath.Join(t.TempDir(), "app.bin")
+	g.Expect(os.WriteFile(repositoryFile, data, 0o600)).To(Succeed())
+
+	checksum, err := artifactChecksum(artifactSource{path: repositoryFile})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(checksum).To(Equal(hex.EncodeToString(hash[:])))
+	checksum, err = artifactChecksum(artifactSource{data: data})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(checksum).To(Equal(hex.EncodeToString(hash[:])))
+	_, err = artifactChecksum(artifactSource{path: filepath.Join(t.TempDir(), "missing")})
+	g.Expect(err).To(HaveOccurred())
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+	"k3f.io/kubeforce/cluster-api-provider-kubeforce/pkg/repository"
+)
+
+const (
+	// maxSourceSize limits the total size of the files of the source,
+	// the files are stored in the playbook object.
+	maxSourceSize = 1 << 20
+
+	sshPrivateKeyKey = "ssh-privatekey"
+	knownHostsKey    = "known_hosts"
+)
+
+// LoadPlaybookSource loads the files of the playbook source.
+// The key of the result is the path of the file relative to the playbook directory.
+// The Secrets and ConfigMaps are looked up in the namespace.
+func LoadPlaybookSource(ctx context.Context, c client.Client, storage *repository.Storage, namespace string, source *infrav1.PlaybookSource) (map[string]string, error) {
+	switch {
+	case source.Git != nil:
+		if storage == nil {
+			return nil, errors.New("the repository storage is not configured")
+		}
+		creds, err := gitCredentials(ctx, c, namespace, source.Git.SecretRef)
+		if err != nil {
+			return nil, err
+		}
+		dir, err := storage.GetGitDir(ctx, source.Git.URL, source.Git.Ref, creds)
+		if err != nil {
+			return nil, err
+		}
+		return readSourceDir(dir, source.Git.Path)
+	case source.OCI != nil:
+		if storage == nil {
+			return nil, errors.New("the repository storage is not configured")
+		}
+		var creds *repository.OCICredentials
+		if source.OCI.SecretRef != nil {
+			s, err := getSecret(ctx, c, namespace, source.OCI.SecretRef.Name)
+			if err != nil {
+				return nil, err
+			}
+			creds = &repository.OCICredentials{
+				Username: string(s.Data[corev1.BasicAuthUsernameKey]),
+				Password: string(s.Data[corev1.BasicAuthPasswordKey]),
+			}
+		}
+		dir, err := storage.GetOCIDir(ctx, source.OCI.Image, source.OCI.Insecure, creds)
+		if err != nil {
+			return nil, err
+		}
+		return readSourceDir(dir, source.OCI.Path)
+	case len(source.ConfigMaps) > 0:
+		return loadConfigMaps(ctx, c, namespace, source.ConfigMaps)
+	}
+	return nil, errors.New("the source of the playbook is not specified")
+}
+
+func getSecret(ctx context.Context, c client.Client, namespace, name string) (*corev1.Secret, error) {
+	s := &corev1.Secret{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, s); err != nil {
+		return nil, errors.Wrapf(err, "unable to get the Secret %s", name)
+	}
+	return s, nil
+}
+
+func gitCredentials(ctx context.Context, c client.Client, namespace string, ref *corev1.LocalObjectReference) (*repository.GitCredentials, error) {
+	if ref == nil {
+		return nil, nil
+	}
+	s, err := getSecret(ctx, c, namespace, ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	return &repository.GitCredentials{
+		Username:      string(s.Data[corev1.BasicAuthUsernameKey]),
+		Password:      string(s.Data[corev1.BasicAuthPasswordKey]),
+		SSHPrivateKey: s.Data[sshPrivateKeyKey],
+		KnownHosts:    s.Data[knownHostsKey],
+	}, nil
+}
+
+// readSourceDir reads the regular files of the subdirectory of the source.
+// The symbolic links are not followed outside of the source directory.
+func readSourceDir(dir, subPath string) (map[string]string, error) {
+	dir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to resolve the source directory")
+	}
+	root, err := filepath.EvalSymlinks(filepath.Join(dir, filepath.Clean("/"+subPath)))
+	if err != nil {
+		return nil, errors.Wrapf(err, "path %q is not found in the source", subPath)
+	}
+	if rel, err := filepath.Rel(dir, root); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, errors.Errorf("path %q is outside of the source", subPath)
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "path %q is not found in the source", subPath)
+	}
+	if !info.IsDir() {
+		return nil, errors.Errorf("path %q of the source is not a directory", subPath)
+	}
+	result := make(map[string]string)
+	size := 0
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(filepath.Clean(p))
+		if err != nil {
+			return err
+		}
+		size += len(data)
+		return addSourceFile(result, filepath.ToSlash(rel), data, size)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func loadConfigMaps(ctx context.Context, c client.Client, namespace string, sources []infrav1.ConfigMapSource) (map[string]string, error) {
+	result := make(map[string]string)
+	size := 0
+	for _, source := range sources {
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: source.Name}, cm); err != nil {
+			return nil, errors.Wrapf(err, "unable to get the ConfigMap %s", source.Name)
+		}
+		for key, value := range cm.Data {
+			size += len(value)
+			if err := addSourceFile(result, path.Join(source.Path, key), []byte(value), size); err != nil {
+				return nil, err
+			}
+		}
+		for key, value := range cm.BinaryData {
+			size += len(value)
+			if err := addSourceFile(result, path.Join(source.Path, key), value, size); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+func addSourceFile(files map[string]string, name string, data []byte, size int) error {
+	if size > maxSourceSize {
+		return errors.Errorf("the files of the source exceed %d bytes, use the fileSources for the large files", maxSourceSize)
+	}
+	if !utf8.Valid(data) {
+		return errors.Errorf("the file %s is not a text file, use the fileSources for the binary files", name)
+	}
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if _, ok := files[name]; ok {
+		return errors.Errorf("the file %s is duplicated in the source", name)
+	}
+	files[name] = string(data)
+	return nil
+}
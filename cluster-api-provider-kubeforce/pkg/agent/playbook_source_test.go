@@ -0,0 +1,148 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package agent
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func TestLoadPlaybookSource(t *testing.T) {
+	newConfigMap := func(name string, data map[string]string, binaryData map[string][]byte) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Data:       data,
+			BinaryData: binaryData,
+		}
+	}
+	objects := []runtime.Object{
+		newConfigMap("playbook", map[string]string{"site.yaml": "- hosts: all\n"}, nil),
+		newConfigMap("tasks", map[string]string{"main.yaml": "- debug: {}\n"}, nil),
+		newConfigMap("binary", nil, map[string][]byte{"app.bin": {0xff, 0xfe}}),
+		newConfigMap("large", map[string]string{"large.txt": strings.Repeat("x", maxSourceSize+1)}, nil),
+	}
+	tests := []struct {
+		name    string
+		source  *infrav1.PlaybookSource
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "configmaps",
+			source: &infrav1.PlaybookSource{
+				ConfigMaps: []infrav1.ConfigMapSource{
+					{Name: "playbook"},
+					{Name: "tasks", Path: "roles/app/tasks"},
+				},
+			},
+			want: map[string]string{
+				"site.yaml":                 "- hosts: all\n",
+				"roles/app/tasks/main.yaml": "- debug: {}\n",
+			},
+		},
+		{
+			name: "duplicated file",
+			source: &infrav1.PlaybookSource{
+				ConfigMaps: []infrav1.ConfigMapSource{{Name: "playbook"}, {Name: "playbook"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "binary file",
+			source:  &infrav1.PlaybookSource{ConfigMaps: []infrav1.ConfigMapSource{{Name: "binary"}}},
+			wantErr: true,
+		},
+		{
+			name:    "large file",
+			source:  &infrav1.PlaybookSource{ConfigMaps: []infrav1.ConfigMapSource{{Name: "large"}}},
+			wantErr: true,
+		},
+		{
+			name:    "missing configmap",
+			source:  &infrav1.PlaybookSource{ConfigMaps: []infrav1.ConfigMapSource{{Name: "missing"}}},
+			wantErr: true,
+		},
+		{
+			name:    "git without storage",
+			source:  &infrav1.PlaybookSource{Git: &infrav1.GitSource{URL: "https://example.com/playbooks.git"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			c := fake.NewClientBuilder().WithRuntimeObjects(objects...).Build()
+			got, err := LoadPlaybookSource(context.Background(), c, nil, "default", tt.source)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestReadSourceDir(t *testing.T) {
+	g := NewWithT(t)
+	dir := t.TempDir()
+	g.Expect(os.MkdirAll(filepath.Join(dir, "playbooks", "roles"), 0o750)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "README.md"), []byte("readme"), 0o600)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "playbooks", "site.yaml"), []byte("site"), 0o600)).To(Succeed())
+	g.Expect(os.WriteFile(filepath.Join(dir, "playbooks", "roles", "main.yaml"), []byte("main"), 0o600)).To(Succeed())
+	g.Expect(os.Symlink("/etc/passwd", filepath.Join(dir, "playbooks", "passwd"))).To(Succeed())
+
+	files, err := readSourceDir(dir, "playbooks")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(files).To(Equal(map[string]string{
+		"site.yaml":       "site",
+		"roles/main.yaml": "main",
+	}))
+
+	files, err = readSourceDir(dir, "../../playbooks")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(files).To(HaveLen(2))
+
+	_, err = readSourceDir(dir, "README.md")
+	g.Expect(err).To(HaveOccurred())
+
+	// the symbolic links of the path must not escape the source directory
+	outside := t.TempDir()
+	g.Expect(os.WriteFile(filepath.Join(outside, "secret.yaml"), []byte("secret"), 0o600)).To(Succeed())
+	g.Expect(os.Symlink(outside, filepath.Join(dir, "outside"))).To(Succeed())
+	g.Expect(os.Symlink("../outside", filepath.Join(dir, "playbooks", "escape"))).To(Succeed())
+	_, err = readSourceDir(dir, "outside")
+	g.Expect(err).To(HaveOccurred())
+	_, err = readSourceDir(dir, "playbooks/escape")
+	g.Expect(err).To(HaveOccurred())
+
+	g.Expect(os.Symlink("playbooks/roles", filepath.Join(dir, "roles"))).To(Succeed())
+	files, err = readSourceDir(dir, "roles")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(files).To(Equal(map[string]string{"main.yaml": "main"}))
+}
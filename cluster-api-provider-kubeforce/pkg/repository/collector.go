@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	defaultDirsCollectionInterval = time.Hour
+	// defaultDirsGracePeriod protects the directories that are used by the playbook sources.
+	defaultDirsGracePeriod = 24 * time.Hour
+)
+
+var ociDirRegexp = regexp.MustCompile(`^sha256_[0-9a-f]{64}$`)
+
+// DirsCollector removes the directories of the git repositories and the OCI artifacts that are not used anymore.
+// The directories are cached by the commit or the digest, so the directories of the previous versions
+// are not referenced by the playbook sources after the ref or the tag is moved.
+type DirsCollector struct {
+	Storage *Storage
+	Log     logr.Logger
+	// Interval is the period of the collection. Defaults to 1 hour.
+	Interval time.Duration
+	// GracePeriod is the minimal time since the last use of the directory to be removed. Defaults to 24 hours.
+	GracePeriod time.Duration
+}
+
+// Start runs the collection periodically until the context is done.
+func (c *DirsCollector) Start(ctx context.Context) error {
+	interval := c.Interval
+	if interval == 0 {
+		interval = defaultDirsCollectionInterval
+	}
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := c.Collect(time.Now()); err != nil {
+			c.Log.Error(err, "unable to remove the unused directories")
+		}
+	}, interval)
+	return nil
+}
+
+// Collect removes the directories that have not been used for the grace period.
+func (c *DirsCollector) Collect(now time.Time) error {
+	gracePeriod := c.GracePeriod
+	if gracePeriod == 0 {
+		gracePeriod = defaultDirsGracePeriod
+	}
+	usedAfter := now.Add(-gracePeriod)
+	if err := c.Storage.removeUnusedDirs("git", commitRegexp, usedAfter, c.Log); err != nil {
+		return err
+	}
+	return c.Storage.removeUnusedDirs("oci", ociDirRegexp, usedAfter, c.Log)
+}
+
+// removeUnusedDirs removes the cached directories under the root that have not been used after the time.
+// The cached directories are found by the name, the modification time of the directory is the time of the last use.
+func (s *Storage) removeUnusedDirs(root string, name *regexp.Regexp, usedAfter time.Time, log logr.Logger) error {
+	err := filepath.WalkDir(path.Join(s.basePath, root), func(fullPath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || !name.MatchString(d.Name()) {
+			return nil
+		}
+		relativePath, err := filepath.Rel(s.basePath, fullPath)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		removed, err := s.removeUnusedDir(filepath.ToSlash(relativePath), usedAfter)
+		if err != nil {
+			return err
+		}
+		if removed {
+			log.Info("the unused directory has been removed", "dir", fullPath)
+		}
+		return filepath.SkipDir
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return errors.WithStack(err)
+}
+
+func (s *Storage) removeUnusedDir(relativePath string, usedAfter time.Time) (bool, error) {
+	unlock := s.keyedMutex.Lock(relativePath)
+	defer unlock()
+
+	fullPath := path.Join(s.basePath, relativePath)
+	info, err := os.Stat(fullPath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, errors.WithStack(err)
+	}
+	if info.ModTime().After(usedAfter) {
+		return false, nil
+	}
+	return true, errors.WithStack(os.RemoveAll(fullPath))
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+)
+
+func TestDirsCollector_Collect(t *testing.T) {
+	g := NewWithT(t)
+	s := NewStorage(logr.Discard(), t.TempDir())
+	fetch := func(ctx context.Context, dir string) error {
+		return os.WriteFile(filepath.Join(dir, "site.yaml"), []byte("#empty"), 0o600)
+	}
+	getDir := func(relativePath string) string {
+		dir, err := s.getDir(context.Background(), relativePath, fetch)
+		g.Expect(err).NotTo(HaveOccurred())
+		return dir
+	}
+	oldCommit := getDir("git/https/example.com/playbooks/0123456789012345678901234567890123456789")
+	newCommit := getDir("git/https/example.com/playbooks/abcdefabcdefabcdefabcdefabcdefabcdefabcd")
+	oldDigest := getDir("oci/ghcr.io/org/playbooks/sha256_" + sha256Digest([]byte("old"))[len("sha256:"):])
+	// the directory that is not a cached one is kept
+	other := filepath.Join(s.basePath, "git", "https", "example.com", "other")
+	g.Expect(os.MkdirAll(other, 0o750)).To(Succeed())
+
+	past := time.Now().Add(-48 * time.Hour)
+	for _, dir := range []string{oldCommit, newCommit, oldDigest, other} {
+		g.Expect(os.Chtimes(dir, past, past)).To(Succeed())
+	}
+	// the cached directory is used again
+	g.Expect(getDir("git/https/example.com/playbooks/abcdefabcdefabcdefabcdefabcdefabcdefabcd")).To(Equal(newCommit))
+
+	c := &DirsCollector{Storage: s, Log: logr.Discard()}
+	g.Expect(c.Collect(time.Now())).To(Succeed())
+	g.Expect(oldCommit).NotTo(BeADirectory())
+	g.Expect(oldDigest).NotTo(BeADirectory())
+	g.Expect(filepath.Join(newCommit, "site.yaml")).To(BeARegularFile())
+	g.Expect(other).To(BeADirectory())
+
+	// the collection of the empty storage succeeds
+	c = &DirsCollector{Storage: NewStorage(logr.Discard(), t.TempDir()), Log: logr.Discard()}
+	g.Expect(c.Collect(time.Now())).To(Succeed())
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var commitRegexp = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// defaultGitRefTTL is the time during which the resolved ref is used without listing the remote references.
+const defaultGitRefTTL = time.Minute
+
+// GitCredentials are the credentials of the git repository.
+type GitCredentials struct {
+	// Username and Password are used for HTTP(S) repositories.
+	Username string
+	Password string
+	// SSHPrivateKey and KnownHosts are used for SSH repositories.
+	SSHPrivateKey []byte
+	KnownHosts    []byte
+}
+
+// GetGitDir returns the directory with the files of the git repository at the ref.
+// The ref is a branch, a tag or a full commit hash, the default branch is used if the ref is empty.
+// The files are cached by the commit, so the repository is cloned again only if the ref points to a new commit.
+// The resolved ref is cached for a minute, so the new commits of the ref are found with the delay.
+func (s *Storage) GetGitDir(ctx context.Context, url, ref string, creds *GitCredentials) (string, error) {
+	auth, err := gitAuth(url, creds)
+	if err != nil {
+		return "", err
+	}
+	key := gitRefKey(url, ref, creds)
+	refName, hash, ok := s.gitRefs.get(key)
+	if !ok {
+		refName, hash, err = resolveGitRef(ctx, url, ref, auth)
+		if err != nil {
+			return "", err
+		}
+		s.gitRefs.set(key, refName, hash)
+	}
+	relativePath := path.Join("git", convertURLToFilesystemPath(url), hash.String())
+	dir, err := s.getDir(ctx, relativePath, func(ctx context.Context, dir string) error {
+		return cloneGit(ctx, dir, url, refName, hash, auth)
+	})
+	if err != nil {
+		// the ref could be moved after it has been resolved, so it is resolved again by the next attempt
+		s.gitRefs.delete(key)
+		return "", err
+	}
+	return dir, nil
+}
+
+// gitRefCache contains the resolved refs of the git repositories.
+type gitRefCache struct {
+	ttl     time.Duration
+	mu      sync.Mutex
+	entries map[string]gitRefCacheEntry
+}
+
+type gitRefCacheEntry struct {
+	name     plumbing.ReferenceName
+	hash     plumbing.Hash
+	resolved time.Time
+}
+
+func newGitRefCache(ttl time.Duration) *gitRefCache {
+	return &gitRefCache{
+		ttl:     ttl,
+		entries: make(map[string]gitRefCacheEntry),
+	}
+}
+
+func (c *gitRefCache) get(key string) (plumbing.ReferenceName, plumbing.Hash, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return "", plumbing.ZeroHash, false
+	}
+	if c.expired(e, time.Now()) {
+		delete(c.entries, key)
+		return "", plumbing.ZeroHash, false
+	}
+	return e.name, e.hash, true
+}
+
+func (c *gitRefCache) set(key string, name plumbing.ReferenceName, hash plumbing.Hash) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	// the expired entries are removed to keep the cache small
+	for k, e := range c.entries {
+		if c.expired(e, now) {
+			delete(c.entries, k)
+		}
+	}
+	c.entries[key] = gitRefCacheEntry{name: name, hash: hash, resolved: now}
+}
+
+func (c *gitRefCache) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+func (c *gitRefCache) expired(e gitRefCacheEntry, now time.Time) bool {
+	return now.Sub(e.resolved) >= c.ttl
+}
+
+// gitRefKey returns the key of the resolved ref.
+// The credentials are a part of the key, so the ref resolved with the other credentials is not used.
+func gitRefKey(url, ref string, creds *GitCredentials) string {
+	h := sha256.New()
+	for _, v := range []string{url, ref} {
+		h.Write([]byte(v))
+		h.Write([]byte{0})
+	}
+	if creds != nil {
+		for _, v := range [][]byte{[]byte(creds.Username), []byte(creds.Password), creds.SSHPrivateKey, creds.KnownHosts} {
+			h.Write(v)
+			h.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func gitAuth(url string, creds *GitCredentials) (transport.AuthMethod, error) {
+	if creds == nil {
+		return nil, nil
+	}
+	ep, err := transport.NewEndpoint(url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid git url %q", url)
+	}
+	switch ep.Protocol {
+	case "http", "https":
+		if creds.Username == "" && creds.Password == "" {
+			return nil, nil
+		}
+		return &githttp.BasicAuth{Username: creds.Username, Password: creds.Password}, nil
+	case "ssh":
+		if len(creds.SSHPrivateKey) == 0 {
+			return nil, nil
+		}
+		user := ep.User
+		if user == "" {
+			user = "git"
+		}
+		auth, err := gitssh.NewPublicKeys(user, creds.SSHPrivateKey, "")
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse the ssh private key")
+		}
+		if len(creds.KnownHosts) == 0 {
+			return nil, errors.New("known_hosts is required for the ssh repository")
+		}
+		auth.HostKeyCallback, err = knownHostsCallback(creds.KnownHosts)
+		if err != nil {
+			return nil, err
+		}
+		return auth, nil
+	}
+	return nil, nil
+}
+
+func knownHostsCallback(data []byte) (ssh.HostKeyCallback, error) {
+	// knownhosts reads only files
+	f, err := os.CreateTemp("", "known_hosts-")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+	if _, err := f.Write(data); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	callback, err := knownhosts.New(f.Name())
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse known_hosts")
+	}
+	return callback, nil
+}
+
+// resolveGitRef returns the name of the reference and the commit of the ref in the remote repository.
+// The name is empty if the ref is a commit hash.
+func resolveGitRef(ctx context.Context, url, ref string, auth transport.AuthMethod) (plumbing.ReferenceName, plumbing.Hash, error) {
+	remote := git.NewRemote(memory.NewStorage(), &gitconfig.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{url},
+	})
+	refs, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth})
+	if err != nil {
+		return "", plumbing.ZeroHash, errors.Wrapf(err, "unable to list the references of the git repository %s", url)
+	}
+	byName := make(map[plumbing.ReferenceName]*plumbing.Reference, len(refs))
+	for _, r := range refs {
+		byName[r.Name()] = r
+	}
+	var names []plumbing.ReferenceName
+	if ref == "" {
+		names = []plumbing.ReferenceName{plumbing.HEAD}
+	} else {
+		names = []plumbing.ReferenceName{
+			plumbing.NewBranchReferenceName(ref),
+			plumbing.NewTagReferenceName(ref),
+			plumbing.ReferenceName(ref),
+		}
+	}
+	for _, name := range names {
+		r, ok := byName[name]
+		if !ok {
+			continue
+		}
+		if r.Type() == plumbing.SymbolicReference {
+			if r, ok = byName[r.Target()]; !ok {
+				continue
+			}
+		}
+		return r.Name(), r.Hash(), nil
+	}
+	if commitRegexp.MatchString(ref) {
+		return "", plumbing.NewHash(ref), nil
+	}
+	if ref == "" {
+		return "", plumbing.ZeroHash, errors.Errorf("the default branch is not found in the git repository %s", url)
+	}
+	return "", plumbing.ZeroHash, errors.Errorf("ref %q is not found in the git repository %s", ref, url)
+}
+
+func cloneGit(ctx context.Context, dir, url string, refName plumbing.ReferenceName, hash plumbing.Hash, auth transport.AuthMethod) error {
+	opts := &git.CloneOptions{
+		URL:   url,
+		Auth:  auth,
+		Tags:  git.NoTags,
+		Depth: 1,
+	}
+	if refName != "" {
+		opts.ReferenceName = refName
+		opts.SingleBranch = true
+	} else {
+		// an arbitrary commit cannot be fetched with the shallow clone
+		opts.Depth = 0
+		opts.NoCheckout = true
+	}
+	repo, err := git.PlainCloneContext(ctx, dir, false, opts)
+	if err != nil {
+		return errors.Wrapf(err, "unable to clone the git repository %s", url)
+	}
+	if refName == "" {
+		w, err := repo.Worktree()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := w.Checkout(&git.CheckoutOptions{Hash: hash, Force: true}); err != nil {
+			return errors.Wrapf(err, "unable to checkout the commit %s", hash)
+		}
+	}
+	// the files are cached by the commit, so the cloned commit must be the resolved one
+	head, err := repo.Head()
+	if err != nil {
+		return errors.Wrapf(err, "unable to get the HEAD of the git repository %s", url)
+	}
+	if head.Hash() != hash {
+		return errors.Errorf("the ref %s of the git repository %s points to the commit %s instead of %s", refName, url, head.Hash(), hash)
+	}
+	return os.RemoveAll(filepath.Join(dir, git.GitDirName))
+}
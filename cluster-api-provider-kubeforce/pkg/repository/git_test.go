@@ -0,0 +1,131 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+)
+
+func TestStorage_GetGitDir(t *testing.T) {
+	g := NewWithT(t)
+	repoDir := t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	w, err := repo.Worktree()
+	g.Expect(err).NotTo(HaveOccurred())
+	commit := func(content string) plumbing.Hash {
+		g.Expect(os.MkdirAll(filepath.Join(repoDir, "playbooks"), 0o750)).To(Succeed())
+		g.Expect(os.WriteFile(filepath.Join(repoDir, "playbooks", "site.yaml"), []byte(content), 0o600)).To(Succeed())
+		_, err := w.Add("playbooks/site.yaml")
+		g.Expect(err).NotTo(HaveOccurred())
+		hash, err := w.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+		return hash
+	}
+	first := commit("first")
+	_, err = repo.CreateTag("v1", first, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	commit("second")
+
+	s := NewStorage(logr.Discard(), t.TempDir())
+	tests := []struct {
+		name    string
+		ref     string
+		want    string
+		wantErr bool
+	}{
+		{name: "default branch", want: "second"},
+		{name: "branch", ref: "master", want: "second"},
+		{name: "tag", ref: "v1", want: "first"},
+		{name: "commit", ref: first.String(), want: "first"},
+		{name: "unknown ref", ref: "unknown", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			dir, err := s.GetGitDir(context.Background(), repoDir, tt.ref, nil)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			data, err := os.ReadFile(filepath.Join(dir, "playbooks", "site.yaml"))
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(data)).To(Equal(tt.want))
+			g.Expect(filepath.Join(dir, git.GitDirName)).NotTo(BeADirectory())
+		})
+	}
+}
+
+func TestStorage_GetGitDir_cachedRef(t *testing.T) {
+	g := NewWithT(t)
+	repoDir := t.TempDir()
+	repo, err := git.PlainInit(repoDir, false)
+	g.Expect(err).NotTo(HaveOccurred())
+	w, err := repo.Worktree()
+	g.Expect(err).NotTo(HaveOccurred())
+	commit := func(content string) {
+		g.Expect(os.WriteFile(filepath.Join(repoDir, "site.yaml"), []byte(content), 0o600)).To(Succeed())
+		_, err := w.Add("site.yaml")
+		g.Expect(err).NotTo(HaveOccurred())
+		_, err = w.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()},
+		})
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+	read := func(s *Storage, creds *GitCredentials) string {
+		dir, err := s.GetGitDir(context.Background(), repoDir, "master", creds)
+		g.Expect(err).NotTo(HaveOccurred())
+		data, err := os.ReadFile(filepath.Join(dir, "site.yaml"))
+		g.Expect(err).NotTo(HaveOccurred())
+		return string(data)
+	}
+
+	commit("first")
+	s := NewStorage(logr.Discard(), t.TempDir())
+	g.Expect(read(s, nil)).To(Equal("first"))
+
+	// the ref is not resolved again until the cached ref is expired
+	commit("second")
+	g.Expect(read(s, nil)).To(Equal("first"))
+	// the ref resolved with the other credentials is not used
+	g.Expect(read(s, &GitCredentials{Username: "user"})).To(Equal("second"))
+
+	s.gitRefs.ttl = 0
+	g.Expect(read(s, nil)).To(Equal("second"))
+
+	// the ref moved after it has been resolved is not cached with the files of the other commit
+	s.gitRefs.ttl = time.Hour
+	commit("third")
+	key := gitRefKey(repoDir, "master", nil)
+	s.gitRefs.set(key, plumbing.NewBranchReferenceName("master"), plumbing.NewHash("0123456789012345678901234567890123456789"))
+	_, err = s.GetGitDir(context.Background(), repoDir, "master", nil)
+	g.Expect(err).To(MatchError(ContainSubstring("instead of 0123456789012345678901234567890123456789")))
+	g.Expect(read(s, nil)).To(Equal("third"))
+}
@@ -0,0 +1,385 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	ociManifestMediaType    = "application/vnd.oci.image.manifest.v1+json"
+	dockerManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+	dockerHubRegistry       = "registry-1.docker.io"
+	maxManifestSize         = 4 << 20
+	maxLayerFileSize        = 64 << 20
+)
+
+var digestRegexp = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// OCICredentials are the credentials of the OCI registry.
+type OCICredentials struct {
+	Username string
+	Password string
+}
+
+// GetOCIDir returns the directory with the files of the layers of the OCI artifact.
+// The files are cached by the digest of the manifest, so the layers are downloaded again
+// only if the tag points to a new manifest.
+func (s *Storage) GetOCIDir(ctx context.Context, image string, insecure bool, creds *OCICredentials) (string, error) {
+	ref, err := parseOCIReference(image)
+	if err != nil {
+		return "", err
+	}
+	c := &ociClient{
+		ref:    ref,
+		creds:  creds,
+		scheme: "https",
+		client: http.DefaultClient,
+	}
+	if insecure {
+		c.scheme = "http"
+	}
+	m, digest, err := c.manifest(ctx)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to get the manifest of %s", image)
+	}
+	relativePath := path.Join("oci", convertURLToFilesystemPath(ref.registry), ref.repository, strings.ReplaceAll(digest, ":", "_"))
+	return s.getDir(ctx, relativePath, func(ctx context.Context, dir string) error {
+		for _, layer := range m.Layers {
+			if err := c.extractLayer(ctx, layer.Digest, dir); err != nil {
+				return errors.Wrapf(err, "unable to extract the layer %s of %s", layer.Digest, image)
+			}
+		}
+		return nil
+	})
+}
+
+type ociReference struct {
+	registry   string
+	repository string
+	// reference is a tag or a digest.
+	reference string
+}
+
+// parseOCIReference parses the reference of the artifact, e.g. ghcr.io/org/playbooks:v1.0.0.
+// The images without the registry are pulled from Docker Hub.
+func parseOCIReference(image string) (ociReference, error) {
+	result := ociReference{}
+	name := image
+	if i := strings.Index(name, "@"); i >= 0 {
+		result.reference = name[i+1:]
+		name = name[:i]
+		if !digestRegexp.MatchString(result.reference) {
+			return result, errors.Errorf("invalid digest in the image %q", image)
+		}
+	} else if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		result.reference = name[i+1:]
+		name = name[:i]
+	}
+	if result.reference == "" {
+		result.reference = "latest"
+	}
+	parts := strings.SplitN(name, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		result.registry = parts[0]
+		result.repository = parts[1]
+	} else {
+		result.registry = dockerHubRegistry
+		result.repository = name
+		if len(parts) == 1 {
+			result.repository = "library/" + name
+		}
+	}
+	if result.repository == "" || strings.Contains(result.repository, "..") {
+		return result, errors.Errorf("invalid image %q", image)
+	}
+	return result, nil
+}
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+// ociClient is a minimal client of the OCI distribution API that pulls the artifacts.
+type ociClient struct {
+	ref    ociReference
+	creds  *OCICredentials
+	scheme string
+	client *http.Client
+	// authorized is set after the challenge of the registry has been handled.
+	authorized bool
+	basicAuth  bool
+	token      string
+}
+
+func (c *ociClient) url(kind, reference string) string {
+	return fmt.Sprintf("%s://%s/v2/%s/%s/%s", c.scheme, c.ref.registry, c.ref.repository, kind, reference)
+}
+
+func (c *ociClient) manifest(ctx context.Context) (*ociManifest, string, error) {
+	resp, err := c.get(ctx, c.url("manifests", c.ref.reference), ociManifestMediaType+", "+dockerManifestMediaType)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize))
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	hash := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(hash[:])
+	if strings.HasPrefix(c.ref.reference, "sha256:") && c.ref.reference != digest {
+		return nil, "", errors.Errorf("digest mismatch: expected %s, got %s", c.ref.reference, digest)
+	}
+	m := &ociManifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, "", errors.Wrap(err, "unable to decode the manifest")
+	}
+	mediaType := m.MediaType
+	if mediaType == "" {
+		mediaType = resp.Header.Get("Content-Type")
+	}
+	if mediaType != ociManifestMediaType && mediaType != dockerManifestMediaType {
+		return nil, "", errors.Errorf("unsupported media type of the manifest %q", mediaType)
+	}
+	return m, digest, nil
+}
+
+func (c *ociClient) extractLayer(ctx context.Context, digest, dir string) error {
+	if !digestRegexp.MatchString(digest) {
+		return errors.Errorf("unsupported digest %q", digest)
+	}
+	resp, err := c.get(ctx, c.url("blobs", digest), "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	hash := sha256.New()
+	r := bufio.NewReader(io.TeeReader(resp.Body, hash))
+	var layer io.Reader = r
+	// the layers can be compressed regardless of the media type
+	if magic, err := r.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gzr, err := gzip.NewReader(r)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer gzr.Close()
+		layer = gzr
+	}
+	if err := extractTar(layer, dir); err != nil {
+		return err
+	}
+	// read the rest of the blob to verify the digest
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return errors.WithStack(err)
+	}
+	if actual := "sha256:" + hex.EncodeToString(hash.Sum(nil)); actual != digest {
+		return errors.Errorf("digest mismatch: expected %s, got %s", digest, actual)
+	}
+	return nil
+}
+
+// extractTar extracts the regular files of the tar archive to the directory.
+func extractTar(r io.Reader, dir string) error {
+	tr := tar.NewReader(r)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "unable to read the tar archive")
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		name := filepath.Clean(header.Name)
+		if filepath.IsAbs(name) || name == ".." || strings.HasPrefix(name, ".."+string(filepath.Separator)) {
+			return errors.Errorf("the archive contains the invalid path %q", header.Name)
+		}
+		if err := extractFile(tr, filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(r io.Reader, path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+		return errors.WithStack(err)
+	}
+	f, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close()
+	n, err := io.CopyN(f, r, maxLayerFileSize+1)
+	if err != nil && err != io.EOF {
+		return errors.WithStack(err)
+	}
+	if n > maxLayerFileSize {
+		return errors.Errorf("the file %s is too large", path)
+	}
+	return nil
+}
+
+func (c *ociClient) get(ctx context.Context, u, accept string) (*http.Response, error) {
+	resp, err := c.do(ctx, u, accept)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized && !c.authorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		if err := c.authorize(ctx, challenge); err != nil {
+			return nil, err
+		}
+		if resp, err = c.do(ctx, u, accept); err != nil {
+			return nil, err
+		}
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.Errorf("bad status: %q url: %q", resp.Status, u)
+	}
+	return resp, nil
+}
+
+func (c *ociClient) do(ctx context.Context, u, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, http.NoBody)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	switch {
+	case c.basicAuth:
+		req.SetBasicAuth(c.creds.Username, c.creds.Password)
+	case c.token != "":
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return resp, nil
+}
+
+// authorize handles the challenge of the registry, the Bearer token is requested from the token service.
+func (c *ociClient) authorize(ctx context.Context, challenge string) error {
+	c.authorized = true
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if c.creds == nil {
+			return errors.New("the registry requires the credentials")
+		}
+		c.basicAuth = true
+		return nil
+	case "bearer":
+	default:
+		return errors.Errorf("unsupported authentication challenge %q", challenge)
+	}
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return errors.Errorf("invalid realm of the authentication challenge %q", challenge)
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = fmt.Sprintf("repository:%s:pull", c.ref.repository)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), http.NoBody)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if c.creds != nil {
+		req.SetBasicAuth(c.creds.Username, c.creds.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unable to get the token: %q url: %q", resp.Status, realm.String())
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&token); err != nil {
+		return errors.Wrap(err, "unable to decode the token")
+	}
+	c.token = token.Token
+	if c.token == "" {
+		c.token = token.AccessToken
+	}
+	if c.token == "" {
+		return errors.New("the token service returned an empty token")
+	}
+	return nil
+}
+
+// parseChallenge parses the WWW-Authenticate header, e.g. Bearer realm="https://auth.docker.io/token",service="registry.docker.io".
+func parseChallenge(challenge string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(challenge), " ")
+	params := make(map[string]string)
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key != "" {
+			params[strings.ToLower(strings.TrimSpace(key))] = value
+		}
+	}
+	return strings.ToLower(scheme), params
+}
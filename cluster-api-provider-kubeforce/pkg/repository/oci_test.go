@@ -0,0 +1,159 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repository
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	. "github.com/onsi/gomega"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	tests := []struct {
+		image   string
+		want    ociReference
+		wantErr bool
+	}{
+		{image: "ghcr.io/org/playbooks:v1", want: ociReference{registry: "ghcr.io", repository: "org/playbooks", reference: "v1"}},
+		{image: "localhost:5000/playbooks", want: ociReference{registry: "localhost:5000", repository: "playbooks", reference: "latest"}},
+		{image: "ghcr.io/org/playbooks@" + digest, want: ociReference{registry: "ghcr.io", repository: "org/playbooks", reference: digest}},
+		{image: "playbooks:v1", want: ociReference{registry: dockerHubRegistry, repository: "library/playbooks", reference: "v1"}},
+		{image: "org/playbooks", want: ociReference{registry: dockerHubRegistry, repository: "org/playbooks", reference: "latest"}},
+		{image: "ghcr.io/org/playbooks@sha256:invalid", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			g := NewWithT(t)
+			got, err := parseOCIReference(tt.image)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestStorage_GetOCIDir(t *testing.T) {
+	g := NewWithT(t)
+	layer := tarGz(g, map[string]string{"playbooks/site.yaml": "- hosts: all\n"})
+	layerDigest := sha256Digest(layer)
+	manifest, err := json.Marshal(ociManifest{
+		MediaType: ociManifestMediaType,
+		Layers: []ociDescriptor{
+			{MediaType: "application/vnd.oci.image.layer.v1.tar+gzip", Digest: layerDigest, Size: int64(len(layer))},
+		},
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	manifestRequests := 0
+	mux := http.NewServeMux()
+	var srv *httptest.Server
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		user, password, ok := r.BasicAuth()
+		if !ok || user != "user" || password != "password" || r.URL.Query().Get("scope") != "repository:org/playbooks:pull" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"token":"secret-token"}`))
+	})
+	mux.HandleFunc("/v2/org/playbooks/", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/v2/org/playbooks/manifests/v1":
+			manifestRequests++
+			w.Header().Set("Content-Type", ociManifestMediaType)
+			_, _ = w.Write(manifest)
+		case "/v2/org/playbooks/blobs/" + layerDigest:
+			_, _ = w.Write(layer)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+	registry := strings.TrimPrefix(srv.URL, "http://")
+
+	s := NewStorage(logr.Discard(), t.TempDir())
+	creds := &OCICredentials{Username: "user", Password: "password"}
+	dir, err := s.GetOCIDir(context.Background(), registry+"/org/playbooks:v1", true, creds)
+	g.Expect(err).NotTo(HaveOccurred())
+	data, err := os.ReadFile(filepath.Join(dir, "playbooks", "site.yaml"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(data)).To(Equal("- hosts: all\n"))
+
+	// the layers are cached by the digest of the manifest
+	cachedDir, err := s.GetOCIDir(context.Background(), registry+"/org/playbooks:v1", true, creds)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(cachedDir).To(Equal(dir))
+	g.Expect(manifestRequests).To(Equal(2))
+
+	_, err = s.GetOCIDir(context.Background(), registry+"/org/playbooks:v1", true, &OCICredentials{Username: "user", Password: "wrong"})
+	g.Expect(err).To(HaveOccurred())
+	_, err = s.GetOCIDir(context.Background(), registry+"/org/playbooks:v2", true, creds)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestExtractTar(t *testing.T) {
+	g := NewWithT(t)
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	g.Expect(tw.WriteHeader(&tar.Header{Name: "../escape.yaml", Mode: 0o600, Size: 1, Typeflag: tar.TypeReg})).To(Succeed())
+	_, err := tw.Write([]byte("x"))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(tw.Close()).To(Succeed())
+	g.Expect(extractTar(buf, t.TempDir())).NotTo(Succeed())
+}
+
+func tarGz(g *WithT, files map[string]string) []byte {
+	buf := &bytes.Buffer{}
+	gzw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gzw)
+	for name, content := range files {
+		g.Expect(tw.WriteHeader(&tar.Header{Name: name, Mode: 0o600, Size: int64(len(content)), Typeflag: tar.TypeReg})).To(Succeed())
+		_, err := tw.Write([]byte(content))
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+	g.Expect(tw.Close()).To(Succeed())
+	g.Expect(gzw.Close()).To(Succeed())
+	return buf.Bytes()
+}
+
+func sha256Digest(data []byte) string {
+	hash := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
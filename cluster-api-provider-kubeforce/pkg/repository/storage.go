@@ -23,6 +23,7 @@ import (
 	"path"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
@@ -36,6 +37,7 @@ func NewStorage(log logr.Logger, basePath string) *Storage {
 		log:        log,
 		keyedMutex: &keyedMutex{},
 		basePath:   basePath,
+		gitRefs:    newGitRefCache(defaultGitRefTTL),
 	}
 }
 
@@ -44,10 +46,13 @@ type Storage struct {
 	log        logr.Logger
 	basePath   string
 	keyedMutex *keyedMutex
+	gitRefs    *gitRefCache
 }
 
 type downloader func(ctx context.Context, w io.Writer) error
 
+type dirFetcher func(ctx context.Context, dir string) error
+
 // GetHTTPFileGetter return FileGetter for HTTPRepository.
 func (s *Storage) GetHTTPFileGetter(r infrav1.HTTPRepository) FileGetter {
 	return NewHTTPFileGetter(s, r)
@@ -117,6 +122,48 @@ func (s *Storage) getFile(ctx context.Context, relativePath string, download dow
 	return fullPath, nil
 }
 
+func (s *Storage) getDir(ctx context.Context, relativePath string, fetch dirFetcher) (string, error) {
+	unlock := s.keyedMutex.Lock(relativePath)
+	defer unlock()
+
+	fullPath := path.Join(s.basePath, relativePath)
+	info, err := os.Stat(fullPath)
+	switch {
+	case err == nil && info.IsDir():
+		return fullPath, touchDir(fullPath)
+	case err == nil:
+		return "", errors.Errorf("found file %s", fullPath)
+	case !errors.Is(err, os.ErrNotExist):
+		return "", errors.Wrapf(err, "unable to get directory info %s", fullPath)
+	}
+
+	// the temporary directory could be left by the interrupted attempt
+	fullTmpPath := fullPath + ".tmp"
+	if err := os.RemoveAll(fullTmpPath); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if err := os.MkdirAll(fullTmpPath, 0o750); err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer os.RemoveAll(fullTmpPath)
+
+	s.log.Info("fetching", "dir", fullTmpPath)
+	if err := fetch(ctx, fullTmpPath); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if err := os.Rename(fullTmpPath, fullPath); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return fullPath, touchDir(fullPath)
+}
+
+// touchDir sets the modification time of the directory to the current time.
+// The modification time is the time of the last use of the cached directory, see DirsCollector.
+func touchDir(dir string) error {
+	now := time.Now()
+	return errors.WithStack(os.Chtimes(dir, now, now))
+}
+
 type keyedMutex struct {
 	mutexes sync.Map
 }
@@ -36,4 +36,10 @@ const (
 
 	// SSHAuthPassphrase is the passphrase of the SSH private key.
 	SSHAuthPassphrase = "ssh-passphrase"
+
+	// SSHKnownHosts is the key of the known_hosts file of the SSH configuration.
+	SSHKnownHosts = "known_hosts"
+
+	// BecomePassword is the default key of the password for the privilege escalation.
+	BecomePassword = "become-password"
 )
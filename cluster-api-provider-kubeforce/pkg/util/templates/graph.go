@@ -0,0 +1,119 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+// Dependencies returns the roles that every role of the template type depends on.
+// The role depends on the roles specified in DependsOn,
+// or on all roles of the same type with a higher priority if DependsOn is empty.
+// The roles without DependsOn that have the same priority are executed one by one in the order of the names.
+func Dependencies(refs map[string]*infrav1.TemplateReference, templateType infrav1.TemplateType) map[string][]string {
+	deps := make(map[string][]string)
+	for role, ref := range refs {
+		if ref.Type != templateType {
+			continue
+		}
+		if len(ref.DependsOn) > 0 {
+			deps[role] = append([]string(nil), ref.DependsOn...)
+			continue
+		}
+		deps[role] = []string{}
+		for other, otherRef := range refs {
+			if otherRef.Type != templateType {
+				continue
+			}
+			if otherRef.Priority > ref.Priority ||
+				(otherRef.Priority == ref.Priority && len(otherRef.DependsOn) == 0 && other < role) {
+				deps[role] = append(deps[role], other)
+			}
+		}
+		sort.Strings(deps[role])
+	}
+	return deps
+}
+
+// SortRoles sorts the roles topologically, so every role follows the roles it depends on.
+// The independent roles are sorted by the priority in descending order and then by the name.
+// It returns an error if a role depends on an unknown role or the dependencies have a cycle.
+func SortRoles(refs map[string]*infrav1.TemplateReference, deps map[string][]string) ([]string, error) {
+	roles := make([]string, 0, len(deps))
+	for role := range deps {
+		roles = append(roles, role)
+	}
+	sort.SliceStable(roles, func(i, j int) bool {
+		if refs[roles[i]].Priority != refs[roles[j]].Priority {
+			return refs[roles[i]].Priority > refs[roles[j]].Priority
+		}
+		return roles[i] < roles[j]
+	})
+	for _, role := range roles {
+		for _, dep := range deps[role] {
+			if dep == role {
+				return nil, errors.Errorf("role %s depends on itself", role)
+			}
+			if _, ok := deps[dep]; !ok {
+				return nil, errors.Errorf("role %s depends on the unknown role %s", role, dep)
+			}
+		}
+	}
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(roles))
+	result := make([]string, 0, len(roles))
+	var visit func(role string, path []string) error
+	visit = func(role string, path []string) error {
+		switch state[role] {
+		case visited:
+			return nil
+		case visiting:
+			cycle := append(path, role)
+			for i := range cycle {
+				if cycle[i] == role {
+					cycle = cycle[i:]
+					break
+				}
+			}
+			return errors.Errorf("roles have a dependency cycle: %s", strings.Join(cycle, " -> "))
+		}
+		state[role] = visiting
+		for _, dep := range deps[role] {
+			if err := visit(dep, append(path, role)); err != nil {
+				return err
+			}
+		}
+		state[role] = visited
+		result = append(result, role)
+		return nil
+	}
+	for _, role := range roles {
+		if err := visit(role, nil); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
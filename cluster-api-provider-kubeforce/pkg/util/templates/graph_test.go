@@ -0,0 +1,125 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package templates
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func TestSortRoles(t *testing.T) {
+	install := func(priority int32, dependsOn ...string) *infrav1.TemplateReference {
+		return &infrav1.TemplateReference{
+			Type:      infrav1.TemplateTypeInstall,
+			Priority:  priority,
+			DependsOn: dependsOn,
+		}
+	}
+	tests := []struct {
+		name     string
+		refs     map[string]*infrav1.TemplateReference
+		wantDeps map[string][]string
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name: "roles are ordered by priority",
+			refs: map[string]*infrav1.TemplateReference{
+				"installer":    install(1000),
+				"loadbalancer": install(100),
+				"cleaner": {
+					Type:     infrav1.TemplateTypeDelete,
+					Priority: 1000,
+				},
+			},
+			wantDeps: map[string][]string{
+				"installer":    {},
+				"loadbalancer": {"installer"},
+			},
+			want: []string{"installer", "loadbalancer"},
+		},
+		{
+			name: "roles with the same priority are executed one by one",
+			refs: map[string]*infrav1.TemplateReference{
+				"installer":    install(1000),
+				"monitoring":   install(100),
+				"loadbalancer": install(100),
+				"hardening":    install(100, "installer"),
+				"logging":      install(10),
+			},
+			wantDeps: map[string][]string{
+				"installer":    {},
+				"loadbalancer": {"installer"},
+				"monitoring":   {"installer", "loadbalancer"},
+				"hardening":    {"installer"},
+				"logging":      {"hardening", "installer", "loadbalancer", "monitoring"},
+			},
+			want: []string{"installer", "hardening", "loadbalancer", "monitoring", "logging"},
+		},
+		{
+			name: "dependencies override priority",
+			refs: map[string]*infrav1.TemplateReference{
+				"hardening":    install(1, "installer"),
+				"installer":    install(1000),
+				"loadbalancer": install(100, "hardening"),
+				"monitoring":   install(100, "hardening"),
+			},
+			wantDeps: map[string][]string{
+				"hardening":    {"installer"},
+				"installer":    {},
+				"loadbalancer": {"hardening"},
+				"monitoring":   {"hardening"},
+			},
+			want: []string{"installer", "hardening", "loadbalancer", "monitoring"},
+		},
+		{
+			name: "unknown role",
+			refs: map[string]*infrav1.TemplateReference{
+				"installer": install(1000, "unknown"),
+			},
+			wantErr: true,
+		},
+		{
+			name: "cycle",
+			refs: map[string]*infrav1.TemplateReference{
+				"installer":    install(1000, "monitoring"),
+				"loadbalancer": install(100),
+				"monitoring":   install(100, "loadbalancer"),
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			deps := Dependencies(tt.refs, infrav1.TemplateTypeInstall)
+			if tt.wantDeps != nil {
+				g.Expect(deps).To(Equal(tt.wantDeps))
+			}
+			got, err := SortRoles(tt.refs, deps)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
@@ -24,6 +24,7 @@ import (
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/utils/strings/slices"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1beta1"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -191,9 +192,35 @@ func (webhook *KubeforceMachine) validate(ctx context.Context, m *infrav1.Kubefo
 			allErrs = append(allErrs, err)
 		}
 	}
+	refsPath := specPath.Child("playbookTemplates", "references")
+	for _, templateType := range infrav1.TemplateTypes {
+		deps := utiltmpl.Dependencies(m.Spec.PlaybookTemplates.References, templateType)
+		if _, err := utiltmpl.SortRoles(m.Spec.PlaybookTemplates.References, deps); err != nil {
+			allErrs = append(allErrs, field.Invalid(refsPath, templateType, err.Error()))
+		}
+	}
+	allErrs = append(allErrs, validateTemplateVariables(specPath.Child("playbookTemplates", "variablesFrom"), m.Spec.PlaybookTemplates.VariablesFrom)...)
 	return allErrs.ToAggregate()
 }
 
+func validateTemplateVariables(path *field.Path, vars []infrav1.TemplateVariable) field.ErrorList {
+	allErrs := field.ErrorList{}
+	names := make(map[string]struct{}, len(vars))
+	for i, v := range vars {
+		varPath := path.Index(i)
+		if v.Name == "" {
+			allErrs = append(allErrs, field.Required(varPath.Child("name"), "cannot be empty"))
+		} else if _, ok := names[v.Name]; ok {
+			allErrs = append(allErrs, field.Duplicate(varPath.Child("name"), v.Name))
+		}
+		names[v.Name] = struct{}{}
+		if (v.ValueFrom.SecretKeyRef == nil) == (v.ValueFrom.ConfigMapKeyRef == nil) {
+			allErrs = append(allErrs, field.Invalid(varPath.Child("valueFrom"), v.Name, "exactly one of secretKeyRef and configMapKeyRef must be specified"))
+		}
+	}
+	return allErrs
+}
+
 func (webhook *KubeforceMachine) validateTemplateReferences(ctx context.Context, path *field.Path, ref *infrav1.TemplateReference) *field.Error {
 	if ref.Priority <= 0 {
 		return field.Invalid(
@@ -202,12 +229,12 @@ func (webhook *KubeforceMachine) validateTemplateReferences(ctx context.Context,
 			"value must be greater than zero",
 		)
 	}
-	if ref.Type != infrav1.TemplateTypeInstall && ref.Type != infrav1.TemplateTypeDelete {
-		return field.NotSupported(
-			path.Child("type"),
-			ref.Type,
-			[]string{infrav1.TemplateTypeInstall, infrav1.TemplateTypeDelete},
-		)
+	supported := make([]string, 0, len(infrav1.TemplateTypes))
+	for _, t := range infrav1.TemplateTypes {
+		supported = append(supported, string(t))
+	}
+	if !slices.Contains(supported, string(ref.Type)) {
+		return field.NotSupported(path.Child("type"), ref.Type, supported)
 	}
 	if ref.APIVersion != infrav1.GroupVersion.String() {
 		return field.NotSupported(
@@ -132,6 +132,14 @@ func TestKubeforceMachineValidateCreate(t *testing.T) {
 			extraObjs: []client.Object{pbTmpl, pbDpTmpl},
 			expectErr: true,
 		},
+		{
+			name: "a lifecycle hook type should be accepted",
+			kfMachine: getKubeforceMachine(func(ma *infrav1.KubeforceMachine) {
+				ma.Spec.PlaybookTemplates.References["init"].Type = infrav1.TemplateTypePreBootstrap
+			}),
+			extraObjs: []client.Object{pbTmpl, pbDpTmpl},
+			expectErr: false,
+		},
 		{
 			name: "a apiVersion that is not supported should be rejected",
 			kfMachine: getKubeforceMachine(func(ma *infrav1.KubeforceMachine) {
@@ -156,6 +164,59 @@ func TestKubeforceMachineValidateCreate(t *testing.T) {
 			extraObjs: []client.Object{pbTmpl, pbDpTmpl},
 			expectErr: true,
 		},
+		{
+			name: "a dependency on the role should be accepted",
+			kfMachine: getKubeforceMachine(func(ma *infrav1.KubeforceMachine) {
+				ma.Spec.PlaybookTemplates.References["init"].DependsOn = []string{"boot"}
+			}),
+			extraObjs: []client.Object{pbTmpl, pbDpTmpl},
+			expectErr: false,
+		},
+		{
+			name: "a dependency on the unknown role should be rejected",
+			kfMachine: getKubeforceMachine(func(ma *infrav1.KubeforceMachine) {
+				ma.Spec.PlaybookTemplates.References["init"].DependsOn = []string{"unknown"}
+			}),
+			extraObjs: []client.Object{pbTmpl, pbDpTmpl},
+			expectErr: true,
+		},
+		{
+			name: "a dependency cycle should be rejected",
+			kfMachine: getKubeforceMachine(func(ma *infrav1.KubeforceMachine) {
+				ma.Spec.PlaybookTemplates.References["init"].DependsOn = []string{"boot"}
+				ma.Spec.PlaybookTemplates.References["boot"].DependsOn = []string{"init"}
+			}),
+			extraObjs: []client.Object{pbTmpl, pbDpTmpl},
+			expectErr: true,
+		},
+		{
+			name: "a variable from the Secret should be accepted",
+			kfMachine: getKubeforceMachine(func(ma *infrav1.KubeforceMachine) {
+				ma.Spec.PlaybookTemplates.VariablesFrom = []infrav1.TemplateVariable{
+					{
+						Name: "token",
+						ValueFrom: infrav1.TemplateVariableSource{
+							SecretKeyRef: &corev1.SecretKeySelector{
+								LocalObjectReference: corev1.LocalObjectReference{Name: "tokens"},
+								Key:                  "token",
+							},
+						},
+					},
+				}
+			}),
+			extraObjs: []client.Object{pbTmpl, pbDpTmpl},
+			expectErr: false,
+		},
+		{
+			name: "a variable without the source should be rejected",
+			kfMachine: getKubeforceMachine(func(ma *infrav1.KubeforceMachine) {
+				ma.Spec.PlaybookTemplates.VariablesFrom = []infrav1.TemplateVariable{
+					{Name: "token"},
+				}
+			}),
+			extraObjs: []client.Object{pbTmpl, pbDpTmpl},
+			expectErr: true,
+		},
 	}
 
 	for _, tt := range tests {
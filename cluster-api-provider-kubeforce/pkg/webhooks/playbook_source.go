@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"path"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func validatePlaybookSource(fldPath *field.Path, source *infrav1.PlaybookSource) field.ErrorList {
+	allErrs := field.ErrorList{}
+	if source == nil {
+		return allErrs
+	}
+	specified := 0
+	if source.Git != nil {
+		specified++
+		gitPath := fldPath.Child("git")
+		if source.Git.URL == "" {
+			allErrs = append(allErrs, field.Required(gitPath.Child("url"), "cannot be empty"))
+		}
+		allErrs = append(allErrs, validateSourcePath(gitPath.Child("path"), source.Git.Path)...)
+	}
+	if source.OCI != nil {
+		specified++
+		ociPath := fldPath.Child("oci")
+		if source.OCI.Image == "" {
+			allErrs = append(allErrs, field.Required(ociPath.Child("image"), "cannot be empty"))
+		}
+		allErrs = append(allErrs, validateSourcePath(ociPath.Child("path"), source.OCI.Path)...)
+	}
+	if len(source.ConfigMaps) > 0 {
+		specified++
+		for i, cm := range source.ConfigMaps {
+			cmPath := fldPath.Child("configMaps").Index(i)
+			if cm.Name == "" {
+				allErrs = append(allErrs, field.Required(cmPath.Child("name"), "cannot be empty"))
+			}
+			allErrs = append(allErrs, validateSourcePath(cmPath.Child("path"), cm.Path)...)
+		}
+	}
+	if specified != 1 {
+		allErrs = append(allErrs, field.Invalid(fldPath, "", "exactly one of git, oci and configMaps must be specified"))
+	}
+	return allErrs
+}
+
+func validateSourcePath(fldPath *field.Path, p string) field.ErrorList {
+	cleanPath := path.Clean(p)
+	if path.IsAbs(p) || cleanPath == ".." || strings.HasPrefix(cleanPath, "../") {
+		return field.ErrorList{field.Invalid(fldPath, p, "must be a relative path")}
+	}
+	return nil
+}
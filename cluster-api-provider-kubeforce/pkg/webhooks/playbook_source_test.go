@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The Kubeforce Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhooks
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+
+	infrav1 "k3f.io/kubeforce/cluster-api-provider-kubeforce/api/v1beta1"
+)
+
+func TestValidatePlaybookSource(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  *infrav1.PlaybookSource
+		wantErr bool
+	}{
+		{
+			name: "no source",
+		},
+		{
+			name:   "git",
+			source: &infrav1.PlaybookSource{Git: &infrav1.GitSource{URL: "https://example.com/playbooks.git", Path: "playbooks"}},
+		},
+		{
+			name:    "git without url",
+			source:  &infrav1.PlaybookSource{Git: &infrav1.GitSource{}},
+			wantErr: true,
+		},
+		{
+			name:    "path outside of the source",
+			source:  &infrav1.PlaybookSource{OCI: &infrav1.OCISource{Image: "ghcr.io/org/playbooks:v1", Path: "../playbooks"}},
+			wantErr: true,
+		},
+		{
+			name:    "configmap without name",
+			source:  &infrav1.PlaybookSource{ConfigMaps: []infrav1.ConfigMapSource{{Path: "roles"}}},
+			wantErr: true,
+		},
+		{
+			name: "several sources",
+			source: &infrav1.PlaybookSource{
+				Git:        &infrav1.GitSource{URL: "https://example.com/playbooks.git"},
+				ConfigMaps: []infrav1.ConfigMapSource{{Name: "playbook"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "empty source",
+			source:  &infrav1.PlaybookSource{},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			errs := validatePlaybookSource(field.NewPath("spec", "source"), tt.source)
+			if tt.wantErr {
+				g.Expect(errs).NotTo(BeEmpty())
+			} else {
+				g.Expect(errs).To(BeEmpty())
+			}
+		})
+	}
+}
@@ -22,6 +22,7 @@ import (
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -42,18 +43,30 @@ type PlaybookDeploymentTemplate struct {
 	Client client.Reader
 }
 
-//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-playbookdeploymenttemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=playbookdeploymenttemplates,verbs=delete,versions=v1beta1,name=vplaybookdeploymenttemplate.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-playbookdeploymenttemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=playbookdeploymenttemplates,verbs=create;update;delete,versions=v1beta1,name=vplaybookdeploymenttemplate.kb.io,admissionReviewVersions=v1
 
 var _ webhook.CustomValidator = &PlaybookDeploymentTemplate{}
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
 func (webhook *PlaybookDeploymentTemplate) ValidateCreate(_ context.Context, obj runtime.Object) error {
-	return nil
+	t, ok := obj.(*infrav1.PlaybookDeploymentTemplate)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected an PlaybookDeploymentTemplate but got a %T", obj))
+	}
+	return webhook.validate(t)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
 func (webhook *PlaybookDeploymentTemplate) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) error {
-	return nil
+	t, ok := newObj.(*infrav1.PlaybookDeploymentTemplate)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected an PlaybookDeploymentTemplate but got a %T", newObj))
+	}
+	return webhook.validate(t)
+}
+
+func (webhook *PlaybookDeploymentTemplate) validate(t *infrav1.PlaybookDeploymentTemplate) error {
+	return validatePlaybookSource(field.NewPath("spec", "template", "source"), t.Spec.Template.Source).ToAggregate()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
@@ -82,5 +95,16 @@ func (webhook *PlaybookDeploymentTemplate) validateDelete(ctx context.Context, t
 			}
 		}
 	}
+	sets := &infrav1.PlaybookDeploymentSetList{}
+	if err := webhook.Client.List(ctx, sets, client.InNamespace(t.Namespace)); err != nil {
+		return err
+	}
+	for _, pds := range sets.Items {
+		if pds.Spec.TemplateRef.Name == t.Name {
+			//nolint:gosec
+			return apierrors.NewForbidden(infrav1.GroupVersion.WithResource("PlaybookDeploymentTemplate").GroupResource(), t.Name,
+				fmt.Errorf("PlaybookDeploymentTemplate cannot be deleted because it is used by PlaybookDeploymentSet %s", client.ObjectKeyFromObject(&pds)))
+		}
+	}
 	return nil
 }
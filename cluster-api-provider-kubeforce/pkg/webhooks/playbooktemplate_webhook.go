@@ -22,6 +22,7 @@ import (
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation/field"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
@@ -42,18 +43,30 @@ type PlaybookTemplate struct {
 	Client client.Reader
 }
 
-//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-playbooktemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=playbooktemplates,verbs=delete,versions=v1beta1,name=vplaybooktemplate.kb.io,admissionReviewVersions=v1
+//+kubebuilder:webhook:path=/validate-infrastructure-cluster-x-k8s-io-v1beta1-playbooktemplate,mutating=false,failurePolicy=fail,sideEffects=None,groups=infrastructure.cluster.x-k8s.io,resources=playbooktemplates,verbs=create;update;delete,versions=v1beta1,name=vplaybooktemplate.kb.io,admissionReviewVersions=v1
 
 var _ webhook.CustomValidator = &PlaybookTemplate{}
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type.
 func (webhook *PlaybookTemplate) ValidateCreate(_ context.Context, obj runtime.Object) error {
-	return nil
+	t, ok := obj.(*infrav1.PlaybookTemplate)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected an PlaybookTemplate but got a %T", obj))
+	}
+	return webhook.validate(t)
 }
 
 // ValidateUpdate implements webhook.Validator so a webhook will be registered for the type.
 func (webhook *PlaybookTemplate) ValidateUpdate(_ context.Context, oldObj, newObj runtime.Object) error {
-	return nil
+	t, ok := newObj.(*infrav1.PlaybookTemplate)
+	if !ok {
+		return apierrors.NewBadRequest(fmt.Sprintf("expected an PlaybookTemplate but got a %T", newObj))
+	}
+	return webhook.validate(t)
+}
+
+func (webhook *PlaybookTemplate) validate(t *infrav1.PlaybookTemplate) error {
+	return validatePlaybookSource(field.NewPath("spec", "source"), t.Spec.Source).ToAggregate()
 }
 
 // ValidateDelete implements webhook.Validator so a webhook will be registered for the type.
@@ -82,5 +95,19 @@ func (webhook *PlaybookTemplate) validateDelete(ctx context.Context, t *infrav1.
 			}
 		}
 	}
+	runs := &infrav1.ClusterPlaybookRunList{}
+	if err := webhook.Client.List(ctx, runs, client.InNamespace(t.Namespace)); err != nil {
+		return err
+	}
+	for _, run := range runs.Items {
+		// the completed run does not create Playbooks anymore
+		if run.Spec.TemplateRef.Name != t.Name || run.Status.Phase == infrav1.ClusterPlaybookRunPhaseSucceeded ||
+			run.Status.Phase == infrav1.ClusterPlaybookRunPhaseFailed {
+			continue
+		}
+		//nolint:gosec
+		return apierrors.NewForbidden(infrav1.GroupVersion.WithResource("PlaybookTemplate").GroupResource(), t.Name,
+			fmt.Errorf("PlaybookTemplate cannot be deleted because it is used by ClusterPlaybookRun %s", client.ObjectKeyFromObject(&run)))
+	}
 	return nil
 }